@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
+)
+
+var (
+	errInvalidRedisCA       = errors.New("no certificates found in redis CA file")
+	errConflictingCacheKeys = errors.New("-cache-encryption-keys and -cache-encryption-key-file are mutually exclusive")
+)
+
+type redisFlags struct {
+	Addresses             StringList
+	Mode                  cache.RedisMode
+	MasterName            string
+	Username              string
+	Password              Secret
+	SentinelPassword      Secret
+	DB                    int
+	TLS                   bool
+	TLSCAFile             string
+	TLSServerName         string
+	TLSInsecureSkipVerify bool
+}
+
+// isSharedCache returns whether c keeps its entries outside of the agent's
+// process, so that they are still available after a restart.
+func isSharedCache(c cache.Cache) bool {
+	switch c.(type) {
+	case *cache.Local, *cache.Noop:
+		return false
+
+	default:
+		return true
+	}
+}
+
+// newRedisConfig builds the configuration of the Redis cache client from
+// the -redis-* flags.
+func newRedisConfig(f redisFlags, logger zerolog.Logger) (cache.RedisConfig, error) {
+	cfg := cache.RedisConfig{
+		Mode:             f.Mode,
+		Addresses:        f.Addresses,
+		MasterName:       f.MasterName,
+		Username:         f.Username,
+		Password:         string(f.Password),
+		SentinelPassword: string(f.SentinelPassword),
+		DB:               f.DB,
+		Timeout:          100 * time.Millisecond,
+		Logger:           logger,
+	}
+
+	if !f.TLS {
+		return cfg, nil
+	}
+
+	cfg.TLS = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         f.TLSServerName,
+		InsecureSkipVerify: f.TLSInsecureSkipVerify,
+	}
+
+	if f.TLSCAFile != "" {
+		pem, err := os.ReadFile(f.TLSCAFile)
+		if err != nil {
+			return cfg, fmt.Errorf("reading redis CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return cfg, fmt.Errorf("%w: %s", errInvalidRedisCA, f.TLSCAFile)
+		}
+
+		cfg.TLS.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// newCacheKeyring builds the keyring used to encrypt values in shared caches
+// from either the keys given directly or the key file. It returns nil if
+// neither is set.
+func newCacheKeyring(keys Secret, keyFile string) (*cache.Keyring, error) {
+	switch {
+	case keys != "" && keyFile != "":
+		return nil, errConflictingCacheKeys
+
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading cache encryption key file: %w", err)
+		}
+
+		keyring, err := cache.ParseKeyring(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+
+		return keyring, nil
+
+	case keys != "":
+		return cache.ParseKeyring(string(keys))
+
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
+)
+
+func TestNewRedisConfig(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	cfg, err := newRedisConfig(redisFlags{
+		Addresses: StringList{"localhost:6379"},
+		Mode:      cache.RedisModeStandalone,
+		Password:  "password",
+	}, logger)
+	require.NoError(t, err)
+	require.Equal(t, "password", cfg.Password)
+	require.Nil(t, cfg.TLS)
+
+	dir := t.TempDir()
+
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	ts.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	cfg, err = newRedisConfig(redisFlags{TLS: true, TLSCAFile: caFile, TLSServerName: "redis.example.com"}, logger)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.TLS)
+	require.NotNil(t, cfg.TLS.RootCAs)
+	require.Equal(t, "redis.example.com", cfg.TLS.ServerName)
+
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("not a certificate"), 0o600))
+
+	_, err = newRedisConfig(redisFlags{TLS: true, TLSCAFile: invalidFile}, logger)
+	require.ErrorIs(t, err, errInvalidRedisCA)
+
+	_, err = newRedisConfig(redisFlags{TLS: true, TLSCAFile: filepath.Join(dir, "missing.pem")}, logger)
+	require.Error(t, err)
+}
+
+func TestSetupTieredCache(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	opts := cacheOpts{
+		Type:          cache.KindTiered,
+		LocalCapacity: 100,
+		LocalTTL:      time.Minute,
+		TierLocalTTL:  10 * time.Second,
+		StaleTTL:      time.Minute,
+		Registerer:    prometheus.NewRegistry(),
+	}
+
+	c, err := setupCache(context.Background(), opts, &logger)
+	require.NoError(t, err)
+	require.IsType(t, &cache.Local{}, c, "without servers the local cache is used")
+	require.False(t, isSharedCache(c))
+
+	opts.Redis = cache.RedisConfig{
+		Mode:      cache.RedisModeStandalone,
+		Addresses: []string{"localhost:6379"},
+		Logger:    logger,
+	}
+
+	c, err = setupCache(context.Background(), opts, &logger)
+	require.NoError(t, err)
+	require.IsType(t, &cache.Tiered{}, c)
+	require.True(t, isSharedCache(c))
+	require.NoError(t, c.(*cache.Tiered).Close())
+}
+
+func TestNewCacheKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	keyring, err := newCacheKeyring("", "")
+	require.NoError(t, err)
+	require.Nil(t, keyring)
+
+	keyring, err = newCacheKeyring(Secret(key), "")
+	require.NoError(t, err)
+	require.NotNil(t, keyring)
+
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(keyFile, []byte("# current\n"+key+"\n"), 0o600))
+
+	keyring, err = newCacheKeyring("", keyFile)
+	require.NoError(t, err)
+	require.NotNil(t, keyring)
+
+	_, err = newCacheKeyring(Secret(key), keyFile)
+	require.ErrorIs(t, err, errConflictingCacheKeys)
+
+	_, err = newCacheKeyring("", filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+
+	_, err = newCacheKeyring("invalid!", "")
+	require.ErrorIs(t, err, cache.ErrInvalidEncryptionKey)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/checks"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+)
+
+// apiConnection describes a connection to a synthetic monitoring API,
+// that is, to the stack the probe runs checks for.
+type apiConnection struct {
+	// Name identifies the connection in logs, metrics and files. It's
+	// empty for the connection configured with -api-server-address
+	// and -api-token.
+	Name     string
+	Address  string
+	Token    Secret
+	Insecure bool
+}
+
+// apiConnections holds the connections passed with repeated
+// -api-connection flags.
+type apiConnections []apiConnection
+
+var _ flag.Value = (*apiConnections)(nil)
+
+var connectionNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (l *apiConnections) String() string {
+	if l == nil || len(*l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(*l))
+	for _, c := range *l {
+		names = append(names, c.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Set adds a connection described as comma-separated key=value pairs, for
+// example:
+//
+//	name=production,address=synthetic-monitoring-grpc.grafana.net:443,token-file=/etc/sm-agent/production.token
+//
+// name and address are required, as is either token or token-file.
+// insecure=true disables TLS.
+func (l *apiConnections) Set(value string) error {
+	var (
+		c         apiConnection
+		tokenFile string
+	)
+
+	for field := range strings.SplitSeq(value, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return fmt.Errorf("invalid API connection field %q, expecting key=value", field)
+		}
+
+		switch k {
+		case "name":
+			c.Name = v
+
+		case "address":
+			c.Address = v
+
+		case "token":
+			c.Token = Secret(v)
+
+		case "token-file":
+			tokenFile = v
+
+		case "insecure":
+			insecure, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid API connection insecure value %q: %w", v, err)
+			}
+
+			c.Insecure = insecure
+
+		default:
+			return fmt.Errorf("unknown API connection field %q", k)
+		}
+	}
+
+	if !connectionNameRe.MatchString(c.Name) {
+		return fmt.Errorf("invalid API connection name %q, expecting letters, digits, '-' and '_'", c.Name)
+	}
+
+	for _, other := range *l {
+		if other.Name == c.Name {
+			return fmt.Errorf("duplicate API connection name %q", c.Name)
+		}
+	}
+
+	// As with -api-server-address, omitting the port is almost certainly
+	// a mistake.
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("parsing API connection %s address %q: %w", c.Name, c.Address, err)
+	}
+
+	if tokenFile != "" {
+		if c.Token != "" {
+			return fmt.Errorf("API connection %s has both token and token-file", c.Name)
+		}
+
+		data, err := os.ReadFile(tokenFile) //#nosec -- the file is provided by the operator.
+		if err != nil {
+			return fmt.Errorf("reading API connection %s token: %w", c.Name, err)
+		}
+
+		c.Token = Secret(strings.TrimSpace(string(data)))
+	}
+
+	if c.Token == "" {
+		return fmt.Errorf("invalid API token for API connection %s", c.Name)
+	}
+
+	*l = append(*l, c)
+
+	return nil
+}
+
+// connectionStateFile returns the state file for the named connection,
+// derived from the one passed with -state-file so that each connection
+// saves its checks separately: state.json becomes state.<name>.json.
+func connectionStateFile(fn, name string) string {
+	if fn == "" || name == "" {
+		return fn
+	}
+
+	ext := filepath.Ext(fn)
+
+	return strings.TrimSuffix(fn, ext) + "." + name + ext
+}
+
+// readinessGroup marks the agent as ready once all its connections have
+// connected to the API at least once.
+type readinessGroup struct {
+	handler *readynessHandler
+	mutex   sync.Mutex
+	ready   []bool
+	pending int
+}
+
+func newReadinessGroup(handler *readynessHandler, n int) *readinessGroup {
+	return &readinessGroup{handler: handler, ready: make([]bool, n), pending: n}
+}
+
+// Setter returns the function to pass as IsConnected to the checks
+// updater of the i-th connection.
+func (g *readinessGroup) Setter(i int) func(bool) {
+	return func(connected bool) {
+		if !connected {
+			return
+		}
+
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+
+		if g.ready[i] {
+			return
+		}
+
+		g.ready[i] = true
+		g.pending--
+
+		if g.pending == 0 {
+			g.handler.Set(true)
+		}
+	}
+}
+
+// checksGroup combines the checks run for several API connections, so
+// that the operator API describes all of them. Checks are looked up in
+// connection order: if checks for different stacks share a global ID,
+// only the first one can be inspected or run.
+type checksGroup []operatorChecks
+
+var _ operatorChecks = checksGroup(nil)
+
+func (g checksGroup) Checks() []scraper.Status {
+	var statuses []scraper.Status
+
+	for _, c := range g {
+		statuses = append(statuses, c.Checks()...)
+	}
+
+	return statuses
+}
+
+func (g checksGroup) Check(id model.GlobalID) (scraper.Status, bool) {
+	for _, c := range g {
+		if status, found := c.Check(id); found {
+			return status, true
+		}
+	}
+
+	return scraper.Status{}, false
+}
+
+func (g checksGroup) RunCheck(ctx context.Context, id model.GlobalID, publish bool) (scraper.Execution, error) {
+	for _, c := range g {
+		exec, err := c.RunCheck(ctx, id, publish)
+		if !errors.Is(err, checks.ErrCheckNotFound) {
+			return exec, err
+		}
+	}
+
+	return scraper.Execution{}, checks.ErrCheckNotFound
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/checks"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestAPIConnections(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0o600))
+
+	var l apiConnections
+
+	require.Empty(t, l.String())
+
+	require.NoError(t, l.Set("name=production,address=prod.example.com:443,token=prod-token"))
+	require.NoError(t, l.Set("name=staging, address=staging.example.com:443, token-file="+tokenFile+", insecure=true"))
+
+	require.Equal(t, apiConnections{
+		{Name: "production", Address: "prod.example.com:443", Token: "prod-token"},
+		{Name: "staging", Address: "staging.example.com:443", Token: "file-token", Insecure: true},
+	}, l)
+	require.Equal(t, "production, staging", l.String())
+
+	testcases := map[string]string{
+		"missing name":       "address=example.com:443,token=t",
+		"invalid name":       "name=a b,address=example.com:443,token=t",
+		"duplicate name":     "name=production,address=example.com:443,token=t",
+		"missing port":       "name=x,address=example.com,token=t",
+		"missing token":      "name=x,address=example.com:443",
+		"both tokens":        "name=x,address=example.com:443,token=t,token-file=" + tokenFile,
+		"missing token file": "name=x,address=example.com:443,token-file=" + tokenFile + ".missing",
+		"invalid insecure":   "name=x,address=example.com:443,token=t,insecure=maybe",
+		"unknown field":      "name=x,address=example.com:443,token=t,region=eu",
+		"invalid field":      "name=x,address=example.com:443,token",
+	}
+
+	for name, value := range testcases {
+		t.Run(name, func(t *testing.T) {
+			l := apiConnections{{Name: "production"}}
+			require.Error(t, l.Set(value))
+			require.Len(t, l, 1)
+		})
+	}
+}
+
+func TestConnectionStateFile(t *testing.T) {
+	require.Empty(t, connectionStateFile("", "staging"))
+	require.Equal(t, "/var/lib/sm/state.json", connectionStateFile("/var/lib/sm/state.json", ""))
+	require.Equal(t, "/var/lib/sm/state.staging.json", connectionStateFile("/var/lib/sm/state.json", "staging"))
+	require.Equal(t, "/var/lib/sm/state.staging", connectionStateFile("/var/lib/sm/state", "staging"))
+}
+
+func TestReadinessGroup(t *testing.T) {
+	handler := NewReadynessHandler()
+	g := newReadinessGroup(handler, 2)
+
+	isReady := func() bool {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		return w.Code == http.StatusOK
+	}
+
+	g.Setter(0)(true)
+	g.Setter(0)(true)
+	require.False(t, isReady())
+
+	g.Setter(1)(false)
+	require.False(t, isReady())
+
+	g.Setter(1)(true)
+	require.True(t, isReady())
+}
+
+func TestChecksGroup(t *testing.T) {
+	production := &testOperatorChecks{statuses: []scraper.Status{
+		{Check: model.Check{Check: sm.Check{Id: 1}}, LastExecution: &scraper.Execution{Result: scraper.ResultSuccess}},
+	}}
+	staging := &testOperatorChecks{statuses: []scraper.Status{
+		{Check: model.Check{Check: sm.Check{Id: 2}}, LastExecution: &scraper.Execution{Result: scraper.ResultFailure}},
+	}}
+
+	g := checksGroup{production, staging}
+
+	require.Len(t, g.Checks(), 2)
+
+	status, found := g.Check(2)
+	require.True(t, found)
+	require.Equal(t, int64(2), status.Check.Id)
+
+	_, found = g.Check(3)
+	require.False(t, found)
+
+	exec, err := g.RunCheck(t.Context(), 2, true)
+	require.NoError(t, err)
+	require.Equal(t, scraper.ResultFailure, exec.Result)
+	require.Empty(t, production.published)
+	require.Equal(t, []model.GlobalID{2}, staging.published)
+
+	_, err = g.RunCheck(t.Context(), 3, false)
+	require.ErrorIs(t, err, checks.ErrCheckNotFound)
+}
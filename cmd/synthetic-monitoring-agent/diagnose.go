@@ -0,0 +1,541 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
+	"github.com/grafana/synthetic-monitoring-agent/internal/feature"
+	"github.com/grafana/synthetic-monitoring-agent/internal/k6runner/version"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober/icmp"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	agentVersion "github.com/grafana/synthetic-monitoring-agent/internal/version"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+const (
+	defaultDiagnoseTimeout = 30 * time.Second
+	defaultErrorLogLines   = 200
+)
+
+// logBuffer keeps the most recent log lines at or above a level, so that
+// they can be included in diagnostics bundles. It's meant to be used with
+// zerolog.MultiLevelWriter.
+type logBuffer struct {
+	level zerolog.Level
+	mutex sync.Mutex
+	lines [][]byte
+	next  int
+}
+
+var _ zerolog.LevelWriter = (*logBuffer)(nil)
+
+func newLogBuffer(size int, level zerolog.Level) *logBuffer {
+	return &logBuffer{level: level, lines: make([][]byte, 0, size)}
+}
+
+// Write discards p, as only messages with a level are kept.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (b *logBuffer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < b.level || level == zerolog.NoLevel {
+		return len(p), nil
+	}
+
+	// zerolog reuses its buffers.
+	line := bytes.Clone(p)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.lines) < cap(b.lines) {
+		b.lines = append(b.lines, line)
+	} else {
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+	}
+
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first.
+func (b *logBuffer) Lines() [][]byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return slices.Concat(b.lines[b.next:], b.lines[:b.next])
+}
+
+// diagnostics collects what's needed to troubleshoot an agent into a
+// gzipped tarball. Each file in the tarball describes one aspect of the
+// agent; failures to collect something are recorded in the corresponding
+// file instead of aborting the whole bundle.
+type diagnostics struct {
+	// Config is the effective configuration, which must redact
+	// secrets when encoded as JSON.
+	Config       any
+	Features     feature.Collection
+	K6URI        string
+	K6Repository string
+	Connections  []diagnosticsConnection
+	CacheType    cache.Kind
+	Cache        cache.Cache
+	ErrorLogs    *logBuffer
+	// Timeout bounds the time spent collecting the bundle,
+	// defaultDiagnoseTimeout if zero.
+	Timeout time.Duration
+}
+
+// diagnosticsConnection describes one of the connections of the agent to
+// the API.
+type diagnosticsConnection struct {
+	Name    string
+	Address string
+	// Conn is the connection to the API, nil in standalone mode.
+	Conn    *grpc.ClientConn
+	Checks  checksInspector
+	Tenants pusher.TenantProvider
+}
+
+// diagnoseFilename returns the name of a bundle collected at t.
+func diagnoseFilename(t time.Time) string {
+	return "sm-agent-diagnose-" + t.UTC().Format("20060102T150405Z") + ".tar.gz"
+}
+
+// Write collects the diagnostics and writes the bundle to w.
+func (d *diagnostics) Write(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(d.Timeout, defaultDiagnoseTimeout))
+	defer cancel()
+
+	now := time.Now()
+
+	files := []struct {
+		name    string
+		collect func(context.Context) any
+	}{
+		{"build.json", func(context.Context) any { return collectBuildInfo() }},
+		{"config.json", func(context.Context) any { return d.Config }},
+		{"features.json", func(context.Context) any { return d.collectFeatures() }},
+		{"k6.json", func(context.Context) any { return d.collectK6() }},
+		{"icmp.json", func(context.Context) any { return icmpInfo{PrivilegedRequired: icmp.PrivilegedRequired()} }},
+		{"api.json", d.collectAPI},
+		{"remote-write.json", d.collectRemoteWrite},
+		{"cache.json", d.collectCache},
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.collect(ctx), "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", f.name, err)
+		}
+
+		if err := writeTarFile(tw, f.name, append(data, '\n'), now); err != nil {
+			return err
+		}
+	}
+
+	var logs []byte
+	if d.ErrorLogs != nil {
+		logs = bytes.Join(d.ErrorLogs.Lines(), nil)
+	}
+
+	if err := writeTarFile(tw, "errors.log", logs, now); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing diagnostics bundle: %w", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("writing diagnostics bundle: %w", err)
+	}
+
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+
+	if err := tw.WriteHeader(&hdr); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// errorString returns the message of err, or an empty string if it's nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+type buildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit"`
+	Buildstamp string `json:"buildstamp"`
+	GoVersion  string `json:"goVersion"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+}
+
+func collectBuildInfo() buildInfo {
+	return buildInfo{
+		Version:    agentVersion.Short(),
+		Commit:     agentVersion.Commit(),
+		Buildstamp: agentVersion.Buildstamp(),
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+	}
+}
+
+func (d *diagnostics) collectFeatures() []string {
+	features := make([]string, 0, len(d.Features))
+
+	for name := range d.Features {
+		features = append(features, name)
+	}
+
+	slices.Sort(features)
+
+	return features
+}
+
+type k6Info struct {
+	Enabled    bool            `json:"enabled"`
+	URI        string          `json:"uri,omitempty"`
+	Repository string          `json:"repository,omitempty"`
+	Versions   []version.Entry `json:"versions,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func (d *diagnostics) collectK6() k6Info {
+	info := k6Info{
+		Enabled:    d.Features.IsSet(feature.K6),
+		URI:        d.K6URI,
+		Repository: d.K6Repository,
+	}
+
+	// Remote runners manage their own binaries.
+	if !info.Enabled || strings.HasPrefix(d.K6URI, "http") {
+		info.Repository = ""
+		return info
+	}
+
+	repo, err := version.NewRepository(d.K6Repository, d.K6URI)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	info.Versions, err = repo.Entries()
+	info.Error = errorString(err)
+
+	return info
+}
+
+type icmpInfo struct {
+	PrivilegedRequired bool `json:"privilegedRequired"`
+}
+
+type apiInfo struct {
+	Name       string `json:"name,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Standalone bool   `json:"standalone"`
+	State      string `json:"state,omitempty"`
+	Latency    string `json:"latency,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// collectAPI pings the API through each of the connections.
+func (d *diagnostics) collectAPI(ctx context.Context) any {
+	infos := make([]apiInfo, len(d.Connections))
+
+	var wg sync.WaitGroup
+
+	for i, c := range d.Connections {
+		wg.Go(func() {
+			infos[i] = c.checkAPI(ctx)
+		})
+	}
+
+	wg.Wait()
+
+	return infos
+}
+
+func (c *diagnosticsConnection) checkAPI(ctx context.Context) apiInfo {
+	if c.Conn == nil {
+		return apiInfo{Name: c.Name, Standalone: true}
+	}
+
+	info := apiInfo{Name: c.Name, Address: c.Address, State: c.Conn.GetState().String()}
+
+	start := time.Now()
+	_, err := sm.NewChecksClient(c.Conn).Ping(ctx, &sm.PingRequest{}, grpc.WaitForReady(false))
+
+	if s, ok := status.FromError(err); ok && s.Code() == codes.Unimplemented {
+		// The API doesn't support pings, but it answered.
+		err = nil
+	}
+
+	info.Latency = time.Since(start).String()
+	info.Error = errorString(err)
+
+	return info
+}
+
+type remoteWriteInfo struct {
+	Connection string         `json:"connection,omitempty"`
+	TenantID   model.GlobalID `json:"tenantId"`
+	Metrics    *remoteInfo    `json:"metrics,omitempty"`
+	Logs       *remoteInfo    `json:"logs,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// remoteInfo describes whether a remote-write endpoint can be reached.
+// Any HTTP response counts, the status code tells whether the
+// credentials are accepted.
+type remoteInfo struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Latency    string `json:"latency,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// collectRemoteWrite checks the remote-write endpoints of the tenants of
+// the running checks, for each connection.
+func (d *diagnostics) collectRemoteWrite(ctx context.Context) any {
+	var (
+		infos       = []remoteWriteInfo{}
+		connections []*diagnosticsConnection
+	)
+
+	for i, c := range d.Connections {
+		var tenantIDs []model.GlobalID
+
+		if c.Checks != nil {
+			for _, s := range c.Checks.Checks() {
+				tenantIDs = append(tenantIDs, s.Check.GlobalTenantID())
+			}
+		}
+
+		slices.Sort(tenantIDs)
+
+		for _, id := range slices.Compact(tenantIDs) {
+			infos = append(infos, remoteWriteInfo{Connection: c.Name, TenantID: id})
+			connections = append(connections, &d.Connections[i])
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for i, c := range connections {
+		if c.Tenants == nil {
+			continue
+		}
+
+		wg.Go(func() {
+			c.checkTenantRemotes(ctx, &infos[i])
+		})
+	}
+
+	wg.Wait()
+
+	return infos
+}
+
+func (c *diagnosticsConnection) checkTenantRemotes(ctx context.Context, info *remoteWriteInfo) {
+	tenant, err := c.Tenants.GetTenant(ctx, &sm.TenantInfo{Id: int64(info.TenantID)})
+	if err != nil {
+		info.Error = err.Error()
+		return
+	}
+
+	if tenant.MetricsRemote != nil {
+		info.Metrics = checkRemote(ctx, tenant.MetricsRemote)
+	}
+
+	if tenant.EventsRemote != nil {
+		info.Logs = checkRemote(ctx, tenant.EventsRemote)
+	}
+}
+
+func checkRemote(ctx context.Context, remote *sm.RemoteInfo) *remoteInfo {
+	info := &remoteInfo{URL: remote.Url}
+
+	// Like the publishers, see pusher.ClientFromRemoteInfo.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, remote.Url+"/push", nil)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	req.Header.Set("User-Agent", agentVersion.UserAgent())
+
+	if remote.Username != "" {
+		req.SetBasicAuth(remote.Username, remote.Password)
+	}
+
+	start := time.Now()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	_ = resp.Body.Close()
+
+	info.StatusCode = resp.StatusCode
+	info.Latency = time.Since(start).String()
+
+	return info
+}
+
+type cacheInfo struct {
+	Type           cache.Kind `json:"type"`
+	Implementation string     `json:"implementation"`
+	Latency        string     `json:"latency,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// collectCache writes, reads and deletes a value to check the cache works.
+func (d *diagnostics) collectCache(ctx context.Context) any {
+	if d.Cache == nil {
+		return cacheInfo{Type: d.CacheType}
+	}
+
+	info := cacheInfo{Type: d.CacheType, Implementation: fmt.Sprintf("%T", d.Cache)}
+
+	key := fmt.Sprintf("diagnose:%d", time.Now().UnixNano())
+	start := time.Now()
+
+	err := d.Cache.Set(ctx, key, key, time.Minute)
+	if err == nil {
+		var value string
+
+		err = d.Cache.Get(ctx, key, &value)
+		if err == nil && value != key {
+			err = fmt.Errorf("read %q from the cache, wrote %q", value, key)
+		}
+
+		if deleteErr := d.Cache.Delete(ctx, key); err == nil {
+			err = deleteErr
+		}
+	}
+
+	info.Latency = time.Since(start).String()
+	info.Error = errorString(err)
+
+	return info
+}
+
+// runDiagnose implements the diagnose subcommand, which downloads the
+// diagnostics bundle from a running agent.
+func runDiagnose(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet(filepath.Base(args[0])+" diagnose", flag.ExitOnError)
+
+	var (
+		listenAddr = "localhost:4050"
+		token      Secret
+		output     string
+	)
+
+	flags.StringVar(&listenAddr, "listen-address", listenAddr, "listen address of the running agent")
+	flags.Var(&token, "operator-api-token", `bearer token required by the operator API (default $SM_AGENT_OPERATOR_API_TOKEN)`)
+	flags.StringVar(&output, "output", output, `file to write the bundle to, or "-" for standard output (default sm-agent-diagnose-<time>.tar.gz)`)
+
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+
+	token = Secret(stringFromEnv("SM_AGENT_OPERATOR_API_TOKEN", string(token)))
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+listenAddr+"/api/v1/diagnose", nil)
+	if err != nil {
+		return fmt.Errorf("building diagnose request: %w", err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+string(token))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting diagnostics bundle: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return fmt.Errorf("requesting diagnostics bundle: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if output == "-" {
+		_, err := io.Copy(stdout, resp.Body)
+		return err
+	}
+
+	if output == "" {
+		output = diagnoseFilename(time.Now())
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating diagnostics bundle: %w", err)
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing diagnostics bundle: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing diagnostics bundle: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(stdout, "wrote %s\n", output)
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
+	"github.com/grafana/synthetic-monitoring-agent/internal/feature"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestLogBuffer(t *testing.T) {
+	b := newLogBuffer(2, zerolog.ErrorLevel)
+	logger := zerolog.New(zerolog.MultiLevelWriter(io.Discard, b))
+
+	logger.Warn().Msg("ignored")
+	require.Empty(t, b.Lines())
+
+	logger.Error().Msg("one")
+	logger.Error().Msg("two")
+	logger.Error().Msg("three")
+
+	require.Equal(t, [][]byte{
+		[]byte(`{"level":"error","message":"two"}` + "\n"),
+		[]byte(`{"level":"error","message":"three"}` + "\n"),
+	}, b.Lines())
+}
+
+type testTenantProvider map[int64]*sm.Tenant
+
+func (p testTenantProvider) GetTenant(_ context.Context, info *sm.TenantInfo) (*sm.Tenant, error) {
+	tenant, found := p[info.Id]
+	if !found {
+		return nil, errors.New("tenant not found")
+	}
+
+	return tenant, nil
+}
+
+// readBundle returns the contents of the files in a diagnostics bundle.
+func readBundle(t *testing.T, r io.Reader) map[string][]byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		files[hdr.Name] = data
+	}
+
+	return files
+}
+
+func newTestDiagnostics(t *testing.T) *diagnostics {
+	t.Helper()
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	t.Cleanup(remote.Close)
+
+	local, err := cache.NewLocal(cache.LocalConfig{MaxCapacity: 10, Logger: zerolog.Nop()})
+	require.NoError(t, err)
+
+	errorLogs := newLogBuffer(10, zerolog.ErrorLevel)
+	logger := zerolog.New(zerolog.MultiLevelWriter(io.Discard, errorLogs))
+	logger.Error().Msg("publishing failed")
+
+	features := feature.NewCollection()
+	require.NoError(t, features.Set(feature.ProtocolSecrets))
+
+	return &diagnostics{
+		Config: struct {
+			Token  Secret
+			Listen string
+		}{Token: "s3cr3t", Listen: "localhost:4050"},
+		Features: features,
+		Connections: []diagnosticsConnection{{
+			Checks: &testOperatorChecks{statuses: []scraper.Status{
+				{Check: model.Check{Check: sm.Check{Id: 1, TenantId: 10}}},
+				{Check: model.Check{Check: sm.Check{Id: 2, TenantId: 10}}},
+				{Check: model.Check{Check: sm.Check{Id: 3, TenantId: 11}}},
+			}},
+			Tenants: testTenantProvider{
+				10: {
+					Id:            10,
+					MetricsRemote: &sm.RemoteInfo{Url: remote.URL, Username: "user", Password: "pass"},
+					EventsRemote:  &sm.RemoteInfo{Url: remote.URL, Username: "user", Password: "wrong"},
+				},
+			},
+		}},
+		CacheType: cache.KindLocal,
+		Cache:     local,
+		ErrorLogs: errorLogs,
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	d := newTestDiagnostics(t)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, d.Write(t.Context(), &buf))
+
+	files := readBundle(t, &buf)
+	require.ElementsMatch(t, []string{
+		"build.json", "config.json", "features.json", "k6.json", "icmp.json",
+		"api.json", "remote-write.json", "cache.json", "errors.log",
+	}, slices.Collect(maps.Keys(files)))
+
+	require.JSONEq(t, `{"Token":"<redacted>","Listen":"localhost:4050"}`, string(files["config.json"]))
+	require.JSONEq(t, `["protocol-secrets"]`, string(files["features.json"]))
+	require.JSONEq(t, `{"enabled":false}`, string(files["k6.json"]))
+	require.JSONEq(t, `[{"standalone":true}]`, string(files["api.json"]))
+	require.Contains(t, string(files["errors.log"]), "publishing failed")
+
+	var remotes []remoteWriteInfo
+
+	require.NoError(t, json.Unmarshal(files["remote-write.json"], &remotes))
+	require.Len(t, remotes, 2)
+	require.Equal(t, model.GlobalID(10), remotes[0].TenantID)
+	require.Equal(t, http.StatusMethodNotAllowed, remotes[0].Metrics.StatusCode)
+	require.Equal(t, http.StatusUnauthorized, remotes[0].Logs.StatusCode)
+	require.Equal(t, model.GlobalID(11), remotes[1].TenantID)
+	require.Equal(t, "tenant not found", remotes[1].Error)
+
+	var cacheResult cacheInfo
+
+	require.NoError(t, json.Unmarshal(files["cache.json"], &cacheResult))
+	require.Equal(t, cache.KindLocal, cacheResult.Type)
+	require.Equal(t, "*cache.Local", cacheResult.Implementation)
+	require.Empty(t, cacheResult.Error)
+
+	// With several connections, the endpoints of the tenants of each of
+	// them are checked.
+	d.Connections = append(d.Connections, diagnosticsConnection{
+		Name:    "staging",
+		Checks:  &testOperatorChecks{statuses: []scraper.Status{{Check: model.Check{Check: sm.Check{Id: 1, TenantId: 10}}}}},
+		Tenants: testTenantProvider{},
+	})
+
+	buf.Reset()
+	require.NoError(t, d.Write(t.Context(), &buf))
+
+	files = readBundle(t, &buf)
+	require.JSONEq(t, `[{"standalone":true},{"name":"staging","standalone":true}]`, string(files["api.json"]))
+	require.NoError(t, json.Unmarshal(files["remote-write.json"], &remotes))
+	require.Len(t, remotes, 3)
+	require.Equal(t, "staging", remotes[2].Connection)
+	require.Equal(t, model.GlobalID(10), remotes[2].TenantID)
+	require.Equal(t, "tenant not found", remotes[2].Error)
+
+	// The noop cache never returns the values written to it.
+	d.Cache = cache.NewNoop(zerolog.Nop())
+
+	buf.Reset()
+	require.NoError(t, d.Write(t.Context(), &buf))
+	require.NoError(t, json.Unmarshal(readBundle(t, &buf)["cache.json"], &cacheResult))
+	require.Equal(t, cache.ErrCacheMiss.Error(), cacheResult.Error)
+}
+
+func TestRunDiagnose(t *testing.T) {
+	d := newTestDiagnostics(t)
+
+	srv := httptest.NewServer(newOperatorAPIHandler(&testOperatorChecks{}, d, nil, "s3cr3t", zerolog.New(io.Discard)))
+	t.Cleanup(srv.Close)
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	output := filepath.Join(t.TempDir(), "bundle.tar.gz")
+
+	var stdout bytes.Buffer
+
+	err := run([]string{"sm-agent", "diagnose", "-listen-address", addr, "-operator-api-token", "wrong"}, &stdout)
+	require.ErrorContains(t, err, "401 Unauthorized")
+
+	err = run([]string{"sm-agent", "diagnose", "-listen-address", addr, "-operator-api-token", "s3cr3t", "-output", output}, &stdout)
+	require.NoError(t, err)
+	require.Equal(t, "wrote "+output+"\n", stdout.String())
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = f.Close() })
+
+	require.Contains(t, readBundle(t, f), "config.json")
+
+	stdout.Reset()
+
+	err = run([]string{"sm-agent", "diagnose", "-listen-address", addr, "-operator-api-token", "s3cr3t", "-output", "-"}, &stdout)
+	require.NoError(t, err)
+	require.Contains(t, readBundle(t, &stdout), "errors.log")
+}
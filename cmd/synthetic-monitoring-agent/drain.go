@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+)
+
+// defaultDrainTimeout is how long the /drain endpoint waits for the agent to
+// drain if -drain-timeout is not set.
+const defaultDrainTimeout = 30 * time.Second
+
+// checksDrainer is implemented by the checks updater.
+type checksDrainer interface {
+	Drain(ctx context.Context, handover bool) error
+}
+
+// adHocDrainer is implemented by the ad-hoc checks handler.
+type adHocDrainer interface {
+	Drain(ctx context.Context) error
+}
+
+// drainer shuts down the work done by the agent gracefully, so that it can
+// be replaced without gaps in the data it publishes. Draining happens in
+// order:
+//
+//  1. The agent is reported as not ready.
+//  2. New ad-hoc checks are no longer accepted, and the checks stop
+//     being scheduled. Executions in progress finish.
+//  3. The publisher queues are flushed.
+//
+// All of it must happen within the timeout.
+type drainer struct {
+	timeout time.Duration
+	// handover skips the stale markers published when checks stop, as
+	// another agent is expected to take over the probe.
+	handover   bool
+	ready      *readynessHandler
+	checks     []checksDrainer
+	adhoc      []adHocDrainer
+	publishers []pusher.Publisher
+	logger     zerolog.Logger
+
+	once sync.Once
+	err  error
+}
+
+// Drain drains the agent, returning once it's done or the timeout expires.
+// It only drains the agent once: calling it again returns the result of
+// the first call, waiting for it if necessary.
+func (d *drainer) Drain() error {
+	d.once.Do(func() {
+		d.err = d.drain()
+	})
+
+	return d.err
+}
+
+func (d *drainer) drain() error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	d.logger.Info().Dur("timeout", d.timeout).Bool("handover", d.handover).Msg("draining")
+
+	d.ready.Drain()
+
+	var g errgroup.Group
+
+	for _, h := range d.adhoc {
+		g.Go(func() error {
+			return h.Drain(ctx)
+		})
+	}
+
+	for _, c := range d.checks {
+		g.Go(func() error {
+			return c.Drain(ctx, d.handover)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		d.logger.Warn().Err(err).Dur("duration", time.Since(start)).Msg("executions in progress did not finish before the drain timeout")
+		return fmt.Errorf("draining checks: %w", err)
+	}
+
+	for _, p := range d.publishers {
+		// Publishers that don't queue payloads have nothing to
+		// flush.
+		f, ok := p.(pusher.Flusher)
+		if !ok {
+			continue
+		}
+
+		if err := f.Flush(ctx); err != nil {
+			d.logger.Warn().Err(err).Dur("duration", time.Since(start)).Msg("publisher queues not flushed before the drain timeout")
+			return fmt.Errorf("flushing publisher: %w", err)
+		}
+	}
+
+	d.logger.Info().Dur("duration", time.Since(start)).Msg("drained")
+
+	return nil
+}
+
+// drainHandler returns the handler for the /drain endpoint. POST requests
+// drain the agent, and the response is sent once it's drained.
+func drainHandler(d *drainer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		switch err := d.Drain(); {
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		default:
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "drained")
+		}
+	})
+}
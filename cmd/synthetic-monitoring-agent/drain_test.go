@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+)
+
+// drainRecorder records the steps taken while draining, checking that the
+// agent is reported as not ready before anything else.
+type drainRecorder struct {
+	t     *testing.T
+	ready *readynessHandler
+	mutex sync.Mutex
+	steps []string
+	// block makes the checks wait for ctx.
+	block bool
+}
+
+func (r *drainRecorder) record(step string) {
+	w := httptest.NewRecorder()
+	r.ready.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(r.t, http.StatusServiceUnavailable, w.Code)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.steps = append(r.steps, step)
+}
+
+type testChecksDrainer struct{ r *drainRecorder }
+
+func (d testChecksDrainer) Drain(ctx context.Context, handover bool) error {
+	if d.r.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if handover {
+		d.r.record("checks (handover)")
+	} else {
+		d.r.record("checks")
+	}
+
+	return nil
+}
+
+type testAdHocDrainer struct{ r *drainRecorder }
+
+func (d testAdHocDrainer) Drain(ctx context.Context) error {
+	d.r.record("adhoc")
+	return nil
+}
+
+type testFlushPublisher struct{ r *drainRecorder }
+
+func (testFlushPublisher) Publish(pusher.Payload) {}
+
+func (p testFlushPublisher) Flush(ctx context.Context) error {
+	p.r.record("flush")
+	return nil
+}
+
+type testPublisher struct{}
+
+func (testPublisher) Publish(pusher.Payload) {}
+
+func newTestDrainer(t *testing.T, handover, block bool) (*drainer, *drainRecorder) {
+	ready := NewReadynessHandler()
+	ready.Set(true)
+
+	r := &drainRecorder{t: t, ready: ready, block: block}
+
+	return &drainer{
+		timeout:    10 * time.Millisecond,
+		handover:   handover,
+		ready:      ready,
+		checks:     []checksDrainer{testChecksDrainer{r}},
+		adhoc:      []adHocDrainer{testAdHocDrainer{r}},
+		publishers: []pusher.Publisher{testFlushPublisher{r}, testPublisher{}},
+		logger:     zerolog.Nop(),
+	}, r
+}
+
+func TestDrainer(t *testing.T) {
+	d, r := newTestDrainer(t, false, false)
+
+	require.NoError(t, d.Drain())
+	require.ElementsMatch(t, []string{"checks", "adhoc"}, r.steps[:2])
+	require.Equal(t, []string{"flush"}, r.steps[2:])
+
+	// Draining again doesn't do anything.
+	require.NoError(t, d.Drain())
+	require.Len(t, r.steps, 3)
+
+	d, r = newTestDrainer(t, true, false)
+
+	require.NoError(t, d.Drain())
+	require.Contains(t, r.steps, "checks (handover)")
+
+	// The publishers are not flushed if the checks don't stop in time.
+	d, r = newTestDrainer(t, false, true)
+
+	require.ErrorIs(t, d.Drain(), context.DeadlineExceeded)
+	require.Equal(t, []string{"adhoc"}, r.steps)
+}
+
+func TestDrainHandler(t *testing.T) {
+	d, r := newTestDrainer(t, false, false)
+	h := drainHandler(d)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Empty(t, r.steps)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/drain", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "drained", w.Body.String())
+	require.Len(t, r.steps, 3)
+
+	d, _ = newTestDrainer(t, false, true)
+	h = drainHandler(d)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/drain", nil))
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
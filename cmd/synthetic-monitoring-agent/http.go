@@ -128,6 +128,12 @@ func NewMux(opts MuxOpts) *Mux {
 	}
 }
 
+// Handle registers handler for pattern. It can be used once the mux is
+// serving requests, for handlers that depend on components created later.
+func (mux *Mux) Handle(pattern string, handler http.Handler) {
+	mux.router.Handle(pattern, handler)
+}
+
 func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux.metrics.inFlightRequests.Inc()
 	m := httpsnoop.CaptureMetrics(mux.router, w, r)
@@ -181,10 +187,16 @@ func defaultHandler() http.Handler {
 // readynessHandler records whether the agent is ready to serve requests.
 //
 // readyness is defined by calling the method Set(true) on the handler
-// at least once. Once the ready state is set, the handler never goes
-// back to the unready state.
+// at least once. Once the ready state is set, the handler only goes back
+// to the unready state when the agent starts draining, see Drain.
 type readynessHandler int32
 
+const (
+	readynessUnready int32 = iota
+	readynessReady
+	readynessDraining
+)
+
 // NewReadynessHandler returns a new readynessHandler set to the unready
 // state.
 func NewReadynessHandler() *readynessHandler {
@@ -196,15 +208,26 @@ func NewReadynessHandler() *readynessHandler {
 // value of the argument, has no effect.
 func (h *readynessHandler) Set(v bool) {
 	if v {
-		atomic.StoreInt32((*int32)(h), 1)
+		atomic.CompareAndSwapInt32((*int32)(h), readynessUnready, readynessReady)
 	}
 }
 
+// Drain marks the agent as unready for good, so that no new work is
+// routed to it while it shuts down.
+func (h *readynessHandler) Drain() {
+	atomic.StoreInt32((*int32)(h), readynessDraining)
+}
+
 // ServeHTTP implements http.Handler.
 func (h *readynessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if atomic.LoadInt32((*int32)(h)) == 0 {
+	switch atomic.LoadInt32((*int32)(h)) {
+	case readynessUnready:
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		return
+
+	case readynessDraining:
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
 	}
 
 	// Signal readiness when the agent has connected once to the API.
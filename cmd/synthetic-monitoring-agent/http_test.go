@@ -63,4 +63,19 @@ func TestReadynessHandler(t *testing.T) {
 	h.ServeHTTP(w, r)
 	require.Equal(t, http.StatusOK, w.Code)
 	require.Equal(t, "ready", w.Body.String())
+
+	// Draining marks the agent as not ready for good.
+	h.Drain()
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/ready", nil)
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	h.Set(true)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/ready", nil)
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/grpclog"
 
 	"github.com/grafana/synthetic-monitoring-agent/internal/adhoc"
@@ -55,38 +58,82 @@ const (
 //
 //nolint:gocyclo // this function is doing a lot of configuration, and it ends up being long and with lots of branches.
 func run(args []string, stdout io.Writer) error {
+	if len(args) > 1 && args[1] == "diagnose" {
+		return runDiagnose(args, stdout)
+	}
+
 	flags := flag.NewFlagSet(filepath.Base(args[0]), flag.ExitOnError)
 
 	var (
 		features = feature.NewCollection()
 		config   = struct {
-			DevMode               bool
-			Debug                 bool
-			Verbose               bool
-			ReportVersion         bool
-			GrpcApiServerAddr     string
-			GrpcInsecure          bool
-			ApiToken              Secret
-			EnableChangeLogLevel  bool
-			EnableDisconnect      bool
-			EnablePProf           bool
-			HttpListenAddr        string
-			K6URI                 string
-			K6Repository          string
-			K6BlacklistedIP       string
-			SelectedPublisher     string
-			TelemetryTimeSpan     int
-			AutoMemLimit          bool
-			MemLimitRatio         float64
-			DisableK6             bool
-			DisableUsageReports   bool
-			CacheType             cache.Kind
-			CacheLocalCapacity    int
-			CacheLocalTTL         time.Duration
-			MemcachedServers      StringList
-			EnableProtocolSecrets bool
-			PushTelemetry         bool
-			MetricsInterval       time.Duration
+			DevMode                bool
+			Debug                  bool
+			Verbose                bool
+			ReportVersion          bool
+			GrpcApiServerAddr      string
+			GrpcInsecure           bool
+			ApiToken               Secret
+			APIConnections         apiConnections
+			EnableChangeLogLevel   bool
+			EnableDisconnect       bool
+			EnablePProf            bool
+			EnableOperatorAPI      bool
+			EnableDrain            bool
+			DrainTimeout           time.Duration
+			DrainHandover          bool
+			OperatorAPIToken       Secret
+			HttpListenAddr         string
+			K6URI                  string
+			K6Repository           string
+			K6BlacklistedIP        string
+			SelectedPublisher      string
+			TelemetryTimeSpan      int
+			TelemetryLedger        string
+			AutoMemLimit           bool
+			MemLimitRatio          float64
+			DisableK6              bool
+			DisableUsageReports    bool
+			CacheType              cache.Kind
+			CacheLocalCapacity     int
+			CacheLocalTTL          time.Duration
+			CacheTierLocalTTL      time.Duration
+			CacheStaleTTL          time.Duration
+			CacheEncryptionKeys    Secret
+			CacheEncryptionKeyFile string
+			MemcachedServers       StringList
+			Redis                  redisFlags
+			EnableProtocolSecrets  bool
+			PushTelemetry          bool
+			MetricsInterval        time.Duration
+			ChecksFile             string
+			ChecksFileInterval     time.Duration
+			StateFile              string
+			StateMaxStaleness      time.Duration
+			CheckLogs              scraper.LogEmission
+			CheckLogsInterval      int
+			CheckRetryAttempts     int
+			CheckRetryDelay        time.Duration
+			CheckRetryOn           scraper.FailureClasses
+			CheckPoliciesFile      string
+			CheckHistorySize       int
+			AdHocRuns              int
+			AdHocRunSpacing        time.Duration
+			AdHocSourceIPs         StringList
+			SecretsBackends        secrets.BackendKinds
+			SecretsTenants         secrets.TenantList
+			SecretsDir             string
+			SecretsEnvPrefix       string
+			SecretsVaultAddr       string
+			SecretsVaultNamespace  string
+			SecretsVaultMount      string
+			SecretsVaultPath       string
+			SecretsVaultField      string
+			SecretsVaultToken      Secret
+			SecretsVaultRoleID     string
+			SecretsVaultSecretID   Secret
+			TenantRefreshAhead     time.Duration
+			TenantStaleGrace       time.Duration
 		}{
 			GrpcApiServerAddr:  "localhost:4031",
 			HttpListenAddr:     "localhost:4050",
@@ -100,7 +147,19 @@ func run(args []string, stdout io.Writer) error {
 			CacheType:          cache.KindAuto,
 			CacheLocalCapacity: 10000,
 			CacheLocalTTL:      5 * time.Minute,
+			CacheTierLocalTTL:  cache.DefaultTieredLocalTTL,
+			Redis:              redisFlags{Mode: cache.RedisModeStandalone},
 			MetricsInterval:    time.Minute,
+			ChecksFileInterval: checks.DefaultLocalSourceInterval,
+			StateMaxStaleness:  checks.DefaultStateMaxStaleness,
+			CheckLogs:          scraper.LogEmissionAll,
+			CheckHistorySize:   scraper.DefaultHistorySize,
+			AdHocRuns:          1,
+			AdHocRunSpacing:    time.Second,
+			SecretsBackends:    secrets.BackendKinds{secrets.BackendGSM},
+			SecretsEnvPrefix:   secrets.DefaultEnvPrefix,
+			TenantRefreshAhead: time.Minute,
+			TenantStaleGrace:   tenants.DefaultStaleGracePeriod,
 		}
 	)
 
@@ -111,9 +170,15 @@ func run(args []string, stdout io.Writer) error {
 	flags.StringVar(&config.GrpcApiServerAddr, "api-server-address", config.GrpcApiServerAddr, "GRPC API server address")
 	flags.BoolVar(&config.GrpcInsecure, "api-insecure", config.GrpcInsecure, "Don't use TLS with connections to GRPC API")
 	flags.Var(&config.ApiToken, "api-token", `synthetic monitoring probe authentication token (default "")`)
+	flags.Var(&config.APIConnections, "api-connection", "connection to an additional API, as name=NAME,address=HOST:PORT,token=TOKEN or token-file=FILE[,insecure=true]; can be repeated to probe for several stacks, replaces -api-server-address and -api-token")
 	flags.BoolVar(&config.EnableChangeLogLevel, "enable-change-log-level", config.EnableChangeLogLevel, "enable changing the log level at runtime")
 	flags.BoolVar(&config.EnableDisconnect, "enable-disconnect", config.EnableDisconnect, "enable HTTP /disconnect endpoint")
 	flags.BoolVar(&config.EnablePProf, "enable-pprof", config.EnablePProf, "exposes profiling data via HTTP /debug/pprof/ endpoint")
+	flags.BoolVar(&config.EnableOperatorAPI, "enable-operator-api", config.EnableOperatorAPI, "exposes the running checks via HTTP /api/v1/ endpoints and the /status page")
+	flags.BoolVar(&config.EnableDrain, "enable-drain", config.EnableDrain, "enable HTTP /drain endpoint, to drain the agent before stopping it")
+	flags.DurationVar(&config.DrainTimeout, "drain-timeout", config.DrainTimeout, "on SIGTERM, drain the agent for up to this long before stopping it, letting executions in progress finish and flushing the publisher queues (0 stops right away)")
+	flags.BoolVar(&config.DrainHandover, "drain-handover", config.DrainHandover, "when draining, don't publish stale markers for the checks, as another agent is expected to take over the probe")
+	flags.Var(&config.OperatorAPIToken, "operator-api-token", `bearer token required by the operator API (default $SM_AGENT_OPERATOR_API_TOKEN)`)
 	flags.StringVar(&config.HttpListenAddr, "listen-address", config.HttpListenAddr, "listen address")
 	flags.StringVar(&config.K6URI, "k6-uri", config.K6URI, "Path or URI to a specific k6 binary, overrides k6 version autodetection")
 	flags.StringVar(&config.K6Repository, "k6-repository", config.K6Repository, "path to folder containing k6 binaries")
@@ -121,17 +186,61 @@ func run(args []string, stdout io.Writer) error {
 		"IP networks to block in CIDR notation. Setting this to an empty string, or '0.0.0.0/32', will disable the blocklist.")
 	flags.StringVar(&config.SelectedPublisher, "publisher", config.SelectedPublisher, "publisher type")
 	flags.IntVar(&config.TelemetryTimeSpan, "telemetry-time-span", config.TelemetryTimeSpan, "time span between telemetry push executions per tenant")
+	flags.StringVar(&config.TelemetryLedger, "telemetry-ledger", config.TelemetryLedger, "file where each telemetry push is appended as a JSON line, with the executions it accounts for")
 	flags.BoolVar(&config.AutoMemLimit, "enable-auto-memlimit", config.AutoMemLimit, "automatically set GOMEMLIMIT")
 	flags.BoolVar(&config.DisableK6, "disable-k6", config.DisableK6, "disables running k6 checks on this probe")
 	flags.BoolVar(&config.DisableUsageReports, "disable-usage-reports", config.DisableUsageReports, "Disable anonymous usage reports")
 	flags.Float64Var(&config.MemLimitRatio, "memlimit-ratio", config.MemLimitRatio, "fraction of available memory to use")
 	flags.Var(&features, "features", "optional feature flags")
-	flags.Var(&config.CacheType, "cache-type", "cache type: auto (memcached if servers provided, else local), memcached, local, or noop")
+	flags.Var(&config.CacheType, "cache-type", "cache type: auto (memcached or redis if servers provided, else local), memcached, redis, tiered, local, or noop")
 	flags.IntVar(&config.CacheLocalCapacity, "cache-local-capacity", config.CacheLocalCapacity, "maximum number of items in local cache")
 	flags.DurationVar(&config.CacheLocalTTL, "cache-local-ttl", config.CacheLocalTTL, "default TTL for local cache items")
+	flags.DurationVar(&config.CacheTierLocalTTL, "cache-tier-local-ttl", config.CacheTierLocalTTL, "how long the tiered cache serves items locally before checking memcached or redis again")
+	flags.DurationVar(&config.CacheStaleTTL, "cache-stale-ttl", config.CacheStaleTTL, "how long past -cache-tier-local-ttl the tiered cache can serve local items when memcached or redis fail (0 disables stale reads)")
+	flags.Var(&config.CacheEncryptionKeys, "cache-encryption-keys", `comma-separated base64-encoded AES keys used to encrypt values stored in memcached or redis; the first one encrypts, all of them decrypt (default $CACHE_ENCRYPTION_KEYS)`)
+	flags.StringVar(&config.CacheEncryptionKeyFile, "cache-encryption-key-file", config.CacheEncryptionKeyFile, "file holding the cache encryption keys, one per line, instead of -cache-encryption-keys")
 	flags.Var(&config.MemcachedServers, "memcached-servers", "memcached servers")
+	flags.Var(&config.Redis.Addresses, "redis-addresses", "redis servers: the server in standalone mode, the sentinels in sentinel mode, or some of the nodes in cluster mode")
+	flags.Var(&config.Redis.Mode, "redis-mode", "redis deployment type: standalone, sentinel, or cluster")
+	flags.StringVar(&config.Redis.MasterName, "redis-master-name", config.Redis.MasterName, "name of the redis master monitored by the sentinels")
+	flags.StringVar(&config.Redis.Username, "redis-username", config.Redis.Username, "username to authenticate with redis")
+	flags.Var(&config.Redis.Password, "redis-password", `password to authenticate with redis (default $REDIS_PASSWORD)`)
+	flags.Var(&config.Redis.SentinelPassword, "redis-sentinel-password", `password to authenticate with the redis sentinels (default "")`)
+	flags.IntVar(&config.Redis.DB, "redis-db", config.Redis.DB, "redis database number (not supported in cluster mode)")
+	flags.BoolVar(&config.Redis.TLS, "redis-tls", config.Redis.TLS, "use TLS to connect to redis")
+	flags.StringVar(&config.Redis.TLSCAFile, "redis-tls-ca-file", config.Redis.TLSCAFile, "file holding the CA certificates used to verify the redis servers, instead of the system ones")
+	flags.StringVar(&config.Redis.TLSServerName, "redis-tls-server-name", config.Redis.TLSServerName, "server name used to verify the redis servers certificates")
+	flags.BoolVar(&config.Redis.TLSInsecureSkipVerify, "redis-tls-insecure-skip-verify", config.Redis.TLSInsecureSkipVerify, "don't verify the redis servers certificates")
 	flags.DurationVar(&config.MetricsInterval, "metrics-push-interval", config.MetricsInterval, "interval between internal metrics push cycles")
 	flags.BoolVar(&config.PushTelemetry, "experimental-push-telemetry", config.PushTelemetry, "enable pushing telemetry to the probe's tenant databases")
+	flags.StringVar(&config.ChecksFile, "checks-file", config.ChecksFile, "run in standalone mode, reading probe, tenants and checks from this file instead of the API")
+	flags.DurationVar(&config.ChecksFileInterval, "checks-file-interval", config.ChecksFileInterval, "interval between checks for modifications of the checks file")
+	flags.StringVar(&config.StateFile, "state-file", config.StateFile, "file where the checks are saved, to run them right away when the agent restarts, even if the API cannot be reached (tenant credentials are not saved: until the API is reached, results are only published with a shared memcached or Redis tenant cache)")
+	flags.DurationVar(&config.StateMaxStaleness, "state-max-staleness", config.StateMaxStaleness, "with -state-file, stop the checks if the API cannot confirm them for this long (0 disables the limit)")
+	flags.Var(&config.CheckLogs, "check-logs", "check executions publishing their full logs: all, or changes (failures and state changes only)")
+	flags.IntVar(&config.CheckLogsInterval, "check-logs-success-interval", config.CheckLogsInterval, "with -check-logs=changes, also publish the full logs of every Nth successful execution (0 disables)")
+	flags.IntVar(&config.CheckRetryAttempts, "check-retry-attempts", config.CheckRetryAttempts, "maximum number of attempts for failed checks within their timeout, each one getting the time left, values lower than 2 disable retries (retries are not supported for MultiHTTP, scripted and browser checks)")
+	flags.DurationVar(&config.CheckRetryDelay, "check-retry-delay", config.CheckRetryDelay, "time to wait between check attempts")
+	flags.Var(&config.CheckRetryOn, "check-retry-on", "comma-separated failures to retry: dns, connection, tls, http, packet-loss, error (default all); timed out attempts are never retried")
+	flags.StringVar(&config.CheckPoliciesFile, "check-policies-file", config.CheckPoliciesFile, "file with rules overriding the log and retry policies of the checks they match")
+	flags.IntVar(&config.CheckHistorySize, "check-history-size", config.CheckHistorySize, "number of executions of each check kept in memory for the operator API history and status page (0 disables)")
+	flags.IntVar(&config.AdHocRuns, "adhoc-runs", config.AdHocRuns, "number of times to run each ad-hoc check, reporting aggregated statistics if greater than 1")
+	flags.DurationVar(&config.AdHocRunSpacing, "adhoc-run-spacing", config.AdHocRunSpacing, "time to wait between runs of the same ad-hoc check")
+	flags.Var(&config.AdHocSourceIPs, "adhoc-source-ips", "additional source IP addresses to run ad-hoc ping, DNS and TCP checks from, reporting statistics for each of them (requires -adhoc-runs greater than 1)")
+	flags.Var(&config.SecretsBackends, "secrets-backends", "comma-separated secret backends to resolve ${secrets.<name>} from, in order: env, files, vault, gsm")
+	flags.Var(&config.SecretsTenants, "secrets-tenants", "comma-separated tenant IDs, optionally prefixed by a region ID and a colon, allowed to use the env, files and vault secret backends (required with any of them)")
+	flags.StringVar(&config.SecretsDir, "secrets-dir", config.SecretsDir, "directory holding one file per secret, for the files secret backend")
+	flags.StringVar(&config.SecretsEnvPrefix, "secrets-env-prefix", config.SecretsEnvPrefix, "prefix of the environment variables holding secrets, for the env secret backend")
+	flags.StringVar(&config.SecretsVaultAddr, "secrets-vault-address", config.SecretsVaultAddr, "Vault server address, for the vault secret backend (default $VAULT_ADDR)")
+	flags.StringVar(&config.SecretsVaultNamespace, "secrets-vault-namespace", config.SecretsVaultNamespace, "Vault namespace (default $VAULT_NAMESPACE)")
+	flags.StringVar(&config.SecretsVaultMount, "secrets-vault-mount", config.SecretsVaultMount, `mount path of the Vault KV version 2 secrets engine (default "secret")`)
+	flags.StringVar(&config.SecretsVaultPath, "secrets-vault-path", config.SecretsVaultPath, "path prefix of the Vault secrets holding the values")
+	flags.StringVar(&config.SecretsVaultField, "secrets-vault-field", config.SecretsVaultField, `field of the Vault secrets holding the values (default "value")`)
+	flags.Var(&config.SecretsVaultToken, "secrets-vault-token", `Vault token (default $VAULT_TOKEN)`)
+	flags.StringVar(&config.SecretsVaultRoleID, "secrets-vault-role-id", config.SecretsVaultRoleID, "Vault AppRole role ID, used if no token is provided")
+	flags.Var(&config.SecretsVaultSecretID, "secrets-vault-secret-id", `Vault AppRole secret ID (default $VAULT_SECRET_ID)`)
+	flags.DurationVar(&config.TenantRefreshAhead, "tenant-refresh-ahead", config.TenantRefreshAhead, "refresh tenant information and secret store tokens in the background this long before they expire (0 disables background refreshes)")
+	flags.DurationVar(&config.TenantStaleGrace, "tenant-stale-grace-period", config.TenantStaleGrace, "keep using expired tenant information for this long if the API cannot be reached")
 
 	if err := flags.Parse(args[1:]); err != nil {
 		return err
@@ -154,6 +263,8 @@ func run(args []string, stdout io.Writer) error {
 		config.EnableChangeLogLevel = true
 		config.EnableDisconnect = true
 		config.EnablePProf = true
+		config.EnableOperatorAPI = true
+		config.EnableDrain = true
 	}
 
 	if config.AutoMemLimit {
@@ -169,7 +280,32 @@ func run(args []string, stdout io.Writer) error {
 		}
 	}
 
-	if _, _, err := net.SplitHostPort(config.GrpcApiServerAddr); err != nil {
+	standalone := config.ChecksFile != ""
+	multiAPI := len(config.APIConnections) > 0
+
+	if multiAPI {
+		if standalone {
+			return fmt.Errorf("-api-connection cannot be used with -checks-file")
+		}
+
+		var conflict error
+
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "api-server-address" || f.Name == "api-token" || f.Name == "api-insecure" {
+				conflict = fmt.Errorf("-api-connection cannot be used with -%s", f.Name)
+			}
+		})
+
+		if conflict != nil {
+			return conflict
+		}
+	}
+
+	if len(config.AdHocSourceIPs) > 0 && config.AdHocRuns < 2 {
+		return fmt.Errorf("-adhoc-source-ips requires -adhoc-runs greater than 1")
+	}
+
+	if _, _, err := net.SplitHostPort(config.GrpcApiServerAddr); err != nil && !standalone && !multiAPI {
 		// SplitHostPort errors if the address has no port. This is intended, as omitting the port in the address is
 		// almost likely a user error that is hard to troubleshoot otherwise.
 		return fmt.Errorf("parsing GRPC api server address %q: %w", config.GrpcApiServerAddr, err)
@@ -183,11 +319,21 @@ func run(args []string, stdout io.Writer) error {
 	// Using API_TOKEN should be deprecated after March 1st, 2023.
 	config.ApiToken = Secret(stringFromEnv("API_TOKEN", stringFromEnv("SM_AGENT_API_TOKEN", string(config.ApiToken))))
 
+	// Vault settings follow the conventions of the Vault CLI, so that
+	// credentials don't need to be passed on the command line.
+	config.SecretsVaultAddr = stringFromEnv("VAULT_ADDR", config.SecretsVaultAddr)
+	config.SecretsVaultNamespace = stringFromEnv("VAULT_NAMESPACE", config.SecretsVaultNamespace)
+	config.SecretsVaultToken = Secret(stringFromEnv("VAULT_TOKEN", string(config.SecretsVaultToken)))
+	config.SecretsVaultSecretID = Secret(stringFromEnv("VAULT_SECRET_ID", string(config.SecretsVaultSecretID)))
+	config.Redis.Password = Secret(stringFromEnv("REDIS_PASSWORD", string(config.Redis.Password)))
+	config.CacheEncryptionKeys = Secret(stringFromEnv("CACHE_ENCRYPTION_KEYS", string(config.CacheEncryptionKeys)))
+	config.OperatorAPIToken = Secret(stringFromEnv("SM_AGENT_OPERATOR_API_TOKEN", string(config.OperatorAPIToken)))
+
 	// Enable protocol secrets support via the "protocol-secrets" feature flag.
 	// This allows testing before enabling by default.
 	config.EnableProtocolSecrets = features.IsSet(feature.ProtocolSecrets)
 
-	if config.ApiToken == "" {
+	if config.ApiToken == "" && !standalone && !multiAPI {
 		return fmt.Errorf("invalid API token")
 	}
 
@@ -198,7 +344,10 @@ func run(args []string, stdout io.Writer) error {
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
 
-	zl := zerolog.New(stdout).With().Timestamp().Str("program", filepath.Base(args[0])).Logger()
+	// Keep the latest errors around for diagnostics bundles.
+	errorLogs := newLogBuffer(defaultErrorLogLines, zerolog.ErrorLevel)
+
+	zl := zerolog.New(zerolog.MultiLevelWriter(stdout, errorLogs)).With().Timestamp().Str("program", filepath.Base(args[0])).Logger()
 
 	switch {
 	case config.Debug:
@@ -217,8 +366,23 @@ func run(args []string, stdout io.Writer) error {
 		zerolog.SetGlobalLevel(zerolog.WarnLevel)
 	}
 
+	// The drainer is set once all the components are running. Signals
+	// received before that stop the agent right away.
+	var activeDrainer atomic.Pointer[drainer]
+
+	var onSignal func()
+	if config.DrainTimeout > 0 {
+		onSignal = func() {
+			if d := activeDrainer.Load(); d != nil {
+				// Errors are logged by the drainer, and the
+				// agent is stopping anyway.
+				_ = d.Drain()
+			}
+		}
+	}
+
 	g.Go(func() error {
-		return signalHandler(ctx, zl.With().Str("subsystem", "signal handler").Logger())
+		return signalHandler(ctx, zl.With().Str("subsystem", "signal handler").Logger(), onSignal)
 	})
 
 	zl.Info().
@@ -248,18 +412,40 @@ func run(args []string, stdout io.Writer) error {
 		return err
 	}
 
-	cacheClient, err := setupCache(
-		ctx,
-		config.CacheType,
-		config.MemcachedServers,
-		config.CacheLocalCapacity,
-		config.CacheLocalTTL,
-		&zl,
-	)
+	cacheKeys, err := newCacheKeyring(config.CacheEncryptionKeys, config.CacheEncryptionKeyFile)
+	if err != nil {
+		return err
+	}
+
+	redisConfig, err := newRedisConfig(config.Redis, zl.With().Str("subsystem", "cache").Logger())
+	if err != nil {
+		return err
+	}
+
+	redisConfig.Encryption = cacheKeys
+
+	cacheClient, err := setupCache(ctx, cacheOpts{
+		Type:             config.CacheType,
+		MemcachedServers: config.MemcachedServers,
+		Redis:            redisConfig,
+		LocalCapacity:    config.CacheLocalCapacity,
+		LocalTTL:         config.CacheLocalTTL,
+		TierLocalTTL:     config.CacheTierLocalTTL,
+		StaleTTL:         config.CacheStaleTTL,
+		Encryption:       cacheKeys,
+		Registerer:       promRegisterer,
+	}, &zl)
 	if err != nil {
 		return err
 	}
 
+	if config.StateFile != "" && !standalone && !isSharedCache(cacheClient) {
+		// Tenant credentials are not saved in the state file.
+		zl.Warn().
+			Str("state_file", config.StateFile).
+			Msg("the tenant cache is not shared, after a restart the results of restored checks are only published once the API can be reached")
+	}
+
 	// to know if probe is connected to API
 	readynessHandler := NewReadynessHandler()
 
@@ -302,14 +488,6 @@ func run(args []string, stdout io.Writer) error {
 		return httpServer.Run(httpListener)
 	})
 
-	tenantCh := make(chan synthetic_monitoring.Tenant)
-
-	conn, err := newAPIServerClient(config.GrpcApiServerAddr, config.GrpcInsecure, string(config.ApiToken))
-	if err != nil {
-		return fmt.Errorf("dialing GRPC server %s: %w", config.GrpcApiServerAddr, err)
-	}
-	defer conn.Close()
-
 	var k6Runner k6runner.Runner
 
 	if features.IsSet(feature.K6) {
@@ -328,116 +506,322 @@ func run(args []string, stdout io.Writer) error {
 		}
 	}
 
-	tm := tenants.NewManager(
-		ctx,
-		synthetic_monitoring.NewTenantsClient(conn),
-		tenantCh,
-		tenants.DefaultCacheTimeout,
-		cacheClient,
-		zl.With().Str("subsystem", "tenant_manager").Logger(),
-	)
-
 	pusherRegistry := pusher.NewRegistry[pusher.Factory]()
 	pusherRegistry.MustRegister(pusherV1.Name, pusherV1.NewPublisher)
-	pusherRegistry.MustRegister(pusherV2.Name, pusherV2.NewPublisher)
+
+	// The remote-write 2.0 publisher falls back to 1.0 for remotes that
+	// don't support it, so it can replace the regular v2 publisher.
+	v2Factory := pusher.Factory(pusherV2.NewPublisher)
+	if features.IsSet(feature.RemoteWriteV2) {
+		v2Factory = pusherV2.NewRemoteWriteV2Publisher
+	}
+
+	pusherRegistry.MustRegister(pusherV2.Name, v2Factory)
 
 	publisherFactory, err := pusherRegistry.Lookup(config.SelectedPublisher)
 	if err != nil {
 		return fmt.Errorf("creating publisher: %w", err)
 	}
 
-	publisher := publisherFactory(ctx, tm, zl.With().Str("subsystem", "publisher").Str("version", config.SelectedPublisher).Logger(), promRegisterer)
-	limits := limits.NewTenantLimits(tm)
-	secretProvider := secrets.NewSecretProvider(tm, 60*time.Second, zl.With().Str("subsystem", "secretstore").Logger())
-	cals := cals.NewCostAttributionLabels(tm)
-
-	telemetry := telemetry.NewTelemeter(
-		ctx, uuid.New().String(), time.Duration(config.TelemetryTimeSpan)*time.Minute,
-		synthetic_monitoring.NewTelemetryClient(conn),
-		zl.With().Str("subsystem", "telemetry").Logger(),
-		promRegisterer,
-	)
+	checkPolicies := scraper.CheckPolicies{
+		Logs: scraper.LogPolicy{
+			Emission:        config.CheckLogs,
+			SuccessInterval: config.CheckLogsInterval,
+		},
+		Retry: scraper.RetryPolicy{
+			MaxAttempts: config.CheckRetryAttempts,
+			Delay:       config.CheckRetryDelay,
+			Classes:     config.CheckRetryOn,
+		},
+	}
 
-	probeCh := make(chan *synthetic_monitoring.Probe, 1)
-
-	checksUpdater, err := checks.NewUpdater(checks.UpdaterOptions{
-		Conn:                    conn,
-		Logger:                  zl.With().Str("subsystem", "updater").Logger(),
-		Backoff:                 newConnectionBackoff(),
-		Publisher:               publisher,
-		TenantCh:                tenantCh,
-		ProbeCh:                 probeCh,
-		IsConnected:             readynessHandler.Set,
-		PromRegisterer:          promRegisterer,
-		Features:                features,
-		K6Runner:                k6Runner,
-		ScraperFactory:          scraper.New,
-		TenantLimits:            limits,
-		SecretProvider:          secretProvider,
-		Telemeter:               telemetry,
-		UsageReporter:           usageReporter,
-		CostAttributionLabels:   cals,
-		LabellingMode:           labelmode.New(tm),
-		SupportsProtocolSecrets: config.EnableProtocolSecrets,
-	})
-	if err != nil {
-		return fmt.Errorf("cannot create checks updater: %w", err)
+	if config.CheckPoliciesFile != "" {
+		checkPolicies.Rules, err = scraper.ReadPolicyRules(config.CheckPoliciesFile)
+		if err != nil {
+			return fmt.Errorf("reading check policies: %w", err)
+		}
 	}
 
-	g.Go(func() error {
-		return checksUpdater.Run(ctx)
-	})
+	scraperFactory := scraper.NewFactory(checkPolicies, config.CheckHistorySize)
 
-	adhocHandler, err := adhoc.NewHandler(adhoc.HandlerOpts{
-		Conn:                    conn,
-		Logger:                  zl.With().Str("subsystem", "adhoc").Logger(),
-		Backoff:                 newConnectionBackoff(),
-		Publisher:               publisher,
-		TenantCh:                tenantCh,
-		PromRegisterer:          promRegisterer,
-		Features:                features,
-		K6Runner:                k6Runner,
-		SecretProvider:          secretProvider,
-		SupportsProtocolSecrets: config.EnableProtocolSecrets,
-	})
-	if err != nil {
-		return fmt.Errorf("cannot create ad-hoc checks handler: %w", err)
+	telemetryInstance := uuid.New().String()
+
+	// The ledger is not closed: the region pushers record their last
+	// push while the agent stops.
+	var ledger *telemetry.Ledger
+
+	if config.TelemetryLedger != "" {
+		ledger, err = telemetry.OpenLedger(config.TelemetryLedger)
+		if err != nil {
+			return fmt.Errorf("opening telemetry ledger: %w", err)
+		}
 	}
 
-	g.Go(func() error {
-		return adhocHandler.Run(ctx)
-	})
+	// Without -api-connection, there's a single unnamed connection,
+	// configured with -api-server-address and -api-token. In standalone
+	// mode, it has no address.
+	connections := config.APIConnections
+	if !multiAPI {
+		connections = apiConnections{{Address: config.GrpcApiServerAddr, Token: config.ApiToken, Insecure: config.GrpcInsecure}}
+	}
 
-	if config.PushTelemetry {
-		g.Go(func() error {
-			metricsHandler := metamonitoring.NewHandler(metamonitoring.HandlerOpts{
-				Logger:    zl.With().Str("subsystem", "metamonitoring").Logger(),
-				Registry:  promRegisterer,
-				Publisher: publisher,
-				Interval:  config.MetricsInterval,
-				ProbeCh:   probeCh,
-			})
+	var (
+		readiness       = newReadinessGroup(readynessHandler, len(connections))
+		connChecks      = make(checksGroup, 0, len(connections))
+		connDiagnostics = make([]diagnosticsConnection, 0, len(connections))
+		connTelemetry   = make([]connectionTelemetry, 0, len(connections))
+		drain           = &drainer{
+			timeout:  cmp.Or(config.DrainTimeout, defaultDrainTimeout),
+			handover: config.DrainHandover,
+			ready:    readynessHandler,
+			logger:   zl.With().Str("subsystem", "drain").Logger(),
+		}
+	)
+
+	// Each connection has its own tenants, publisher and checks, as
+	// those belong to a stack. The k6 runner, the cache and the HTTP
+	// server are shared. The metrics and logs of named connections are
+	// labelled with their name, and so are their keys in the shared
+	// cache and their state files.
+	for i, api := range connections {
+		var (
+			logger          = zl
+			registerer      = prometheus.Registerer(promRegisterer)
+			gatherer        = prometheus.Gatherer(promRegisterer)
+			tenantCache     = cacheClient
+			stateFile       = config.StateFile
+			tenantCh        = make(chan synthetic_monitoring.Tenant)
+			probeCh         = make(chan *synthetic_monitoring.Probe, 1)
+			conn            *grpc.ClientConn
+			localSource     *checks.LocalSource
+			tenantsClient   synthetic_monitoring.TenantsClient
+			telemetryClient synthetic_monitoring.TelemetryClient
+		)
+
+		if api.Name != "" {
+			logger = zl.With().Str("connection", api.Name).Logger()
+			// Metamonitoring publishes the metrics of this
+			// connection and those of the process only, so they
+			// are gathered from a registry of their own as well.
+			connRegistry := prometheus.NewRegistry()
+			if err := registerMetrics(connRegistry); err != nil {
+				return err
+			}
+
+			registerer = prometheus.WrapRegistererWith(
+				prometheus.Labels{"connection": api.Name},
+				teeRegisterer{promRegisterer, connRegistry},
+			)
+			gatherer = connRegistry
+			tenantCache = cache.NewPrefixed(cacheClient, api.Name+":")
+			stateFile = connectionStateFile(config.StateFile, api.Name)
+		}
 
-			return metricsHandler.Run(ctx)
+		if standalone {
+			// In standalone mode there's no connection to the API.
+			// Tenants come from the checks file, and telemetry is
+			// discarded.
+			localSource = checks.NewLocalSource(config.ChecksFile, config.ChecksFileInterval)
+			tenantsClient = localSource
+			telemetryClient = discardTelemetryClient{}
+
+			logger.Info().Str("checks_file", config.ChecksFile).Msg("running in standalone mode")
+		} else {
+			conn, err = newAPIServerClient(api.Address, api.Insecure, string(api.Token))
+			if err != nil {
+				return fmt.Errorf("dialing GRPC server %s: %w", api.Address, err)
+			}
+			defer conn.Close()
+
+			tenantsClient = synthetic_monitoring.NewTenantsClient(conn)
+			telemetryClient = synthetic_monitoring.NewTelemetryClient(conn)
+		}
+
+		tm := tenants.NewManagerWithOpts(ctx, tenants.ManagerOpts{
+			TenantsClient:    tenantsClient,
+			TenantCh:         tenantCh,
+			Timeout:          tenants.DefaultCacheTimeout,
+			RefreshAhead:     config.TenantRefreshAhead,
+			StaleGracePeriod: config.TenantStaleGrace,
+			Cache:            tenantCache,
+			Registerer:       registerer,
+			Logger:           logger.With().Str("subsystem", "tenant_manager").Logger(),
+		})
+
+		publisher := publisherFactory(ctx, tm, logger.With().Str("subsystem", "publisher").Str("version", config.SelectedPublisher).Logger(), registerer)
+		limits := limits.NewTenantLimits(tm.Settings())
+		secretProvider, err := newSecretProvider(secretsConfig{
+			Backends:        config.SecretsBackends,
+			Tenants:         config.SecretsTenants,
+			Dir:             config.SecretsDir,
+			EnvPrefix:       config.SecretsEnvPrefix,
+			ProtocolSecrets: config.EnableProtocolSecrets,
+			Vault: secrets.VaultOpts{
+				Address:   config.SecretsVaultAddr,
+				Namespace: config.SecretsVaultNamespace,
+				Mount:     config.SecretsVaultMount,
+				Path:      config.SecretsVaultPath,
+				Field:     config.SecretsVaultField,
+				Token:     string(config.SecretsVaultToken),
+				RoleID:    config.SecretsVaultRoleID,
+				SecretID:  string(config.SecretsVaultSecretID),
+			},
+		}, tm, logger.With().Str("subsystem", "secretstore").Logger())
+		if err != nil {
+			return fmt.Errorf("creating secret provider: %w", err)
+		}
+
+		cals := cals.NewCostAttributionLabels(tm.Settings())
+
+		var pusherOpts []telemetry.RegionPusherOption
+		if ledger != nil {
+			pusherOpts = append(pusherOpts, telemetry.WithLedger(ledger.ForConnection(api.Name)))
+		}
+
+		telemeter := telemetry.NewTelemeter(
+			ctx, telemetryInstance, time.Duration(config.TelemetryTimeSpan)*time.Minute,
+			telemetryClient,
+			logger.With().Str("subsystem", "telemetry").Logger(),
+			registerer,
+			pusherOpts...,
+		)
+
+		checksUpdater, err := checks.NewUpdater(checks.UpdaterOptions{
+			Conn:                    conn,
+			Logger:                  logger.With().Str("subsystem", "updater").Logger(),
+			Backoff:                 newConnectionBackoff(),
+			Publisher:               publisher,
+			TenantCh:                tenantCh,
+			ProbeCh:                 probeCh,
+			IsConnected:             readiness.Setter(i),
+			PromRegisterer:          registerer,
+			Features:                features,
+			K6Runner:                k6Runner,
+			ScraperFactory:          scraperFactory,
+			TenantLimits:            limits,
+			SecretProvider:          secretProvider,
+			Telemeter:               telemeter,
+			UsageReporter:           usageReporter,
+			CostAttributionLabels:   cals,
+			LabellingMode:           labelmode.New(tm.Settings()),
+			SupportsProtocolSecrets: config.EnableProtocolSecrets,
+			LocalSource:             localSource,
+			StateFile:               stateFile,
+			StateMaxStaleness:       config.StateMaxStaleness,
+			TenantRestorer:          tm,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot create checks updater: %w", err)
+		}
+
+		connChecks = append(connChecks, checksUpdater)
+		connTelemetry = append(connTelemetry, connectionTelemetry{Name: api.Name, Reporter: telemeter})
+		connDiagnostics = append(connDiagnostics, diagnosticsConnection{
+			Name:    api.Name,
+			Address: api.Address,
+			Conn:    conn,
+			Checks:  checksUpdater,
+			Tenants: tm,
 		})
-	}
 
-	if k6Runner != nil {
-		k6VersionsLogger := zl.With().Str("subsystem", "k6versions").Logger()
+		drain.checks = append(drain.checks, checksUpdater)
+		drain.publishers = append(drain.publishers, publisher)
 
-		k6VersionsHandler, err := k6version.NewHandler(
-			k6version.HandlerOpts{
-				Logger:   &k6VersionsLogger,
-				K6Runner: k6Runner,
-				K6Client: synthetic_monitoring.NewK6Client(conn),
+		g.Go(func() error {
+			return checksUpdater.Run(ctx)
+		})
+
+		if config.PushTelemetry {
+			g.Go(func() error {
+				metricsHandler := metamonitoring.NewHandler(metamonitoring.HandlerOpts{
+					Logger:    logger.With().Str("subsystem", "metamonitoring").Logger(),
+					Registry:  gatherer,
+					Publisher: publisher,
+					Interval:  config.MetricsInterval,
+					ProbeCh:   probeCh,
+				})
+
+				return metricsHandler.Run(ctx)
 			})
+		}
+
+		if standalone {
+			// Ad-hoc checks and k6 version reporting require the API.
+			continue
+		}
+
+		adhocHandler, err := adhoc.NewHandler(adhoc.HandlerOpts{
+			Conn:                    conn,
+			Logger:                  logger.With().Str("subsystem", "adhoc").Logger(),
+			Backoff:                 newConnectionBackoff(),
+			Publisher:               publisher,
+			TenantCh:                tenantCh,
+			PromRegisterer:          registerer,
+			Features:                features,
+			K6Runner:                k6Runner,
+			SecretProvider:          secretProvider,
+			SupportsProtocolSecrets: config.EnableProtocolSecrets,
+			Consensus: adhoc.ConsensusOpts{
+				Runs:      config.AdHocRuns,
+				Spacing:   config.AdHocRunSpacing,
+				SourceIPs: config.AdHocSourceIPs,
+			},
+		})
 		if err != nil {
-			return fmt.Errorf("cannot create k6versions handler: %w", err)
+			return fmt.Errorf("cannot create ad-hoc checks handler: %w", err)
 		}
 
+		drain.adhoc = append(drain.adhoc, adhocHandler)
+
 		g.Go(func() error {
-			return k6VersionsHandler.Handle(ctx)
+			return adhocHandler.Run(ctx)
 		})
+
+		if k6Runner != nil {
+			k6VersionsLogger := logger.With().Str("subsystem", "k6versions").Logger()
+
+			k6VersionsHandler, err := k6version.NewHandler(
+				k6version.HandlerOpts{
+					Logger:   &k6VersionsLogger,
+					K6Runner: k6Runner,
+					K6Client: synthetic_monitoring.NewK6Client(conn),
+				})
+			if err != nil {
+				return fmt.Errorf("cannot create k6versions handler: %w", err)
+			}
+
+			g.Go(func() error {
+				return k6VersionsHandler.Handle(ctx)
+			})
+		}
+	}
+
+	activeDrainer.Store(drain)
+
+	if config.EnableDrain {
+		router.Handle("/drain", drainHandler(drain))
+	}
+
+	if config.EnableOperatorAPI {
+		operatorAPI := newOperatorAPIHandler(
+			connChecks,
+			&diagnostics{
+				Config:       config,
+				Features:     features,
+				K6URI:        config.K6URI,
+				K6Repository: config.K6Repository,
+				Connections:  connDiagnostics,
+				CacheType:    config.CacheType,
+				Cache:        cacheClient,
+				ErrorLogs:    errorLogs,
+			},
+			connTelemetry,
+			string(config.OperatorAPIToken),
+			zl.With().Str("subsystem", "operator_api").Logger(),
+		)
+
+		router.Handle("/api/v1/", operatorAPI)
+		router.Handle("/status", operatorAPI)
 	}
 
 	return g.Wait()
@@ -450,14 +834,22 @@ func main() {
 	}
 }
 
-func signalHandler(ctx context.Context, logger zerolog.Logger) error {
+// signalHandler waits for a signal to stop the agent, and returns an error
+// to stop it. If onSignal is not nil, it's called before returning.
+func signalHandler(ctx context.Context, logger zerolog.Logger, onSignal func()) error {
 	sigCh := make(chan os.Signal, 1)
 
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	select {
 	case sig := <-sigCh:
+		if onSignal != nil {
+			logger.Info().Str("signal", sig.String()).Msg("draining before shutting down")
+			onSignal()
+		}
+
 		logger.Info().Str("signal", sig.String()).Msg("shutting down")
+
 		return fmt.Errorf("got signal %s", sig)
 
 	case <-ctx.Done():
@@ -518,50 +910,58 @@ func setupGoMemLimit(ratio float64) error {
 	return nil
 }
 
-func setupCache(ctx context.Context, cacheType cache.Kind, memcachedServers []string, localCapacity int, localTTL time.Duration, logger *zerolog.Logger) (cache.Cache, error) {
+// cacheOpts holds the settings used to create the cache client.
+type cacheOpts struct {
+	Type             cache.Kind
+	MemcachedServers []string
+	Redis            cache.RedisConfig
+	LocalCapacity    int
+	LocalTTL         time.Duration
+	TierLocalTTL     time.Duration
+	StaleTTL         time.Duration
+	Encryption       *cache.Keyring
+	Registerer       prometheus.Registerer
+}
+
+func setupCache(ctx context.Context, opts cacheOpts, logger *zerolog.Logger) (cache.Cache, error) {
 	// Determine effective cache type with auto mode logic:
-	// auto + servers provided -> memcached -> local -> noop
+	// auto + memcached servers provided -> memcached -> local -> noop
+	// auto + redis servers provided -> redis -> local -> noop
 	// auto + no servers -> local -> noop
-	effectiveType := cacheType
-	if cacheType == cache.KindAuto {
-		if len(memcachedServers) > 0 {
+	effectiveType := opts.Type
+	if opts.Type == cache.KindAuto {
+		switch {
+		case len(opts.MemcachedServers) > 0:
 			effectiveType = cache.KindMemcached
-		} else {
+		case len(opts.Redis.Addresses) > 0:
+			effectiveType = cache.KindRedis
+		default:
 			effectiveType = cache.KindLocal
 		}
 	}
 
 	switch effectiveType {
 	case cache.KindMemcached:
-		if len(memcachedServers) == 0 {
+		if len(opts.MemcachedServers) == 0 {
 			logger.Warn().Msg("memcached type selected but no servers configured, falling back to local cache")
-			return setupLocalCache(localCapacity, localTTL, logger), nil
+			return setupLocalCache(opts.LocalCapacity, opts.LocalTTL, logger), nil
 		}
 
-		cacheConfig := cache.MemcachedConfig{
-			Servers: memcachedServers,
-			Logger:  logger.With().Str("subsystem", "cache").Logger(),
-			Timeout: 100 * time.Millisecond,
-		}
-
-		cacheClient, err := cache.NewMemcachedClient(ctx, cacheConfig)
-		if err != nil {
-			logger.Warn().
-				Err(err).
-				Strs("servers", memcachedServers).
-				Msg("failed to initialize memcached cache")
+		return setupMemcachedCache(ctx, opts.MemcachedServers, opts.Encryption, logger)
 
-			return nil, fmt.Errorf("failed to initialize memcached client: %w", err)
+	case cache.KindRedis:
+		if len(opts.Redis.Addresses) == 0 {
+			logger.Warn().Msg("redis type selected but no servers configured, falling back to local cache")
+			return setupLocalCache(opts.LocalCapacity, opts.LocalTTL, logger), nil
 		}
 
-		logger.Info().
-			Strs("servers", memcachedServers).
-			Msg("memcached cache initialized")
+		return setupRedisCache(opts.Redis, logger)
 
-		return cacheClient, nil
+	case cache.KindTiered:
+		return setupTieredCache(ctx, opts, logger)
 
 	case cache.KindLocal:
-		return setupLocalCache(localCapacity, localTTL, logger), nil
+		return setupLocalCache(opts.LocalCapacity, opts.LocalTTL, logger), nil
 
 	case cache.KindNoop:
 		logger.Debug().Msg("noop cache selected")
@@ -572,8 +972,106 @@ func setupCache(ctx context.Context, cacheType cache.Kind, memcachedServers []st
 			Stringer("type", effectiveType).
 			Msg("unknown cache type, falling back to local cache")
 
-		return setupLocalCache(localCapacity, localTTL, logger), nil
+		return setupLocalCache(opts.LocalCapacity, opts.LocalTTL, logger), nil
+	}
+}
+
+func setupMemcachedCache(ctx context.Context, servers []string, encryption *cache.Keyring, logger *zerolog.Logger) (*cache.MemcachedClient, error) {
+	cacheConfig := cache.MemcachedConfig{
+		Servers:    servers,
+		Logger:     logger.With().Str("subsystem", "cache").Logger(),
+		Timeout:    100 * time.Millisecond,
+		Encryption: encryption,
 	}
+
+	cacheClient, err := cache.NewMemcachedClient(ctx, cacheConfig)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Strs("servers", servers).
+			Msg("failed to initialize memcached cache")
+
+		return nil, fmt.Errorf("failed to initialize memcached client: %w", err)
+	}
+
+	logger.Info().
+		Strs("servers", servers).
+		Bool("encrypted", encryption != nil).
+		Msg("memcached cache initialized")
+
+	return cacheClient, nil
+}
+
+func setupRedisCache(redisConfig cache.RedisConfig, logger *zerolog.Logger) (*cache.RedisClient, error) {
+	cacheClient, err := cache.NewRedisClient(redisConfig)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Strs("servers", redisConfig.Addresses).
+			Msg("failed to initialize redis cache")
+
+		return nil, fmt.Errorf("failed to initialize redis client: %w", err)
+	}
+
+	logger.Info().
+		Strs("servers", redisConfig.Addresses).
+		Stringer("mode", redisConfig.Mode).
+		Bool("encrypted", redisConfig.Encryption != nil).
+		Msg("redis cache initialized")
+
+	return cacheClient, nil
+}
+
+// setupTieredCache puts a local cache in front of memcached, or redis if no
+// memcached servers are configured.
+func setupTieredCache(ctx context.Context, opts cacheOpts, logger *zerolog.Logger) (cache.Cache, error) {
+	var remote cache.Cache
+
+	switch {
+	case len(opts.MemcachedServers) > 0:
+		client, err := setupMemcachedCache(ctx, opts.MemcachedServers, opts.Encryption, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		remote = client
+
+	case len(opts.Redis.Addresses) > 0:
+		client, err := setupRedisCache(opts.Redis, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		remote = client
+
+	default:
+		logger.Warn().Msg("tiered type selected but no servers configured, falling back to local cache")
+		return setupLocalCache(opts.LocalCapacity, opts.LocalTTL, logger), nil
+	}
+
+	local, err := cache.NewLocal(cache.LocalConfig{
+		MaxCapacity:     opts.LocalCapacity,
+		InitialCapacity: opts.LocalCapacity / 10,
+		DefaultTTL:      opts.TierLocalTTL + opts.StaleTTL,
+		Logger:          logger.With().Str("subsystem", "cache").Logger(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize local cache tier: %w", err)
+	}
+
+	tiered, err := cache.NewTiered(cache.TieredConfig{
+		Local:      local,
+		Remote:     remote,
+		LocalTTL:   opts.TierLocalTTL,
+		StaleTTL:   opts.StaleTTL,
+		Registerer: opts.Registerer,
+		Logger:     logger.With().Str("subsystem", "cache").Logger(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tiered cache: %w", err)
+	}
+
+	return tiered, nil
 }
 
 func setupLocalCache(capacity int, ttl time.Duration, logger *zerolog.Logger) cache.Cache {
@@ -20,3 +20,41 @@ func registerMetrics(r prometheus.Registerer) error {
 
 	return nil
 }
+
+// teeRegisterer registers collectors with all of its registerers, so that
+// the same metrics can be gathered from each of them.
+type teeRegisterer []prometheus.Registerer
+
+func (t teeRegisterer) Register(c prometheus.Collector) error {
+	for i, r := range t {
+		if err := r.Register(c); err != nil {
+			for _, prev := range t[:i] {
+				prev.Unregister(c)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t teeRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := t.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (t teeRegisterer) Unregister(c prometheus.Collector) bool {
+	unregistered := true
+
+	for _, r := range t {
+		if !r.Unregister(c) {
+			unregistered = false
+		}
+	}
+
+	return unregistered
+}
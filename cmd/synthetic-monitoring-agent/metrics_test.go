@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeeRegisterer(t *testing.T) {
+	all := prometheus.NewRegistry()
+	production := prometheus.NewRegistry()
+	staging := prometheus.NewRegistry()
+
+	newCounter := func(connection string, r *prometheus.Registry) prometheus.Counter {
+		c := prometheus.NewCounter(prometheus.CounterOpts{Name: "sm_agent_test_total", Help: "test"})
+		prometheus.WrapRegistererWith(prometheus.Labels{"connection": connection}, teeRegisterer{all, r}).MustRegister(c)
+
+		return c
+	}
+
+	newCounter("production", production).Inc()
+	newCounter("staging", staging).Add(2)
+
+	count, err := testutil.GatherAndCount(all, "sm_agent_test_total")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// Each connection's registry only has its own metrics.
+	mfs, err := production.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 1)
+	require.Len(t, mfs[0].GetMetric(), 1)
+	require.Equal(t, "production", mfs[0].GetMetric()[0].GetLabel()[0].GetValue())
+	require.Equal(t, 1.0, mfs[0].GetMetric()[0].GetCounter().GetValue())
+
+	// A registration rejected by one registerer is undone in the others.
+	dup := prometheus.NewCounter(prometheus.CounterOpts{Name: "sm_agent_dup_total", Help: "test"})
+	require.NoError(t, staging.Register(dup))
+	require.Error(t, teeRegisterer{all, staging}.Register(dup))
+
+	count, err = testutil.GatherAndCount(all, "sm_agent_dup_total")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/checks"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+	"github.com/grafana/synthetic-monitoring-agent/internal/telemetry"
+)
+
+// checksInspector provides the status of the checks run by the agent.
+type checksInspector interface {
+	Checks() []scraper.Status
+	Check(id model.GlobalID) (scraper.Status, bool)
+}
+
+// checkRunner runs checks on demand.
+type checkRunner interface {
+	RunCheck(ctx context.Context, id model.GlobalID, publish bool) (scraper.Execution, error)
+}
+
+// telemetryReporter reports the telemetry accumulated for an API
+// connection.
+type telemetryReporter interface {
+	Report() telemetry.Report
+}
+
+// connectionTelemetry is the telemetry of an API connection, identified by
+// its name, which is empty without -api-connection.
+type connectionTelemetry struct {
+	Name     string
+	Reporter telemetryReporter
+}
+
+// operatorChecks is what the operator API needs from the checks updater.
+type operatorChecks interface {
+	checksInspector
+	checkRunner
+}
+
+// operatorAPI serves JSON endpoints describing what the agent is doing,
+// meant for the people operating it:
+//
+//	GET  /api/v1/checks           lists the running checks
+//	GET  /api/v1/checks/{id}      describes a check, including the logs
+//	                              and series of its last execution
+//	GET  /api/v1/checks/{id}/history
+//	                              lists the latest executions of a check,
+//	                              oldest first
+//	POST /api/v1/checks/{id}/run  runs a check right away and returns the
+//	                              logs and series, publishing them only
+//	                              with ?publish=true
+//	GET  /api/v1/diagnose         returns a diagnostics bundle, see
+//	                              diagnostics
+//	GET  /api/v1/telemetry        returns the telemetry accumulated for
+//	                              each API connection since the agent
+//	                              started, as pushed to the API
+//	GET  /status                  summarises the checks as a plain text
+//	                              table, see statusPage
+//
+// Checks are identified by their global ID. Running checks is only allowed
+// when a token is configured.
+type operatorAPI struct {
+	checks      operatorChecks
+	diagnostics *diagnostics
+	telemetry   []connectionTelemetry
+	token       string
+	logger      zerolog.Logger
+}
+
+// newOperatorAPIHandler returns the handler for the operator API. If token
+// is not empty, requests must carry it as a bearer token. The diagnose
+// endpoint is only available if diag is not nil, and the telemetry one if
+// tele is not nil.
+func newOperatorAPIHandler(updater operatorChecks, diag *diagnostics, tele []connectionTelemetry, token string, logger zerolog.Logger) http.Handler {
+	api := &operatorAPI{checks: updater, diagnostics: diag, telemetry: tele, token: token, logger: logger}
+
+	router := http.NewServeMux()
+	router.HandleFunc("GET /api/v1/checks", api.listChecks)
+	router.HandleFunc("GET /api/v1/checks/{id}", api.getCheck)
+	router.HandleFunc("GET /api/v1/checks/{id}/history", api.checkHistory)
+	router.HandleFunc("POST /api/v1/checks/{id}/run", api.runCheck)
+
+	if diag != nil {
+		router.HandleFunc("GET /api/v1/diagnose", api.diagnose)
+	}
+
+	if tele != nil {
+		router.HandleFunc("GET /api/v1/telemetry", api.telemetryReport)
+	}
+
+	router.HandleFunc("GET /status", api.statusPage)
+
+	return api.authenticate(router)
+}
+
+func (api *operatorAPI) authenticate(next http.Handler) http.Handler {
+	if api.token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (api *operatorAPI) listChecks(w http.ResponseWriter, r *http.Request) {
+	statuses := api.checks.Checks()
+
+	resp := struct {
+		Checks []checkSummary `json:"checks"`
+	}{
+		Checks: make([]checkSummary, 0, len(statuses)),
+	}
+
+	for _, status := range statuses {
+		resp.Checks = append(resp.Checks, newCheckSummary(status))
+	}
+
+	api.writeJSON(w, resp)
+}
+
+func (api *operatorAPI) getCheck(w http.ResponseWriter, r *http.Request) {
+	id, ok := checkIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	status, found := api.checks.Check(id)
+	if !found {
+		http.Error(w, "check not found", http.StatusNotFound)
+		return
+	}
+
+	resp := checkDetail{checkSummary: newCheckSummary(status)}
+	if status.LastExecution != nil {
+		resp.LastExecution = newExecutionDetail(status.LastExecution)
+	}
+
+	api.writeJSON(w, resp)
+}
+
+func (api *operatorAPI) checkHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := checkIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	status, found := api.checks.Check(id)
+	if !found {
+		http.Error(w, "check not found", http.StatusNotFound)
+		return
+	}
+
+	resp := struct {
+		History []historyEntry `json:"history"`
+	}{
+		History: make([]historyEntry, 0, len(status.History)),
+	}
+
+	for _, entry := range status.History {
+		resp.History = append(resp.History, historyEntry{
+			Time:         entry.Time,
+			Duration:     entry.Duration.String(),
+			Result:       string(entry.Result),
+			FailureClass: string(entry.FailureClass),
+			Error:        entry.Error,
+			ExecutionID:  entry.ExecutionID,
+			Logs:         entry.Logs,
+		})
+	}
+
+	api.writeJSON(w, resp)
+}
+
+func (api *operatorAPI) runCheck(w http.ResponseWriter, r *http.Request) {
+	if api.token == "" {
+		http.Error(w, "running checks requires an operator API token", http.StatusForbidden)
+		return
+	}
+
+	id, ok := checkIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	publish, err := strconv.ParseBool(cmp.Or(r.URL.Query().Get("publish"), "false"))
+	if err != nil {
+		http.Error(w, "invalid publish parameter", http.StatusBadRequest)
+		return
+	}
+
+	exec, err := api.checks.RunCheck(r.Context(), id, publish)
+
+	switch {
+	case errors.Is(err, checks.ErrCheckNotFound):
+		http.Error(w, "check not found", http.StatusNotFound)
+		return
+
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.writeJSON(w, newExecutionDetail(&exec))
+}
+
+func (api *operatorAPI) diagnose(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+diagnoseFilename(time.Now())+`"`)
+
+	// The headers are already sent by the time this fails, the client
+	// gets a truncated bundle.
+	if err := api.diagnostics.Write(r.Context(), w); err != nil {
+		api.logger.Warn().Err(err).Msg("writing diagnostics bundle")
+	}
+}
+
+// telemetryReport describes the executions accounted for by the agent, for
+// each connection, region, tenant, check class and combination of cost
+// attribution labels. The counters are totals since the agent started;
+// -telemetry-ledger records what each push to the API added.
+func (api *operatorAPI) telemetryReport(w http.ResponseWriter, _ *http.Request) {
+	type connectionReport struct {
+		Name string `json:"name,omitempty"`
+		telemetry.Report
+	}
+
+	resp := struct {
+		Connections []connectionReport `json:"connections"`
+	}{
+		Connections: make([]connectionReport, 0, len(api.telemetry)),
+	}
+
+	for _, conn := range api.telemetry {
+		resp.Connections = append(resp.Connections, connectionReport{
+			Name:   conn.Name,
+			Report: conn.Reporter.Report(),
+		})
+	}
+
+	api.writeJSON(w, resp)
+}
+
+// checkIDFromPath returns the check ID in the request path, replying with
+// an error if it's not valid.
+func checkIDFromPath(w http.ResponseWriter, r *http.Request) (model.GlobalID, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid check ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return model.GlobalID(id), true
+}
+
+func (api *operatorAPI) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		api.logger.Warn().Err(err).Msg("writing operator API response")
+	}
+}
+
+type checkSummary struct {
+	ID            int64      `json:"id"`
+	CheckID       int64      `json:"checkId"`
+	TenantID      int64      `json:"tenantId"`
+	RegionID      int        `json:"regionId"`
+	Type          string     `json:"type"`
+	Job           string     `json:"job"`
+	Target        string     `json:"target"`
+	Frequency     string     `json:"frequency"`
+	ConfigVersion string     `json:"configVersion"`
+	State         string     `json:"state"`
+	LastRun       *time.Time `json:"lastRun,omitempty"`
+	LastResult    string     `json:"lastResult,omitempty"`
+}
+
+func newCheckSummary(status scraper.Status) checkSummary {
+	summary := checkSummary{
+		ID:            int64(status.Check.GlobalID()),
+		CheckID:       status.Check.Id,
+		TenantID:      status.Check.TenantId,
+		RegionID:      status.Check.RegionId,
+		Type:          status.Check.Type().String(),
+		Job:           status.Check.Job,
+		Target:        status.Check.Target,
+		Frequency:     (time.Duration(status.Check.Frequency) * time.Millisecond).String(),
+		ConfigVersion: status.Check.ConfigVersion(),
+		State:         string(status.State),
+	}
+
+	if exec := status.LastExecution; exec != nil {
+		summary.LastRun = &exec.Time
+		summary.LastResult = string(exec.Result)
+	}
+
+	return summary
+}
+
+type checkDetail struct {
+	checkSummary
+
+	LastExecution *executionDetail `json:"lastExecution,omitempty"`
+}
+
+type executionDetail struct {
+	Time         time.Time     `json:"time"`
+	Duration     string        `json:"duration"`
+	Result       string        `json:"result"`
+	FailureClass string        `json:"failureClass,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	ExecutionID  string        `json:"executionId,omitempty"`
+	Logs         []logStream   `json:"logs"`
+	Series       []seriesValue `json:"series"`
+}
+
+type historyEntry struct {
+	Time         time.Time `json:"time"`
+	Duration     string    `json:"duration"`
+	Result       string    `json:"result"`
+	FailureClass string    `json:"failureClass,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ExecutionID  string    `json:"executionId,omitempty"`
+	Logs         string    `json:"logs,omitempty"`
+}
+
+type logStream struct {
+	Labels  string     `json:"labels"`
+	Entries []logEntry `json:"entries"`
+}
+
+type logEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Line      string    `json:"line"`
+}
+
+// seriesValue holds the samples of a series. Values are strings, like in
+// the Prometheus HTTP API, as JSON can't represent NaN or infinities.
+// Native histograms are not included.
+type seriesValue struct {
+	Labels  map[string]string `json:"labels"`
+	Samples []sampleValue     `json:"samples"`
+}
+
+type sampleValue struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     string    `json:"value"`
+}
+
+func newExecutionDetail(exec *scraper.Execution) *executionDetail {
+	detail := &executionDetail{
+		Time:         exec.Time,
+		Duration:     exec.Duration.String(),
+		Result:       string(exec.Result),
+		FailureClass: string(exec.FailureClass),
+		Error:        exec.Error,
+		ExecutionID:  exec.ExecutionID,
+		Logs:         make([]logStream, 0, len(exec.Streams)),
+		Series:       make([]seriesValue, 0, len(exec.Series)),
+	}
+
+	for _, stream := range exec.Streams {
+		s := logStream{Labels: stream.Labels, Entries: make([]logEntry, 0, len(stream.Entries))}
+
+		for _, entry := range stream.Entries {
+			s.Entries = append(s.Entries, logEntry{Timestamp: entry.Timestamp, Line: entry.Line})
+		}
+
+		detail.Logs = append(detail.Logs, s)
+	}
+
+	for _, ts := range exec.Series {
+		if len(ts.Samples) == 0 {
+			continue
+		}
+
+		s := seriesValue{
+			Labels:  make(map[string]string, len(ts.Labels)),
+			Samples: make([]sampleValue, 0, len(ts.Samples)),
+		}
+
+		for _, label := range ts.Labels {
+			s.Labels[label.Name] = label.Value
+		}
+
+		for _, sample := range ts.Samples {
+			s.Samples = append(s.Samples, sampleValue{
+				Timestamp: time.UnixMilli(sample.Timestamp).UTC(),
+				Value:     strconv.FormatFloat(sample.Value, 'g', -1, 64),
+			})
+		}
+
+		detail.Series = append(detail.Series, s)
+	}
+
+	return detail
+}
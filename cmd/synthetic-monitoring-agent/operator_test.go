@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	logproto "github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/checks"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+	"github.com/grafana/synthetic-monitoring-agent/internal/telemetry"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+type testOperatorChecks struct {
+	statuses  []scraper.Status
+	published []model.GlobalID
+}
+
+func (c *testOperatorChecks) Checks() []scraper.Status {
+	return c.statuses
+}
+
+func (c *testOperatorChecks) Check(id model.GlobalID) (scraper.Status, bool) {
+	for _, status := range c.statuses {
+		if status.Check.GlobalID() == id {
+			return status, true
+		}
+	}
+
+	return scraper.Status{}, false
+}
+
+func (c *testOperatorChecks) RunCheck(ctx context.Context, id model.GlobalID, publish bool) (scraper.Execution, error) {
+	status, found := c.Check(id)
+	if !found {
+		return scraper.Execution{}, checks.ErrCheckNotFound
+	}
+
+	if publish {
+		c.published = append(c.published, id)
+	}
+
+	return *status.LastExecution, nil
+}
+
+func TestOperatorAPI(t *testing.T) {
+	lastRun := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	updater := &testOperatorChecks{statuses: []scraper.Status{
+		{
+			Check: model.Check{Check: sm.Check{
+				Id:        1,
+				TenantId:  10,
+				Job:       "job",
+				Target:    "https://example.org",
+				Frequency: 60000,
+				Modified:  1,
+				Settings:  sm.CheckSettings{Http: &sm.HttpSettings{}},
+			}},
+			State: scraper.StatePassing,
+			LastExecution: &scraper.Execution{
+				Time:     lastRun,
+				Duration: 150 * time.Millisecond,
+				Result:   scraper.ResultSuccess,
+				Series: []prompb.TimeSeries{
+					{
+						Labels:  []prompb.Label{{Name: "__name__", Value: "probe_success"}},
+						Samples: []prompb.Sample{{Timestamp: lastRun.UnixMilli(), Value: 1}},
+					},
+					{
+						Labels:  []prompb.Label{{Name: "__name__", Value: "probe_http_ssl"}},
+						Samples: []prompb.Sample{{Timestamp: lastRun.UnixMilli(), Value: math.NaN()}},
+					},
+				},
+				Streams: []logproto.Stream{
+					{Labels: `{job="job"}`, Entries: []logproto.Entry{{Timestamp: lastRun, Line: "msg=done"}}},
+				},
+			},
+			History: []scraper.HistoryEntry{
+				{
+					Time:         lastRun.Add(-time.Minute),
+					Duration:     5 * time.Second,
+					Result:       scraper.ResultFailure,
+					FailureClass: scraper.FailureClassTimeout,
+					ExecutionID:  "exec-1",
+					Logs:         "msg=timeout",
+				},
+				{
+					Time:        lastRun,
+					Duration:    150 * time.Millisecond,
+					Result:      scraper.ResultSuccess,
+					ExecutionID: "exec-2",
+					Logs:        "msg=done",
+				},
+			},
+		},
+		{
+			Check: model.Check{Check: sm.Check{
+				Id:        2,
+				TenantId:  10,
+				Target:    "example.org",
+				Frequency: 10000,
+				Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+			}},
+			State: scraper.StateUnknown,
+		},
+	}}
+
+	do := func(t *testing.T, h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		return w
+	}
+
+	get := func(t *testing.T, h http.Handler, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		return do(t, h, http.MethodGet, path, token)
+	}
+
+	h := newOperatorAPIHandler(updater, nil, nil, "", zerolog.New(io.Discard))
+
+	t.Run("list", func(t *testing.T) {
+		w := get(t, h, "/api/v1/checks", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var resp struct {
+			Checks []checkSummary `json:"checks"`
+		}
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Checks, 2)
+
+		require.Equal(t, checkSummary{
+			ID:            1,
+			CheckID:       1,
+			TenantID:      10,
+			Type:          "http",
+			Job:           "job",
+			Target:        "https://example.org",
+			Frequency:     "1m0s",
+			ConfigVersion: updater.statuses[0].Check.ConfigVersion(),
+			State:         "passing",
+			LastRun:       &lastRun,
+			LastResult:    "success",
+		}, resp.Checks[0])
+
+		require.Equal(t, "ping", resp.Checks[1].Type)
+		require.Equal(t, "unknown", resp.Checks[1].State)
+		require.Nil(t, resp.Checks[1].LastRun)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		w := get(t, h, "/api/v1/checks/1", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp checkDetail
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, int64(1), resp.ID)
+		require.NotNil(t, resp.LastExecution)
+		require.Equal(t, "150ms", resp.LastExecution.Duration)
+		require.Equal(t, []logStream{
+			{Labels: `{job="job"}`, Entries: []logEntry{{Timestamp: lastRun, Line: "msg=done"}}},
+		}, resp.LastExecution.Logs)
+		require.Equal(t, []seriesValue{
+			{Labels: map[string]string{"__name__": "probe_success"}, Samples: []sampleValue{{Timestamp: lastRun, Value: "1"}}},
+			{Labels: map[string]string{"__name__": "probe_http_ssl"}, Samples: []sampleValue{{Timestamp: lastRun, Value: "NaN"}}},
+		}, resp.LastExecution.Series)
+
+		w = get(t, h, "/api/v1/checks/2", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotContains(t, w.Body.String(), "lastExecution")
+	})
+
+	t.Run("history", func(t *testing.T) {
+		w := get(t, h, "/api/v1/checks/1/history", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			History []historyEntry `json:"history"`
+		}
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, []historyEntry{
+			{
+				Time:         lastRun.Add(-time.Minute),
+				Duration:     "5s",
+				Result:       "failure",
+				FailureClass: "timeout",
+				ExecutionID:  "exec-1",
+				Logs:         "msg=timeout",
+			},
+			{
+				Time:        lastRun,
+				Duration:    "150ms",
+				Result:      "success",
+				ExecutionID: "exec-2",
+				Logs:        "msg=done",
+			},
+		}, resp.History)
+
+		w = get(t, h, "/api/v1/checks/2/history", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"history":[]}`, w.Body.String())
+
+		require.Equal(t, http.StatusNotFound, get(t, h, "/api/v1/checks/3/history", "").Code)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		w := get(t, h, "/status", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		require.Len(t, lines, 3)
+		require.Equal(t, []string{"ID", "TYPE", "JOB", "TARGET", "STATE", "RUNS", "SUCCESS", "P50", "P90", "P99", "LAST", "TIMELINE"}, strings.Fields(lines[0]))
+		require.Equal(t, []string{"1", "http", "job", "https://example.org", "passing", "2", "50.0%", "150ms", "5s", "5s", "success", "x."}, strings.Fields(lines[1]))
+		require.Equal(t, []string{"2", "ping", "example.org", "unknown", "0", "-", "-", "-", "-", "-"}, strings.Fields(lines[2]))
+
+		h := newOperatorAPIHandler(updater, nil, nil, "s3cr3t", zerolog.New(io.Discard))
+		require.Equal(t, http.StatusUnauthorized, get(t, h, "/status", "").Code)
+		require.Equal(t, http.StatusOK, get(t, h, "/status", "s3cr3t").Code)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, get(t, h, "/api/v1/checks/3", "").Code)
+		require.Equal(t, http.StatusBadRequest, get(t, h, "/api/v1/checks/abc", "").Code)
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/checks", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("token", func(t *testing.T) {
+		h := newOperatorAPIHandler(updater, nil, nil, "s3cr3t", zerolog.New(io.Discard))
+
+		w := get(t, h, "/api/v1/checks", "")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+		require.Equal(t, http.StatusUnauthorized, get(t, h, "/api/v1/checks", "wrong").Code)
+		require.Equal(t, http.StatusOK, get(t, h, "/api/v1/checks", "s3cr3t").Code)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		// Running checks requires a token.
+		require.Equal(t, http.StatusForbidden, do(t, h, http.MethodPost, "/api/v1/checks/1/run", "").Code)
+
+		h := newOperatorAPIHandler(updater, nil, nil, "s3cr3t", zerolog.New(io.Discard))
+
+		require.Equal(t, http.StatusUnauthorized, do(t, h, http.MethodPost, "/api/v1/checks/1/run", "").Code)
+		require.Equal(t, http.StatusNotFound, do(t, h, http.MethodPost, "/api/v1/checks/3/run", "s3cr3t").Code)
+		require.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/api/v1/checks/1/run?publish=maybe", "s3cr3t").Code)
+		require.Equal(t, http.StatusMethodNotAllowed, do(t, h, http.MethodGet, "/api/v1/checks/1/run", "s3cr3t").Code)
+
+		w := do(t, h, http.MethodPost, "/api/v1/checks/1/run", "s3cr3t")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp executionDetail
+
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, "success", resp.Result)
+		require.Len(t, resp.Series, 2)
+		require.Len(t, resp.Logs, 1)
+		require.Empty(t, updater.published)
+
+		w = do(t, h, http.MethodPost, "/api/v1/checks/1/run?publish=true", "s3cr3t")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, []model.GlobalID{1}, updater.published)
+	})
+}
+
+type testTelemetryReporter telemetry.Report
+
+func (r testTelemetryReporter) Report() telemetry.Report {
+	return telemetry.Report(r)
+}
+
+func TestOperatorAPITelemetry(t *testing.T) {
+	report := telemetry.Report{
+		Instance: "instance",
+		Regions: []telemetry.RegionReport{
+			{
+				RegionID: 1,
+				Tenants: []telemetry.TenantReport{
+					{
+						TenantID: 10,
+						Telemetry: []telemetry.ClassReport{
+							{CheckClass: "PROTOCOL", CostAttributionLabels: map[string]string{"team": "a"}, Executions: 3, Duration: 1.5, SampledExecutions: 3},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	h := newOperatorAPIHandler(&testOperatorChecks{}, nil, []connectionTelemetry{
+		{Reporter: testTelemetryReporter(report)},
+		{Name: "other", Reporter: testTelemetryReporter{Instance: "instance", Regions: []telemetry.RegionReport{}}},
+	}, "", zerolog.New(io.Discard))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/telemetry", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{
+		"connections": [
+			{
+				"instance": "instance",
+				"regions": [
+					{
+						"regionId": 1,
+						"tenants": [
+							{
+								"tenantId": 10,
+								"telemetry": [
+									{"checkClass": "PROTOCOL", "costAttributionLabels": {"team": "a"}, "executions": 3, "duration": 1.5, "sampledExecutions": 3}
+								]
+							}
+						]
+					}
+				]
+			},
+			{"name": "other", "instance": "instance", "regions": []}
+		]
+	}`, w.Body.String())
+
+	// Without telemetry, the endpoint is not available.
+	h = newOperatorAPIHandler(&testOperatorChecks{}, nil, nil, "", zerolog.New(io.Discard))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/telemetry", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSummarizeHistory(t *testing.T) {
+	require.Equal(t, historySummary{}, summarizeHistory(nil))
+
+	var history []scraper.HistoryEntry
+
+	for i := 1; i <= 10; i++ {
+		history = append(history, scraper.HistoryEntry{Duration: time.Duration(i) * time.Second, Result: scraper.ResultSuccess})
+	}
+
+	history[2].Result = scraper.ResultFailure
+	history[9] = scraper.HistoryEntry{Result: scraper.ResultError}
+
+	require.Equal(t, historySummary{
+		Executions: 10,
+		Successes:  8,
+		Measured:   9,
+		P50:        5 * time.Second,
+		P90:        9 * time.Second,
+		P99:        9 * time.Second,
+		Timeline:   "..x......!",
+	}, summarizeHistory(history))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
+)
+
+// secretCacheTTL is how long secret values obtained from remote stores are
+// cached.
+const secretCacheTTL = 60 * time.Second
+
+type secretsConfig struct {
+	Backends        secrets.BackendKinds
+	Tenants         secrets.TenantList
+	Dir             string
+	EnvPrefix       string
+	Vault           secrets.VaultOpts
+	ProtocolSecrets bool
+}
+
+// newSecretProvider creates the secret provider for the configured
+// backends. Grafana Secrets Manager alone keeps the historical behavior;
+// otherwise the local backends are consulted in the configured order,
+// before Grafana Secrets Manager if it's listed. Local backends can only be
+// used by the tenants listed in cfg.Tenants, which must not be empty.
+func newSecretProvider(cfg secretsConfig, tp secrets.TenantProvider, logger zerolog.Logger) (secrets.SecretProvider, error) {
+	var (
+		remote secrets.SecretProvider
+		local  []secrets.Backend
+	)
+
+	if slices.Contains(cfg.Backends, secrets.BackendGSM) {
+		remote = secrets.NewSecretProvider(tp, secretCacheTTL, logger)
+	}
+
+	for _, kind := range cfg.Backends {
+		switch kind {
+		case secrets.BackendGSM:
+			// Always consulted last, as it's the only one providing
+			// secret store credentials for k6-backed checks.
+
+		case secrets.BackendEnv:
+			local = append(local, secrets.NewEnvBackend(cfg.EnvPrefix))
+
+		case secrets.BackendFiles:
+			if cfg.Dir == "" {
+				return nil, fmt.Errorf("the %s secret backend requires a directory", kind)
+			}
+
+			backend, err := secrets.NewFilesBackend(cfg.Dir)
+			if err != nil {
+				return nil, err
+			}
+
+			local = append(local, backend)
+
+		case secrets.BackendVault:
+			vaultOpts := cfg.Vault
+			vaultOpts.TTL = secretCacheTTL
+
+			backend, err := secrets.NewVaultBackend(vaultOpts, logger)
+			if err != nil {
+				return nil, err
+			}
+
+			local = append(local, backend)
+
+		default:
+			return nil, fmt.Errorf("%w: %s", secrets.ErrUnsupportedBackend, kind)
+		}
+	}
+
+	if len(local) == 0 && remote != nil {
+		return remote, nil
+	}
+
+	if len(local) > 0 && len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("local secret backends require the list of tenants allowed to use them")
+	}
+
+	return secrets.NewLayeredSecretProvider(secrets.LayeredOpts{
+		Backends:        local,
+		Tenants:         cfg.Tenants,
+		Remote:          remote,
+		ProtocolSecrets: cfg.ProtocolSecrets,
+	}, logger), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
+)
+
+func TestNewSecretProvider(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "password"), []byte("from file\n"), 0o600))
+	t.Setenv("SM_SECRET_PASSWORD", "from env")
+
+	{
+		provider, err := newSecretProvider(secretsConfig{
+			Backends: secrets.BackendKinds{secrets.BackendFiles, secrets.BackendEnv},
+			Tenants:  secrets.TenantList{{TenantID: 1000}},
+			Dir:      dir,
+		}, nil, logger)
+		require.NoError(t, err)
+
+		value, err := provider.GetSecretValue(context.Background(), 1000, "password")
+		require.NoError(t, err)
+		require.Equal(t, "from file", value)
+	}
+
+	{
+		provider, err := newSecretProvider(secretsConfig{
+			Backends:  secrets.BackendKinds{secrets.BackendEnv, secrets.BackendFiles},
+			Tenants:   secrets.TenantList{{TenantID: 1000}},
+			Dir:       dir,
+			EnvPrefix: secrets.DefaultEnvPrefix,
+		}, nil, logger)
+		require.NoError(t, err)
+
+		value, err := provider.GetSecretValue(context.Background(), 1000, "password")
+		require.NoError(t, err)
+		require.Equal(t, "from env", value)
+	}
+
+	{
+		_, err := newSecretProvider(secretsConfig{Backends: secrets.BackendKinds{secrets.BackendFiles}, Tenants: secrets.TenantList{{TenantID: 1000}}}, nil, logger)
+		require.Error(t, err)
+	}
+
+	{
+		// Local backends require the tenants allowed to use them.
+		_, err := newSecretProvider(secretsConfig{Backends: secrets.BackendKinds{secrets.BackendEnv}}, nil, logger)
+		require.Error(t, err)
+	}
+
+	{
+		_, err := newSecretProvider(secretsConfig{Backends: secrets.BackendKinds{secrets.BackendVault}}, nil, logger)
+		require.ErrorIs(t, err, secrets.ErrVaultAddressRequired)
+	}
+}
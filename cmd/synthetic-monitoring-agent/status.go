@@ -0,0 +1,142 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
+)
+
+// historySummary describes the executions in the history of a check.
+type historySummary struct {
+	Executions int
+	Successes  int
+	// Measured is the number of executions that ran. P50, P90 and P99
+	// are their latency percentiles.
+	Measured      int
+	P50, P90, P99 time.Duration
+	// Timeline has one character per execution, oldest first: '.' for
+	// success, 'x' for failure and '!' for error.
+	Timeline string
+}
+
+func summarizeHistory(history []scraper.HistoryEntry) historySummary {
+	var (
+		summary   historySummary
+		durations = make([]time.Duration, 0, len(history))
+		timeline  strings.Builder
+	)
+
+	for _, entry := range history {
+		summary.Executions++
+
+		switch entry.Result {
+		case scraper.ResultSuccess:
+			summary.Successes++
+
+			timeline.WriteByte('.')
+
+		case scraper.ResultFailure:
+			timeline.WriteByte('x')
+
+		case scraper.ResultError:
+			timeline.WriteByte('!')
+
+			continue
+		}
+
+		durations = append(durations, entry.Duration)
+	}
+
+	slices.Sort(durations)
+
+	summary.Measured = len(durations)
+	summary.P50 = percentile(durations, 50)
+	summary.P90 = percentile(durations, 90)
+	summary.P99 = percentile(durations, 99)
+	summary.Timeline = timeline.String()
+
+	return summary
+}
+
+// percentile returns the p-th percentile of the sorted durations using the
+// nearest-rank method, or 0 if there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+
+	return sorted[max(rank, 1)-1]
+}
+
+// statusPage writes a plain text table describing each check and the
+// executions in its history, meant to be read in a terminal:
+//
+//	curl -s localhost:4050/status
+//
+// The latency percentiles and the success ratio only cover the executions
+// kept in the history, see -check-history-size.
+func (api *operatorAPI) statusPage(w http.ResponseWriter, r *http.Request) {
+	statuses := api.checks.Checks()
+
+	slices.SortFunc(statuses, func(a, b scraper.Status) int {
+		return cmp.Compare(a.Check.GlobalID(), b.Check.GlobalID())
+	})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err := writeStatusTable(w, statuses); err != nil {
+		api.logger.Warn().Err(err).Msg("writing status page")
+	}
+}
+
+func writeStatusTable(w io.Writer, statuses []scraper.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ID\tTYPE\tJOB\tTARGET\tSTATE\tRUNS\tSUCCESS\tP50\tP90\tP99\tLAST\tTIMELINE")
+
+	for _, status := range statuses {
+		summary := summarizeHistory(status.History)
+
+		success, p50, p90, p99 := "-", "-", "-", "-"
+
+		if summary.Executions > 0 {
+			success = fmt.Sprintf("%.1f%%", 100*float64(summary.Successes)/float64(summary.Executions))
+		}
+
+		if summary.Measured > 0 {
+			p50 = summary.P50.Round(time.Millisecond).String()
+			p90 = summary.P90.Round(time.Millisecond).String()
+			p99 = summary.P99.Round(time.Millisecond).String()
+		}
+
+		last := "-"
+		if status.LastExecution != nil {
+			last = string(status.LastExecution.Result)
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			status.Check.GlobalID(),
+			status.Check.Type(),
+			status.Check.Job,
+			status.Check.Target,
+			status.State,
+			summary.Executions,
+			success,
+			p50, p90, p99,
+			last,
+			summary.Timeline,
+		)
+	}
+
+	return tw.Flush()
+}
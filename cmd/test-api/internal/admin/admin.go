@@ -0,0 +1,688 @@
+// Package admin implements an HTTP API to change what test-api serves
+// while agents are connected to it, so that scenarios can be scripted
+// against a real agent:
+//
+//	GET    /api/v1/tenants                  lists the tenants
+//	POST   /api/v1/tenants                  adds a tenant
+//	GET    /api/v1/tenants/{id}             returns a tenant
+//	PUT    /api/v1/tenants/{id}             updates a tenant
+//	DELETE /api/v1/tenants/{id}             deletes a tenant
+//	POST   /api/v1/tenants/{id}/rotate      changes the remote passwords
+//	GET    /api/v1/probes                   lists the probes
+//	POST   /api/v1/probes                   adds a probe, with its token
+//	GET    /api/v1/probes/{id}              returns a probe
+//	PUT    /api/v1/probes/{id}              updates a probe
+//	DELETE /api/v1/probes/{id}              deletes a probe
+//	POST   /api/v1/probes/{id}/disconnect   closes the probe's changes stream
+//	GET    /api/v1/probes/{id}/k6-versions  lists the k6 versions of a probe
+//	GET    /api/v1/probes/{id}/faults       returns the faults injected for a probe
+//	PUT    /api/v1/probes/{id}/faults       changes the faults injected for a probe
+//	DELETE /api/v1/probes/{id}/faults       stops injecting faults for a probe
+//	GET    /api/v1/faults                   lists the faults injected for each probe
+//	GET    /api/v1/checks                   lists the checks
+//	POST   /api/v1/checks                   adds a check
+//	GET    /api/v1/checks/{id}              returns a check
+//	PUT    /api/v1/checks/{id}              updates a check
+//	DELETE /api/v1/checks/{id}              deletes a check
+//	POST   /api/v1/adhoc-checks             queues an ad-hoc check
+//	GET    /api/v1/telemetry                lists the telemetry received
+//
+// Bodies use the JSON encoding of the synthetic monitoring types, which
+// redacts the passwords of the tenant remotes in responses. Changes
+// to checks and tenants are pushed to the connected probes as they happen.
+// Changes to probes are seen by the agent when it registers again.
+package admin
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/db"
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/grpc"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+)
+
+// maxBodySize is the maximum size of request bodies.
+const maxBodySize = 1 << 20
+
+type Db interface {
+	AddTenant(ctx context.Context, tenant *sm.Tenant) error
+	GetTenant(ctx context.Context, id int64) (*sm.Tenant, error)
+	ListTenants(ctx context.Context) ([]sm.Tenant, error)
+	UpdateTenant(ctx context.Context, tenant *sm.Tenant) (*sm.Tenant, error)
+	DeleteTenant(ctx context.Context, id int64) error
+
+	AddProbe(ctx context.Context, probe *sm.Probe, token []byte) error
+	GetProbe(ctx context.Context, id int64) (*sm.Probe, error)
+	ListProbes(ctx context.Context) ([]sm.Probe, error)
+	UpdateProbe(ctx context.Context, probe *sm.Probe) (*sm.Probe, error)
+	DeleteProbe(ctx context.Context, id int64) error
+	GetK6Versions(ctx context.Context, probeID int64) ([]string, error)
+
+	AddCheck(ctx context.Context, check *sm.Check) error
+	GetCheck(ctx context.Context, id int64) (*sm.Check, error)
+	ListChecks(ctx context.Context) ([]sm.Check, error)
+	UpdateCheck(ctx context.Context, check *sm.Check) (*sm.Check, error)
+	DeleteCheck(ctx context.Context, id int64) error
+
+	QueueAdHocCheck(ctx context.Context, check *sm.AdHocCheck) error
+	ListTelemetry(ctx context.Context) ([]db.TelemetryRecord, error)
+}
+
+// Probes is implemented by the checks server, which keeps track of the
+// connected probes.
+type Probes interface {
+	PushChanges(changes sm.Changes)
+	Disconnect(probeID int64) error
+}
+
+// Faults is implemented by the fault injector shared by the gRPC services.
+type Faults interface {
+	Get(probeID int64) grpc.Faults
+	Set(probeID int64, faults grpc.Faults) error
+	List() map[int64]grpc.Faults
+}
+
+// RoutesRegisterer adds more endpoints to the admin server.
+type RoutesRegisterer interface {
+	RegisterRoutes(router *http.ServeMux)
+}
+
+type Opts struct {
+	Logger     zerolog.Logger
+	ListenAddr string
+	Db         Db
+	Probes     Probes
+	// Faults, if not nil, registers the fault injection endpoints.
+	Faults Faults
+	// Receiver, if not nil, registers the remote-write and Loki
+	// receiver endpoints.
+	Receiver RoutesRegisterer
+}
+
+type Server struct {
+	logger  zerolog.Logger
+	addr    string
+	db      Db
+	probes  Probes
+	faults  Faults
+	handler http.Handler
+}
+
+func NewServer(opts Opts) (*Server, error) {
+	s := &Server{
+		logger: opts.Logger,
+		addr:   opts.ListenAddr,
+		db:     opts.Db,
+		probes: opts.Probes,
+		faults: opts.Faults,
+	}
+
+	router := http.NewServeMux()
+
+	router.HandleFunc("GET /api/v1/tenants", s.listTenants)
+	router.HandleFunc("POST /api/v1/tenants", s.addTenant)
+	router.HandleFunc("GET /api/v1/tenants/{id}", s.getTenant)
+	router.HandleFunc("PUT /api/v1/tenants/{id}", s.updateTenant)
+	router.HandleFunc("DELETE /api/v1/tenants/{id}", s.deleteTenant)
+	router.HandleFunc("POST /api/v1/tenants/{id}/rotate", s.rotateTenant)
+
+	router.HandleFunc("GET /api/v1/probes", s.listProbes)
+	router.HandleFunc("POST /api/v1/probes", s.addProbe)
+	router.HandleFunc("GET /api/v1/probes/{id}", s.getProbe)
+	router.HandleFunc("PUT /api/v1/probes/{id}", s.updateProbe)
+	router.HandleFunc("DELETE /api/v1/probes/{id}", s.deleteProbe)
+	router.HandleFunc("POST /api/v1/probes/{id}/disconnect", s.disconnectProbe)
+	router.HandleFunc("GET /api/v1/probes/{id}/k6-versions", s.getK6Versions)
+
+	router.HandleFunc("GET /api/v1/checks", s.listChecks)
+	router.HandleFunc("POST /api/v1/checks", s.addCheck)
+	router.HandleFunc("GET /api/v1/checks/{id}", s.getCheck)
+	router.HandleFunc("PUT /api/v1/checks/{id}", s.updateCheck)
+	router.HandleFunc("DELETE /api/v1/checks/{id}", s.deleteCheck)
+
+	router.HandleFunc("POST /api/v1/adhoc-checks", s.queueAdHocCheck)
+	router.HandleFunc("GET /api/v1/telemetry", s.listTelemetry)
+
+	if opts.Faults != nil {
+		router.HandleFunc("GET /api/v1/probes/{id}/faults", s.getFaults)
+		router.HandleFunc("PUT /api/v1/probes/{id}/faults", s.setFaults)
+		router.HandleFunc("DELETE /api/v1/probes/{id}/faults", s.clearFaults)
+		router.HandleFunc("GET /api/v1/faults", s.listFaults)
+	}
+
+	if opts.Receiver != nil {
+		opts.Receiver.RegisterRoutes(router)
+	}
+
+	s.handler = router
+
+	return s, nil
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	s.logger.Info().Str("address", s.addr).Msg("starting admin HTTP server")
+
+	l, err := (&net.ListenConfig{}).Listen(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("could not serve HTTP on %s: %w", s.addr, err)
+	}
+
+	return nil
+}
+
+func (s *Server) listTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := s.db.ListTenants(r.Context())
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	slices.SortFunc(tenants, func(a, b sm.Tenant) int { return cmp.Compare(a.Id, b.Id) })
+
+	s.writeJSON(w, http.StatusOK, tenants)
+}
+
+func (s *Server) addTenant(w http.ResponseWriter, r *http.Request) {
+	var tenant sm.Tenant
+
+	if !s.readJSON(w, r, &tenant) {
+		return
+	}
+
+	if err := s.db.AddTenant(r.Context(), &tenant); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, tenant)
+}
+
+func (s *Server) getTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := s.findTenant(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, tenant)
+}
+
+func (s *Server) updateTenant(w http.ResponseWriter, r *http.Request) {
+	oldTenant, ok := s.findTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var tenant sm.Tenant
+
+	if !s.readJSON(w, r, &tenant) {
+		return
+	}
+
+	tenant.Id = oldTenant.Id
+
+	// Passwords are redacted in responses, so they are kept if
+	// they're left out.
+	keepPassword(tenant.MetricsRemote, oldTenant.MetricsRemote)
+	keepPassword(tenant.EventsRemote, oldTenant.EventsRemote)
+
+	s.saveTenant(w, r, &tenant)
+}
+
+func keepPassword(remote, oldRemote *sm.RemoteInfo) {
+	if remote != nil && oldRemote != nil && remote.Password == "" {
+		remote.Password = oldRemote.Password
+	}
+}
+
+// rotateTenant changes the passwords of the tenant's remotes, as the API
+// does when the access policy tokens are rotated. The new passwords can be
+// passed in the body, otherwise random ones are used.
+func (s *Server) rotateTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := s.findTenant(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MetricsPassword string `json:"metricsPassword"`
+		EventsPassword  string `json:"eventsPassword"`
+	}
+
+	if r.ContentLength != 0 && !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if tenant.MetricsRemote != nil {
+		remote := *tenant.MetricsRemote
+		remote.Password = cmp.Or(req.MetricsPassword, rand.Text())
+		tenant.MetricsRemote = &remote
+	}
+
+	if tenant.EventsRemote != nil {
+		remote := *tenant.EventsRemote
+		remote.Password = cmp.Or(req.EventsPassword, rand.Text())
+		tenant.EventsRemote = &remote
+	}
+
+	s.saveTenant(w, r, tenant)
+}
+
+func (s *Server) saveTenant(w http.ResponseWriter, r *http.Request, tenant *sm.Tenant) {
+	updated, err := s.db.UpdateTenant(r.Context(), tenant)
+	if err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.probes.PushChanges(sm.Changes{Tenants: []sm.Tenant{*updated}})
+
+	s.writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := s.findTenant(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteTenant(r.Context(), tenant.Id); err != nil {
+		s.writeError(w, err, http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) findTenant(w http.ResponseWriter, r *http.Request) (*sm.Tenant, bool) {
+	id, ok := idFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	tenant, err := s.db.GetTenant(r.Context(), id)
+	if err != nil {
+		s.writeError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	return tenant, true
+}
+
+func (s *Server) listProbes(w http.ResponseWriter, r *http.Request) {
+	probes, err := s.db.ListProbes(r.Context())
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	slices.SortFunc(probes, func(a, b sm.Probe) int { return cmp.Compare(a.Id, b.Id) })
+
+	s.writeJSON(w, http.StatusOK, probes)
+}
+
+func (s *Server) addProbe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Probe sm.Probe `json:"probe"`
+		// Token is what the agent passes as its API token.
+		Token string `json:"token"`
+	}
+
+	if !s.readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Token == "" {
+		s.writeError(w, errors.New("missing probe token"), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.AddProbe(r.Context(), &req.Probe, []byte(req.Token)); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, req.Probe)
+}
+
+func (s *Server) getProbe(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, probe)
+}
+
+func (s *Server) updateProbe(w http.ResponseWriter, r *http.Request) {
+	oldProbe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	var probe sm.Probe
+
+	if !s.readJSON(w, r, &probe) {
+		return
+	}
+
+	probe.Id = oldProbe.Id
+
+	updated, err := s.db.UpdateProbe(r.Context(), &probe)
+	if err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteProbe(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteProbe(r.Context(), probe.Id); err != nil {
+		s.writeError(w, err, http.StatusConflict)
+		return
+	}
+
+	// The probe can't connect again, as its token is gone.
+	_ = s.probes.Disconnect(probe.Id)
+
+	if s.faults != nil {
+		_ = s.faults.Set(probe.Id, grpc.Faults{})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) disconnectProbe(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.probes.Disconnect(probe.Id); err != nil {
+		s.writeError(w, err, http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getK6Versions(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := s.db.GetK6Versions(r.Context(), probe.Id)
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if versions == nil {
+		versions = []string{}
+	}
+
+	s.writeJSON(w, http.StatusOK, versions)
+}
+
+func (s *Server) getFaults(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.faults.Get(probe.Id))
+}
+
+func (s *Server) setFaults(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	var faults grpc.Faults
+
+	if !s.readJSON(w, r, &faults) {
+		return
+	}
+
+	if err := s.faults.Set(probe.Id, faults); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.logger.Info().Int64("probe_id", probe.Id).Interface("faults", faults).Msg("faults changed")
+
+	s.writeJSON(w, http.StatusOK, faults)
+}
+
+func (s *Server) clearFaults(w http.ResponseWriter, r *http.Request) {
+	probe, ok := s.findProbe(w, r)
+	if !ok {
+		return
+	}
+
+	_ = s.faults.Set(probe.Id, grpc.Faults{})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listFaults(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.faults.List())
+}
+
+func (s *Server) findProbe(w http.ResponseWriter, r *http.Request) (*sm.Probe, bool) {
+	id, ok := idFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	probe, err := s.db.GetProbe(r.Context(), id)
+	if err != nil {
+		s.writeError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	return probe, true
+}
+
+func (s *Server) listChecks(w http.ResponseWriter, r *http.Request) {
+	checks, err := s.db.ListChecks(r.Context())
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	slices.SortFunc(checks, func(a, b sm.Check) int { return cmp.Compare(a.Id, b.Id) })
+
+	s.writeJSON(w, http.StatusOK, checks)
+}
+
+func (s *Server) addCheck(w http.ResponseWriter, r *http.Request) {
+	var check sm.Check
+
+	if !s.readJSON(w, r, &check) {
+		return
+	}
+
+	if err := s.db.AddCheck(r.Context(), &check); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.probes.PushChanges(sm.Changes{
+		Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_ADD, Check: check}},
+	})
+
+	s.writeJSON(w, http.StatusCreated, check)
+}
+
+func (s *Server) getCheck(w http.ResponseWriter, r *http.Request) {
+	check, ok := s.findCheck(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, check)
+}
+
+func (s *Server) updateCheck(w http.ResponseWriter, r *http.Request) {
+	oldCheck, ok := s.findCheck(w, r)
+	if !ok {
+		return
+	}
+
+	var check sm.Check
+
+	if !s.readJSON(w, r, &check) {
+		return
+	}
+
+	check.Id = oldCheck.Id
+
+	if _, err := s.db.UpdateCheck(r.Context(), &check); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Probes that no longer run the check get a delete, see
+	// filterUpdate in the grpc package.
+	s.probes.PushChanges(sm.Changes{
+		Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_UPDATE, Check: check}},
+	})
+
+	s.writeJSON(w, http.StatusOK, check)
+}
+
+func (s *Server) deleteCheck(w http.ResponseWriter, r *http.Request) {
+	check, ok := s.findCheck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.db.DeleteCheck(r.Context(), check.Id); err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.probes.PushChanges(sm.Changes{
+		Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_DELETE, Check: sm.Check{Id: check.Id}}},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) findCheck(w http.ResponseWriter, r *http.Request) (*sm.Check, bool) {
+	id, ok := idFromPath(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	check, err := s.db.GetCheck(r.Context(), id)
+	if err != nil {
+		s.writeError(w, err, http.StatusNotFound)
+		return nil, false
+	}
+
+	return check, true
+}
+
+func (s *Server) queueAdHocCheck(w http.ResponseWriter, r *http.Request) {
+	var check sm.AdHocCheck
+
+	if !s.readJSON(w, r, &check) {
+		return
+	}
+
+	if err := s.db.QueueAdHocCheck(r.Context(), &check); err != nil {
+		s.writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.writeJSON(w, http.StatusAccepted, check)
+}
+
+func (s *Server) listTelemetry(w http.ResponseWriter, r *http.Request) {
+	records, err := s.db.ListTelemetry(r.Context())
+	if err != nil {
+		s.writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []db.TelemetryRecord{}
+	}
+
+	s.writeJSON(w, http.StatusOK, records)
+}
+
+func idFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (s *Server) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		s.writeError(w, fmt.Errorf("invalid request body: %w", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn().Err(err).Msg("writing admin API response")
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error, code int) {
+	s.logger.Debug().Err(err).Int("code", code).Msg("admin API request failed")
+
+	http.Error(w, err.Error(), code)
+}
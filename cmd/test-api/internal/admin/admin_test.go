@@ -0,0 +1,298 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/db"
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/grpc"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+type testProbes struct {
+	changes      []sm.Changes
+	connected    map[int64]bool
+	disconnected []int64
+}
+
+func (p *testProbes) PushChanges(changes sm.Changes) {
+	p.changes = append(p.changes, changes)
+}
+
+func (p *testProbes) Disconnect(probeID int64) error {
+	if !p.connected[probeID] {
+		return grpc.ErrProbeNotConnected
+	}
+
+	p.disconnected = append(p.disconnected, probeID)
+
+	return nil
+}
+
+type testClient struct {
+	t *testing.T
+	h http.Handler
+}
+
+func (c testClient) do(method, path, body string, v any) int {
+	c.t.Helper()
+
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	if v != nil && w.Code < 300 {
+		require.NoError(c.t, json.Unmarshal(w.Body.Bytes(), v))
+	}
+
+	return w.Code
+}
+
+func newTestServer(t *testing.T) (testClient, *db.Db, *testProbes) {
+	d := db.New()
+	probes := &testProbes{connected: map[int64]bool{}}
+
+	s, err := NewServer(Opts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d, Probes: probes, Faults: grpc.NewFaultInjector()})
+	require.NoError(t, err)
+
+	return testClient{t: t, h: s.handler}, d, probes
+}
+
+func TestTenants(t *testing.T) {
+	c, d, probes := newTestServer(t)
+
+	passwords := func() (string, string) {
+		tenant, err := d.GetTenant(t.Context(), 1)
+		require.NoError(t, err)
+
+		return tenant.MetricsRemote.Password, tenant.EventsRemote.Password
+	}
+
+	var tenant sm.Tenant
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/tenants", `{
+		"stackId": 10,
+		"metricsRemote": {"name": "metrics", "url": "http://localhost/push", "username": "1", "password": "p1"},
+		"eventsRemote": {"name": "logs", "url": "http://localhost/loki", "username": "2", "password": "p2"}
+	}`, &tenant))
+	require.Equal(t, int64(1), tenant.Id)
+	require.Equal(t, int64(10), tenant.StackId)
+
+	var tenants []sm.Tenant
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/tenants", "", &tenants))
+	require.Equal(t, []sm.Tenant{tenant}, tenants)
+
+	var rotated sm.Tenant
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPost, "/api/v1/tenants/1/rotate", `{"metricsPassword": "new"}`, &rotated))
+	require.Equal(t, tenant.Created, rotated.Created)
+	require.Len(t, probes.changes, 1)
+	require.Equal(t, rotated.Id, probes.changes[0].Tenants[0].Id)
+
+	metricsPassword, eventsPassword := passwords()
+	require.Equal(t, "new", metricsPassword)
+	require.NotEqual(t, "p2", eventsPassword)
+	require.NotEmpty(t, eventsPassword)
+	require.Equal(t, eventsPassword, probes.changes[0].Tenants[0].EventsRemote.Password)
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPost, "/api/v1/tenants/1/rotate", "", &rotated))
+	metricsPassword, _ = passwords()
+	require.NotEqual(t, "new", metricsPassword)
+	require.Len(t, probes.changes, 2)
+
+	var updated sm.Tenant
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPut, "/api/v1/tenants/1", `{
+		"stackId": 10,
+		"status": 1,
+		"reason": "disabled",
+		"metricsRemote": {"name": "metrics", "url": "http://localhost/push", "username": "1"},
+		"eventsRemote": {"name": "logs", "url": "http://localhost/loki", "username": "2", "password": "p3"}
+	}`, &updated))
+	require.Equal(t, sm.TenantStatus_DISABLED, updated.Status)
+	require.Len(t, probes.changes, 3)
+
+	newMetricsPassword, eventsPassword := passwords()
+	require.Equal(t, metricsPassword, newMetricsPassword)
+	require.Equal(t, "p3", eventsPassword)
+
+	require.Equal(t, http.StatusNotFound, c.do(http.MethodGet, "/api/v1/tenants/2", "", nil))
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodGet, "/api/v1/tenants/abc", "", nil))
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPost, "/api/v1/tenants", `{"unknown": 1}`, nil))
+
+	require.Equal(t, http.StatusNoContent, c.do(http.MethodDelete, "/api/v1/tenants/1", "", nil))
+	require.Equal(t, http.StatusNotFound, c.do(http.MethodGet, "/api/v1/tenants/1", "", nil))
+}
+
+func TestProbes(t *testing.T) {
+	c, d, probes := newTestServer(t)
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/tenants", `{"stackId": 10}`, nil))
+
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPost, "/api/v1/probes", `{"probe": {"tenantId": 1, "name": "probe"}}`, nil))
+
+	var probe sm.Probe
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/probes", `{"probe": {"tenantId": 1, "name": "probe"}, "token": "MTIz"}`, &probe))
+	require.Equal(t, int64(1), probe.Id)
+
+	id, err := d.FindProbeIDByToken(t.Context(), []byte("MTIz"))
+	require.NoError(t, err)
+	require.Equal(t, probe.Id, id)
+
+	var updated sm.Probe
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPut, "/api/v1/probes/1", `{"tenantId": 1, "name": "probe", "region": "EU"}`, &updated))
+	require.Equal(t, "EU", updated.Region)
+	require.Equal(t, probe.Created, updated.Created)
+
+	require.Equal(t, http.StatusConflict, c.do(http.MethodPost, "/api/v1/probes/1/disconnect", "", nil))
+
+	probes.connected[1] = true
+
+	require.Equal(t, http.StatusNoContent, c.do(http.MethodPost, "/api/v1/probes/1/disconnect", "", nil))
+	require.Equal(t, []int64{1}, probes.disconnected)
+
+	require.NoError(t, d.SetK6Versions(t.Context(), 1, []string{"v1.0.0"}))
+
+	var versions []string
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/probes/1/k6-versions", "", &versions))
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	require.Equal(t, http.StatusNoContent, c.do(http.MethodDelete, "/api/v1/probes/1", "", nil))
+	require.Equal(t, []int64{1, 1}, probes.disconnected)
+	require.Equal(t, http.StatusNotFound, c.do(http.MethodDelete, "/api/v1/probes/1", "", nil))
+}
+
+func TestChecks(t *testing.T) {
+	c, d, probes := newTestServer(t)
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/tenants", `{"stackId": 10}`, nil))
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/probes", `{"probe": {"tenantId": 1, "name": "probe"}, "token": "MTIz"}`, nil))
+
+	const checkJSON = `{
+		"tenantId": 1,
+		"job": "job",
+		"target": "127.0.0.1",
+		"frequency": %FREQUENCY%,
+		"timeout": 2000,
+		"enabled": true,
+		"probes": [1],
+		"settings": {"ping": {}}
+	}`
+
+	withFrequency := func(f string) string {
+		return strings.Replace(checkJSON, "%FREQUENCY%", f, 1)
+	}
+
+	var check sm.Check
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/checks", withFrequency("10000"), &check))
+	require.Equal(t, int64(1), check.Id)
+	require.Equal(t, []sm.Changes{
+		{Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_ADD, Check: check}}},
+	}, probes.changes)
+
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPost, "/api/v1/checks", withFrequency("10000"), nil), "duplicate check")
+
+	var updated sm.Check
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPut, "/api/v1/checks/1", withFrequency("20000"), &updated))
+	require.Equal(t, int64(20000), updated.Frequency)
+	require.Equal(t, check.Created, updated.Created)
+	require.Equal(t, sm.Changes{
+		Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_UPDATE, Check: updated}},
+	}, probes.changes[1])
+
+	checks, err := d.ListChecksForProbe(t.Context(), 1)
+	require.NoError(t, err)
+	require.Equal(t, []sm.Check{updated}, checks)
+
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPut, "/api/v1/checks/1", withFrequency("-1"), nil))
+	require.Len(t, probes.changes, 2)
+
+	var checks2 []sm.Check
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/checks", "", &checks2))
+	require.Equal(t, []sm.Check{updated}, checks2)
+
+	require.Equal(t, http.StatusNoContent, c.do(http.MethodDelete, "/api/v1/checks/1", "", nil))
+	require.Equal(t, sm.Changes{
+		Checks: []sm.CheckChange{{Operation: sm.CheckOperation_CHECK_DELETE, Check: sm.Check{Id: 1}}},
+	}, probes.changes[2])
+	require.Equal(t, http.StatusNotFound, c.do(http.MethodGet, "/api/v1/checks/1", "", nil))
+}
+
+func TestAdHocChecksAndTelemetry(t *testing.T) {
+	c, d, _ := newTestServer(t)
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/tenants", `{"stackId": 10}`, nil))
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/probes", `{"probe": {"tenantId": 1, "name": "probe"}, "token": "MTIz"}`, nil))
+
+	var check sm.AdHocCheck
+
+	require.Equal(t, http.StatusAccepted, c.do(http.MethodPost, "/api/v1/adhoc-checks", `{
+		"tenantId": 1,
+		"target": "127.0.0.1",
+		"timeout": 2000,
+		"probes": [1],
+		"settings": {"ping": {}}
+	}`, &check))
+	require.NotEmpty(t, check.Id)
+
+	requests, err := d.TakeAdHocChecks(t.Context(), 1)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	require.Equal(t, check, requests[0].AdHocCheck)
+
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPost, "/api/v1/adhoc-checks", `{"tenantId": 1, "probes": [1]}`, nil))
+
+	var records []db.TelemetryRecord
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/telemetry", "", &records))
+	require.Empty(t, records)
+
+	require.NoError(t, d.AddTelemetry(t.Context(), 1, &sm.RegionTelemetry{Instance: "instance"}))
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/telemetry", "", &records))
+	require.Len(t, records, 1)
+	require.Equal(t, "instance", records[0].Telemetry.Instance)
+}
+
+func TestFaults(t *testing.T) {
+	c, _, _ := newTestServer(t)
+
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/tenants", `{"stackId": 10}`, nil))
+	require.Equal(t, http.StatusCreated, c.do(http.MethodPost, "/api/v1/probes", `{"probe": {"tenantId": 1, "name": "probe"}, "token": "MTIz"}`, nil))
+
+	var faults grpc.Faults
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/probes/1/faults", "", &faults))
+	require.Equal(t, grpc.Faults{}, faults)
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodPut, "/api/v1/probes/1/faults", `{"registerError": "UNAVAILABLE", "pingDelay": "30s"}`, &faults))
+	require.Equal(t, grpc.Faults{RegisterError: grpc.Code(codes.Unavailable), PingDelay: grpc.Duration(30 * time.Second)}, faults)
+
+	var all map[int64]grpc.Faults
+
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/faults", "", &all))
+	require.Equal(t, map[int64]grpc.Faults{1: faults}, all)
+
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPut, "/api/v1/probes/1/faults", `{"registerError": "BROKEN"}`, nil))
+	require.Equal(t, http.StatusBadRequest, c.do(http.MethodPut, "/api/v1/probes/1/faults", `{"resetAfter": -1}`, nil))
+	require.Equal(t, http.StatusNotFound, c.do(http.MethodPut, "/api/v1/probes/2/faults", `{}`, nil))
+
+	require.Equal(t, http.StatusNoContent, c.do(http.MethodDelete, "/api/v1/probes/1/faults", "", nil))
+
+	all = nil
+	require.Equal(t, http.StatusOK, c.do(http.MethodGet, "/api/v1/faults", "", &all))
+	require.Empty(t, all)
+}
@@ -1,12 +1,15 @@
 package db
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"slices"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
 
@@ -17,6 +20,24 @@ type Db struct {
 	probeTokens   map[string]int64
 	checks        map[int64]sm.Check
 	checksByProbe map[int64][]int64
+	adHocChecks   map[int64][]sm.AdHocCheck
+	telemetry     []TelemetryRecord
+	k6Versions    map[int64][]string
+	// lastTenantID, lastProbeID and lastCheckID are the last IDs
+	// assigned, so that IDs are not reused after deletions.
+	lastTenantID int64
+	lastProbeID  int64
+	lastCheckID  int64
+	// defaultRemotes returns the remotes of tenants added without
+	// them.
+	defaultRemotes func(tenantID int64) (metrics, events *sm.RemoteInfo)
+}
+
+// TelemetryRecord is a telemetry message pushed by a probe.
+type TelemetryRecord struct {
+	ProbeID   int64              `json:"probeId"`
+	Received  time.Time          `json:"received"`
+	Telemetry sm.RegionTelemetry `json:"telemetry"`
 }
 
 func New() *Db {
@@ -26,9 +47,20 @@ func New() *Db {
 		probeTokens:   make(map[string]int64),
 		checks:        make(map[int64]sm.Check),
 		checksByProbe: make(map[int64][]int64),
+		adHocChecks:   make(map[int64][]sm.AdHocCheck),
+		k6Versions:    make(map[int64][]string),
 	}
 }
 
+// SetDefaultRemotes sets the function returning the remotes of tenants
+// added without them.
+func (db *Db) SetDefaultRemotes(fn func(tenantID int64) (metrics, events *sm.RemoteInfo)) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.defaultRemotes = fn
+}
+
 func (db *Db) FindProbeIDByToken(ctx context.Context, token []byte) (int64, error) {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
@@ -76,8 +108,10 @@ func (db *Db) AddTenant(ctx context.Context, tenant *sm.Tenant) error {
 
 	now := nsNow()
 
+	db.lastTenantID++
+
 	newTenant := sm.Tenant{
-		Id:       int64(len(db.tenants) + 1),
+		Id:       db.lastTenantID,
 		OrgId:    tenant.OrgId,
 		StackId:  tenant.StackId,
 		Status:   sm.TenantStatus_ACTIVE,
@@ -103,6 +137,12 @@ func (db *Db) AddTenant(ctx context.Context, tenant *sm.Tenant) error {
 		}
 	}
 
+	if db.defaultRemotes != nil && (newTenant.MetricsRemote == nil || newTenant.EventsRemote == nil) {
+		metrics, events := db.defaultRemotes(newTenant.Id)
+		newTenant.MetricsRemote = cmp.Or(newTenant.MetricsRemote, metrics)
+		newTenant.EventsRemote = cmp.Or(newTenant.EventsRemote, events)
+	}
+
 	db.tenants[newTenant.Id] = newTenant
 
 	*tenant = newTenant
@@ -138,10 +178,12 @@ func (db *Db) UpdateTenant(ctx context.Context, tenant *sm.Tenant) (*sm.Tenant,
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
-	if _, found := db.tenants[tenant.Id]; !found {
+	oldTenant, found := db.tenants[tenant.Id]
+	if !found {
 		return nil, errors.New("tenant not found")
 	}
 
+	tenant.Created = oldTenant.Created
 	tenant.Modified = nsNow()
 	db.tenants[tenant.Id] = *tenant
 
@@ -198,7 +240,9 @@ func (db *Db) AddProbe(ctx context.Context, probe *sm.Probe, token []byte) error
 		return errors.New("invalid probe token")
 	}
 
-	probe.Id = int64(len(db.probes) + 1)
+	db.lastProbeID++
+
+	probe.Id = db.lastProbeID
 	probe.Created = nsNow()
 	probe.Modified = probe.Created
 
@@ -266,6 +310,7 @@ func (db *Db) UpdateProbe(ctx context.Context, probe *sm.Probe) (*sm.Probe, erro
 	}
 
 	updatedProbe := *probe
+	updatedProbe.Created = oldProbe.Created
 	updatedProbe.Modified = nsNow()
 
 	db.probes[probe.Id] = updatedProbe
@@ -294,6 +339,8 @@ func (db *Db) DeleteProbe(ctx context.Context, id int64) error {
 	}
 
 	delete(db.probes, id)
+	delete(db.adHocChecks, id)
+	delete(db.k6Versions, id)
 
 	return nil
 }
@@ -316,27 +363,20 @@ func (db *Db) AddCheck(ctx context.Context, check *sm.Check) error {
 		}
 	}
 
-	for _, pId := range check.Probes {
-		probe, found := db.probes[pId]
-		if !found {
-			return errors.New("probe not found")
-		}
-
-		if probe.TenantId != check.TenantId && !probe.Public {
-			return errors.New("invalid probe")
-		}
+	if err := db.validateProbes(check.TenantId, check.Probes); err != nil {
+		return err
 	}
 
-	check.Id = int64(len(db.checks) + 1)
+	db.lastCheckID++
+
+	check.Id = db.lastCheckID
 	check.Created = nsNow()
 	check.Modified = check.Created
 
 	db.checks[check.Id] = *check
 
 	// now that we now everything is valid, add checks to probes
-	for _, pId := range check.Probes {
-		db.checksByProbe[pId] = append(db.checksByProbe[pId], check.Id)
-	}
+	db.indexCheck(check)
 
 	return nil
 }
@@ -390,10 +430,18 @@ func (db *Db) UpdateCheck(ctx context.Context, check *sm.Check) (*sm.Check, erro
 		return nil, err
 	}
 
+	if err := db.validateProbes(check.TenantId, check.Probes); err != nil {
+		return nil, err
+	}
+
+	check.Created = oldCheck.Created
 	check.Modified = nsNow()
 
 	db.checks[check.Id] = *check
 
+	db.unindexCheck(&oldCheck)
+	db.indexCheck(check)
+
 	return &oldCheck, nil
 }
 
@@ -401,15 +449,166 @@ func (db *Db) DeleteCheck(ctx context.Context, id int64) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
-	if _, found := db.checks[id]; !found {
+	check, found := db.checks[id]
+	if !found {
 		return errors.New("check not found")
 	}
 
+	db.unindexCheck(&check)
+
 	delete(db.checks, id)
 
 	return nil
 }
 
+// validateProbes checks that checks for the tenant can run on the
+// probes. It must be called with the mutex held.
+func (db *Db) validateProbes(tenantID int64, probes []int64) error {
+	for _, pId := range probes {
+		probe, found := db.probes[pId]
+		if !found {
+			return errors.New("probe not found")
+		}
+
+		if probe.TenantId != tenantID && !probe.Public {
+			return errors.New("invalid probe")
+		}
+	}
+
+	return nil
+}
+
+// indexCheck adds the check to the list of checks of its probes. It must
+// be called with the mutex held.
+func (db *Db) indexCheck(check *sm.Check) {
+	for _, pId := range check.Probes {
+		db.checksByProbe[pId] = append(db.checksByProbe[pId], check.Id)
+	}
+}
+
+// unindexCheck removes the check from the list of checks of its probes.
+// It must be called with the mutex held.
+func (db *Db) unindexCheck(check *sm.Check) {
+	for _, pId := range check.Probes {
+		db.checksByProbe[pId] = slices.DeleteFunc(db.checksByProbe[pId], func(id int64) bool {
+			return id == check.Id
+		})
+	}
+}
+
+// QueueAdHocCheck queues an ad-hoc check for each of the probes listed in
+// it, to be picked up with TakeAdHocChecks. If the check doesn't have an
+// ID, a random one is assigned.
+func (db *Db) QueueAdHocCheck(ctx context.Context, check *sm.AdHocCheck) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if check.Id == "" {
+		check.Id = uuid.New().String()
+	}
+
+	if err := check.Validate(); err != nil {
+		return err
+	}
+
+	if _, found := db.tenants[check.TenantId]; !found {
+		return errors.New("invalid tenant")
+	}
+
+	if len(check.Probes) == 0 {
+		return errors.New("no probes")
+	}
+
+	if err := db.validateProbes(check.TenantId, check.Probes); err != nil {
+		return err
+	}
+
+	for _, pId := range check.Probes {
+		db.adHocChecks[pId] = append(db.adHocChecks[pId], *check)
+	}
+
+	return nil
+}
+
+// TakeAdHocChecks removes the ad-hoc checks queued for the probe and
+// returns them, oldest first, together with their tenant.
+func (db *Db) TakeAdHocChecks(ctx context.Context, probeID int64) ([]sm.AdHocRequest, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	checks := db.adHocChecks[probeID]
+	delete(db.adHocChecks, probeID)
+
+	requests := make([]sm.AdHocRequest, 0, len(checks))
+
+	for _, check := range checks {
+		req := sm.AdHocRequest{AdHocCheck: check}
+
+		// The tenant might have been deleted after the check was
+		// queued. The probe might know it already, let it try.
+		if tenant, found := db.tenants[check.TenantId]; found {
+			req.Tenant = &tenant
+		}
+
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+// AddTelemetry records telemetry pushed by a probe.
+func (db *Db) AddTelemetry(ctx context.Context, probeID int64, telemetry *sm.RegionTelemetry) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, found := db.probes[probeID]; !found {
+		return errors.New("probe not found")
+	}
+
+	db.telemetry = append(db.telemetry, TelemetryRecord{
+		ProbeID:   probeID,
+		Received:  time.Now(),
+		Telemetry: *telemetry,
+	})
+
+	return nil
+}
+
+// ListTelemetry returns the telemetry pushed by all probes, oldest first.
+func (db *Db) ListTelemetry(ctx context.Context) ([]TelemetryRecord, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return slices.Clone(db.telemetry), nil
+}
+
+// SetK6Versions records the k6 versions supported by a probe, replacing
+// the ones it reported before.
+func (db *Db) SetK6Versions(ctx context.Context, probeID int64, versions []string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, found := db.probes[probeID]; !found {
+		return errors.New("probe not found")
+	}
+
+	db.k6Versions[probeID] = slices.Clone(versions)
+
+	return nil
+}
+
+// GetK6Versions returns the k6 versions last reported by a probe.
+func (db *Db) GetK6Versions(ctx context.Context, probeID int64) ([]string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, found := db.probes[probeID]; !found {
+		return nil, errors.New("probe not found")
+	}
+
+	return slices.Clone(db.k6Versions[probeID]), nil
+}
+
 func nsNow() float64 {
 	return float64(time.Now().UnixNano()) / 1e9
 }
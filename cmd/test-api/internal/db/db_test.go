@@ -49,6 +49,29 @@ func TestTenantOps(t *testing.T) {
 	require.Len(t, tenants, 0)
 }
 
+func TestDefaultRemotes(t *testing.T) {
+	db := New()
+
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	db.SetDefaultRemotes(func(tenantID int64) (*synthetic_monitoring.RemoteInfo, *synthetic_monitoring.RemoteInfo) {
+		return &synthetic_monitoring.RemoteInfo{Name: "default-metrics"}, &synthetic_monitoring.RemoteInfo{Name: "default-logs"}
+	})
+
+	var tenant synthetic_monitoring.Tenant
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+	require.Equal(t, "default-metrics", tenant.MetricsRemote.Name)
+	require.Equal(t, "default-logs", tenant.EventsRemote.Name)
+
+	tenant = synthetic_monitoring.Tenant{StackId: 2, MetricsRemote: &synthetic_monitoring.RemoteInfo{Name: "metrics"}}
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+	require.Equal(t, "metrics", tenant.MetricsRemote.Name)
+	require.Equal(t, "default-logs", tenant.EventsRemote.Name)
+}
+
 func TestProbeOps(t *testing.T) {
 	db := New()
 	require.NotNil(t, db)
@@ -174,6 +197,191 @@ func TestCheckOps(t *testing.T) {
 	require.Len(t, checks, 0)
 }
 
+func TestChecksForProbe(t *testing.T) {
+	db := New()
+
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	var tenant synthetic_monitoring.Tenant
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+
+	probe1 := synthetic_monitoring.Probe{Name: "probe1", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe1, []byte("123")))
+
+	probe2 := synthetic_monitoring.Probe{Name: "probe2", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe2, []byte("456")))
+
+	newCheck := func(job string) synthetic_monitoring.Check {
+		return synthetic_monitoring.Check{
+			TenantId:  tenant.Id,
+			Probes:    []int64{probe1.Id},
+			Target:    "127.0.0.1",
+			Job:       job,
+			Frequency: 2000,
+			Timeout:   2000,
+			Enabled:   true,
+			Settings: synthetic_monitoring.CheckSettings{
+				Ping: &synthetic_monitoring.PingSettings{},
+			},
+		}
+	}
+
+	checkIDs := func(probeID int64) []int64 {
+		checks, err := db.ListChecksForProbe(ctx, probeID)
+		require.NoError(t, err)
+
+		ids := make([]int64, 0, len(checks))
+		for _, check := range checks {
+			ids = append(ids, check.Id)
+		}
+
+		return ids
+	}
+
+	check1 := newCheck("job1")
+	require.NoError(t, db.AddCheck(ctx, &check1))
+
+	check2 := newCheck("job2")
+	require.NoError(t, db.AddCheck(ctx, &check2))
+
+	require.Equal(t, []int64{check1.Id, check2.Id}, checkIDs(probe1.Id))
+
+	// Moving a check to another probe.
+	check1.Probes = []int64{probe2.Id}
+	_, err := db.UpdateCheck(ctx, &check1)
+	require.NoError(t, err)
+
+	require.Equal(t, []int64{check2.Id}, checkIDs(probe1.Id))
+	require.Equal(t, []int64{check1.Id}, checkIDs(probe2.Id))
+
+	check1.Probes = []int64{42}
+	_, err = db.UpdateCheck(ctx, &check1)
+	require.Error(t, err)
+
+	// IDs are not reused after deleting checks.
+	require.NoError(t, db.DeleteCheck(ctx, check2.Id))
+	require.Empty(t, checkIDs(probe1.Id))
+
+	check3 := newCheck("job3")
+	require.NoError(t, db.AddCheck(ctx, &check3))
+	require.Greater(t, check3.Id, check2.Id)
+}
+
+func TestAdHocCheckOps(t *testing.T) {
+	db := New()
+
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	var tenant synthetic_monitoring.Tenant
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+
+	probe1 := synthetic_monitoring.Probe{Name: "probe1", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe1, []byte("123")))
+
+	probe2 := synthetic_monitoring.Probe{Name: "probe2", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe2, []byte("456")))
+
+	check := synthetic_monitoring.AdHocCheck{
+		TenantId: tenant.Id,
+		Probes:   []int64{probe1.Id, probe2.Id},
+		Target:   "127.0.0.1",
+		Timeout:  2000,
+		Settings: synthetic_monitoring.CheckSettings{
+			Ping: &synthetic_monitoring.PingSettings{},
+		},
+	}
+
+	require.NoError(t, db.QueueAdHocCheck(ctx, &check))
+	require.NotEmpty(t, check.Id)
+
+	requests, err := db.TakeAdHocChecks(ctx, probe1.Id)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	require.Equal(t, check, requests[0].AdHocCheck)
+	require.Equal(t, &tenant, requests[0].Tenant)
+
+	// Checks are only sent once.
+	requests, err = db.TakeAdHocChecks(ctx, probe1.Id)
+	require.NoError(t, err)
+	require.Empty(t, requests)
+
+	requests, err = db.TakeAdHocChecks(ctx, probe2.Id)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+
+	invalid := check
+	invalid.Probes = []int64{42}
+	require.Error(t, db.QueueAdHocCheck(ctx, &invalid))
+
+	invalid = check
+	invalid.TenantId = 42
+	require.Error(t, db.QueueAdHocCheck(ctx, &invalid))
+
+	invalid = check
+	invalid.Probes = nil
+	require.Error(t, db.QueueAdHocCheck(ctx, &invalid))
+}
+
+func TestTelemetryOps(t *testing.T) {
+	db := New()
+
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	var tenant synthetic_monitoring.Tenant
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+
+	probe := synthetic_monitoring.Probe{Name: "test", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe, []byte("123")))
+
+	telemetry := synthetic_monitoring.RegionTelemetry{Instance: "instance", RegionId: 1}
+
+	require.NoError(t, db.AddTelemetry(ctx, probe.Id, &telemetry))
+	require.Error(t, db.AddTelemetry(ctx, 42, &telemetry))
+
+	records, err := db.ListTelemetry(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, probe.Id, records[0].ProbeID)
+	require.Equal(t, telemetry, records[0].Telemetry)
+	require.NotZero(t, records[0].Received)
+}
+
+func TestK6VersionOps(t *testing.T) {
+	db := New()
+
+	ctx, cancel := testContext(t)
+	t.Cleanup(cancel)
+
+	var tenant synthetic_monitoring.Tenant
+
+	require.NoError(t, db.AddTenant(ctx, &tenant))
+
+	probe := synthetic_monitoring.Probe{Name: "test", TenantId: tenant.Id}
+	require.NoError(t, db.AddProbe(ctx, &probe, []byte("123")))
+
+	versions, err := db.GetK6Versions(ctx, probe.Id)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	require.NoError(t, db.SetK6Versions(ctx, probe.Id, []string{"v1.0.0", "v1.1.0"}))
+	require.NoError(t, db.SetK6Versions(ctx, probe.Id, []string{"v1.2.0"}))
+
+	versions, err = db.GetK6Versions(ctx, probe.Id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.2.0"}, versions)
+
+	require.Error(t, db.SetK6Versions(ctx, 42, nil))
+
+	_, err = db.GetK6Versions(ctx, 42)
+	require.Error(t, err)
+}
+
 func testContext(t *testing.T) (context.Context, func()) {
 	if deadline, ok := t.Deadline(); ok {
 		return context.WithDeadline(context.Background(), deadline)
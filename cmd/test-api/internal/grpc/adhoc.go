@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+)
+
+// adHocChecksPollInterval is how often GetAdHocChecks looks for queued
+// ad-hoc checks.
+const adHocChecksPollInterval = 100 * time.Millisecond
+
+type AdHocChecksDb interface {
+	FindProbeByID(ctx context.Context, id int64) (*sm.Probe, error)
+	TakeAdHocChecks(ctx context.Context, probeID int64) ([]sm.AdHocRequest, error)
+}
+
+type AdHocChecksServerOpts struct {
+	Logger zerolog.Logger
+	Db     AdHocChecksDb
+	// Faults, if not nil, has the faults to inject for each probe.
+	Faults *FaultInjector
+}
+
+// AdHocChecksServer sends the ad-hoc checks queued in the database to the
+// probes they are meant for.
+type AdHocChecksServer struct {
+	logger zerolog.Logger
+	db     AdHocChecksDb
+	faults *FaultInjector
+}
+
+func NewAdHocChecksServer(opts AdHocChecksServerOpts) (*AdHocChecksServer, error) {
+	return &AdHocChecksServer{
+		logger: opts.Logger,
+		db:     opts.Db,
+		faults: opts.Faults,
+	}, nil
+}
+
+func (s *AdHocChecksServer) RegisterProbe(ctx context.Context, _ *sm.ProbeInfo) (*sm.RegisterProbeResult, error) {
+	probeID, found := probeIdFromContext(ctx)
+	if !found {
+		return &sm.RegisterProbeResult{
+			Status: sm.Status{
+				Code:    sm.StatusCode_NOT_AUTHORIZED,
+				Message: "cannot get probe ID",
+			},
+		}, nil
+	}
+
+	if result, err := injectRegisterFaults(ctx, s.faults.Get(probeID)); result != nil || err != nil {
+		return result, err
+	}
+
+	probe, err := s.db.FindProbeByID(ctx, probeID)
+	if err != nil {
+		return &sm.RegisterProbeResult{
+			Status: sm.Status{
+				Code:    sm.StatusCode_INTERNAL_ERROR,
+				Message: "internal error retrieving probe",
+			},
+		}, nil
+	}
+
+	s.logger.Info().Int64("probe_id", probeID).Msg("ad-hoc probe registered")
+
+	return &sm.RegisterProbeResult{Probe: *probe}, nil
+}
+
+func (s *AdHocChecksServer) GetAdHocChecks(_ *sm.Void, stream sm.AdHocChecks_GetAdHocChecksServer) error {
+	ctx := stream.Context()
+
+	probeID, found := probeIdFromContext(ctx)
+	if !found {
+		return errors.New("invalid probe authorization")
+	}
+
+	if faults := s.faults.Get(probeID); faults.AdHocChecksError != 0 {
+		return faults.AdHocChecksError.err("GetAdHocChecks")
+	}
+
+	ticker := time.NewTicker(adHocChecksPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-ticker.C:
+		}
+
+		requests, err := s.db.TakeAdHocChecks(ctx, probeID)
+		if err != nil {
+			return err
+		}
+
+		for _, req := range requests {
+			s.logger.Info().Int64("probe_id", probeID).Str("id", req.AdHocCheck.Id).Msg("sending ad-hoc check")
+
+			if err := stream.Send(&req); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -23,11 +23,14 @@ type ChecksServer struct {
 	db          ChecksDb
 	probesMutex sync.Mutex
 	probes      map[int64]probeController
+	faults      *FaultInjector
 }
 
 type ChecksServerOpts struct {
 	Logger zerolog.Logger
 	Db     ChecksDb
+	// Faults, if not nil, has the faults to inject for each probe.
+	Faults *FaultInjector
 }
 
 func NewChecksServer(opts ChecksServerOpts) (*ChecksServer, error) {
@@ -35,6 +38,7 @@ func NewChecksServer(opts ChecksServerOpts) (*ChecksServer, error) {
 		logger: opts.Logger,
 		db:     opts.Db,
 		probes: make(map[int64]probeController),
+		faults: opts.Faults,
 	}, nil
 }
 
@@ -62,6 +66,10 @@ func (s *ChecksServer) RegisterProbe(ctx context.Context, _ *sm.ProbeInfo) (*sm.
 		}, nil
 	}
 
+	if result, err := injectRegisterFaults(ctx, s.faults.Get(probeID)); result != nil || err != nil {
+		return result, err
+	}
+
 	s.acquireProbesMutex(probeID)
 	defer s.releaseProbesMutex(probeID)
 
@@ -114,13 +122,28 @@ func (s *ChecksServer) GetChanges(currentState *sm.ProbeState, stream sm.Checks_
 		return fmt.Errorf("activating probe %d: %w", probeID, err)
 	}
 
+	faults := s.faults.Get(probeID)
+	if faults.ChangesError != 0 {
+		return faults.ChangesError.err("GetChanges")
+	}
+
+	faultyStream := &faultyChangesStream{
+		Checks_GetChangesServer: stream,
+		faults:                  s.faults,
+		probeID:                 probeID,
+		resetAfter:              faults.ResetAfter,
+		resetError:              faults.ResetError,
+	}
+
 	// Load all the existing checks from the database and send them to client
 
-	existingChecks, err := s.sendInitialChanges(currentState, stream, probeID)
+	existingChecks, err := s.sendInitialChanges(currentState, faultyStream, probeID)
 	if err != nil {
 		return err
 	}
 
+	faultyStream.pushing = true
+
 	for {
 		select {
 		case up, ok := <-updates:
@@ -131,7 +154,7 @@ func (s *ChecksServer) GetChanges(currentState *sm.ProbeState, stream sm.Checks_
 				continue
 			}
 
-			_, err := s.processUpdate(up, probeID, existingChecks, stream)
+			_, err := s.processUpdate(up, probeID, existingChecks, faultyStream)
 			if err != nil {
 				return err
 			}
@@ -150,13 +173,72 @@ func (s *ChecksServer) GetChanges(currentState *sm.ProbeState, stream sm.Checks_
 }
 
 func (s *ChecksServer) Ping(ctx context.Context, req *sm.PingRequest) (*sm.PongResponse, error) {
-	if _, found := probeIdFromContext(ctx); !found {
+	probeID, found := probeIdFromContext(ctx)
+	if !found {
 		return nil, errors.New("probe not found")
 	}
 
+	faults := s.faults.Get(probeID)
+
+	if err := sleepCtx(ctx, time.Duration(faults.PingDelay)); err != nil {
+		return nil, err
+	}
+
+	if faults.PingError != 0 {
+		return nil, faults.PingError.err("Ping")
+	}
+
 	return &sm.PongResponse{Sequence: req.Sequence}, nil
 }
 
+// ErrProbeNotConnected is returned when a probe that is not connected is
+// asked to disconnect.
+var ErrProbeNotConnected = errors.New("probe not connected")
+
+// PushChanges sends changes to all the connected probes. Each probe only
+// gets the changes to the checks it runs, and all the tenant changes.
+//
+// Probes that are too far behind are disconnected, so that they get all
+// the checks again when they reconnect.
+func (s *ChecksServer) PushChanges(changes sm.Changes) {
+	s.probesMutex.Lock()
+	defer s.probesMutex.Unlock()
+
+	for id, probe := range s.probes {
+		select {
+		case probe.ch <- changes:
+
+		default:
+			s.logger.Warn().Int64("probe_id", id).Msg("probe updates queue full, disconnecting probe")
+
+			select {
+			case probe.restart <- restartSignal{}:
+			default:
+			}
+		}
+	}
+}
+
+// Disconnect closes the changes stream of the probe. The probe is
+// expected to register and ask for changes again.
+func (s *ChecksServer) Disconnect(probeID int64) error {
+	s.probesMutex.Lock()
+	defer s.probesMutex.Unlock()
+
+	probe, found := s.probes[probeID]
+	if !found {
+		return ErrProbeNotConnected
+	}
+
+	select {
+	case probe.restart <- restartSignal{}:
+	default:
+		// A restart is already pending.
+	}
+
+	return nil
+}
+
 const (
 	probeUpdatesQueueLenght  = 128
 	probeRegistrationTimeout = 1 * time.Second
@@ -0,0 +1,319 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/status"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"google.golang.org/grpc/codes"
+)
+
+// Faults describes how test-api misbehaves towards a probe, to exercise
+// the agent's error handling and reconnection logic. The zero value
+// injects no faults.
+//
+// Faults are looked up on every call, so changing them affects the
+// connected probes right away, except for ResetAfter and ResetError,
+// which are read when the changes stream is opened.
+type Faults struct {
+	// RegisterDelay delays the responses to RegisterProbe, in both the
+	// checks and the ad-hoc checks services.
+	RegisterDelay Duration `json:"registerDelay,omitempty"`
+	// RegisterError makes RegisterProbe fail with this gRPC code.
+	RegisterError Code `json:"registerError,omitempty"`
+	// RegisterStatus makes RegisterProbe return this status code in
+	// its result, without failing the call.
+	RegisterStatus StatusCode `json:"registerStatus,omitempty"`
+
+	// ChangesError makes GetChanges fail with this gRPC code before
+	// sending anything.
+	ChangesError Code `json:"changesError,omitempty"`
+	// ResetAfter ends the changes stream with ResetError, or
+	// UNAVAILABLE if it's not set, after sending that many batches.
+	ResetAfter int  `json:"resetAfter,omitempty"`
+	ResetError Code `json:"resetError,omitempty"`
+	// DuplicateChanges sends every batch of changes pushed to the
+	// probe twice.
+	DuplicateChanges bool `json:"duplicateChanges,omitempty"`
+	// ReorderChanges holds back each batch of changes pushed to the
+	// probe until the next one is sent, so that they arrive swapped.
+	// The first batch sent when the probe connects is not affected.
+	ReorderChanges bool `json:"reorderChanges,omitempty"`
+
+	// PingDelay delays the responses to Ping.
+	PingDelay Duration `json:"pingDelay,omitempty"`
+	// PingError makes Ping fail with this gRPC code.
+	PingError Code `json:"pingError,omitempty"`
+
+	// AdHocChecksError makes GetAdHocChecks fail with this gRPC code.
+	AdHocChecksError Code `json:"adHocChecksError,omitempty"`
+}
+
+// Validate returns an error if the faults can't be injected.
+func (f Faults) Validate() error {
+	switch {
+	case f.RegisterDelay < 0, f.PingDelay < 0:
+		return errors.New("delays cannot be negative")
+
+	case f.ResetAfter < 0:
+		return errors.New("resetAfter cannot be negative")
+
+	case f.RegisterError != 0 && f.RegisterStatus != 0:
+		return errors.New("registerError and registerStatus are mutually exclusive")
+	}
+
+	return nil
+}
+
+// FaultInjector keeps the faults to inject for each probe. A nil
+// *FaultInjector injects no faults.
+type FaultInjector struct {
+	mutex  sync.Mutex
+	faults map[int64]Faults
+}
+
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		faults: make(map[int64]Faults),
+	}
+}
+
+// Get returns the faults to inject for the specified probe.
+func (f *FaultInjector) Get(probeID int64) Faults {
+	if f == nil {
+		return Faults{}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.faults[probeID]
+}
+
+// Set replaces the faults to inject for the specified probe. Setting the
+// zero value stops injecting faults.
+func (f *FaultInjector) Set(probeID int64, faults Faults) error {
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if faults == (Faults{}) {
+		delete(f.faults, probeID)
+	} else {
+		f.faults[probeID] = faults
+	}
+
+	return nil
+}
+
+// List returns the faults injected for each probe.
+func (f *FaultInjector) List() map[int64]Faults {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return maps.Clone(f.faults)
+}
+
+// injectRegisterFaults applies the RegisterProbe faults for the probe. If
+// the returned result or error are not nil, RegisterProbe must return
+// them.
+func injectRegisterFaults(ctx context.Context, faults Faults) (*sm.RegisterProbeResult, error) {
+	if err := sleepCtx(ctx, time.Duration(faults.RegisterDelay)); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case faults.RegisterError != 0:
+		return nil, faults.RegisterError.err("RegisterProbe")
+
+	case faults.RegisterStatus != 0:
+		return &sm.RegisterProbeResult{
+			Status: sm.Status{
+				Code:    sm.StatusCode(faults.RegisterStatus),
+				Message: "injected fault",
+			},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// faultyChangesStream applies the ResetAfter, DuplicateChanges and
+// ReorderChanges faults to the changes sent to a probe. The last two only
+// apply once pushing is set, after the initial changes are sent.
+type faultyChangesStream struct {
+	sm.Checks_GetChangesServer
+	faults     *FaultInjector
+	probeID    int64
+	resetAfter int
+	resetError Code
+	pushing    bool
+	sent       int
+	held       *sm.Changes
+}
+
+func (s *faultyChangesStream) Send(changes *sm.Changes) error {
+	var batches []*sm.Changes
+
+	faults := Faults{}
+	if s.pushing {
+		faults = s.faults.Get(s.probeID)
+	}
+
+	switch {
+	case faults.ReorderChanges && s.held == nil:
+		s.held = changes
+
+		return nil
+
+	case s.held != nil && faults.ReorderChanges:
+		batches = append(batches, changes, s.held)
+
+	case s.held != nil:
+		// Reordering was turned off while holding a batch.
+		batches = append(batches, s.held, changes)
+
+	default:
+		batches = append(batches, changes)
+	}
+
+	s.held = nil
+
+	for _, batch := range batches {
+		for range 1 + boolToInt(faults.DuplicateChanges) {
+			if err := s.Checks_GetChangesServer.Send(batch); err != nil {
+				return err
+			}
+
+			s.sent++
+
+			if s.resetAfter > 0 && s.sent >= s.resetAfter {
+				return s.resetError.or(codes.Unavailable).err("GetChanges")
+			}
+		}
+	}
+
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Code is a gRPC status code, encoded by name (e.g. "UNAVAILABLE").
+type Code codes.Code
+
+func (c Code) err(method string) error {
+	return status.Error(codes.Code(c), method+": injected fault")
+}
+
+// or returns c, or fallback if c is OK.
+func (c Code) or(fallback codes.Code) Code {
+	if c == Code(codes.OK) {
+		return Code(fallback)
+	}
+
+	return c
+}
+
+func (c Code) MarshalText() ([]byte, error) {
+	return []byte(codeNames[codes.Code(c)]), nil
+}
+
+func (c *Code) UnmarshalText(text []byte) error {
+	for code, name := range codeNames {
+		if strings.EqualFold(string(text), name) {
+			*c = Code(code)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid gRPC status code %q", text)
+}
+
+var codeNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
+
+// StatusCode is a RegisterProbe status code, encoded by name (e.g.
+// "NOT_AUTHORIZED").
+type StatusCode sm.StatusCode
+
+func (c StatusCode) MarshalText() ([]byte, error) {
+	return []byte(sm.StatusCode(c).String()), nil
+}
+
+func (c *StatusCode) UnmarshalText(text []byte) error {
+	value, found := sm.StatusCode_value[strings.ToUpper(string(text))]
+	if !found {
+		return fmt.Errorf("invalid status code %q", text)
+	}
+
+	*c = StatusCode(value)
+
+	return nil
+}
+
+// Duration is encoded as a string accepted by time.ParseDuration.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
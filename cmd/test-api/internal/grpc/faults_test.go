@@ -0,0 +1,216 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gogo/status"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestFaultsJSON(t *testing.T) {
+	var faults Faults
+
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"registerDelay": "1.5s",
+		"registerStatus": "not_authorized",
+		"resetAfter": 3,
+		"resetError": "PERMISSION_DENIED",
+		"pingError": "unimplemented"
+	}`), &faults))
+	require.Equal(t, Faults{
+		RegisterDelay:  Duration(1500 * time.Millisecond),
+		RegisterStatus: StatusCode(sm.StatusCode_NOT_AUTHORIZED),
+		ResetAfter:     3,
+		ResetError:     Code(codes.PermissionDenied),
+		PingError:      Code(codes.Unimplemented),
+	}, faults)
+
+	data, err := json.Marshal(faults)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"registerDelay": "1.5s",
+		"registerStatus": "NOT_AUTHORIZED",
+		"resetAfter": 3,
+		"resetError": "PERMISSION_DENIED",
+		"pingError": "UNIMPLEMENTED"
+	}`, string(data))
+
+	require.Error(t, json.Unmarshal([]byte(`{"pingError": "BROKEN"}`), &faults))
+	require.Error(t, json.Unmarshal([]byte(`{"registerStatus": "BROKEN"}`), &faults))
+	require.Error(t, json.Unmarshal([]byte(`{"pingDelay": "soon"}`), &faults))
+}
+
+func TestFaultInjector(t *testing.T) {
+	var nilInjector *FaultInjector
+
+	require.Equal(t, Faults{}, nilInjector.Get(1))
+
+	f := NewFaultInjector()
+
+	require.NoError(t, f.Set(1, Faults{PingError: Code(codes.Unavailable)}))
+	require.Equal(t, Faults{PingError: Code(codes.Unavailable)}, f.Get(1))
+	require.Equal(t, Faults{}, f.Get(2))
+
+	require.Error(t, f.Set(1, Faults{ResetAfter: -1}))
+	require.Error(t, f.Set(1, Faults{PingDelay: Duration(-time.Second)}))
+	require.Error(t, f.Set(1, Faults{RegisterError: Code(codes.Unavailable), RegisterStatus: StatusCode(sm.StatusCode_NOT_AUTHORIZED)}))
+	require.Len(t, f.List(), 1)
+
+	require.NoError(t, f.Set(1, Faults{}))
+	require.Empty(t, f.List())
+}
+
+type testChangesStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *sm.Changes
+}
+
+func (s *testChangesStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testChangesStream) Send(changes *sm.Changes) error {
+	s.sent <- changes
+	return nil
+}
+
+func TestChecksServerFaults(t *testing.T) {
+	d, _, probe := newTestDb(t)
+	faults := NewFaultInjector()
+
+	s, err := NewChecksServer(ChecksServerOpts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d, Faults: faults})
+	require.NoError(t, err)
+
+	ctx := contextWithProbeId(t.Context(), probe.Id)
+
+	require.NoError(t, faults.Set(probe.Id, Faults{RegisterError: Code(codes.Unavailable)}))
+	_, err = s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	require.NoError(t, faults.Set(probe.Id, Faults{RegisterStatus: StatusCode(sm.StatusCode_NOT_AUTHORIZED)}))
+	result, err := s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_NOT_AUTHORIZED, result.Status.Code)
+
+	require.NoError(t, faults.Set(probe.Id, Faults{PingError: Code(codes.PermissionDenied)}))
+	_, err = s.Ping(ctx, &sm.PingRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	require.NoError(t, faults.Set(probe.Id, Faults{PingDelay: Duration(time.Hour)}))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, err = s.Ping(timeoutCtx, &sm.PingRequest{})
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// GetChanges fails without sending anything.
+	require.NoError(t, faults.Set(probe.Id, Faults{ChangesError: Code(codes.Unimplemented)}))
+	result, err = s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_OK, result.Status.Code)
+
+	stream := &testChangesStream{ctx: ctx, sent: make(chan *sm.Changes, 10)}
+	err = s.GetChanges(&sm.ProbeState{}, stream)
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	require.Empty(t, stream.sent)
+
+	// The stream is reset after the initial changes and the first
+	// pushed batch.
+	require.NoError(t, faults.Set(probe.Id, Faults{ResetAfter: 2}))
+
+	done := startGetChanges(t, s, ctx, stream)
+
+	receiveChanges(t, stream)
+
+	s.PushChanges(checkChange(2, probe.Id))
+	require.Equal(t, []sm.CheckChange{checkChange(2, probe.Id).Checks[0]}, receiveChanges(t, stream).Checks)
+	require.Equal(t, codes.Unavailable, status.Code(<-done))
+
+	// Pushed batches are swapped and then duplicated.
+	require.NoError(t, faults.Set(probe.Id, Faults{ReorderChanges: true}))
+
+	done = startGetChanges(t, s, ctx, stream)
+
+	receiveChanges(t, stream)
+
+	s.PushChanges(checkChange(3, probe.Id))
+	s.PushChanges(checkChange(4, probe.Id))
+	require.Equal(t, int64(4), receiveChanges(t, stream).Checks[0].Check.Id)
+	require.Equal(t, int64(3), receiveChanges(t, stream).Checks[0].Check.Id)
+
+	require.NoError(t, faults.Set(probe.Id, Faults{DuplicateChanges: true}))
+
+	s.PushChanges(checkChange(5, probe.Id))
+	require.Equal(t, int64(5), receiveChanges(t, stream).Checks[0].Check.Id)
+	require.Equal(t, int64(5), receiveChanges(t, stream).Checks[0].Check.Id)
+
+	require.NoError(t, s.Disconnect(probe.Id))
+	require.Equal(t, codes.Aborted, status.Code(<-done))
+}
+
+func startGetChanges(t *testing.T, s *ChecksServer, ctx context.Context, stream *testChangesStream) <-chan error {
+	t.Helper()
+
+	result, err := s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_OK, result.Status.Code)
+
+	done := make(chan error, 1)
+
+	go func() {
+		// The probe knows about a check that doesn't exist, so
+		// the initial changes are never empty.
+		done <- s.GetChanges(&sm.ProbeState{Checks: []sm.EntityRef{{Id: 99}}}, stream)
+	}()
+
+	return done
+}
+
+func receiveChanges(t *testing.T, stream *testChangesStream) *sm.Changes {
+	t.Helper()
+
+	select {
+	case changes := <-stream.sent:
+		return changes
+
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for changes")
+		return nil
+	}
+}
+
+func checkChange(id, probeID int64) sm.Changes {
+	return sm.Changes{
+		Checks: []sm.CheckChange{
+			{
+				Operation: sm.CheckOperation_CHECK_ADD,
+				Check:     sm.Check{Id: id, Enabled: true, Probes: []int64{probeID}},
+			},
+		},
+	}
+}
+
+func TestAdHocChecksServerFaults(t *testing.T) {
+	d, _, probe := newTestDb(t)
+	faults := NewFaultInjector()
+
+	s, err := NewAdHocChecksServer(AdHocChecksServerOpts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d, Faults: faults})
+	require.NoError(t, err)
+
+	ctx := contextWithProbeId(t.Context(), probe.Id)
+
+	require.NoError(t, faults.Set(probe.Id, Faults{RegisterError: Code(codes.PermissionDenied)}))
+	_, err = s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	require.NoError(t, faults.Set(probe.Id, Faults{AdHocChecksError: Code(codes.Unavailable)}))
+	err = s.GetAdHocChecks(&sm.Void{}, &testAdHocChecksStream{ctx: ctx})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -29,6 +29,8 @@ type Opts struct {
 	ChecksServer      sm.ChecksServer
 	TenantsServer     sm.TenantsServer
 	AdHocChecksServer sm.AdHocChecksServer
+	TelemetryServer   sm.TelemetryServer
+	K6Server          sm.K6Server
 	Db                ServerDb
 }
 
@@ -72,6 +74,14 @@ func NewServer(ctx context.Context, opts *Opts) (*Server, error) {
 		sm.RegisterAdHocChecksServer(srv.srv, opts.AdHocChecksServer)
 	}
 
+	if opts.TelemetryServer != nil {
+		sm.RegisterTelemetryServer(srv.srv, opts.TelemetryServer)
+	}
+
+	if opts.K6Server != nil {
+		sm.RegisterK6Server(srv.srv, opts.K6Server)
+	}
+
 	return srv, nil
 }
 
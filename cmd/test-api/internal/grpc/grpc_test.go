@@ -30,6 +30,8 @@ func TestNewServer(t *testing.T) {
 			ChecksServer:      &testChecksServer{},
 			TenantsServer:     &testTenantsServer{},
 			AdHocChecksServer: &testAdHocChecksServer{},
+			TelemetryServer:   &TelemetryServer{},
+			K6Server:          &K6Server{},
 			Db:                &testDb{},
 		},
 	)
@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+)
+
+type K6Db interface {
+	SetK6Versions(ctx context.Context, probeID int64, versions []string) error
+}
+
+type K6ServerOpts struct {
+	Logger zerolog.Logger
+	Db     K6Db
+}
+
+// K6Server records the k6 versions supported by the probes.
+type K6Server struct {
+	logger zerolog.Logger
+	db     K6Db
+}
+
+func NewK6Server(opts K6ServerOpts) (*K6Server, error) {
+	return &K6Server{
+		logger: opts.Logger,
+		db:     opts.Db,
+	}, nil
+}
+
+func (s *K6Server) RegisterK6Version(ctx context.Context, req *sm.RegisterK6VersionRequest) (*sm.RegisterK6VersionResponse, error) {
+	probeID, found := probeIdFromContext(ctx)
+	if !found {
+		return nil, errors.New("invalid probe authorization")
+	}
+
+	versions := make([]string, 0, len(req.Versions))
+	for _, v := range req.Versions {
+		versions = append(versions, v.Version)
+	}
+
+	if err := s.db.SetK6Versions(ctx, probeID, versions); err != nil {
+		return &sm.RegisterK6VersionResponse{
+			Status: sm.Status{
+				Code:    sm.StatusCode_INTERNAL_ERROR,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	s.logger.Info().Int64("probe_id", probeID).Strs("versions", versions).Msg("k6 versions registered")
+
+	return &sm.RegisterK6VersionResponse{Status: sm.Status{Code: sm.StatusCode_OK}}, nil
+}
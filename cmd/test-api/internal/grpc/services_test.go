@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/db"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func newTestDb(t *testing.T) (*db.Db, sm.Tenant, sm.Probe) {
+	t.Helper()
+
+	d := db.New()
+
+	var tenant sm.Tenant
+
+	require.NoError(t, d.AddTenant(t.Context(), &tenant))
+
+	probe := sm.Probe{Name: "test", TenantId: tenant.Id}
+	require.NoError(t, d.AddProbe(t.Context(), &probe, []byte("MTIz")))
+
+	return d, tenant, probe
+}
+
+type testAdHocChecksStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *sm.AdHocRequest
+}
+
+func (s *testAdHocChecksStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testAdHocChecksStream) Send(req *sm.AdHocRequest) error {
+	s.sent <- req
+	return nil
+}
+
+func TestAdHocChecksServer(t *testing.T) {
+	d, tenant, probe := newTestDb(t)
+
+	s, err := NewAdHocChecksServer(AdHocChecksServerOpts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(contextWithProbeId(t.Context(), probe.Id))
+	defer cancel()
+
+	result, err := s.RegisterProbe(ctx, &sm.ProbeInfo{})
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_OK, result.Status.Code)
+	require.Equal(t, probe, result.Probe)
+
+	result, err = s.RegisterProbe(t.Context(), &sm.ProbeInfo{})
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_NOT_AUTHORIZED, result.Status.Code)
+
+	stream := &testAdHocChecksStream{ctx: ctx, sent: make(chan *sm.AdHocRequest)}
+	done := make(chan error)
+
+	go func() {
+		done <- s.GetAdHocChecks(&sm.Void{}, stream)
+	}()
+
+	check := sm.AdHocCheck{
+		TenantId: tenant.Id,
+		Probes:   []int64{probe.Id},
+		Target:   "127.0.0.1",
+		Timeout:  2000,
+		Settings: sm.CheckSettings{Ping: &sm.PingSettings{}},
+	}
+	require.NoError(t, d.QueueAdHocCheck(t.Context(), &check))
+
+	select {
+	case req := <-stream.sent:
+		require.Equal(t, check, req.AdHocCheck)
+		require.Equal(t, tenant.Id, req.Tenant.Id)
+
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "ad-hoc check not sent")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestTelemetryServer(t *testing.T) {
+	d, tenant, probe := newTestDb(t)
+
+	s, err := NewTelemetryServer(TelemetryServerOpts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d})
+	require.NoError(t, err)
+
+	telemetry := sm.RegionTelemetry{
+		Instance: "instance",
+		RegionId: 1,
+		Telemetry: []*sm.TenantTelemetry{
+			{TenantId: tenant.Id, Telemetry: []*sm.CheckClassTelemetry{{Executions: 10, Duration: 1.5}}},
+		},
+	}
+
+	resp, err := s.PushTelemetry(contextWithProbeId(t.Context(), probe.Id), &telemetry)
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_OK, resp.Status.Code)
+
+	records, err := d.ListTelemetry(t.Context())
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, telemetry, records[0].Telemetry)
+
+	resp, err = s.PushTelemetry(contextWithProbeId(t.Context(), 42), &telemetry)
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_INTERNAL_ERROR, resp.Status.Code)
+
+	_, err = s.PushTelemetry(t.Context(), &telemetry)
+	require.Error(t, err)
+}
+
+func TestK6Server(t *testing.T) {
+	d, _, probe := newTestDb(t)
+
+	s, err := NewK6Server(K6ServerOpts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d})
+	require.NoError(t, err)
+
+	resp, err := s.RegisterK6Version(
+		contextWithProbeId(t.Context(), probe.Id),
+		&sm.RegisterK6VersionRequest{Versions: []sm.K6Version{{Version: "v1.0.0"}, {Version: "v1.1.0"}}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, sm.StatusCode_OK, resp.Status.Code)
+
+	versions, err := d.GetK6Versions(t.Context(), probe.Id)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+
+	_, err = s.RegisterK6Version(t.Context(), &sm.RegisterK6VersionRequest{})
+	require.Error(t, err)
+}
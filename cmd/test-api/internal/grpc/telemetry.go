@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/rs/zerolog"
+)
+
+type TelemetryDb interface {
+	AddTelemetry(ctx context.Context, probeID int64, telemetry *sm.RegionTelemetry) error
+}
+
+type TelemetryServerOpts struct {
+	Logger zerolog.Logger
+	Db     TelemetryDb
+}
+
+// TelemetryServer records the telemetry pushed by the probes.
+type TelemetryServer struct {
+	logger zerolog.Logger
+	db     TelemetryDb
+}
+
+func NewTelemetryServer(opts TelemetryServerOpts) (*TelemetryServer, error) {
+	return &TelemetryServer{
+		logger: opts.Logger,
+		db:     opts.Db,
+	}, nil
+}
+
+func (s *TelemetryServer) PushTelemetry(ctx context.Context, telemetry *sm.RegionTelemetry) (*sm.PushTelemetryResponse, error) {
+	probeID, found := probeIdFromContext(ctx)
+	if !found {
+		return nil, errors.New("invalid probe authorization")
+	}
+
+	if err := s.db.AddTelemetry(ctx, probeID, telemetry); err != nil {
+		return &sm.PushTelemetryResponse{
+			Status: &sm.Status{
+				Code:    sm.StatusCode_INTERNAL_ERROR,
+				Message: err.Error(),
+			},
+		}, nil
+	}
+
+	s.logger.Info().
+		Int64("probe_id", probeID).
+		Str("instance", telemetry.Instance).
+		Int32("region_id", telemetry.RegionId).
+		Int("tenants", len(telemetry.Telemetry)).
+		Msg("telemetry received")
+
+	return &sm.PushTelemetryResponse{Status: &sm.Status{Code: sm.StatusCode_OK}}, nil
+}
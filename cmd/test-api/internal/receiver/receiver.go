@@ -0,0 +1,484 @@
+// Package receiver implements in-memory Prometheus remote-write and Loki
+// push endpoints, so that agents connected to test-api can publish their
+// data without real remotes:
+//
+//	POST /tenants/{id}/api/prom/push          Remote-Write 1.0
+//	POST /tenants/{id}/loki/api/v1/push       Loki push (protobuf)
+//	GET  /api/v1/tenants/{id}/series          received series
+//	GET  /api/v1/tenants/{id}/streams         received log streams
+//	GET  /api/v1/tenants/{id}/received        request and sample counters
+//
+// Push requests must use the credentials of the tenant's remotes, so
+// rotating them makes the agent fail to publish until it gets the new
+// ones. The query endpoints take label=value query parameters to select
+// series or streams, e.g. ?__name__=probe_success&job=ping. Only the
+// latest maxValues samples of each series and entries of each stream are
+// kept.
+package receiver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	logproto "github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/rs/zerolog"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+const (
+	// maxValues is the number of samples kept for each series, and of
+	// entries for each stream.
+	maxValues = 1000
+	// maxBodySize is the maximum size of push requests, compressed.
+	maxBodySize = 10 << 20
+
+	remoteWriteV1ContentType = "application/x-protobuf"
+)
+
+type TenantsDb interface {
+	GetTenant(ctx context.Context, id int64) (*sm.Tenant, error)
+}
+
+type Opts struct {
+	Logger zerolog.Logger
+	Db     TenantsDb
+}
+
+// Receiver stores the data pushed for each tenant.
+type Receiver struct {
+	logger  zerolog.Logger
+	db      TenantsDb
+	mutex   sync.Mutex
+	tenants map[int64]*tenantData
+}
+
+type tenantData struct {
+	series  map[string]*Series
+	streams map[string]*Stream
+	stats   Stats
+}
+
+// Stats counts what was pushed for a tenant.
+type Stats struct {
+	MetricsRequests int64 `json:"metricsRequests"`
+	Series          int64 `json:"series"`
+	Samples         int64 `json:"samples"`
+	Histograms      int64 `json:"histograms"`
+	LogsRequests    int64 `json:"logsRequests"`
+	Streams         int64 `json:"streams"`
+	Entries         int64 `json:"entries"`
+	// Rejected counts requests that failed authentication or could
+	// not be decoded.
+	Rejected int64 `json:"rejected"`
+}
+
+// Series is a received series. Values are strings, as JSON can't
+// represent NaN, and stale markers are reported as "stale".
+type Series struct {
+	Labels  map[string]string `json:"labels"`
+	Samples []Sample          `json:"samples"`
+}
+
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     string    `json:"value"`
+}
+
+// Stream is a received log stream.
+type Stream struct {
+	Labels  string  `json:"labels"`
+	Entries []Entry `json:"entries"`
+
+	labels map[string]string
+}
+
+type Entry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Line      string            `json:"line"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+func New(opts Opts) *Receiver {
+	return &Receiver{
+		logger:  opts.Logger,
+		db:      opts.Db,
+		tenants: make(map[int64]*tenantData),
+	}
+}
+
+// DefaultRemotes returns a function that points the remotes of tenants to
+// the receiver, which is served at baseURL, using a random password.
+func DefaultRemotes(baseURL string) func(tenantID int64) (metrics, events *sm.RemoteInfo) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	return func(tenantID int64) (*sm.RemoteInfo, *sm.RemoteInfo) {
+		id := strconv.FormatInt(tenantID, 10)
+
+		metrics := &sm.RemoteInfo{
+			Name:     "metrics",
+			Url:      fmt.Sprintf("%s/tenants/%s/api/prom", baseURL, id),
+			Username: id,
+			Password: rand.Text(),
+		}
+
+		events := &sm.RemoteInfo{
+			Name:     "logs",
+			Url:      fmt.Sprintf("%s/tenants/%s/loki/api/v1", baseURL, id),
+			Username: id,
+			Password: rand.Text(),
+		}
+
+		return metrics, events
+	}
+}
+
+// RegisterRoutes adds the receiver endpoints to router.
+func (r *Receiver) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("POST /tenants/{id}/api/prom/push", r.pushMetrics)
+	router.HandleFunc("POST /tenants/{id}/loki/api/v1/push", r.pushLogs)
+	router.HandleFunc("GET /api/v1/tenants/{id}/series", r.listSeries)
+	router.HandleFunc("GET /api/v1/tenants/{id}/streams", r.listStreams)
+	router.HandleFunc("GET /api/v1/tenants/{id}/received", r.getStats)
+}
+
+func (r *Receiver) pushMetrics(w http.ResponseWriter, req *http.Request) {
+	if ct := req.Header.Get("Content-Type"); ct != "" && ct != remoteWriteV1ContentType {
+		// The agent falls back to Remote-Write 1.0.
+		http.Error(w, "unsupported content type "+ct, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	tenantID, ok := r.authenticate(w, req, func(t *sm.Tenant) *sm.RemoteInfo { return t.MetricsRemote })
+	if !ok {
+		return
+	}
+
+	var wr prompb.WriteRequest
+
+	if err := r.decode(w, req, &wr); err != nil {
+		r.reject(w, tenantID, err)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data := r.tenant(tenantID)
+	data.stats.MetricsRequests++
+
+	for _, ts := range wr.Timeseries {
+		key, lbls := seriesKey(ts.Labels)
+
+		s, found := data.series[key]
+		if !found {
+			s = &Series{Labels: lbls}
+			data.series[key] = s
+			data.stats.Series++
+		}
+
+		for _, sample := range ts.Samples {
+			s.Samples = appendBounded(s.Samples, Sample{
+				Timestamp: time.UnixMilli(sample.Timestamp).UTC(),
+				Value:     formatValue(sample.Value),
+			})
+		}
+
+		data.stats.Samples += int64(len(ts.Samples))
+		data.stats.Histograms += int64(len(ts.Histograms))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *Receiver) pushLogs(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := r.authenticate(w, req, func(t *sm.Tenant) *sm.RemoteInfo { return t.EventsRemote })
+	if !ok {
+		return
+	}
+
+	var pr logproto.PushRequest
+
+	if err := r.decode(w, req, &pr); err != nil {
+		r.reject(w, tenantID, err)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data := r.tenant(tenantID)
+	data.stats.LogsRequests++
+
+	for _, stream := range pr.Streams {
+		s, found := data.streams[stream.Labels]
+		if !found {
+			lbls, err := parseStreamLabels(stream.Labels)
+			if err != nil {
+				r.logger.Warn().Err(err).Int64("tenant_id", tenantID).Str("labels", stream.Labels).Msg("invalid stream labels")
+			}
+
+			s = &Stream{Labels: stream.Labels, labels: lbls}
+			data.streams[stream.Labels] = s
+			data.stats.Streams++
+		}
+
+		for _, entry := range stream.Entries {
+			e := Entry{Timestamp: entry.Timestamp.UTC(), Line: entry.Line}
+
+			if len(entry.StructuredMetadata) > 0 {
+				e.Metadata = make(map[string]string, len(entry.StructuredMetadata))
+				for _, l := range entry.StructuredMetadata {
+					e.Metadata[l.Name] = l.Value
+				}
+			}
+
+			s.Entries = appendBounded(s.Entries, e)
+		}
+
+		data.stats.Entries += int64(len(stream.Entries))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate checks that the request carries the credentials of the
+// tenant's remote, returning the tenant ID.
+func (r *Receiver) authenticate(w http.ResponseWriter, req *http.Request, remote func(*sm.Tenant) *sm.RemoteInfo) (int64, bool) {
+	tenantID, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid tenant ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	tenant, err := r.db.GetTenant(req.Context(), tenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return 0, false
+	}
+
+	username, password, _ := req.BasicAuth()
+
+	if ri := remote(tenant); ri == nil || ri.Username != username || ri.Password != password {
+		r.reject(w, tenantID, errUnauthorized)
+		return 0, false
+	}
+
+	return tenantID, true
+}
+
+var errUnauthorized = errors.New("invalid credentials")
+
+func (r *Receiver) reject(w http.ResponseWriter, tenantID int64, err error) {
+	r.logger.Warn().Err(err).Int64("tenant_id", tenantID).Msg("rejecting push request")
+
+	r.mutex.Lock()
+	r.tenant(tenantID).stats.Rejected++
+	r.mutex.Unlock()
+
+	code := http.StatusBadRequest
+	if errors.Is(err, errUnauthorized) {
+		code = http.StatusUnauthorized
+	}
+
+	http.Error(w, err.Error(), code)
+}
+
+func (r *Receiver) decode(w http.ResponseWriter, req *http.Request, msg proto.Message) error {
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("reading request: %w", err)
+	}
+
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return fmt.Errorf("decompressing request: %w", err)
+	}
+
+	if err := proto.Unmarshal(buf, msg); err != nil {
+		return fmt.Errorf("decoding request: %w", err)
+	}
+
+	return nil
+}
+
+// tenant returns the data for the tenant, creating it if needed. It must
+// be called with the mutex held.
+func (r *Receiver) tenant(id int64) *tenantData {
+	data, found := r.tenants[id]
+	if !found {
+		data = &tenantData{
+			series:  make(map[string]*Series),
+			streams: make(map[string]*Stream),
+		}
+		r.tenants[id] = data
+	}
+
+	return data
+}
+
+func (r *Receiver) listSeries(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := tenantIDFromPath(w, req)
+	if !ok {
+		return
+	}
+
+	r.mutex.Lock()
+
+	series := []Series{}
+
+	if data, found := r.tenants[tenantID]; found {
+		for _, s := range data.series {
+			if matches(s.Labels, req.URL.Query()) {
+				series = append(series, Series{Labels: s.Labels, Samples: latest(s.Samples)})
+			}
+		}
+	}
+
+	r.mutex.Unlock()
+
+	slices.SortFunc(series, func(a, b Series) int {
+		return labels.Compare(labels.FromMap(a.Labels), labels.FromMap(b.Labels))
+	})
+
+	writeJSON(w, r.logger, series)
+}
+
+func (r *Receiver) listStreams(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := tenantIDFromPath(w, req)
+	if !ok {
+		return
+	}
+
+	r.mutex.Lock()
+
+	streams := []Stream{}
+
+	if data, found := r.tenants[tenantID]; found {
+		for _, s := range data.streams {
+			if matches(s.labels, req.URL.Query()) {
+				streams = append(streams, Stream{Labels: s.Labels, Entries: latest(s.Entries)})
+			}
+		}
+	}
+
+	r.mutex.Unlock()
+
+	slices.SortFunc(streams, func(a, b Stream) int { return strings.Compare(a.Labels, b.Labels) })
+
+	writeJSON(w, r.logger, streams)
+}
+
+func (r *Receiver) getStats(w http.ResponseWriter, req *http.Request) {
+	tenantID, ok := tenantIDFromPath(w, req)
+	if !ok {
+		return
+	}
+
+	r.mutex.Lock()
+
+	var stats Stats
+	if data, found := r.tenants[tenantID]; found {
+		stats = data.stats
+	}
+
+	r.mutex.Unlock()
+
+	writeJSON(w, r.logger, stats)
+}
+
+func tenantIDFromPath(w http.ResponseWriter, req *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid tenant ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// matches returns whether the labels have the values in the query.
+func matches(lbls map[string]string, query url.Values) bool {
+	for name, values := range query {
+		if !slices.Contains(values, lbls[name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// seriesKey returns a key identifying the series with the labels, and the
+// labels as a map.
+func seriesKey(lbls []prompb.Label) (string, map[string]string) {
+	m := make(map[string]string, len(lbls))
+	for _, l := range lbls {
+		m[l.Name] = l.Value
+	}
+
+	return labels.FromMap(m).String(), m
+}
+
+var labelsParser = parser.NewParser(parser.Options{})
+
+// parseStreamLabels parses stream labels in the {name="value", ...}
+// format used by Loki.
+func parseStreamLabels(s string) (map[string]string, error) {
+	lbls, err := labelsParser.ParseMetric(s)
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	return lbls.Map(), nil
+}
+
+func formatValue(v float64) string {
+	if value.IsStaleNaN(v) {
+		return "stale"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// appendBounded appends v to s, keeping the latest maxValues elements.
+// Old elements are dropped in batches, so that appending doesn't copy
+// the slice every time.
+func appendBounded[T any](s []T, v T) []T {
+	s = append(s, v)
+
+	if len(s) >= 2*maxValues {
+		s = slices.Clone(s[len(s)-maxValues:])
+	}
+
+	return s
+}
+
+// latest returns a copy of the latest maxValues elements of s.
+func latest[T any](s []T) []T {
+	return slices.Clone(s[max(len(s)-maxValues, 0):])
+}
+
+func writeJSON(w http.ResponseWriter, logger zerolog.Logger, v any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn().Err(err).Msg("writing receiver response")
+	}
+}
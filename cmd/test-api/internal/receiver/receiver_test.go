@@ -0,0 +1,199 @@
+package receiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	logproto "github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/db"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func newTestReceiver(t *testing.T) (http.Handler, *sm.Tenant) {
+	d := db.New()
+	d.SetDefaultRemotes(DefaultRemotes("http://localhost:4032/"))
+
+	var tenant sm.Tenant
+
+	require.NoError(t, d.AddTenant(t.Context(), &tenant))
+
+	r := New(Opts{Logger: zerolog.New(zerolog.NewTestWriter(t)), Db: d})
+
+	router := http.NewServeMux()
+	r.RegisterRoutes(router)
+
+	return router, &tenant
+}
+
+func push(t *testing.T, h http.Handler, path string, remote *sm.RemoteInfo, msg proto.Message, contentType string) int {
+	t.Helper()
+
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(snappy.Encode(nil, data)))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.SetBasicAuth(remote.Username, remote.Password)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w.Code
+}
+
+func get(t *testing.T, h http.Handler, path string, v any) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+}
+
+func TestDefaultRemotes(t *testing.T) {
+	metrics, events := DefaultRemotes("http://localhost:4032/")(3)
+
+	require.Equal(t, "http://localhost:4032/tenants/3/api/prom", metrics.Url)
+	require.Equal(t, "3", metrics.Username)
+	require.NotEmpty(t, metrics.Password)
+
+	require.Equal(t, "http://localhost:4032/tenants/3/loki/api/v1", events.Url)
+	require.Equal(t, "3", events.Username)
+	require.NotEqual(t, metrics.Password, events.Password)
+}
+
+func TestPushMetrics(t *testing.T) {
+	h, tenant := newTestReceiver(t)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	wr := &prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "probe_success"}, {Name: "job", Value: "ping"}},
+			Samples: []prompb.Sample{{Timestamp: ts.UnixMilli(), Value: 1}},
+		},
+		{
+			Labels: []prompb.Label{{Name: "__name__", Value: "probe_duration_seconds"}, {Name: "job", Value: "ping"}},
+			Samples: []prompb.Sample{
+				{Timestamp: ts.UnixMilli(), Value: math.NaN()},
+				{Timestamp: ts.UnixMilli() + 1, Value: math.Float64frombits(value.StaleNaN)},
+			},
+		},
+	}}
+
+	path := "/tenants/1/api/prom/push"
+
+	require.Equal(t, http.StatusNoContent, push(t, h, path, tenant.MetricsRemote, wr, remoteWriteV1ContentType))
+	require.Equal(t, http.StatusNoContent, push(t, h, path, tenant.MetricsRemote, wr, remoteWriteV1ContentType))
+
+	var series []Series
+
+	get(t, h, "/api/v1/tenants/1/series?__name__=probe_success", &series)
+	require.Equal(t, []Series{
+		{
+			Labels: map[string]string{"__name__": "probe_success", "job": "ping"},
+			Samples: []Sample{
+				{Timestamp: ts, Value: "1"},
+				{Timestamp: ts, Value: "1"},
+			},
+		},
+	}, series)
+
+	get(t, h, "/api/v1/tenants/1/series?job=ping", &series)
+	require.Len(t, series, 2)
+	require.Equal(t, "probe_duration_seconds", series[0].Labels["__name__"])
+	require.Equal(t, "NaN", series[0].Samples[0].Value)
+	require.Equal(t, "stale", series[0].Samples[1].Value)
+
+	get(t, h, "/api/v1/tenants/1/series?job=http", &series)
+	require.Empty(t, series)
+
+	// Wrong credentials, the logs credentials, unknown tenants and
+	// Remote-Write 2.0 requests are rejected.
+	require.Equal(t, http.StatusUnauthorized, push(t, h, path, &sm.RemoteInfo{Username: "1", Password: "wrong"}, wr, remoteWriteV1ContentType))
+	require.Equal(t, http.StatusUnauthorized, push(t, h, path, tenant.EventsRemote, wr, remoteWriteV1ContentType))
+	require.Equal(t, http.StatusNotFound, push(t, h, "/tenants/2/api/prom/push", tenant.MetricsRemote, wr, remoteWriteV1ContentType))
+	require.Equal(t, http.StatusUnsupportedMediaType, push(t, h, path, tenant.MetricsRemote, wr, "application/x-protobuf;proto=io.prometheus.write.v2.Request"))
+
+	var stats Stats
+
+	get(t, h, "/api/v1/tenants/1/received", &stats)
+	require.Equal(t, Stats{MetricsRequests: 2, Series: 2, Samples: 6, Rejected: 2}, stats)
+}
+
+func TestPushLogs(t *testing.T) {
+	h, tenant := newTestReceiver(t)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	pr := &logproto.PushRequest{Streams: []logproto.Stream{
+		{
+			Labels: `{job="ping", probe="test"}`,
+			Entries: []logproto.Entry{
+				{
+					Timestamp:          ts,
+					Line:               "msg=done",
+					StructuredMetadata: logproto.LabelsAdapter{{Name: "execution_id", Value: "1234"}},
+				},
+			},
+		},
+		{
+			Labels:  `{job="http", probe="test"}`,
+			Entries: []logproto.Entry{{Timestamp: ts, Line: "msg=failed"}},
+		},
+	}}
+
+	path := "/tenants/1/loki/api/v1/push"
+
+	require.Equal(t, http.StatusNoContent, push(t, h, path, tenant.EventsRemote, pr, "application/x-protobuf"))
+	require.Equal(t, http.StatusUnauthorized, push(t, h, path, tenant.MetricsRemote, pr, "application/x-protobuf"))
+
+	var streams []Stream
+
+	get(t, h, "/api/v1/tenants/1/streams?job=ping", &streams)
+	require.Equal(t, []Stream{
+		{
+			Labels: `{job="ping", probe="test"}`,
+			Entries: []Entry{
+				{Timestamp: ts, Line: "msg=done", Metadata: map[string]string{"execution_id": "1234"}},
+			},
+		},
+	}, streams)
+
+	get(t, h, "/api/v1/tenants/1/streams", &streams)
+	require.Len(t, streams, 2)
+
+	var stats Stats
+
+	get(t, h, "/api/v1/tenants/1/received", &stats)
+	require.Equal(t, Stats{LogsRequests: 1, Streams: 2, Entries: 2, Rejected: 1}, stats)
+
+	get(t, h, "/api/v1/tenants/2/streams", &streams)
+	require.Empty(t, streams)
+}
+
+func TestAppendBounded(t *testing.T) {
+	var s []int
+
+	for i := range 3 * maxValues {
+		s = appendBounded(s, i)
+	}
+
+	l := latest(s)
+	require.Len(t, l, maxValues)
+	require.Equal(t, 2*maxValues, l[0])
+	require.Equal(t, 3*maxValues-1, l[len(l)-1])
+}
@@ -10,8 +10,10 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/admin"
 	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/db"
 	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/grpc"
+	"github.com/grafana/synthetic-monitoring-agent/cmd/test-api/internal/receiver"
 	"github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
@@ -30,7 +32,10 @@ func run(args []string, stdout io.Writer) error {
 		debug          = flags.Bool("debug", false, "debug output (enables verbose)")
 		verbose        = flags.Bool("verbose", false, "verbose logging")
 		grpcListenAddr = flags.String("grpc-listen-address", ":4031", "GRPC listen address")
+		httpListenAddr = flags.String("http-listen-address", ":4032", "admin HTTP API listen address, empty to disable")
+		receiverURL    = flags.String("receiver-url", "http://localhost:4032", "URL the agents use to reach the admin HTTP server, for the remotes of tenants added without them")
 		dataFn         = flags.String("load-data", "data.json", "filename with data to load")
+		faultsFn       = flags.String("faults", "", "filename with the faults to inject for each probe")
 	)
 
 	if err := flags.Parse(args[1:]); err != nil {
@@ -46,13 +51,33 @@ func run(args []string, stdout io.Writer) error {
 
 	db := db.New()
 
+	var recv *receiver.Receiver
+
+	if *httpListenAddr != "" {
+		recv = receiver.New(receiver.Opts{
+			Logger: zl.With().Str("subsystem", "receiver").Logger(),
+			Db:     db,
+		})
+
+		db.SetDefaultRemotes(receiver.DefaultRemotes(*receiverURL))
+	}
+
 	if err := loadData(*dataFn, db); err != nil {
 		return err
 	}
 
+	faults := grpc.NewFaultInjector()
+
+	if *faultsFn != "" {
+		if err := loadFaults(*faultsFn, faults); err != nil {
+			return err
+		}
+	}
+
 	checksServer, err := grpc.NewChecksServer(grpc.ChecksServerOpts{
 		Logger: zl.With().Str("subsystem", "checks_server").Logger(),
 		Db:     db,
+		Faults: faults,
 	})
 	if err != nil {
 		zl.Error().Err(err).Msg("cannot create checks server")
@@ -68,12 +93,43 @@ func run(args []string, stdout io.Writer) error {
 		return err
 	}
 
+	adHocChecksServer, err := grpc.NewAdHocChecksServer(grpc.AdHocChecksServerOpts{
+		Logger: zl.With().Str("subsystem", "adhoc_server").Logger(),
+		Db:     db,
+		Faults: faults,
+	})
+	if err != nil {
+		zl.Error().Err(err).Msg("cannot create ad-hoc checks server")
+		return err
+	}
+
+	telemetryServer, err := grpc.NewTelemetryServer(grpc.TelemetryServerOpts{
+		Logger: zl.With().Str("subsystem", "telemetry_server").Logger(),
+		Db:     db,
+	})
+	if err != nil {
+		zl.Error().Err(err).Msg("cannot create telemetry server")
+		return err
+	}
+
+	k6Server, err := grpc.NewK6Server(grpc.K6ServerOpts{
+		Logger: zl.With().Str("subsystem", "k6_server").Logger(),
+		Db:     db,
+	})
+	if err != nil {
+		zl.Error().Err(err).Msg("cannot create k6 server")
+		return err
+	}
+
 	grpcServer, err := grpc.NewServer(ctx, &grpc.Opts{
-		Logger:        zl.With().Str("subsystem", "grpc").Logger(),
-		ListenAddr:    *grpcListenAddr,
-		ChecksServer:  checksServer,
-		TenantsServer: tenantsServer,
-		Db:            db,
+		Logger:            zl.With().Str("subsystem", "grpc").Logger(),
+		ListenAddr:        *grpcListenAddr,
+		ChecksServer:      checksServer,
+		TenantsServer:     tenantsServer,
+		AdHocChecksServer: adHocChecksServer,
+		TelemetryServer:   telemetryServer,
+		K6Server:          k6Server,
+		Db:                db,
 	})
 	if err != nil {
 		zl.Error().Err(err).Msg("cannot create GRPC server")
@@ -82,6 +138,23 @@ func run(args []string, stdout io.Writer) error {
 
 	eg.Go(func() error { return grpcServer.Run(ctx) })
 
+	if *httpListenAddr != "" {
+		adminServer, err := admin.NewServer(admin.Opts{
+			Logger:     zl.With().Str("subsystem", "admin").Logger(),
+			ListenAddr: *httpListenAddr,
+			Db:         db,
+			Probes:     checksServer,
+			Faults:     faults,
+			Receiver:   recv,
+		})
+		if err != nil {
+			zl.Error().Err(err).Msg("cannot create admin server")
+			return err
+		}
+
+		eg.Go(func() error { return adminServer.Run(ctx) })
+	}
+
 	if err := eg.Wait(); err != nil {
 		zl.Error().Err(err).Send()
 		return err
@@ -113,10 +186,11 @@ func getLogger(name string, verbose, debug bool, w io.Writer) zerolog.Logger {
 
 func loadData(fn string, db *db.Db) error {
 	var data struct {
-		Tenants     []synthetic_monitoring.Tenant `json:"tenants"`
-		Probes      []synthetic_monitoring.Probe  `json:"probes"`
-		ProbeTokens map[int64]string              `json:"probeTokens"`
-		Checks      []synthetic_monitoring.Check  `json:"checks"`
+		Tenants     []synthetic_monitoring.Tenant     `json:"tenants"`
+		Probes      []synthetic_monitoring.Probe      `json:"probes"`
+		ProbeTokens map[int64]string                  `json:"probeTokens"`
+		Checks      []synthetic_monitoring.Check      `json:"checks"`
+		AdHocChecks []synthetic_monitoring.AdHocCheck `json:"adHocChecks"`
 	}
 
 	fh, err := os.Open(fn) //#nosec -- yes, I want to read whatever file the user tells me.
@@ -157,5 +231,37 @@ func loadData(fn string, db *db.Db) error {
 		}
 	}
 
+	// Ad-hoc checks are sent to the probes as soon as they connect.
+	for _, check := range data.AdHocChecks {
+		if err := db.QueueAdHocCheck(ctx, &check); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadFaults reads the faults to inject from a JSON object keyed by probe
+// ID, e.g.:
+//
+//	{"1": {"registerError": "UNAVAILABLE", "pingDelay": "30s"}}
+func loadFaults(fn string, faults *grpc.FaultInjector) error {
+	data, err := os.ReadFile(fn) //#nosec -- yes, I want to read whatever file the user tells me.
+	if err != nil {
+		return err
+	}
+
+	var probeFaults map[int64]grpc.Faults
+
+	if err := json.Unmarshal(data, &probeFaults); err != nil {
+		return fmt.Errorf("parsing faults: %w", err)
+	}
+
+	for probeID, f := range probeFaults {
+		if err := faults.Set(probeID, f); err != nil {
+			return fmt.Errorf("faults for probe %d: %w", probeID, err)
+		}
+	}
+
 	return nil
 }
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	prompb "github.com/prometheus/prometheus/prompb"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
@@ -44,6 +46,12 @@ type Handler struct {
 	grpcAdhocChecksClientFactory func(conn ClientConn) (sm.AdHocChecksClient, error)
 	proberFactory                prober.ProberFactory
 	supportsProtocolSecrets      bool
+	consensus                    ConsensusOpts
+	// runningMutex protects draining, so that no runner is added to
+	// running once Drain is waiting for them.
+	runningMutex sync.Mutex
+	running      sync.WaitGroup
+	draining     chan struct{}
 }
 
 // Error represents errors returned from this package.
@@ -55,6 +63,7 @@ const (
 	errNotAuthorized       = Error("probe not authorized")
 	errTransportClosing    = Error("transport closing")
 	errProbeUnregistered   = Error("probe no longer registered")
+	errDraining            = Error("draining, not accepting ad-hoc checks")
 	errIncompatibleApi     = Error("API does not support required features")
 	errInvalidAdHocRequest = Error("invalid ad-hoc request")
 	errIdleTimeout         = Error("connection idle timeout")
@@ -65,12 +74,14 @@ const (
 // Removed HTTP status code parsing; we treat all codes.Unavailable as idle timeout.
 
 type runner struct {
-	logger  zerolog.Logger
-	prober  prober.Prober
-	id      string
-	target  string
-	probe   string
-	timeout time.Duration
+	logger    zerolog.Logger
+	prober    prober.Prober
+	id        string
+	target    string
+	probe     string
+	timeout   time.Duration
+	consensus ConsensusOpts
+	sources   []consensusSource
 }
 
 // ClientConn represents the GRPC client connection that can be used to
@@ -118,6 +129,7 @@ type HandlerOpts struct {
 	K6Runner                k6runner.Runner
 	SecretProvider          secrets.SecretProvider
 	SupportsProtocolSecrets bool
+	Consensus               ConsensusOpts
 
 	// these two fields exists so that tests can pass alternate
 	// implementations, they are unexported so that clients of this
@@ -152,6 +164,8 @@ func NewHandler(opts HandlerOpts) (*Handler, error) {
 		grpcAdhocChecksClientFactory: opts.grpcAdhocChecksClientFactory,
 		proberFactory:                prober.NewProberFactory(opts.K6Runner, 0, opts.Features, opts.SecretProvider),
 		supportsProtocolSecrets:      opts.SupportsProtocolSecrets,
+		consensus:                    opts.Consensus,
+		draining:                     make(chan struct{}),
 		api: apiInfo{
 			conn: opts.Conn,
 		},
@@ -177,9 +191,27 @@ func NewHandler(opts HandlerOpts) (*Handler, error) {
 
 // Run starts the handler.
 func (h *Handler) Run(ctx context.Context) error {
+	// The connection to the API uses apiCtx, which is cancelled when
+	// draining, while ad-hoc checks use ctx so that the ones in
+	// progress can finish.
+	apiCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-h.draining:
+			cancel()
+		case <-apiCtx.Done():
+		}
+	}()
+
 	for {
-		err := h.loop(ctx)
+		err := h.loop(apiCtx, ctx)
 		switch {
+		case h.isDraining():
+			h.logger.Info().Msg("drained, not fetching ad-hoc checks again")
+			return nil
+
 		case err == nil:
 			return nil
 
@@ -270,7 +302,7 @@ func (h *Handler) Run(ctx context.Context) error {
 	}
 }
 
-func (h *Handler) loop(ctx context.Context) error {
+func (h *Handler) loop(ctx, runCtx context.Context) error {
 	h.logger.Info().Msg("fetching ad-hoc checks from synthetic-monitoring-api")
 
 	client, err := h.grpcAdhocChecksClientFactory(h.api.conn)
@@ -352,10 +384,12 @@ func (h *Handler) loop(ctx context.Context) error {
 		return grpcErrorHandler("requesting ad-hoc checks from synthetic-monitoring-api", err)
 	}
 
-	return h.processAdHocChecks(ctx, requests)
+	return h.processAdHocChecks(ctx, runCtx, requests)
 }
 
-func (h *Handler) processAdHocChecks(ctx context.Context, client sm.AdHocChecks_GetAdHocChecksClient) error {
+// processAdHocChecks receives ad-hoc checks from client until it's closed
+// or ctx is done, and runs them using runCtx.
+func (h *Handler) processAdHocChecks(ctx, runCtx context.Context, client sm.AdHocChecks_GetAdHocChecksClient) error {
 	for {
 		select {
 		case <-client.Context().Done():
@@ -367,9 +401,12 @@ func (h *Handler) processAdHocChecks(ctx context.Context, client sm.AdHocChecks_
 		default:
 			switch msg, err := client.Recv(); err {
 			case nil:
-				if err := h.handleAdHocCheck(ctx, msg); err != nil {
+				switch err := h.handleAdHocCheck(runCtx, msg); {
+				case errors.Is(err, errDraining):
+					h.logger.Info().Str("check_id", msg.AdHocCheck.Id).Msg("draining, dropping ad-hoc check")
+
+				case err != nil:
 					h.logger.Error().Err(err).Interface("request", msg).Msg("handling ad-hoc check")
-					continue
 				}
 
 			case io.EOF:
@@ -401,7 +438,18 @@ func (h *Handler) handleAdHocCheck(ctx context.Context, ahReq *sm.AdHocRequest)
 		return err
 	}
 
-	go runner.Run(ctx, model.GlobalID(ahReq.AdHocCheck.TenantId), h.publisher)
+	h.runningMutex.Lock()
+
+	if h.isDraining() {
+		h.runningMutex.Unlock()
+		return errDraining
+	}
+
+	h.running.Go(func() {
+		runner.Run(ctx, model.GlobalID(ahReq.AdHocCheck.TenantId), h.publisher)
+	})
+
+	h.runningMutex.Unlock()
 
 	// If there's a tenant in the request, this should be forwarded
 	// to the changes handler.
@@ -412,6 +460,45 @@ func (h *Handler) handleAdHocCheck(ctx context.Context, ahReq *sm.AdHocRequest)
 	return nil
 }
 
+// Drain stops accepting ad-hoc checks and disconnects from the API, without
+// connecting again. It returns once the ad-hoc checks in progress have
+// finished, or ctx is done.
+func (h *Handler) Drain(ctx context.Context) error {
+	h.runningMutex.Lock()
+
+	if !h.isDraining() {
+		close(h.draining)
+	}
+
+	h.runningMutex.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		h.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isDraining returns whether Drain has been called.
+func (h *Handler) isDraining() bool {
+	select {
+	case <-h.draining:
+		return true
+
+	default:
+		return false
+	}
+}
+
 func defaultGrpcAdhocChecksClientFactory(conn ClientConn) (sm.AdHocChecksClient, error) {
 	cc, ok := conn.(*grpc.ClientConn)
 	if !ok {
@@ -465,14 +552,21 @@ func (h *Handler) defaultRunnerFactory(ctx context.Context, req *sm.AdHocRequest
 		timeout += k6AdhocGraceTime
 	}
 
-	return &runner{
+	r := &runner{
 		logger:  h.logger,
 		prober:  p,
 		id:      req.AdHocCheck.Id,
 		target:  target,
 		probe:   h.probe.Name,
 		timeout: timeout,
-	}, nil
+	}
+
+	if h.consensus.enabled() {
+		r.consensus = h.consensus
+		r.sources = h.consensusSources(ctx, check)
+	}
+
+	return r, nil
 }
 
 // sleepCtx is like time.Sleep, but it pays attention to the
@@ -520,66 +614,59 @@ func (l *jsonLogger) Log(keyvals ...any) error {
 	return nil
 }
 
-// Run runs the specified prober once and captures the results using
-// jsonLogger.
+// runResult holds the outcome of a single run of an ad-hoc check.
+type runResult struct {
+	success  bool
+	duration float64 // seconds
+	timedOut bool
+	logs     []map[string]string
+	mfs      []*dto.MetricFamily
+	err      error
+}
+
+// Run runs the specified prober and captures the results using
+// jsonLogger. The prober runs once, unless consensus mode is enabled, in
+// which case aggregated statistics for all the runs are included in the
+// results.
 func (r *runner) Run(ctx context.Context, tenantId model.GlobalID, publisher pusher.Publisher) {
 	r.logger.Info().Msg("running ad-hoc check")
 
 	var (
-		logger   = &jsonLogger{}
-		registry = prometheus.NewRegistry()
 		// This is the execution ID for the check run.
 		executionID = uuid.New().String()
+		// These are the secrets resolved during the check run, by
+		// all of its runs.
+		secretUsage = secrets.NewUsage(0, executionID, r.logger.With().Str("adhocId", r.id).Logger())
+		start       = time.Now()
+		res         runResult
+		consensus   *consensusResult
 	)
 
-	// TODO(mem): decide what to do with these metrics.
-	successGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "probe_success",
-		Help: "whether the check was successful",
-	})
-
-	registry.MustRegister(successGauge)
-
-	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "probe_duration_seconds",
-		Help: "duration of the check in seconds",
-	})
-
-	registry.MustRegister(durationGauge)
-
-	start := time.Now()
-
-	rCtx, cancel := context.WithTimeout(ctx, r.timeout)
-	defer cancel()
-
-	success, duration := r.prober.Probe(rCtx, r.target, registry, logger, executionID)
-
-	if success {
-		successGauge.Set(1)
-	} else {
-		successGauge.Set(0)
-	}
+	ctx = secrets.WithUsage(ctx, secretUsage)
 
-	if duration != 0 {
-		durationGauge.Set(duration)
+	if r.consensus.enabled() {
+		res, consensus = r.runConsensus(ctx, executionID)
 	} else {
-		durationGauge.Set(float64(time.Since(start).Microseconds()) / 1e6)
+		res = r.runOnce(ctx, r.prober, executionID)
 	}
 
-	mfs, err := registry.Gather()
-
 	buf := &bytes.Buffer{}
 	targetLogger := zerolog.New(buf)
 
-	targetLogger.Warn().
-		AnErr("error", err).
+	event := targetLogger.Warn().
+		AnErr("error", res.err).
 		Str("id", r.id).
 		Str("target", r.target).
 		Str("probe", r.probe).
 		Str("check_name", r.prober.Name()).
-		Interface("logs", logger.entries).
-		Interface("timeseries", mfs).
-		Msg("ad-hoc check done")
+		Interface("logs", res.logs).
+		Interface("timeseries", res.mfs)
+
+	if consensus != nil {
+		event = event.Interface("consensus", consensus)
+	}
+
+	event.Msg("ad-hoc check done")
 
 	r.logger.Debug().
 		Str("id", r.id).
@@ -614,6 +701,80 @@ func (r *runner) Run(ctx context.Context, tenantId model.GlobalID, publisher pus
 		Msg("ad-hoc result sent to publisher")
 }
 
+// runOnce runs p once and gathers its logs and metrics.
+func (r *runner) runOnce(ctx context.Context, p prober.Prober, executionID string) runResult {
+	var (
+		logger   = &jsonLogger{}
+		registry = prometheus.NewRegistry()
+	)
+
+	// TODO(mem): decide what to do with these metrics.
+	successGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "whether the check was successful",
+	})
+
+	registry.MustRegister(successGauge)
+
+	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "duration of the check in seconds",
+	})
+
+	registry.MustRegister(durationGauge)
+
+	start := time.Now()
+
+	rCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	success, duration := p.Probe(rCtx, r.target, registry, logger, executionID)
+
+	if success {
+		successGauge.Set(1)
+	} else {
+		successGauge.Set(0)
+	}
+
+	if duration == 0 {
+		duration = float64(time.Since(start).Microseconds()) / 1e6
+	}
+
+	durationGauge.Set(duration)
+
+	mfs, err := registry.Gather()
+
+	return runResult{
+		success:  success,
+		duration: duration,
+		timedOut: !success && errors.Is(rCtx.Err(), context.DeadlineExceeded),
+		logs:     redactLogs(logger.entries, secrets.UsageFromContext(ctx)),
+		mfs:      mfs,
+		err:      err,
+	}
+}
+
+// redactLogs returns entries with the values of the secrets recorded by
+// usage removed from their keys and values.
+func redactLogs(entries []map[string]string, usage *secrets.Usage) []map[string]string {
+	if usage.Empty() {
+		return entries
+	}
+
+	redacted := make([]map[string]string, 0, len(entries))
+
+	for _, entry := range entries {
+		m := make(map[string]string, len(entry))
+		for k, v := range entry {
+			m[usage.Redact(k)] = usage.Redact(v)
+		}
+
+		redacted = append(redacted, m)
+	}
+
+	return redacted
+}
+
 type (
 	TimeSeries = []prompb.TimeSeries
 	Streams    = []logproto.Stream
@@ -1,6 +1,7 @@
 package adhoc
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"github.com/grafana/synthetic-monitoring-agent/internal/prober"
 	"github.com/grafana/synthetic-monitoring-agent/internal/prober/logger"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
 	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
@@ -427,6 +429,54 @@ func (p *testProber) Probe(ctx context.Context, target string, registry *prometh
 	return true, 1
 }
 
+// secretProber resolves a secret and logs its value, like a prober
+// reporting a request URL including it would.
+type secretProber struct{}
+
+func (secretProber) Name() string {
+	return "secret"
+}
+
+func (secretProber) Probe(ctx context.Context, target string, registry *prometheus.Registry, logger logger.Logger, _ string) (bool, float64) {
+	secrets.UsageFromContext(ctx).Record("token", "s3cr3t")
+
+	_ = logger.Log("msg", "making request", "url", "https://example.com/?token=s3cr3t", "s3cr3t", "as key")
+
+	return true, 1
+}
+
+func TestRunnerRunRedactsSecrets(t *testing.T) {
+	t.Parallel()
+
+	var audit bytes.Buffer
+
+	publishCh := make(chan pusher.Payload, 1)
+
+	r := &runner{
+		logger:  zerolog.New(&audit),
+		prober:  secretProber{},
+		id:      "test",
+		target:  "example.com",
+		probe:   "test-probe",
+		timeout: time.Second,
+	}
+
+	r.Run(context.Background(), 1000, channelPublisher(publishCh))
+
+	payload := <-publishCh
+	require.Len(t, payload.Streams(), 1)
+	require.Len(t, payload.Streams()[0].Entries, 1)
+
+	line := payload.Streams()[0].Entries[0].Line
+	require.NotContains(t, line, "s3cr3t")
+	require.Contains(t, line, "https://example.com/?token="+secrets.RedactedValue)
+
+	require.Contains(t, audit.String(), `"event":"secret_resolved"`)
+	require.Contains(t, audit.String(), `"secretName":"token"`)
+	require.Contains(t, audit.String(), `"adhocId":"test"`)
+	require.NotContains(t, audit.String(), "s3cr3t")
+}
+
 func TestIdleTimeoutHandling(t *testing.T) {
 	features := feature.NewCollection()
 	require.NoError(t, features.Set("adhoc"))
@@ -726,3 +776,79 @@ func (r *testK6Runner) Run(ctx context.Context, script k6runner.Script, secretSt
 func (*testK6Runner) Versions(_ context.Context) <-chan []string {
 	return nil // Blocks forever if read.
 }
+
+type blockingProber struct {
+	testProber
+	release chan struct{}
+}
+
+func (p *blockingProber) Probe(ctx context.Context, target string, registry *prometheus.Registry, logger logger.Logger, secretStore string) (bool, float64) {
+	<-p.release
+
+	return p.testProber.Probe(ctx, target, registry, logger, secretStore)
+}
+
+func TestHandlerDrain(t *testing.T) {
+	features := feature.NewCollection()
+	require.NoError(t, features.Set("adhoc"))
+
+	logger := zerolog.New(io.Discard)
+	if testing.Verbose() {
+		logger = zerolog.New(os.Stdout)
+	}
+
+	publishCh := make(chan pusher.Payload, 10)
+	prober := &blockingProber{testProber: testProber{logger}, release: make(chan struct{})}
+
+	opts := HandlerOpts{
+		Logger:         logger,
+		Publisher:      channelPublisher(publishCh),
+		TenantCh:       make(chan sm.Tenant),
+		PromRegisterer: prometheus.NewPedanticRegistry(),
+		Features:       features,
+		runnerFactory: func(ctx context.Context, req *sm.AdHocRequest) (*runner, error) {
+			return &runner{
+				logger: logger,
+				prober: prober,
+				id:     req.AdHocCheck.Id,
+				target: req.AdHocCheck.Target,
+				probe:  "testProbe",
+			}, nil
+		},
+		grpcAdhocChecksClientFactory: func(conn ClientConn) (sm.AdHocChecksClient, error) {
+			return &testClient{logger: logger}, nil
+		},
+	}
+
+	h, err := NewHandler(opts)
+	require.NoError(t, err)
+
+	req := &sm.AdHocRequest{
+		AdHocCheck: sm.AdHocCheck{
+			Id:       "test",
+			Target:   "testTarget",
+			Timeout:  1000,
+			Settings: sm.CheckSettings{Ping: &sm.PingSettings{}},
+		},
+	}
+
+	require.NoError(t, h.handleAdHocCheck(t.Context(), req))
+
+	// The check in progress is waited for, up to the deadline.
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, h.Drain(ctx), context.DeadlineExceeded)
+
+	// New checks are not accepted.
+	require.ErrorIs(t, h.handleAdHocCheck(t.Context(), req), errDraining)
+
+	close(prober.release)
+
+	require.NoError(t, h.Drain(t.Context()))
+	require.Len(t, publishCh, 1)
+
+	// And the handler doesn't fetch checks from the API anymore.
+	require.NoError(t, h.Run(t.Context()))
+	require.Len(t, publishCh, 1)
+}
@@ -0,0 +1,287 @@
+package adhoc
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// ConsensusOpts configures ad-hoc checks to run multiple times and report
+// aggregated statistics, in addition to the results of the last run.
+type ConsensusOpts struct {
+	// Runs is the number of times each ad-hoc check is run. Values
+	// lower than 2 disable consensus mode, including SourceIPs.
+	Runs int
+	// Spacing is the time to wait between consecutive runs.
+	Spacing time.Duration
+	// SourceIPs are additional source addresses to run the checks
+	// from. Addresses that are not available on this host are
+	// ignored, as well as checks that do not support selecting the
+	// source address (only ping, DNS and TCP checks do). They are
+	// only used if Runs is greater than 1.
+	SourceIPs []string
+}
+
+func (o ConsensusOpts) enabled() bool {
+	return o.Runs > 1
+}
+
+func (o ConsensusOpts) runs() int {
+	return max(o.Runs, 1)
+}
+
+// consensusSource is a prober running the check from a specific source
+// address.
+type consensusSource struct {
+	ip     string
+	prober prober.Prober
+}
+
+// latencyStats summarizes the durations of multiple runs, in seconds.
+type latencyStats struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Max    float64 `json:"max"`
+}
+
+// consensusStats aggregates the results of multiple runs of a check.
+type consensusStats struct {
+	Runs         int            `json:"runs"`
+	Successes    int            `json:"successes"`
+	SuccessRatio float64        `json:"success_ratio"`
+	Latency      latencyStats   `json:"latency_seconds"`
+	Errors       map[string]int `json:"errors,omitempty"`
+}
+
+type sourceStats struct {
+	SourceIP string `json:"source_ip"`
+	consensusStats
+}
+
+// consensusResult is the structured result of an ad-hoc check run in
+// consensus mode. The top level statistics correspond to the check as
+// requested; Sources has the statistics for each source address.
+type consensusResult struct {
+	consensusStats
+	Sources []sourceStats `json:"sources,omitempty"`
+}
+
+// runConsensus runs the check the configured number of times, from the
+// default source and from each of the additional sources concurrently. It
+// returns the result of the last run from the default source, and the
+// aggregated statistics.
+func (r *runner) runConsensus(ctx context.Context, executionID string) (runResult, *consensusResult) {
+	var (
+		wg      sync.WaitGroup
+		result  consensusResult
+		sources = make([]sourceStats, len(r.sources))
+	)
+
+	for i, src := range r.sources {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, stats := r.runSeries(ctx, src.prober, executionID)
+			sources[i] = sourceStats{SourceIP: src.ip, consensusStats: stats}
+		}()
+	}
+
+	last, stats := r.runSeries(ctx, r.prober, executionID)
+
+	wg.Wait()
+
+	result.consensusStats = stats
+	result.Sources = sources
+
+	return last, &result
+}
+
+// runSeries runs the check using p the configured number of times, and
+// returns the result of the last run along with the statistics for all of
+// them.
+func (r *runner) runSeries(ctx context.Context, p prober.Prober, executionID string) (runResult, consensusStats) {
+	var (
+		results = make([]runResult, 0, r.consensus.runs())
+		last    runResult
+	)
+
+	for i := range r.consensus.runs() {
+		if i > 0 && sleepCtx(ctx, r.consensus.Spacing) != nil {
+			break
+		}
+
+		last = r.runOnce(ctx, p, executionID)
+		results = append(results, last)
+	}
+
+	return last, summarizeRuns(results)
+}
+
+func summarizeRuns(results []runResult) consensusStats {
+	stats := consensusStats{Runs: len(results)}
+
+	if len(results) == 0 {
+		return stats
+	}
+
+	durations := make([]float64, 0, len(results))
+
+	for _, res := range results {
+		durations = append(durations, res.duration)
+
+		if res.success {
+			stats.Successes++
+			continue
+		}
+
+		if stats.Errors == nil {
+			stats.Errors = make(map[string]int)
+		}
+
+		stats.Errors[res.failureReason()]++
+	}
+
+	slices.Sort(durations)
+
+	stats.SuccessRatio = float64(stats.Successes) / float64(stats.Runs)
+	stats.Latency = latencyStats{
+		Min:    durations[0],
+		Median: median(durations),
+		Max:    durations[len(durations)-1],
+	}
+
+	return stats
+}
+
+// median returns the median of the sorted values.
+func median(values []float64) float64 {
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// failureReason returns a short description of why the run failed, taken
+// from the last error logged by the prober.
+func (res runResult) failureReason() string {
+	if res.timedOut {
+		return "timeout"
+	}
+
+	for _, entry := range slices.Backward(res.logs) {
+		if entry["level"] != "error" {
+			continue
+		}
+
+		if err := entry["err"]; err != "" {
+			return err
+		}
+
+		if msg := entry["msg"]; msg != "" {
+			return msg
+		}
+	}
+
+	return "unknown"
+}
+
+// consensusSources creates a prober for each of the configured source
+// addresses that is available on this host, if the check supports
+// selecting the source address.
+func (h *Handler) consensusSources(ctx context.Context, check model.Check) []consensusSource {
+	if len(h.consensus.SourceIPs) == 0 {
+		return nil
+	}
+
+	switch check.Type() {
+	case sm.CheckTypePing, sm.CheckTypeDns, sm.CheckTypeTcp:
+
+	default:
+		h.logger.Warn().Str("type", check.Type().String()).Msg("check type does not support source addresses, ignoring them")
+		return nil
+	}
+
+	available, err := localAddresses()
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("cannot list local addresses, ignoring source addresses")
+		return nil
+	}
+
+	var sources []consensusSource
+
+	for _, ip := range h.consensus.SourceIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil || !slices.Contains(available, addr.Unmap()) {
+			h.logger.Warn().Str("source_ip", ip).Msg("source address not available on this host, ignoring it")
+			continue
+		}
+
+		srcCheck := check
+		srcCheck.Settings = withSourceIP(check.Settings, ip)
+
+		p, _, err := h.proberFactory.New(ctx, h.logger, srcCheck)
+		if err != nil {
+			h.logger.Warn().Err(err).Str("source_ip", ip).Msg("cannot create prober for source address, ignoring it")
+			continue
+		}
+
+		sources = append(sources, consensusSource{ip: ip, prober: p})
+	}
+
+	return sources
+}
+
+// withSourceIP returns a copy of settings using ip as the source address.
+func withSourceIP(settings sm.CheckSettings, ip string) sm.CheckSettings {
+	switch {
+	case settings.Ping != nil:
+		s := *settings.Ping
+		s.SourceIpAddress = ip
+		settings.Ping = &s
+
+	case settings.Dns != nil:
+		s := *settings.Dns
+		s.SourceIpAddress = ip
+		settings.Dns = &s
+
+	case settings.Tcp != nil:
+		s := *settings.Tcp
+		s.SourceIpAddress = ip
+		settings.Tcp = &s
+	}
+
+	return settings
+}
+
+// localAddresses returns the IP addresses assigned to the interfaces of
+// this host.
+func localAddresses() ([]netip.Addr, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]netip.Addr, 0, len(addrs))
+
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
+		}
+
+		out = append(out, prefix.Addr().Unmap())
+	}
+
+	return out, nil
+}
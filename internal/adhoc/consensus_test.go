@@ -0,0 +1,171 @@
+package adhoc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/feature"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober"
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober/logger"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestConsensusOptsEnabled(t *testing.T) {
+	require.False(t, ConsensusOpts{}.enabled())
+	require.False(t, ConsensusOpts{Runs: 1}.enabled())
+	require.False(t, ConsensusOpts{Runs: 1, SourceIPs: []string{"127.0.0.1"}}.enabled())
+	require.True(t, ConsensusOpts{Runs: 2}.enabled())
+}
+
+func TestSummarizeRuns(t *testing.T) {
+	t.Parallel()
+
+	results := []runResult{
+		{success: true, duration: 0.3},
+		{success: false, duration: 0.1, timedOut: true},
+		{success: true, duration: 0.4},
+		{success: false, duration: 0.2, logs: []map[string]string{
+			{"level": "error", "msg": "Error for HTTP request", "err": "connection refused"},
+			{"level": "info", "msg": "Check failed"},
+		}},
+	}
+
+	stats := summarizeRuns(results)
+
+	require.Equal(t, consensusStats{
+		Runs:         4,
+		Successes:    2,
+		SuccessRatio: 0.5,
+		Latency:      latencyStats{Min: 0.1, Median: 0.25, Max: 0.4},
+		Errors:       map[string]int{"timeout": 1, "connection refused": 1},
+	}, stats)
+
+	require.Equal(t, consensusStats{}, summarizeRuns(nil))
+	require.Equal(t, 0.2, summarizeRuns(results[1:]).Latency.Median)
+}
+
+func TestFailureReason(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "timeout", runResult{timedOut: true}.failureReason())
+	require.Equal(t, "unknown", runResult{}.failureReason())
+	require.Equal(t, "Check failed", runResult{logs: []map[string]string{
+		{"level": "error", "msg": "first"},
+		{"level": "error", "msg": "Check failed"},
+	}}.failureReason())
+}
+
+// flakyProber alternates between success and failure, starting with a
+// success.
+type flakyProber struct {
+	runs int
+}
+
+func (p *flakyProber) Name() string {
+	return "flaky"
+}
+
+func (p *flakyProber) Probe(ctx context.Context, target string, registry *prometheus.Registry, logger logger.Logger, _ string) (bool, float64) {
+	p.runs++
+
+	if p.runs%2 == 0 {
+		_ = logger.Log("level", "error", "msg", "Probe failed", "err", "no route to host")
+		return false, 0.2
+	}
+
+	return true, 0.1
+}
+
+func TestRunnerRunConsensus(t *testing.T) {
+	t.Parallel()
+
+	publishCh := make(chan pusher.Payload, 1)
+
+	r := &runner{
+		logger:    zerolog.New(io.Discard),
+		prober:    &flakyProber{},
+		id:        "test",
+		target:    "example.com",
+		probe:     "test-probe",
+		timeout:   time.Second,
+		consensus: ConsensusOpts{Runs: 3, Spacing: time.Millisecond},
+		sources: []consensusSource{
+			{ip: "127.0.0.1", prober: &flakyProber{runs: 1}},
+		},
+	}
+
+	r.Run(context.Background(), 1000, channelPublisher(publishCh))
+
+	payload := <-publishCh
+	require.Len(t, payload.Streams(), 1)
+	require.Len(t, payload.Streams()[0].Entries, 1)
+
+	var line struct {
+		Message   string          `json:"message"`
+		Logs      []any           `json:"logs"`
+		Consensus consensusResult `json:"consensus"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(payload.Streams()[0].Entries[0].Line), &line))
+	require.Equal(t, "ad-hoc check done", line.Message)
+	require.Empty(t, line.Logs, "the last run succeeded without logging")
+
+	require.Equal(t, consensusStats{
+		Runs:         3,
+		Successes:    2,
+		SuccessRatio: 2.0 / 3,
+		Latency:      latencyStats{Min: 0.1, Median: 0.1, Max: 0.2},
+		Errors:       map[string]int{"no route to host": 1},
+	}, line.Consensus.consensusStats)
+
+	require.Len(t, line.Consensus.Sources, 1)
+	require.Equal(t, "127.0.0.1", line.Consensus.Sources[0].SourceIP)
+	require.Equal(t, 3, line.Consensus.Sources[0].Runs)
+	require.Equal(t, 1, line.Consensus.Sources[0].Successes)
+}
+
+func TestConsensusSources(t *testing.T) {
+	t.Parallel()
+
+	features := feature.NewCollection()
+
+	h := &Handler{
+		logger:        zerolog.New(io.Discard),
+		features:      features,
+		proberFactory: prober.NewProberFactory(nil, 0, features, &testhelper.TestSecretStore{}),
+		consensus: ConsensusOpts{
+			Runs: 2,
+			// 192.0.2.1 is reserved for documentation, it should
+			// never be assigned to a local interface.
+			SourceIPs: []string{"127.0.0.1", "192.0.2.1", "invalid"},
+		},
+	}
+
+	newCheck := func(settings sm.CheckSettings) model.Check {
+		return model.Check{Check: sm.Check{
+			TenantId: 1000,
+			Target:   "127.0.0.1:80",
+			Timeout:  1000,
+			Settings: settings,
+		}}
+	}
+
+	tcpSettings := &sm.TcpSettings{}
+	sources := h.consensusSources(context.Background(), newCheck(sm.CheckSettings{Tcp: tcpSettings}))
+	require.Len(t, sources, 1)
+	require.Equal(t, "127.0.0.1", sources[0].ip)
+	require.Empty(t, tcpSettings.SourceIpAddress, "the original settings must not be modified")
+
+	sources = h.consensusSources(context.Background(), newCheck(sm.CheckSettings{Http: &sm.HttpSettings{}}))
+	require.Empty(t, sources)
+}
@@ -6,7 +6,11 @@
 //
 // Available implementations:
 //   - Memcached: Distributed cache using memcached servers
+//   - Redis: Distributed cache using Redis-compatible servers (standalone, sentinel or cluster)
+//   - Tiered: Local cache in front of a distributed one, with optional stale reads
+//   - Local: In-process cache for single agent deployments
 //   - Noop: No-op cache for testing and fallback (always returns ErrCacheMiss)
+//   - Prefixed: Wrapper adding a prefix to the keys, to share a cache without collisions
 //
 // The cache supports multiple memcached servers, custom expiration times,
 // and automatic serialization/deserialization of Go values using encoding/gob.
@@ -91,7 +95,7 @@ const ErrUnsupportedCacheKind = error_types.BasicError("unsupported cache type")
 
 func (val *Kind) Set(s string) error {
 	switch s {
-	case string(KindAuto), string(KindLocal), string(KindMemcached), string(KindNoop):
+	case string(KindAuto), string(KindLocal), string(KindMemcached), string(KindRedis), string(KindTiered), string(KindNoop):
 		*val = Kind(s)
 
 		return nil
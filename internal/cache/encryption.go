@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/error_types"
+)
+
+const (
+	// ErrInvalidEncryptionKey is returned for keys that are not valid
+	// base64-encoded AES-128, AES-192 or AES-256 keys.
+	ErrInvalidEncryptionKey = error_types.BasicError("invalid cache encryption key")
+
+	// ErrNoEncryptionKeys is returned when a keyring is created without
+	// keys.
+	ErrNoEncryptionKeys = error_types.BasicError("no cache encryption keys")
+
+	// ErrUnencryptedValue is returned when reading a value that wasn't
+	// encrypted from a cache configured with encryption keys.
+	ErrUnencryptedValue = error_types.BasicError("cache value is not encrypted")
+
+	// ErrUnknownEncryptionKey is returned when reading a value encrypted
+	// with a key that's not in the keyring, or that was tampered with.
+	ErrUnknownEncryptionKey = error_types.BasicError("cache value encrypted with an unknown key")
+)
+
+const (
+	envelopeVersion = 1
+	keyIDSize       = 4
+)
+
+// envelopeMagic starts every encrypted value. Gob streams start with a
+// non-zero message length, so they can't be mistaken for one.
+var envelopeMagic = []byte{0x00, 's', 'm'}
+
+// Keyring holds the keys used to encrypt values written to shared caches.
+// Values are encrypted with the first key, and can be decrypted with any of
+// them, which allows rotating keys without flushing the cache: add the new
+// key after the current one on every agent, then move it to the front, and
+// finally drop the old one once its values have expired.
+type Keyring struct {
+	primaryID [keyIDSize]byte
+	keys      map[[keyIDSize]byte]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from raw AES keys. The first key is used for
+// encryption.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoEncryptionKeys
+	}
+
+	k := &Keyring{keys: make(map[[keyIDSize]byte]cipher.AEAD, len(keys))}
+
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+		}
+
+		id := keyID(key)
+		if i == 0 {
+			k.primaryID = id
+		}
+
+		k.keys[id] = aead
+	}
+
+	return k, nil
+}
+
+// ParseKeyring creates a keyring from base64-encoded keys separated by
+// commas or newlines. Empty lines and lines starting with # are ignored.
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys [][]byte
+
+	for line := range strings.Lines(s) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		for field := range strings.SplitSeq(line, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			key, err := base64.StdEncoding.DecodeString(field)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidEncryptionKey, err)
+			}
+
+			keys = append(keys, key)
+		}
+	}
+
+	return NewKeyring(keys...)
+}
+
+// keyID identifies a key in encrypted values without revealing it.
+func keyID(key []byte) [keyIDSize]byte {
+	sum := sha256.Sum256(key)
+
+	var id [keyIDSize]byte
+
+	copy(id[:], sum[:])
+
+	return id
+}
+
+// seal encrypts data with the primary key. The result is the envelope
+// header (magic, version and key ID), followed by the nonce and the
+// ciphertext. The header is authenticated as well.
+func (k *Keyring) seal(data []byte) ([]byte, error) {
+	aead := k.keys[k.primaryID]
+
+	header := make([]byte, 0, len(envelopeMagic)+1+keyIDSize)
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion)
+	header = append(header, k.primaryID[:]...)
+
+	out := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, header)
+
+	nonce := out[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// open decrypts a value produced by seal with any of the keys.
+func (k *Keyring) open(data []byte) ([]byte, error) {
+	headerSize := len(envelopeMagic) + 1 + keyIDSize
+
+	if len(data) < headerSize || !bytes.HasPrefix(data, envelopeMagic) {
+		return nil, ErrUnencryptedValue
+	}
+
+	if version := data[len(envelopeMagic)]; version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported cache envelope version %d", version)
+	}
+
+	var id [keyIDSize]byte
+
+	copy(id[:], data[len(envelopeMagic)+1:headerSize])
+
+	aead, found := k.keys[id]
+	if !found || len(data) < headerSize+aead.NonceSize() {
+		return nil, ErrUnknownEncryptionKey
+	}
+
+	header := data[:headerSize]
+	nonce := data[headerSize : headerSize+aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, data[headerSize+aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrUnknownEncryptionKey
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte, size int) []byte {
+	return bytes.Repeat([]byte{b}, size)
+}
+
+func TestNewKeyring(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		k, err := NewKeyring(testKey(1, size))
+		require.NoError(t, err)
+		require.Len(t, k.keys, 1)
+	}
+
+	_, err := NewKeyring()
+	require.ErrorIs(t, err, ErrNoEncryptionKeys)
+
+	_, err = NewKeyring(testKey(1, 32), testKey(2, 10))
+	require.ErrorIs(t, err, ErrInvalidEncryptionKey)
+}
+
+func TestParseKeyring(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(testKey(1, 32))
+	k2 := base64.StdEncoding.EncodeToString(testKey(2, 32))
+
+	testcases := map[string]struct {
+		input       string
+		expectedErr error
+		expectedLen int
+	}{
+		"single":   {input: k1, expectedLen: 1},
+		"commas":   {input: k1 + ", " + k2, expectedLen: 2},
+		"file":     {input: "# current key\n" + k1 + "\n\n# previous key\n" + k2 + "\n", expectedLen: 2},
+		"empty":    {input: "\n# nothing\n", expectedErr: ErrNoEncryptionKeys},
+		"base64":   {input: "not base64!", expectedErr: ErrInvalidEncryptionKey},
+		"key size": {input: base64.StdEncoding.EncodeToString([]byte("short")), expectedErr: ErrInvalidEncryptionKey},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			k, err := ParseKeyring(tc.input)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, k.keys, tc.expectedLen)
+			require.Equal(t, keyID(testKey(1, 32)), k.primaryID)
+		})
+	}
+}
+
+func TestEncodeDecodeEncrypted(t *testing.T) {
+	secret := TestStruct{ID: 1, Name: "remote-write-password", Tags: []string{"token"}}
+
+	current, err := NewKeyring(testKey(1, 32))
+	require.NoError(t, err)
+
+	encoded, err := encode(secret, current)
+	require.NoError(t, err)
+	require.NotContains(t, string(encoded), secret.Name)
+
+	var decoded TestStruct
+	require.NoError(t, decode(encoded, &decoded, current))
+	require.Equal(t, secret, decoded)
+
+	// Each value gets its own nonce.
+	again, err := encode(secret, current)
+	require.NoError(t, err)
+	require.NotEqual(t, encoded, again)
+
+	t.Run("rotation", func(t *testing.T) {
+		rotated, err := NewKeyring(testKey(2, 32), testKey(1, 32))
+		require.NoError(t, err)
+
+		var decoded TestStruct
+		require.NoError(t, decode(encoded, &decoded, rotated))
+		require.Equal(t, secret, decoded)
+
+		// New values use the new key, which the old keyring doesn't
+		// know about.
+		newEncoded, err := encode(secret, rotated)
+		require.NoError(t, err)
+		require.ErrorIs(t, decode(newEncoded, &decoded, current), ErrUnknownEncryptionKey)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		other, err := NewKeyring(testKey(3, 32))
+		require.NoError(t, err)
+
+		require.ErrorIs(t, decode(encoded, new(TestStruct), other), ErrUnknownEncryptionKey)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := bytes.Clone(encoded)
+		tampered[len(tampered)-1] ^= 0xff
+
+		require.ErrorIs(t, decode(tampered, new(TestStruct), current), ErrUnknownEncryptionKey)
+
+		truncated := encoded[:len(envelopeMagic)+1+keyIDSize+4]
+		require.ErrorIs(t, decode(truncated, new(TestStruct), current), ErrUnknownEncryptionKey)
+	})
+
+	t.Run("unencrypted", func(t *testing.T) {
+		plain, err := encode(secret, nil)
+		require.NoError(t, err)
+
+		require.ErrorIs(t, decode(plain, new(TestStruct), current), ErrUnencryptedValue)
+
+		// Encrypted values are not gob.
+		require.Error(t, decode(encoded, new(TestStruct), nil))
+	})
+
+	t.Run("version", func(t *testing.T) {
+		future := bytes.Clone(encoded)
+		future[len(envelopeMagic)]++
+
+		err := decode(future, new(TestStruct), current)
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrUnknownEncryptionKey)
+	})
+}
+
+func TestRedisClientEncryption(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, nil, "")
+
+	keys, err := NewKeyring(testKey(1, 32))
+	require.NoError(t, err)
+
+	client := newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, Encryption: keys})
+
+	require.NoError(t, client.Set(ctx, "tenant", "remote-write-password", time.Minute))
+
+	srv.mutex.Lock()
+	stored := srv.data["tenant"].value
+	srv.mutex.Unlock()
+
+	require.False(t, strings.Contains(string(stored), "remote-write-password"))
+
+	var got string
+	require.NoError(t, client.Get(ctx, "tenant", &got))
+	require.Equal(t, "remote-write-password", got)
+
+	// Agents without the key can't read the value.
+	plain := newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}})
+	require.Error(t, plain.Get(ctx, "tenant", &got))
+}
@@ -86,7 +86,7 @@ func NewLocal(config LocalConfig) (*Local, error) {
 func (l *Local) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
 	// Serialize value using existing encode function. In principle this is not necessary with Otter, but we need to
 	// support the common interface that uses `any` values.
-	data, err := encode(value)
+	data, err := encode(value, nil)
 	if err != nil {
 		l.logger.Error().Err(err).Str("key", key).Msg("failed to encode value")
 		return fmt.Errorf("cache set: %w", err)
@@ -121,7 +121,7 @@ func (l *Local) Get(ctx context.Context, key string, dest any) error {
 		return ErrCacheMiss
 	}
 
-	if err := decode(data, dest); err != nil {
+	if err := decode(data, dest, nil); err != nil {
 		l.logger.Error().Err(err).Str("key", key).Msg("failed to decode value")
 
 		return fmt.Errorf("cache get: %w", err)
@@ -48,6 +48,8 @@ type MemcachedConfig struct {
 	// Resolver is the DNS resolver to use (optional, defaults to net.DefaultResolver)
 	// This is primarily for testing purposes.
 	Resolver Resolver
+	// Encryption encrypts the values stored in memcached (optional)
+	Encryption *Keyring
 }
 
 // MemcachedClient wraps the memcached client with additional functionality.
@@ -58,6 +60,7 @@ type MemcachedClient struct {
 	originalServers []string
 	cancel          context.CancelFunc
 	resolver        Resolver
+	keys            *Keyring
 }
 
 const KindMemcached Kind = "memcached"
@@ -138,6 +141,7 @@ func NewMemcachedClient(ctx context.Context, config MemcachedConfig) (*Memcached
 		serverList:      serverList,
 		originalServers: config.Servers,
 		cancel:          cancel,
+		keys:            config.Encryption,
 		resolver:        resolver,
 	}
 
@@ -173,7 +177,7 @@ func (c *MemcachedClient) Set(ctx context.Context, key string, value any, expira
 	}
 
 	// Serialize value
-	data, err := encode(value)
+	data, err := encode(value, c.keys)
 	if err != nil {
 		c.logger.Error().Err(err).Str("key", key).Msg("failed to encode value")
 		return fmt.Errorf("cache set: %w", err)
@@ -231,7 +235,7 @@ func (c *MemcachedClient) Get(ctx context.Context, key string, dest any) error {
 	}
 
 	// Deserialize value
-	if err := decode(item.Value, dest); err != nil {
+	if err := decode(item.Value, dest, c.keys); err != nil {
 		c.logger.Error().Err(err).Str("key", key).Msg("failed to decode value")
 		return fmt.Errorf("cache get: %w", err)
 	}
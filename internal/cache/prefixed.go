@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Prefixed is a cache that adds a prefix to all the keys before passing
+// them to another cache. It allows several users to share a cache without
+// their keys colliding.
+type Prefixed struct {
+	cache  Cache
+	prefix string
+}
+
+// Ensure Prefixed implements Cache interface at compile time
+var _ Cache = (*Prefixed)(nil)
+
+// NewPrefixed returns a cache that stores its items in c, adding prefix to
+// their keys.
+func NewPrefixed(c Cache, prefix string) *Prefixed {
+	return &Prefixed{cache: c, prefix: prefix}
+}
+
+// Set stores a value under the prefixed key.
+func (p *Prefixed) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	return p.cache.Set(ctx, p.prefix+key, value, expiration)
+}
+
+// Get retrieves the value stored under the prefixed key.
+func (p *Prefixed) Get(ctx context.Context, key string, dest any) error {
+	return p.cache.Get(ctx, p.prefix+key, dest)
+}
+
+// Delete removes the prefixed key.
+func (p *Prefixed) Delete(ctx context.Context, key string) error {
+	return p.cache.Delete(ctx, p.prefix+key)
+}
+
+// Flush flushes the underlying cache. The caches it's shared with are
+// flushed too, as most implementations cannot remove keys by prefix.
+func (p *Prefixed) Flush(ctx context.Context) error {
+	return p.cache.Flush(ctx)
+}
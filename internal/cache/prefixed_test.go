@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixed(t *testing.T) {
+	ctx := t.Context()
+
+	local, err := NewLocal(LocalConfig{MaxCapacity: 10, Logger: zerolog.Nop()})
+	require.NoError(t, err)
+
+	staging := NewPrefixed(local, "staging:")
+	production := NewPrefixed(local, "production:")
+
+	require.NoError(t, staging.Set(ctx, "tenant:1", "staging", time.Minute))
+	require.NoError(t, production.Set(ctx, "tenant:1", "production", time.Minute))
+
+	var value string
+
+	require.NoError(t, staging.Get(ctx, "tenant:1", &value))
+	require.Equal(t, "staging", value)
+
+	require.NoError(t, production.Get(ctx, "tenant:1", &value))
+	require.Equal(t, "production", value)
+
+	require.NoError(t, local.Get(ctx, "staging:tenant:1", &value))
+	require.Equal(t, "staging", value)
+
+	require.ErrorIs(t, local.Get(ctx, "tenant:1", &value), ErrCacheMiss)
+
+	require.NoError(t, staging.Delete(ctx, "tenant:1"))
+	require.ErrorIs(t, staging.Get(ctx, "tenant:1", &value), ErrCacheMiss)
+	require.NoError(t, production.Get(ctx, "tenant:1", &value))
+}
@@ -0,0 +1,356 @@
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/error_types"
+)
+
+const KindRedis Kind = "redis"
+
+// RedisMode selects how the Redis client finds the server holding a key.
+type RedisMode string
+
+const (
+	// RedisModeStandalone uses a single Redis server.
+	RedisModeStandalone RedisMode = "standalone"
+	// RedisModeSentinel asks Redis Sentinel for the address of the
+	// current master.
+	RedisModeSentinel RedisMode = "sentinel"
+	// RedisModeCluster spreads keys across the masters of a Redis
+	// Cluster.
+	RedisModeCluster RedisMode = "cluster"
+)
+
+const ErrUnsupportedRedisMode = error_types.BasicError("unsupported redis mode")
+
+var _ flag.Value = (*RedisMode)(nil)
+
+func (val *RedisMode) Set(s string) error {
+	switch mode := RedisMode(s); mode {
+	case RedisModeStandalone, RedisModeSentinel, RedisModeCluster:
+		*val = mode
+
+		return nil
+
+	default:
+		return ErrUnsupportedRedisMode
+	}
+}
+
+func (val RedisMode) String() string {
+	return string(val)
+}
+
+// RedisConfig holds configuration for the Redis cache client.
+type RedisConfig struct {
+	// Mode selects the deployment type (optional, defaults to standalone)
+	Mode RedisMode
+	// Addresses is the list of server addresses (host:port). In
+	// standalone mode only the first one is used; in sentinel mode these
+	// are the sentinels; in cluster mode these are the nodes used to
+	// discover the cluster.
+	Addresses []string
+	// MasterName is the name of the master monitored by the sentinels
+	// (required in sentinel mode)
+	MasterName string
+	// Username and Password authenticate with the Redis servers
+	// (optional). Only Password is needed with the legacy requirepass
+	// setting.
+	Username string
+	Password string
+	// SentinelUsername and SentinelPassword authenticate with the
+	// sentinels (optional)
+	SentinelUsername string
+	SentinelPassword string
+	// DB is the logical database to use (optional, not supported in
+	// cluster mode)
+	DB int
+	// TLS enables TLS with the given configuration (optional)
+	TLS *tls.Config
+	// Timeout is the timeout for Redis operations, including connecting
+	// (optional, defaults to 100ms)
+	Timeout time.Duration
+	// MaxIdleConns is the maximum number of idle connections per server
+	// (optional, defaults to 2)
+	MaxIdleConns int
+	// Encryption encrypts the values stored in Redis (optional)
+	Encryption *Keyring
+	// Logger is the logger instance for the cache client
+	Logger zerolog.Logger
+}
+
+// RedisClient is a Cache storing values in Redis or any server compatible
+// with it, like Valkey, using the go-redis client.
+//
+// Values are serialized with gob, like MemcachedClient does, so entries are
+// interchangeable between both.
+type RedisClient struct {
+	mode    RedisMode
+	options *redis.UniversalOptions
+	client  redis.UniversalClient
+	keys    *Keyring
+	logger  zerolog.Logger
+}
+
+// Ensure RedisClient implements Cache interface at compile time
+var _ Cache = (*RedisClient)(nil)
+
+// NewRedisClient creates a new Redis cache client with the provided
+// configuration. It validates the configuration and returns an error if
+// invalid. Connections are established on first use.
+func NewRedisClient(config RedisConfig) (*RedisClient, error) {
+	if config.Mode == "" {
+		config.Mode = RedisModeStandalone
+	}
+
+	if err := config.Mode.Set(string(config.Mode)); err != nil {
+		return nil, fmt.Errorf("%w: %q", err, config.Mode)
+	}
+
+	if len(config.Addresses) == 0 {
+		return nil, fmt.Errorf("at least one redis server must be provided")
+	}
+
+	addresses := make([]string, 0, len(config.Addresses))
+
+	for i, server := range config.Addresses {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			return nil, fmt.Errorf("server address at index %d is empty", i)
+		}
+
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, fmt.Errorf("invalid server address %q: %w", server, err)
+		}
+
+		addresses = append(addresses, server)
+	}
+
+	if config.Mode == RedisModeSentinel && config.MasterName == "" {
+		return nil, fmt.Errorf("a master name is required in %s mode", config.Mode)
+	}
+
+	if config.Mode == RedisModeCluster && config.DB != 0 {
+		return nil, fmt.Errorf("databases other than 0 are not supported in %s mode", config.Mode)
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	if config.MaxIdleConns == 0 {
+		config.MaxIdleConns = DefaultMaxIdleConns
+	}
+
+	options := &redis.UniversalOptions{
+		Addrs:                 addresses,
+		MasterName:            config.MasterName,
+		Username:              config.Username,
+		Password:              config.Password,
+		SentinelUsername:      config.SentinelUsername,
+		SentinelPassword:      config.SentinelPassword,
+		DB:                    config.DB,
+		TLSConfig:             config.TLS,
+		DialTimeout:           config.Timeout,
+		ReadTimeout:           config.Timeout,
+		WriteTimeout:          config.Timeout,
+		PoolTimeout:           config.Timeout,
+		ContextTimeoutEnabled: true,
+		MaxIdleConns:          config.MaxIdleConns,
+		// RESP2 is all GET, SET and DEL need, and every server
+		// compatible with Redis supports it.
+		Protocol: 2,
+		// Some of those servers don't support CLIENT SETINFO either.
+		DisableIdentity: true,
+	}
+
+	var client redis.UniversalClient
+
+	switch config.Mode {
+	case RedisModeSentinel:
+		client = redis.NewFailoverClient(options.Failover())
+
+	case RedisModeCluster:
+		client = redis.NewClusterClient(options.Cluster())
+
+	default:
+		// Only the first address is used.
+		client = redis.NewClient(options.Simple())
+	}
+
+	c := &RedisClient{
+		mode:    config.Mode,
+		options: options,
+		client:  client,
+		keys:    config.Encryption,
+		logger:  config.Logger.With().Str("component", "cache").Logger(),
+	}
+
+	c.logger.Info().
+		Stringer("mode", config.Mode).
+		Strs("servers", addresses).
+		Bool("tls", config.TLS != nil).
+		Dur("timeout", config.Timeout).
+		Int("max_idle_conns", config.MaxIdleConns).
+		Msg("redis cache client initialized")
+
+	return c, nil
+}
+
+// Set stores a value in the cache with the specified expiration time.
+// The value is serialized using gob encoding before storage.
+//
+// Key must be non-empty and at most 250 bytes, the same as for memcached.
+// Use expiration of 0 for no expiration.
+//
+// Returns an error if:
+//   - key is invalid (empty or too long)
+//   - value cannot be serialized
+//   - redis operation fails
+func (c *RedisClient) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	// Validate key
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	// Serialize value
+	data, err := encode(value, c.keys)
+	if err != nil {
+		c.logger.Error().Err(err).Str("key", key).Msg("failed to encode value")
+		return fmt.Errorf("cache set: %w", err)
+	}
+
+	// Like 0, negative expirations mean no expiration; go-redis would
+	// take -1 as KEEPTTL.
+	if err := c.client.Set(ctx, key, data, max(expiration, 0)).Err(); err != nil {
+		c.logger.Error().Err(err).Str("key", key).Msg("cache set failed")
+		return fmt.Errorf("cache set: %w", err)
+	}
+
+	c.logger.Debug().
+		Str("key", key).
+		Int("size", len(data)).
+		Dur("expiration", expiration).
+		Msg("cache set")
+
+	return nil
+}
+
+// Get retrieves a value from the cache and deserializes it into dest.
+// The dest parameter must be a pointer to the target type.
+//
+// Returns ErrCacheMiss if the key is not found in the cache.
+// Returns an error if:
+//   - key is invalid (empty or too long)
+//   - dest is not a pointer
+//   - value cannot be deserialized
+//   - redis operation fails
+func (c *RedisClient) Get(ctx context.Context, key string, dest any) error {
+	// Validate key
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	data, err := c.client.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		c.logger.Debug().Str("key", key).Msg("cache miss")
+		return ErrCacheMiss
+
+	case err != nil:
+		c.logger.Error().Err(err).Str("key", key).Msg("cache get failed")
+		return fmt.Errorf("cache get: %w", err)
+	}
+
+	// Deserialize value
+	if err := decode(data, dest, c.keys); err != nil {
+		c.logger.Error().Err(err).Str("key", key).Msg("failed to decode value")
+		return fmt.Errorf("cache get: %w", err)
+	}
+
+	c.logger.Debug().
+		Str("key", key).
+		Int("size", len(data)).
+		Msg("cache hit")
+
+	return nil
+}
+
+// Delete removes a key from the cache.
+//
+// Returns nil if the key doesn't exist (not an error).
+// Returns an error if:
+//   - key is invalid (empty or too long)
+//   - redis operation fails
+func (c *RedisClient) Delete(ctx context.Context, key string) error {
+	// Validate key
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	n, err := c.client.Del(ctx, key).Result()
+	if err != nil {
+		c.logger.Error().Err(err).Str("key", key).Msg("cache delete failed")
+		return fmt.Errorf("cache delete: %w", err)
+	}
+
+	if n == 0 {
+		// Key doesn't exist, not an error
+		c.logger.Debug().Str("key", key).Msg("cache delete - key not found")
+		return nil
+	}
+
+	c.logger.Debug().Str("key", key).Msg("cache delete")
+
+	return nil
+}
+
+// Flush removes all items from the selected database, on every master in
+// cluster mode. Use this operation cautiously as it affects all cache
+// users.
+func (c *RedisClient) Flush(ctx context.Context) error {
+	var err error
+
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return client.FlushDB(ctx).Err()
+		})
+	} else {
+		err = c.client.FlushDB(ctx).Err()
+	}
+
+	if err != nil {
+		c.logger.Error().Err(err).Msg("cache flush failed")
+		return fmt.Errorf("cache flush: %w", err)
+	}
+
+	c.logger.Info().Msg("cache flushed")
+
+	return nil
+}
+
+// Close closes the connections to the Redis servers. The client must not
+// be used afterwards.
+//
+// Note: This is not part of the Cache interface, so it must be called
+// explicitly if cleanup is needed.
+func (c *RedisClient) Close() error {
+	if err := c.client.Close(); err != nil {
+		return fmt.Errorf("closing redis client: %w", err)
+	}
+
+	c.logger.Debug().Msg("cache client closed")
+
+	return nil
+}
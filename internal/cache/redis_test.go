@@ -0,0 +1,660 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// redisClusterSlots is the number of hash slots in a Redis Cluster.
+const redisClusterSlots = 16384
+
+// redisError is an error reply sent by fakeRedis.
+type redisError string
+
+type fakeRedisEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// fakeRedis is an in-process server implementing the subset of the Redis
+// protocol (RESP2) used by RedisClient.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mutex      sync.Mutex
+	data       map[string]fakeRedisEntry
+	commands   []string
+	master     string         // reply to SENTINEL get-master-addr-by-name
+	slots      []any          // reply to CLUSTER SLOTS
+	owns       func(int) bool // slots served by this node, in cluster mode
+	redirectTo string         // where to redirect keys for other slots
+	conns      []net.Conn
+}
+
+func newFakeRedis(t *testing.T, tlsConfig *tls.Config, password string) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	srv := &fakeRedis{
+		listener: listener,
+		password: password,
+		data:     make(map[string]fakeRedisEntry),
+	}
+
+	go srv.serve()
+
+	t.Cleanup(srv.close)
+
+	return srv
+}
+
+func (s *fakeRedis) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeRedis) close() {
+	_ = s.listener.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+func (s *fakeRedis) setMaster(addr string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.master = addr
+}
+
+func (s *fakeRedis) setCluster(slots []any, owns func(int) bool, redirectTo string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.slots = slots
+	s.owns = owns
+	s.redirectTo = redirectTo
+}
+
+func (s *fakeRedis) keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (s *fakeRedis) commandCount(name string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := 0
+
+	for _, cmd := range s.commands {
+		if cmd == name {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	rd := bufio.NewReader(conn)
+	wr := bufio.NewWriter(conn)
+	authenticated := s.password == ""
+	asking := false
+
+	for {
+		args, err := readFakeRedisCommand(rd)
+		if err != nil {
+			return
+		}
+
+		var reply any
+
+		switch {
+		case len(args) == 0:
+			reply = redisError("ERR empty command")
+
+		case strings.EqualFold(args[0], "AUTH"):
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				reply = "OK"
+			} else {
+				reply = redisError("WRONGPASS invalid username-password pair")
+			}
+
+		case !authenticated:
+			reply = redisError("NOAUTH Authentication required.")
+
+		default:
+			reply = s.exec(args, asking)
+			asking = strings.EqualFold(args[0], "ASKING")
+		}
+
+		writeFakeRedisReply(wr, reply)
+
+		if err := wr.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) exec(args []string, asking bool) any {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cmd := strings.ToUpper(args[0])
+	s.commands = append(s.commands, cmd)
+
+	if len(args) > 1 && s.owns != nil && !asking && (cmd == "GET" || cmd == "SET" || cmd == "DEL") {
+		if slot := redisKeySlot(args[1]); !s.owns(int(slot)) {
+			return redisError(fmt.Sprintf("MOVED %d %s", slot, s.redirectTo))
+		}
+	}
+
+	switch cmd {
+	case "PING":
+		return "PONG"
+
+	case "ASKING", "SELECT":
+		return "OK"
+
+	case "GET":
+		entry, found := s.data[args[1]]
+		if !found || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
+			return nil
+		}
+
+		return entry.value
+
+	case "SET":
+		entry := fakeRedisEntry{value: []byte(args[2])}
+
+		if len(args) == 5 {
+			n, err := strconv.Atoi(args[4])
+			if err != nil {
+				return redisError("ERR value is not an integer or out of range")
+			}
+
+			switch strings.ToUpper(args[3]) {
+			case "PX":
+				entry.expiresAt = time.Now().Add(time.Duration(n) * time.Millisecond)
+
+			case "EX":
+				entry.expiresAt = time.Now().Add(time.Duration(n) * time.Second)
+
+			default:
+				return redisError("ERR syntax error")
+			}
+		}
+
+		s.data[args[1]] = entry
+
+		return "OK"
+
+	case "DEL":
+		_, found := s.data[args[1]]
+		delete(s.data, args[1])
+
+		if found {
+			return int64(1)
+		}
+
+		return int64(0)
+
+	case "FLUSHDB":
+		s.data = make(map[string]fakeRedisEntry)
+		return "OK"
+
+	case "SENTINEL":
+		if len(args) < 2 || !strings.EqualFold(args[1], "get-master-addr-by-name") {
+			// No other sentinels or replicas.
+			return []any{}
+		}
+
+		if s.master == "" {
+			return nil
+		}
+
+		host, port, _ := net.SplitHostPort(s.master)
+
+		return []any{[]byte(host), []byte(port)}
+
+	case "CLUSTER":
+		return s.slots
+
+	default:
+		return redisError("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+// readFakeRedisCommand reads a command, sent as an array of bulk strings.
+func readFakeRedisCommand(rd *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		line, found := strings.CutSuffix(line, "\r\n")
+		if !found || len(line) < 2 || line[0] != prefix {
+			return 0, fmt.Errorf("unexpected line %q", line)
+		}
+
+		return strconv.Atoi(line[1:])
+	}
+
+	n, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+
+	for range n {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func writeFakeRedisReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+
+	case string:
+		fmt.Fprintf(w, "+%s\r\n", v)
+
+	case redisError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+
+	case []byte:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+
+		for _, elem := range v {
+			writeFakeRedisReply(w, elem)
+		}
+	}
+}
+
+// clusterSlotRange builds a CLUSTER SLOTS entry served by the node at addr.
+func clusterSlotRange(first, last int, addr string) []any {
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.ParseInt(port, 10, 64)
+
+	return []any{int64(first), int64(last), []any{[]byte(host), p, []byte("node-id")}}
+}
+
+func TestRedisModeSet(t *testing.T) {
+	var mode RedisMode
+
+	require.NoError(t, mode.Set("cluster"))
+	require.Equal(t, RedisModeCluster, mode)
+	require.Equal(t, "cluster", mode.String())
+	require.ErrorIs(t, mode.Set("ring"), ErrUnsupportedRedisMode)
+
+	var kind Kind
+
+	require.NoError(t, kind.Set("redis"))
+	require.Equal(t, KindRedis, kind)
+}
+
+func TestNewRedisClient(t *testing.T) {
+	testcases := map[string]struct {
+		config    RedisConfig
+		expectErr bool
+	}{
+		"standalone": {
+			config: RedisConfig{Addresses: []string{"localhost:6379"}},
+		},
+		"no servers": {
+			config:    RedisConfig{},
+			expectErr: true,
+		},
+		"invalid address": {
+			config:    RedisConfig{Addresses: []string{"localhost"}},
+			expectErr: true,
+		},
+		"empty address": {
+			config:    RedisConfig{Addresses: []string{"localhost:6379", " "}},
+			expectErr: true,
+		},
+		"invalid mode": {
+			config:    RedisConfig{Mode: "ring", Addresses: []string{"localhost:6379"}},
+			expectErr: true,
+		},
+		"sentinel without master name": {
+			config:    RedisConfig{Mode: RedisModeSentinel, Addresses: []string{"localhost:26379"}},
+			expectErr: true,
+		},
+		"cluster with database": {
+			config:    RedisConfig{Mode: RedisModeCluster, Addresses: []string{"localhost:6379"}, DB: 1},
+			expectErr: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			tc.config.Logger = testLogger()
+
+			client, err := NewRedisClient(tc.config)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Implements(t, (*Cache)(nil), client)
+			require.Equal(t, DefaultTimeout, client.options.ReadTimeout)
+			require.Equal(t, DefaultMaxIdleConns, client.options.MaxIdleConns)
+			require.NoError(t, client.Close())
+		})
+	}
+}
+
+func newTestRedisClient(t *testing.T, config RedisConfig) *RedisClient {
+	t.Helper()
+
+	config.Logger = testLogger()
+	config.Timeout = time.Second
+
+	client, err := NewRedisClient(config)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client
+}
+
+func TestRedisClient(t *testing.T) {
+	type testStruct struct {
+		Name  string
+		Count int
+	}
+
+	ctx := context.Background()
+	srv := newFakeRedis(t, nil, "")
+	client := newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, DB: 2})
+
+	var dest testStruct
+
+	require.ErrorIs(t, client.Get(ctx, "missing", &dest), ErrCacheMiss)
+
+	require.NoError(t, client.Set(ctx, "key", testStruct{Name: "test", Count: 3}, time.Minute))
+	require.NoError(t, client.Get(ctx, "key", &dest))
+	require.Equal(t, testStruct{Name: "test", Count: 3}, dest)
+
+	// Values that can't be decoded into dest are reported.
+	var wrong int
+	require.Error(t, client.Get(ctx, "key", &wrong))
+
+	require.NoError(t, client.Delete(ctx, "key"))
+	require.NoError(t, client.Delete(ctx, "key"))
+	require.ErrorIs(t, client.Get(ctx, "key", &dest), ErrCacheMiss)
+
+	// Expiration is honoured.
+	require.NoError(t, client.Set(ctx, "short", "value", 50*time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	require.ErrorIs(t, client.Get(ctx, "short", new(string)), ErrCacheMiss)
+
+	require.NoError(t, client.Set(ctx, "a", "value", 0))
+	require.NoError(t, client.Flush(ctx))
+	require.Empty(t, srv.keys())
+
+	// Keys are validated the same way as for memcached.
+	require.Error(t, client.Set(ctx, "", "value", 0))
+	require.Error(t, client.Get(ctx, strings.Repeat("k", MaxKeyLength+1), &dest))
+	require.Error(t, client.Delete(ctx, ""))
+
+	// Connections are reused, and the database selected on each.
+	require.Equal(t, 1, srv.commandCount("SELECT"))
+
+	// Idle connections closed by the server are replaced.
+	srv.close()
+
+	srv2 := newFakeRedis(t, nil, "")
+	client = newTestRedisClient(t, RedisConfig{Addresses: []string{srv2.addr()}})
+	require.NoError(t, client.Set(ctx, "key", "value", 0))
+
+	srv2.mutex.Lock()
+	for _, conn := range srv2.conns {
+		_ = conn.Close()
+	}
+	srv2.mutex.Unlock()
+
+	require.NoError(t, client.Get(ctx, "key", new(string)))
+}
+
+func TestRedisClientAuth(t *testing.T) {
+	ctx := context.Background()
+	srv := newFakeRedis(t, nil, "s3cr3t")
+
+	client := newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, Username: "agent", Password: "s3cr3t"})
+	require.NoError(t, client.Set(ctx, "key", "value", 0))
+
+	client = newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, Password: "wrong"})
+	require.ErrorContains(t, client.Set(ctx, "key", "value", 0), "WRONGPASS")
+
+	client = newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}})
+	require.ErrorContains(t, client.Set(ctx, "key", "value", 0), "NOAUTH")
+}
+
+func TestRedisClientTLS(t *testing.T) {
+	ctx := context.Background()
+
+	// Borrow the certificate of the httptest package, valid for
+	// 127.0.0.1.
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	serverConfig := &tls.Config{Certificates: ts.TLS.Certificates}
+	clientConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	ts.Close()
+
+	srv := newFakeRedis(t, serverConfig, "")
+
+	client := newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, TLS: clientConfig})
+	require.NoError(t, client.Set(ctx, "key", "value", 0))
+
+	var value string
+	require.NoError(t, client.Get(ctx, "key", &value))
+	require.Equal(t, "value", value)
+
+	// The server certificate is verified.
+	client = newTestRedisClient(t, RedisConfig{Addresses: []string{srv.addr()}, TLS: &tls.Config{}})
+	require.Error(t, client.Set(ctx, "key", "value", 0))
+}
+
+func TestRedisClientSentinel(t *testing.T) {
+	ctx := context.Background()
+
+	master := newFakeRedis(t, nil, "data")
+
+	sentinel := newFakeRedis(t, nil, "sentinel")
+	sentinel.setMaster(master.addr())
+
+	down := newFakeRedis(t, nil, "")
+	down.close()
+
+	client := newTestRedisClient(t, RedisConfig{
+		Mode:             RedisModeSentinel,
+		Addresses:        []string{down.addr(), sentinel.addr()},
+		MasterName:       "mymaster",
+		Password:         "data",
+		SentinelPassword: "sentinel",
+	})
+
+	require.NoError(t, client.Set(ctx, "key", "value", 0))
+	require.Equal(t, []string{"key"}, master.keys())
+	require.NoError(t, client.Get(ctx, "key", new(string)))
+
+	// After a failover, the new master is discovered once the old one
+	// fails.
+	promoted := newFakeRedis(t, nil, "data")
+	sentinel.setMaster(promoted.addr())
+
+	master.close()
+
+	require.Eventually(t, func() bool {
+		return errors.Is(client.Get(ctx, "key", new(string)), ErrCacheMiss)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Set(ctx, "key", "value", 0))
+	require.Equal(t, []string{"key"}, promoted.keys())
+
+	// Unknown masters are reported.
+	sentinel.setMaster("")
+
+	client = newTestRedisClient(t, RedisConfig{
+		Mode:             RedisModeSentinel,
+		Addresses:        []string{sentinel.addr()},
+		MasterName:       "other",
+		SentinelPassword: "sentinel",
+	})
+	require.ErrorContains(t, client.Set(ctx, "key", "value", 0), "all sentinels specified in configuration are unreachable")
+}
+
+func TestRedisClientCluster(t *testing.T) {
+	ctx := context.Background()
+
+	const half = redisClusterSlots / 2
+
+	node1 := newFakeRedis(t, nil, "")
+	node2 := newFakeRedis(t, nil, "")
+
+	slots := []any{
+		clusterSlotRange(0, half-1, node1.addr()),
+		clusterSlotRange(half, redisClusterSlots-1, node2.addr()),
+	}
+	node1.setCluster(slots, func(slot int) bool { return slot < half }, node2.addr())
+	node2.setCluster(slots, func(slot int) bool { return slot >= half }, node1.addr())
+
+	client := newTestRedisClient(t, RedisConfig{Mode: RedisModeCluster, Addresses: []string{node1.addr()}})
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		require.NoError(t, client.Set(ctx, keys[i], i, 0))
+	}
+
+	for i, key := range keys {
+		var value int
+		require.NoError(t, client.Get(ctx, key, &value))
+		require.Equal(t, i, value)
+	}
+
+	// Keys end up in the node owning their slot, without redirections.
+	require.NotEmpty(t, node1.keys())
+	require.NotEmpty(t, node2.keys())
+	require.Len(t, append(node1.keys(), node2.keys()...), len(keys))
+	require.Equal(t, 1, node1.commandCount("CLUSTER"))
+
+	// Moving all slots to the first node is followed.
+	slots = []any{clusterSlotRange(0, redisClusterSlots-1, node1.addr())}
+	node1.setCluster(slots, func(int) bool { return true }, "")
+	node2.setCluster(slots, func(int) bool { return false }, node1.addr())
+
+	for _, key := range keys {
+		require.NoError(t, client.Set(ctx, key, 0, 0))
+	}
+
+	require.Len(t, node1.keys(), len(keys))
+
+	// Flush affects all the masters.
+	require.NoError(t, client.Flush(ctx))
+	require.Empty(t, node1.keys())
+}
+
+// redisKeySlot returns the hash slot of key, for fakeRedis to decide
+// whether it serves it. If the key contains a non-empty hash tag, like
+// "{user}.name", only the tag is hashed.
+func redisKeySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return crc16(key) % redisClusterSlots
+}
+
+// crc16 implements CRC-16/XMODEM, the checksum used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := range len(s) {
+		crc ^= uint16(s[i]) << 8
+
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
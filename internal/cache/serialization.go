@@ -9,7 +9,10 @@ import (
 // encode serializes a Go value to bytes using gob encoding.
 // The value must be a gob-encodable type (no unexported fields in structs,
 // no channels, functions, etc.).
-func encode(value any) ([]byte, error) {
+//
+// If keys is not nil, the serialized value is encrypted with its primary
+// key.
+func encode(value any, keys *Keyring) ([]byte, error) {
 	var buf bytes.Buffer
 
 	enc := gob.NewEncoder(&buf)
@@ -18,12 +21,32 @@ func encode(value any) ([]byte, error) {
 		return nil, fmt.Errorf("failed to encode value: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	if keys == nil {
+		return buf.Bytes(), nil
+	}
+
+	data, err := keys.seal(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt value: %w", err)
+	}
+
+	return data, nil
 }
 
 // decode deserializes bytes to a Go value using gob decoding.
 // The dest parameter must be a pointer to the target type.
-func decode(data []byte, dest any) error {
+//
+// If keys is not nil, data must have been encrypted with one of its keys.
+func decode(data []byte, dest any, keys *Keyring) error {
+	if keys != nil {
+		var err error
+
+		data, err = keys.open(data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt value: %w", err)
+		}
+	}
+
 	buf := bytes.NewBuffer(data)
 	dec := gob.NewDecoder(buf)
 
@@ -16,26 +16,26 @@ type TestStruct struct {
 func TestEncodeDecode(t *testing.T) {
 	t.Run("string", func(t *testing.T) {
 		original := "hello world"
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded string
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
 
 	t.Run("int", func(t *testing.T) {
 		original := 42
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded int
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
@@ -46,39 +46,39 @@ func TestEncodeDecode(t *testing.T) {
 			Name: "test",
 			Tags: []string{"a", "b", "c"},
 		}
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded TestStruct
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
 
 	t.Run("slice", func(t *testing.T) {
 		original := []string{"a", "b", "c"}
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded []string
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
 
 	t.Run("map", func(t *testing.T) {
 		original := map[string]int{"a": 1, "b": 2}
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded map[string]int
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
@@ -89,13 +89,13 @@ func TestEncodeDecode(t *testing.T) {
 			Name: "pointer test",
 			Tags: []string{"x", "y"},
 		}
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded *TestStruct
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Equal(t, original, decoded)
 	})
@@ -115,7 +115,7 @@ func TestEncodeErrors(t *testing.T) {
 
 	for name, tc := range testcases {
 		t.Run(name, func(t *testing.T) {
-			_, err := encode(tc.value)
+			_, err := encode(tc.value, nil)
 			require.Error(t, err)
 		})
 	}
@@ -125,31 +125,31 @@ func TestDecodeErrors(t *testing.T) {
 	t.Run("invalid data", func(t *testing.T) {
 		var dest string
 
-		err := decode([]byte("invalid gob data"), &dest)
+		err := decode([]byte("invalid gob data"), &dest, nil)
 		require.Error(t, err)
 	})
 
 	t.Run("type mismatch", func(t *testing.T) {
 		// Encode a string
-		encoded, err := encode("hello")
+		encoded, err := encode("hello", nil)
 		require.NoError(t, err)
 
 		// Try to decode as int
 		var dest int
 
-		err = decode(encoded, &dest)
+		err = decode(encoded, &dest, nil)
 		require.Error(t, err)
 	})
 
 	t.Run("non-pointer destination", func(t *testing.T) {
-		encoded, err := encode("hello")
+		encoded, err := encode("hello", nil)
 		require.NoError(t, err)
 
 		// This should fail because dest is not a pointer
 		var dest string
 		// Note: We need to pass dest directly (not &dest) to test this
 		// But gob.Decode requires a pointer, so this will fail
-		err = decode(encoded, dest)
+		err = decode(encoded, dest, nil)
 		require.Error(t, err)
 	})
 }
@@ -158,13 +158,13 @@ func TestEncodeDecodeNil(t *testing.T) {
 	t.Run("nil slice", func(t *testing.T) {
 		var original []string
 
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded []string
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		require.Nil(t, decoded)
 	})
@@ -172,13 +172,13 @@ func TestEncodeDecodeNil(t *testing.T) {
 	t.Run("nil map", func(t *testing.T) {
 		var original map[string]int
 
-		encoded, err := encode(original)
+		encoded, err := encode(original, nil)
 		require.NoError(t, err)
 		require.NotEmpty(t, encoded)
 
 		var decoded map[string]int
 
-		err = decode(encoded, &decoded)
+		err = decode(encoded, &decoded, nil)
 		require.NoError(t, err)
 		// Note: gob decodes nil maps as empty maps, this is expected behavior
 		require.Empty(t, decoded)
@@ -203,12 +203,12 @@ func TestEncodeDecodeComplexStruct(t *testing.T) {
 		},
 	}
 
-	encoded, err := encode(original)
+	encoded, err := encode(original, nil)
 	require.NoError(t, err)
 
 	var decoded NestedStruct
 
-	err = decode(encoded, &decoded)
+	err = decode(encoded, &decoded, nil)
 	require.NoError(t, err)
 	require.Equal(t, original, decoded)
 }
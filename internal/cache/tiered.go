@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultTieredLocalTTL is the default time values are served from
+	// the local tier before the remote one is consulted again.
+	DefaultTieredLocalTTL = 30 * time.Second
+
+	tierLocal  = "local"
+	tierRemote = "remote"
+
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultStale = "stale"
+	resultError = "error"
+)
+
+// KindTiered selects a local cache in front of a shared one.
+const KindTiered Kind = "tiered"
+
+// TieredConfig holds configuration for the two-tier cache.
+type TieredConfig struct {
+	// Local is the in-process tier, consulted first (required)
+	Local *Local
+	// Remote is the tier shared by all agents, like a MemcachedClient
+	// (required)
+	Remote Cache
+	// LocalTTL bounds how long values are served from the local tier
+	// without consulting the remote one (optional, defaults to 30s)
+	LocalTTL time.Duration
+	// StaleTTL is how long past LocalTTL values are kept in the local
+	// tier, to be returned when the remote tier fails (optional, 0
+	// disables stale reads)
+	StaleTTL time.Duration
+	// Registerer is used to register the hit and miss metrics of both
+	// tiers (optional)
+	Registerer prometheus.Registerer
+	// Logger is the logger instance for the cache
+	Logger zerolog.Logger
+}
+
+// Tiered is a Cache keeping recently used values in a local cache in
+// front of a remote one. Writes go to both tiers. Reads are served from the
+// local tier for a short time, so values written by other agents are seen
+// at most LocalTTL late.
+type Tiered struct {
+	local    *Local
+	remote   Cache
+	localTTL time.Duration
+	staleTTL time.Duration
+	logger   zerolog.Logger
+	metrics  tieredMetrics
+	now      func() time.Time
+}
+
+// tieredEntry is what the local tier stores for each value.
+type tieredEntry struct {
+	Data       []byte
+	FreshUntil time.Time
+}
+
+// Ensure Tiered implements Cache interface at compile time
+var _ Cache = (*Tiered)(nil)
+
+// NewTiered creates a two-tier cache with the provided configuration.
+func NewTiered(config TieredConfig) (*Tiered, error) {
+	if config.Local == nil || config.Remote == nil {
+		return nil, fmt.Errorf("both local and remote caches must be provided")
+	}
+
+	if config.LocalTTL <= 0 {
+		config.LocalTTL = DefaultTieredLocalTTL
+	}
+
+	if config.StaleTTL < 0 {
+		return nil, fmt.Errorf("stale TTL cannot be negative, got %s", config.StaleTTL)
+	}
+
+	c := &Tiered{
+		local:    config.Local,
+		remote:   config.Remote,
+		localTTL: config.LocalTTL,
+		staleTTL: config.StaleTTL,
+		logger:   config.Logger.With().Str("component", "cache").Str("type", "tiered").Logger(),
+		metrics:  newTieredMetrics(config.Registerer),
+		now:      time.Now,
+	}
+
+	c.logger.Info().
+		Dur("local_ttl", config.LocalTTL).
+		Dur("stale_ttl", config.StaleTTL).
+		Msg("tiered cache initialized")
+
+	return c, nil
+}
+
+// Set stores a value in both tiers. The value is kept in the local tier
+// for at most LocalTTL (plus StaleTTL for stale reads), even if expiration
+// is longer.
+//
+// If the remote tier fails, the value is still stored locally and the
+// error is returned.
+func (c *Tiered) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	data, err := encode(value, nil)
+	if err != nil {
+		c.logger.Error().Err(err).Str("key", key).Msg("failed to encode value")
+		return fmt.Errorf("cache set: %w", err)
+	}
+
+	remoteErr := c.remote.Set(ctx, key, value, expiration)
+
+	c.setLocal(ctx, key, data, expiration)
+
+	return remoteErr
+}
+
+// Get retrieves a value from the local tier if it's fresh there, or from
+// the remote one otherwise, refreshing the local copy. If the remote tier
+// fails and stale reads are enabled, the local copy is returned even if
+// it's no longer fresh.
+//
+// Returns ErrCacheMiss if the key is not found in the remote tier.
+func (c *Tiered) Get(ctx context.Context, key string, dest any) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	var (
+		entry    tieredEntry
+		hasEntry bool
+	)
+
+	switch err := c.local.Get(ctx, key, &entry); {
+	case err == nil && c.now().Before(entry.FreshUntil):
+		if err := decode(entry.Data, dest, nil); err != nil {
+			c.logger.Error().Err(err).Str("key", key).Msg("failed to decode value")
+			return fmt.Errorf("cache get: %w", err)
+		}
+
+		c.metrics.requests.WithLabelValues(tierLocal, resultHit).Inc()
+
+		return nil
+
+	case err == nil:
+		hasEntry = true
+
+		c.metrics.requests.WithLabelValues(tierLocal, resultStale).Inc()
+
+	case errors.Is(err, ErrCacheMiss):
+		c.metrics.requests.WithLabelValues(tierLocal, resultMiss).Inc()
+
+	default:
+		// Unreadable local entries are replaced below.
+		c.metrics.requests.WithLabelValues(tierLocal, resultError).Inc()
+	}
+
+	err := c.remote.Get(ctx, key, dest)
+
+	switch {
+	case err == nil:
+		c.metrics.requests.WithLabelValues(tierRemote, resultHit).Inc()
+
+		if data, err := encode(dest, nil); err == nil {
+			c.setLocal(ctx, key, data, 0)
+		}
+
+		return nil
+
+	case errors.Is(err, ErrCacheMiss):
+		c.metrics.requests.WithLabelValues(tierRemote, resultMiss).Inc()
+
+		// Deleted or expired in the remote tier.
+		_ = c.local.Delete(ctx, key)
+
+		return ErrCacheMiss
+
+	default:
+		c.metrics.requests.WithLabelValues(tierRemote, resultError).Inc()
+
+		if !hasEntry || c.staleTTL == 0 {
+			return err
+		}
+
+		if decodeErr := decode(entry.Data, dest, nil); decodeErr != nil {
+			return err
+		}
+
+		c.metrics.staleReads.Inc()
+
+		c.logger.Warn().
+			Err(err).
+			Str("key", key).
+			Time("fresh_until", entry.FreshUntil).
+			Msg("remote cache failed, returning stale local value")
+
+		return nil
+	}
+}
+
+// Delete removes a key from both tiers.
+func (c *Tiered) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	_ = c.local.Delete(ctx, key)
+
+	return c.remote.Delete(ctx, key)
+}
+
+// Flush removes all items from both tiers.
+func (c *Tiered) Flush(ctx context.Context) error {
+	return errors.Join(c.local.Flush(ctx), c.remote.Flush(ctx))
+}
+
+// Close closes both tiers, if they need it.
+func (c *Tiered) Close() error {
+	errs := []error{c.local.Close()}
+
+	if closer, ok := c.remote.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// setLocal stores the encoded value in the local tier, fresh for LocalTTL
+// or expiration, whichever is shorter.
+func (c *Tiered) setLocal(ctx context.Context, key string, data []byte, expiration time.Duration) {
+	freshFor := c.localTTL
+	if expiration > 0 && expiration < freshFor {
+		freshFor = expiration
+	}
+
+	entry := tieredEntry{Data: data, FreshUntil: c.now().Add(freshFor)}
+
+	if err := c.local.Set(ctx, key, entry, freshFor+c.staleTTL); err != nil {
+		c.logger.Warn().Err(err).Str("key", key).Msg("failed to store value in local tier")
+	}
+}
+
+// tieredMetrics are the metrics exposed by the tiered cache.
+type tieredMetrics struct {
+	requests   *prometheus.CounterVec
+	staleReads prometheus.Counter
+}
+
+func newTieredMetrics(registerer prometheus.Registerer) tieredMetrics {
+	m := tieredMetrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "sm_agent",
+				Subsystem: "cache",
+				Name:      "requests_total",
+				Help:      "Total number of cache lookups by tier and result.",
+			},
+			[]string{"tier", "result"},
+		),
+		staleReads: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: "sm_agent",
+				Subsystem: "cache",
+				Name:      "stale_reads_total",
+				Help:      "Total number of stale local values returned because the remote cache failed.",
+			},
+		),
+	}
+
+	if registerer != nil {
+		registerer.MustRegister(m.requests, m.staleReads)
+	}
+
+	return m
+}
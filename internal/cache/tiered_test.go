@@ -0,0 +1,362 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+var errRemoteDown = errors.New("remote down")
+
+// fakeRemote is a Cache backed by a Local one that can be made to fail.
+type fakeRemote struct {
+	*Local
+
+	mutex sync.Mutex
+	err   error
+	gets  int
+}
+
+func newFakeRemote(t *testing.T) *fakeRemote {
+	t.Helper()
+
+	local, err := NewLocal(LocalConfig{MaxCapacity: 100, Logger: zerolog.New(io.Discard)})
+	require.NoError(t, err)
+
+	return &fakeRemote{Local: local}
+}
+
+func (r *fakeRemote) setErr(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.err = err
+}
+
+func (r *fakeRemote) getCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.gets
+}
+
+func (r *fakeRemote) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	r.mutex.Lock()
+	err := r.err
+	r.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return r.Local.Set(ctx, key, value, expiration)
+}
+
+func (r *fakeRemote) Get(ctx context.Context, key string, dest any) error {
+	r.mutex.Lock()
+	r.gets++
+	err := r.err
+	r.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return r.Local.Get(ctx, key, dest)
+}
+
+// newTestTiered returns a tiered cache in front of a fake remote, and a
+// function to move its clock forward.
+func newTestTiered(t *testing.T, staleTTL time.Duration, registerer prometheus.Registerer) (*Tiered, *fakeRemote, func(time.Duration)) {
+	t.Helper()
+
+	local, err := NewLocal(LocalConfig{MaxCapacity: 100, Logger: zerolog.New(io.Discard)})
+	require.NoError(t, err)
+
+	remote := newFakeRemote(t)
+
+	c, err := NewTiered(TieredConfig{
+		Local:      local,
+		Remote:     remote,
+		LocalTTL:   time.Minute,
+		StaleTTL:   staleTTL,
+		Registerer: registerer,
+		Logger:     zerolog.New(io.Discard),
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = c.Close() })
+
+	var (
+		mutex sync.Mutex
+		now   = time.Now()
+	)
+
+	c.now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return now
+	}
+
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now = now.Add(d)
+	}
+
+	return c, remote, advance
+}
+
+func TestNewTiered(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+
+	local, err := NewLocal(LocalConfig{MaxCapacity: 10, Logger: logger})
+	require.NoError(t, err)
+
+	defer local.Close()
+
+	t.Run("defaults", func(t *testing.T) {
+		c, err := NewTiered(TieredConfig{Local: local, Remote: NewNoop(logger), Logger: logger})
+		require.NoError(t, err)
+		require.Implements(t, (*Cache)(nil), c)
+		require.Equal(t, DefaultTieredLocalTTL, c.localTTL)
+		require.Zero(t, c.staleTTL)
+	})
+
+	t.Run("missing tiers", func(t *testing.T) {
+		_, err := NewTiered(TieredConfig{Local: local, Logger: logger})
+		require.Error(t, err)
+
+		_, err = NewTiered(TieredConfig{Remote: NewNoop(logger), Logger: logger})
+		require.Error(t, err)
+	})
+
+	t.Run("negative stale TTL", func(t *testing.T) {
+		_, err := NewTiered(TieredConfig{Local: local, Remote: NewNoop(logger), StaleTTL: -time.Second, Logger: logger})
+		require.Error(t, err)
+	})
+}
+
+func TestTieredSetGet(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("write-through", func(t *testing.T) {
+		c, remote, _ := newTestTiered(t, 0, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "value", time.Hour))
+
+		var fromRemote string
+		require.NoError(t, remote.Local.Get(ctx, "key", &fromRemote))
+		require.Equal(t, "value", fromRemote)
+
+		var got string
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "value", got)
+		require.Zero(t, remote.getCount(), "fresh values must be served locally")
+	})
+
+	t.Run("remote consulted after local TTL", func(t *testing.T) {
+		c, remote, advance := newTestTiered(t, 0, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "old", time.Hour))
+
+		// Another agent updates the value.
+		require.NoError(t, remote.Local.Set(ctx, "key", "new", time.Hour))
+
+		var got string
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "old", got)
+
+		advance(time.Minute + time.Second)
+
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "new", got)
+		require.Equal(t, 1, remote.getCount())
+
+		// The local copy was refreshed.
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "new", got)
+		require.Equal(t, 1, remote.getCount())
+	})
+
+	t.Run("short expiration", func(t *testing.T) {
+		c, remote, advance := newTestTiered(t, 0, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "value", 10*time.Second))
+
+		advance(11 * time.Second)
+
+		var got string
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, 1, remote.getCount())
+	})
+
+	t.Run("remote hit fills local tier", func(t *testing.T) {
+		c, remote, _ := newTestTiered(t, 0, nil)
+
+		require.NoError(t, remote.Local.Set(ctx, "key", 42, time.Hour))
+
+		var got int
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, 42, got)
+
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, 42, got)
+		require.Equal(t, 1, remote.getCount())
+	})
+
+	t.Run("remote miss purges local tier", func(t *testing.T) {
+		c, remote, advance := newTestTiered(t, time.Hour, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "value", time.Hour))
+		require.NoError(t, remote.Local.Delete(ctx, "key"))
+
+		advance(2 * time.Minute)
+
+		var got string
+		require.ErrorIs(t, c.Get(ctx, "key", &got), ErrCacheMiss)
+
+		// A stale read is no longer possible.
+		remote.setErr(errRemoteDown)
+		require.ErrorIs(t, c.Get(ctx, "key", &got), errRemoteDown)
+	})
+
+	t.Run("remote set error", func(t *testing.T) {
+		c, remote, _ := newTestTiered(t, 0, nil)
+
+		remote.setErr(errRemoteDown)
+
+		require.ErrorIs(t, c.Set(ctx, "key", "value", time.Hour), errRemoteDown)
+
+		var got string
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "value", got)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		c, _, _ := newTestTiered(t, 0, nil)
+
+		require.Error(t, c.Set(ctx, "", "value", time.Hour))
+		require.Error(t, c.Get(ctx, "", new(string)))
+		require.Error(t, c.Delete(ctx, ""))
+	})
+}
+
+func TestTieredStaleReads(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("disabled", func(t *testing.T) {
+		c, remote, advance := newTestTiered(t, 0, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "value", time.Hour))
+
+		remote.setErr(errRemoteDown)
+		advance(2 * time.Minute)
+
+		var got string
+		require.ErrorIs(t, c.Get(ctx, "key", &got), errRemoteDown)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		c, remote, advance := newTestTiered(t, time.Hour, nil)
+
+		require.NoError(t, c.Set(ctx, "key", "value", time.Hour))
+
+		remote.setErr(errRemoteDown)
+		advance(2 * time.Minute)
+
+		var got string
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "value", got)
+		require.Equal(t, 1, remote.getCount())
+
+		// Stale values don't hide the remote tier once it's back.
+		remote.setErr(nil)
+		require.NoError(t, remote.Local.Set(ctx, "key", "new", time.Hour))
+
+		require.NoError(t, c.Get(ctx, "key", &got))
+		require.Equal(t, "new", got)
+	})
+
+	t.Run("nothing cached", func(t *testing.T) {
+		c, remote, _ := newTestTiered(t, time.Hour, nil)
+
+		remote.setErr(errRemoteDown)
+
+		var got string
+		require.ErrorIs(t, c.Get(ctx, "key", &got), errRemoteDown)
+	})
+}
+
+func TestTieredDeleteFlush(t *testing.T) {
+	ctx := context.Background()
+
+	c, remote, _ := newTestTiered(t, 0, nil)
+
+	require.NoError(t, c.Set(ctx, "a", "1", time.Hour))
+	require.NoError(t, c.Set(ctx, "b", "2", time.Hour))
+
+	require.NoError(t, c.Delete(ctx, "a"))
+
+	var got string
+	require.ErrorIs(t, c.Get(ctx, "a", &got), ErrCacheMiss)
+	require.ErrorIs(t, remote.Local.Get(ctx, "a", &got), ErrCacheMiss)
+
+	require.NoError(t, c.Flush(ctx))
+	require.ErrorIs(t, c.Get(ctx, "b", &got), ErrCacheMiss)
+	require.Zero(t, remote.Size())
+}
+
+func TestTieredMetrics(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+
+	c, remote, advance := newTestTiered(t, time.Hour, registry)
+
+	var got string
+
+	require.ErrorIs(t, c.Get(ctx, "key", &got), ErrCacheMiss) // local miss, remote miss
+	require.NoError(t, c.Set(ctx, "key", "value", time.Hour))
+	require.NoError(t, c.Get(ctx, "key", &got)) // local hit
+
+	advance(2 * time.Minute)
+	require.NoError(t, c.Get(ctx, "key", &got)) // local stale, remote hit
+
+	advance(2 * time.Minute)
+	remote.setErr(errRemoteDown)
+	require.NoError(t, c.Get(ctx, "key", &got)) // local stale, remote error, stale read
+
+	expected := `
+# HELP sm_agent_cache_requests_total Total number of cache lookups by tier and result.
+# TYPE sm_agent_cache_requests_total counter
+sm_agent_cache_requests_total{result="error",tier="remote"} 1
+sm_agent_cache_requests_total{result="hit",tier="local"} 1
+sm_agent_cache_requests_total{result="hit",tier="remote"} 1
+sm_agent_cache_requests_total{result="miss",tier="local"} 1
+sm_agent_cache_requests_total{result="miss",tier="remote"} 1
+sm_agent_cache_requests_total{result="stale",tier="local"} 2
+# HELP sm_agent_cache_stale_reads_total Total number of stale local values returned because the remote cache failed.
+# TYPE sm_agent_cache_stale_reads_total counter
+sm_agent_cache_stale_reads_total 1
+`
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+}
+
+func TestKindSetTiered(t *testing.T) {
+	var kind Kind
+
+	require.NoError(t, kind.Set("tiered"))
+	require.Equal(t, KindTiered, kind)
+}
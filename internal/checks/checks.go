@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -30,6 +32,7 @@ import (
 	"github.com/grafana/synthetic-monitoring-agent/internal/labelmode"
 	"github.com/grafana/synthetic-monitoring-agent/internal/limits"
 	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
 	"github.com/grafana/synthetic-monitoring-agent/internal/scraper"
 	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
@@ -51,10 +54,18 @@ const (
 	errNotAuthorized       = FatalError("probe not authorized")
 	errProbeUnregistered   = TransientError("probe no longer registered")
 	errTransportClosing    = TransientError("transport closing")
+
+	// ErrCheckNotFound is returned when asked about a check that this
+	// updater is not running.
+	ErrCheckNotFound = Error("check not found")
 )
 
 const metricNamespace = "sm_agent"
 
+// secretPrefetchTimeout bounds the time spent warming the secret cache for
+// a newly added check, which delays its first execution.
+const secretPrefetchTimeout = 30 * time.Second
+
 // Backoffer defines an interface to provide backoff durations.
 //
 // The implementation of this interface SHOULD NOT perform the actual
@@ -93,6 +104,12 @@ type Updater struct {
 	tenantCals              *cals.CostAttributionLabels
 	tenantLabellingMode     *labelmode.LabelMode
 	supportsProtocolSecrets bool
+	localSource             *LocalSource
+	state                   stateInfo
+	stateWriteMutex         sync.Mutex
+	// draining is closed by Drain.
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
 type apiInfo struct {
@@ -133,6 +150,26 @@ type UpdaterOptions struct {
 	CostAttributionLabels   *cals.CostAttributionLabels
 	LabellingMode           *labelmode.LabelMode
 	SupportsProtocolSecrets bool
+	// LocalSource, if set, makes the updater obtain checks from a
+	// local file instead of the API.
+	LocalSource *LocalSource
+	// StateFile, if set, is where the updater saves the checks it
+	// runs, to restore them when it starts. See State.
+	StateFile string
+	// StateMaxStaleness is how long checks keep running without being
+	// confirmed by the API, either after being restored from the state
+	// file or while disconnected. Zero means forever. It only applies
+	// when StateFile is set.
+	StateMaxStaleness time.Duration
+	// TenantRestorer, if set, receives the tenants restored from the
+	// state file.
+	TenantRestorer TenantRestorer
+}
+
+// TenantRestorer is given the tenants restored from the state file, which
+// don't include credentials.
+type TenantRestorer interface {
+	RestoreTenants(tenants []sm.Tenant)
 }
 
 func NewUpdater(opts UpdaterOptions) (*Updater, error) {
@@ -258,6 +295,14 @@ func NewUpdater(opts UpdaterOptions) (*Updater, error) {
 		tenantSecrets:           opts.SecretProvider,
 		telemeter:               opts.Telemeter,
 		supportsProtocolSecrets: opts.SupportsProtocolSecrets,
+		localSource:             opts.LocalSource,
+		draining:                make(chan struct{}),
+		state: stateInfo{
+			filename:     opts.StateFile,
+			maxStaleness: opts.StateMaxStaleness,
+			restorer:     opts.TenantRestorer,
+			tenants:      make(map[int64]sm.Tenant),
+		},
 		metrics: metrics{
 			changeErrorsCounter: changeErrorsCounter,
 			changesCounter:      changesCounter,
@@ -274,11 +319,30 @@ func NewUpdater(opts UpdaterOptions) (*Updater, error) {
 }
 
 func (c *Updater) Run(ctx context.Context) error {
+	if c.localSource != nil {
+		return c.runLocal(ctx)
+	}
+
 	c.backoff.Reset()
 
+	if c.state.filename != "" {
+		c.restoreState(ctx)
+	}
+
 	for {
+		if c.isDraining() {
+			c.logger.Info().Msg("drained, not connecting to the API again")
+			return nil
+		}
+
 		wasConnected, err := c.loop(ctx)
 
+		c.disconnectedState()
+
+		if c.isDraining() {
+			continue
+		}
+
 		logger := c.logger.With().Str("connection_state", c.api.conn.GetState().String()).Logger()
 
 		logger.Info().Err(err).Bool("was_connected", wasConnected).Msg("broke out of loop")
@@ -416,6 +480,8 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 
 	c.probe = &result.Probe
 
+	c.connectedState()
+
 	c.notifyProbeTenant()
 
 	logger := c.logger.With().Int64("probe_id", c.probe.Id).Logger()
@@ -435,13 +501,7 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 	// we don't know the probe's id or name until this point, set it
 	// here.
 	c.metrics.probeInfo.Reset()
-	c.metrics.probeInfo.With(map[string]string{
-		"id":         strconv.FormatInt(c.probe.Id, 10),
-		"name":       c.probe.Name,
-		"version":    version.Short(),
-		"commit":     version.Commit(),
-		"buildstamp": version.Buildstamp(),
-	}).Set(1)
+	c.metrics.probeInfo.With(c.probeInfoLabels()).Set(1)
 
 	// groupCtx is used to coordinate shutting down all the
 	// goroutines started here.
@@ -455,7 +515,7 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 	// returning from this function; cancelling the new context
 	// because the signal fired), so we need an additional way of
 	// telling them apart.
-	sigCtx, signalFired := installSignalHandler(groupCtx)
+	sigCtx, signalFired := installSignalHandler(groupCtx, c.draining)
 
 	errorHandler := func(err error, action string, signalFired *int32) error {
 		switch {
@@ -470,6 +530,8 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 		}
 	}
 
+	c.scrapersMutex.Lock()
+
 	knownChecks := sm.ProbeState{
 		Checks: make([]sm.EntityRef, 0, len(c.scrapers)),
 	}
@@ -481,6 +543,8 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 		})
 	}
 
+	c.scrapersMutex.Unlock()
+
 	cc, err := client.GetChanges(sigCtx, &knownChecks)
 	if err != nil {
 		return connected, errorHandler(err, "requesting changes from synthetic-monitoring-api", signalFired)
@@ -507,6 +571,13 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 		return err
 	})
 
+	if c.state.filename != "" {
+		g.Go(func() error {
+			c.refreshState(groupCtx)
+			return nil
+		})
+	}
+
 	go func() {
 		// Do this in a goroutine to avoid blocking the rest of the process.
 		//
@@ -529,6 +600,16 @@ func (c *Updater) loop(ctx context.Context) (bool, error) {
 	return connected, errorHandler(err, "getting changes from synthetic-monitoring-api", signalFired)
 }
 
+func (c *Updater) probeInfoLabels() prometheus.Labels {
+	return prometheus.Labels{
+		"id":         strconv.FormatInt(c.probe.Id, 10),
+		"name":       c.probe.Name,
+		"version":    version.Short(),
+		"commit":     version.Commit(),
+		"buildstamp": version.Buildstamp(),
+	}
+}
+
 func (c *Updater) validateProbeCapabilities(capabilities *sm.Probe_Capabilities) error {
 	// k6 is required by default unless it has been explicitly disabled from
 	// the API side by forbidding scripted and browser checks execution.
@@ -617,8 +698,8 @@ func ping(ctx context.Context, client sm.ChecksClient) error {
 // delivered, the signal handler is removed and the returned context's
 // Done channel is closed, too. It's the callers responsibility to
 // cancel the provided context if it's no longer interested in the
-// signal.
-func installSignalHandler(ctx context.Context) (context.Context, *int32) {
+// signal. Closing drain has the same effect as the signal.
+func installSignalHandler(ctx context.Context, drain <-chan struct{}) (context.Context, *int32) {
 	sigCtx, cancel := context.WithCancel(ctx)
 
 	fired := new(int32)
@@ -631,6 +712,9 @@ func installSignalHandler(ctx context.Context) (context.Context, *int32) {
 		case <-sigCh:
 			atomic.StoreInt32(fired, 1)
 			cancel()
+		case <-drain:
+			atomic.StoreInt32(fired, 1)
+			cancel()
 		case <-ctx.Done():
 		}
 
@@ -655,6 +739,7 @@ func (c *Updater) processChanges(ctx context.Context, cc sm.Checks_GetChangesCli
 			switch msg, err := cc.Recv(); err {
 			case nil:
 				c.handleChangeBatch(ctx, msg, firstBatch)
+				c.syncState(msg)
 				firstBatch = false
 
 			case io.EOF:
@@ -937,6 +1022,11 @@ func (c *Updater) addAndStartScraperWithLock(ctx context.Context, check model.Ch
 	default:
 	}
 
+	if c.isDraining() {
+		c.logger.Debug().Int64("check_id", check.Id).Msg("draining, not starting scraper")
+		return nil
+	}
+
 	checkType := check.Type().String()
 
 	tidStr := strconv.FormatInt(check.TenantId, 10)
@@ -979,13 +1069,138 @@ func (c *Updater) addAndStartScraperWithLock(ctx context.Context, check model.Ch
 
 	c.scrapers[check.GlobalID()] = scraper
 
-	go scraper.Run(ctx)
+	names := prober.SecretNames(check)
+
+	go func() {
+		// Warm the secret cache before the scraper starts, as its
+		// first execution can happen right away.
+		if len(names) > 0 && c.tenantSecrets != nil {
+			c.prefetchSecrets(ctx, check, names)
+		}
+
+		scraper.Run(ctx)
+	}()
 
 	c.metrics.runningScrapers.WithLabelValues(checkType).Inc()
 
 	return nil
 }
 
+// prefetchSecrets warms the secret provider's cache with the secrets used
+// by the check, so that its first execution doesn't have to wait for them.
+// It doesn't take longer than the check's timeout, as the execution would
+// not have waited longer for them either.
+func (c *Updater) prefetchSecrets(ctx context.Context, check model.Check, names []string) {
+	timeout := secretPrefetchTimeout
+	if check.Timeout > 0 {
+		timeout = min(timeout, time.Duration(check.Timeout)*time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	values, err := secrets.GetSecretValues(ctx, c.tenantSecrets, check.GlobalTenantID(), names)
+	if err != nil {
+		c.logger.Debug().
+			Err(err).
+			Int64("checkId", check.Id).
+			Int64("tenantId", check.TenantId).
+			Msg("failed to prefetch check secrets")
+
+		return
+	}
+
+	c.logger.Debug().
+		Int64("checkId", check.Id).
+		Int64("tenantId", check.TenantId).
+		Int("count", len(values)).
+		Msg("check secrets prefetched")
+}
+
+// Checks returns the status of the checks run by this updater, sorted by
+// their global ID.
+func (c *Updater) Checks() []scraper.Status {
+	c.scrapersMutex.Lock()
+	defer c.scrapersMutex.Unlock()
+
+	ids := slices.Sorted(maps.Keys(c.scrapers))
+	checks := make([]scraper.Status, 0, len(ids))
+
+	for _, id := range ids {
+		checks = append(checks, c.scrapers[id].Status())
+	}
+
+	return checks
+}
+
+// Check returns the status of the check with the given global ID, if this
+// updater runs it.
+func (c *Updater) Check(id model.GlobalID) (scraper.Status, bool) {
+	c.scrapersMutex.Lock()
+	defer c.scrapersMutex.Unlock()
+
+	s, found := c.scrapers[id]
+	if !found {
+		return scraper.Status{}, false
+	}
+
+	return s.Status(), true
+}
+
+// RunCheck runs the check with the given global ID once, right away,
+// without waiting for its next scheduled execution and without disturbing
+// its schedule. The collected data is published only if publish is true.
+//
+// It returns ErrCheckNotFound if this updater is not running the check.
+func (c *Updater) RunCheck(ctx context.Context, id model.GlobalID, publish bool) (scraper.Execution, error) {
+	c.scrapersMutex.Lock()
+	s, found := c.scrapers[id]
+	c.scrapersMutex.Unlock()
+
+	if !found {
+		return scraper.Execution{}, ErrCheckNotFound
+	}
+
+	now := time.Now()
+
+	ts, streams, tenantID, duration, err := s.Detached().CollectData(ctx, now)
+	exec := scraper.NewExecution(now, duration, ts, streams, err)
+
+	check := s.Status().Check
+
+	c.logger.Info().
+		Int64("check_id", check.Id).
+		Int64("tenantId", check.TenantId).
+		Str("result", string(exec.Result)).
+		Bool("publish", publish).
+		Msg("check run on demand")
+
+	if publish && exec.Result != scraper.ResultError {
+		c.publisher.Publish(runCheckData{tenantID: tenantID, ts: ts, streams: streams})
+	}
+
+	return exec, nil
+}
+
+// runCheckData is the payload published for checks run on demand.
+type runCheckData struct {
+	tenantID model.GlobalID
+	ts       []prompb.TimeSeries
+	streams  []logproto.Stream
+}
+
+func (d runCheckData) Tenant() model.GlobalID {
+	return d.tenantID
+}
+
+func (d runCheckData) Metrics() []prompb.TimeSeries {
+	return d.ts
+}
+
+func (d runCheckData) Streams() []logproto.Stream {
+	return d.streams
+}
+
 // sleepCtx is like time.Sleep, but it pays attention to the
 // cancellation of the provided context.
 func sleepCtx(ctx context.Context, d time.Duration) error {
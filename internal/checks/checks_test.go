@@ -101,7 +101,7 @@ func TestInstallSignalHandler(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 			defer cancel()
 
-			sigCtx, signalFired := installSignalHandler(ctx)
+			sigCtx, signalFired := installSignalHandler(ctx, nil)
 			require.NotNil(t, sigCtx)
 			require.NotNil(t, signalFired)
 			require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
@@ -114,13 +114,32 @@ func TestInstallSignalHandler(t *testing.T) {
 			}
 		},
 
+		"drain": func(t *testing.T) {
+			// verify that closing the drain channel has the
+			// same effect as the signal.
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			drain := make(chan struct{})
+			sigCtx, signalFired := installSignalHandler(ctx, drain)
+
+			close(drain)
+
+			select {
+			case <-ctx.Done():
+				t.Fatal("context timeout expired")
+			case <-sigCtx.Done():
+				require.Equal(t, int32(1), atomic.LoadInt32(signalFired))
+			}
+		},
+
 		"no signal": func(t *testing.T) {
 			// verify that the signal context is done after
 			// the parrent context is done, and that the
 			// signal is correctly reported as not having
 			// fired.
 			ctx, cancel := context.WithCancel(context.Background())
-			sigCtx, signalFired := installSignalHandler(ctx)
+			sigCtx, signalFired := installSignalHandler(ctx, nil)
 			require.NotNil(t, sigCtx)
 			require.NotNil(t, signalFired)
 
@@ -260,6 +279,18 @@ func testHandleCheckOpImpl(t *testing.T) {
 	require.Equal(t, 1.0, testutil.ToFloat64(u.metrics.runningScrapers))
 	require.True(t, scraperExists())
 
+	// the check is reported by the updater
+	statuses := u.Checks()
+	require.Len(t, statuses, 1)
+	require.Equal(t, check.Id, statuses[0].Check.Id)
+
+	status, found := u.Check(check.GlobalID())
+	require.True(t, found)
+	require.Equal(t, check.Job, status.Check.Job)
+
+	_, found = u.Check(check.GlobalID() + 1)
+	require.False(t, found)
+
 	check.Modified++
 
 	// try to add again, this should fail, even if modified changed
@@ -280,6 +311,7 @@ func testHandleCheckOpImpl(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 0.0, testutil.ToFloat64(u.metrics.runningScrapers))
 	require.False(t, scraperExists())
+	require.Empty(t, u.Checks())
 
 	// try to delete again
 	err = u.handleCheckDelete(ctx, check)
@@ -303,6 +335,66 @@ func testHandleCheckOpImpl(t *testing.T) {
 	synctest.Wait()
 }
 
+func TestRunCheck(t *testing.T) {
+	publishCh := make(chan pusher.Payload, 1)
+
+	u, err := NewUpdater(
+		UpdaterOptions{
+			Conn:           new(grpc.ClientConn),
+			PromRegisterer: prometheus.NewPedanticRegistry(),
+			Publisher:      channelPublisher(publishCh),
+			TenantCh:       make(chan<- sm.Tenant),
+			Logger:         testhelper.Logger(t),
+		},
+	)
+	require.NoError(t, err)
+
+	var check model.Check
+
+	require.NoError(t, check.FromSM(sm.Check{
+		Id:        5000,
+		TenantId:  1,
+		Frequency: 60000,
+		Timeout:   1000,
+		Target:    "127.0.0.1",
+		Job:       "test-job",
+		Probes:    []int64{1},
+		Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+	}))
+
+	s, err := scraper.NewWithOpts(t.Context(), check, scraper.ScraperOpts{
+		Logger:        testhelper.Logger(t),
+		ProbeFactory:  testProbeFactory{},
+		Publisher:     channelPublisher(publishCh),
+		LabelsLimiter: testLabelsLimiter{metricLabelsLimit: 20, logLabelsLimit: 20},
+		LabellingMode: testLabellingMode{},
+	})
+	require.NoError(t, err)
+
+	u.scrapers[check.GlobalID()] = s
+
+	_, err = u.RunCheck(t.Context(), check.GlobalID()+1, false)
+	require.ErrorIs(t, err, ErrCheckNotFound)
+
+	// testProber always fails.
+	exec, err := u.RunCheck(t.Context(), check.GlobalID(), false)
+	require.NoError(t, err)
+	require.Equal(t, scraper.ResultFailure, exec.Result)
+	require.NotEmpty(t, exec.Series)
+	require.NotEmpty(t, exec.Streams)
+	require.Empty(t, publishCh)
+
+	// The scheduled executions are not affected.
+	require.Nil(t, s.Status().LastExecution)
+
+	_, err = u.RunCheck(t.Context(), check.GlobalID(), true)
+	require.NoError(t, err)
+
+	payload := <-publishCh
+	require.Equal(t, check.GlobalTenantID(), payload.Tenant())
+	require.NotEmpty(t, payload.Metrics())
+}
+
 func TestCheckHandlerProbeValidation(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,59 @@
+package checks
+
+import (
+	"context"
+)
+
+// Drain stops all the checks, letting the executions in progress finish,
+// and disconnects from the API without connecting again, so that another
+// agent can take over the probe. Changes received while draining don't
+// start new checks. With handover, the checks don't publish stale markers
+// for their series, as the agent taking over is expected to continue
+// publishing them.
+//
+// Drain returns once all the checks have stopped, or ctx is done.
+func (c *Updater) Drain(ctx context.Context, handover bool) error {
+	c.drainOnce.Do(func() {
+		close(c.draining)
+	})
+
+	c.scrapersMutex.Lock()
+
+	stopped := make([]<-chan struct{}, 0, len(c.scrapers))
+
+	for id, s := range c.scrapers {
+		checkType := s.CheckType().String()
+
+		stopped = append(stopped, s.Drain(handover))
+
+		delete(c.scrapers, id)
+
+		c.metrics.runningScrapers.WithLabelValues(checkType).Dec()
+	}
+
+	c.scrapersMutex.Unlock()
+
+	c.logger.Info().Int("checks", len(stopped)).Bool("handover", handover).Msg("draining checks")
+
+	for _, done := range stopped {
+		select {
+		case <-done:
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// isDraining returns whether Drain has been called.
+func (c *Updater) isDraining() bool {
+	select {
+	case <-c.draining:
+		return true
+
+	default:
+		return false
+	}
+}
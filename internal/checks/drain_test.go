@@ -0,0 +1,76 @@
+package checks
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+type zeroBackoff struct{}
+
+func (zeroBackoff) Reset() {}
+
+func (zeroBackoff) Duration() time.Duration { return 0 }
+
+func TestUpdaterDrain(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := t.Context()
+
+		u, err := NewUpdater(UpdaterOptions{
+			Conn:           new(grpc.ClientConn),
+			PromRegisterer: prometheus.NewPedanticRegistry(),
+			Publisher:      channelPublisher(make(chan pusher.Payload, 100)),
+			TenantCh:       make(chan<- sm.Tenant),
+			Logger:         testhelper.Logger(t),
+			Backoff:        zeroBackoff{},
+			ScraperFactory: testScraperFactory,
+			K6Runner:       noopRunner{},
+		})
+		require.NoError(t, err)
+
+		u.probe = &sm.Probe{Id: 1, TenantId: 1000, Name: "probe"}
+
+		changes := sm.Changes{}
+
+		for _, id := range []int64{10, 11} {
+			changes.Checks = append(changes.Checks, sm.CheckChange{
+				Operation: sm.CheckOperation_CHECK_ADD,
+				Check: sm.Check{
+					Id:        id,
+					TenantId:  1000,
+					Job:       "job",
+					Target:    "127.0.0.1",
+					Frequency: 60000,
+					Timeout:   1000,
+					Enabled:   true,
+					Probes:    []int64{1},
+					Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+				},
+			})
+		}
+
+		u.handleChangeBatch(ctx, &changes, true)
+		require.Len(t, u.Checks(), 2)
+
+		require.NoError(t, u.Drain(ctx, false))
+		require.Empty(t, u.Checks())
+
+		// Checks are not started again while draining.
+		u.handleChangeBatch(ctx, &changes, false)
+		require.Empty(t, u.Checks())
+
+		// And the updater doesn't connect to the API.
+		require.NoError(t, u.Run(ctx))
+
+		// Draining again is harmless.
+		require.NoError(t, u.Drain(ctx, true))
+	})
+}
@@ -0,0 +1,404 @@
+package checks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// DefaultLocalSourceInterval is the default interval between checks for
+// modifications of the local checks file.
+const DefaultLocalSourceInterval = 5 * time.Second
+
+var errTenantNotFound = errors.New("tenant not found in local checks file")
+
+// LocalChecks is the content of a local checks file. The file can be
+// written either in JSON or in YAML, in both cases using the same field
+// names as the JSON representation of the protobuf messages.
+type LocalChecks struct {
+	Probe   sm.Probe    `json:"probe"`
+	Tenants []sm.Tenant `json:"tenants"`
+	Checks  []sm.Check  `json:"checks"`
+}
+
+// ReadLocalChecks reads and validates the local checks file with the
+// specified name. Files with a .json extension are decoded as JSON, any
+// other file is decoded as YAML.
+func ReadLocalChecks(fn string) (*LocalChecks, error) {
+	data, err := os.ReadFile(fn) //#nosec -- the file is provided by the operator.
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(fn), ".json") {
+		// Going thru a generic value allows to reuse the JSON
+		// tags and custom JSON unmarshallers defined for the
+		// protobuf messages.
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", fn, err)
+		}
+
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", fn, err)
+		}
+	}
+
+	var lc LocalChecks
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&lc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", fn, err)
+	}
+
+	if err := lc.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", fn, err)
+	}
+
+	return &lc, nil
+}
+
+// Validate verifies that the probe, tenants and checks are valid, and
+// that every check references a known tenant.
+func (lc *LocalChecks) Validate() error {
+	if err := lc.Probe.Validate(); err != nil {
+		return fmt.Errorf("invalid probe: %w", err)
+	}
+
+	tenants := make(map[int64]struct{}, len(lc.Tenants))
+
+	for _, tenant := range lc.Tenants {
+		if _, found := tenants[tenant.Id]; found {
+			return fmt.Errorf("duplicate tenant %d", tenant.Id)
+		}
+
+		tenants[tenant.Id] = struct{}{}
+	}
+
+	checks := make(map[int64]struct{}, len(lc.Checks))
+
+	for _, check := range lc.Checks {
+		if _, found := checks[check.Id]; found {
+			return fmt.Errorf("duplicate check %d", check.Id)
+		}
+
+		checks[check.Id] = struct{}{}
+
+		if err := check.Validate(); err != nil {
+			return fmt.Errorf("invalid check %d: %w", check.Id, err)
+		}
+
+		if _, found := tenants[check.TenantId]; !found {
+			return fmt.Errorf("check %d references unknown tenant %d", check.Id, check.TenantId)
+		}
+	}
+
+	return nil
+}
+
+// LocalSource provides checks, probe and tenants from a local file,
+// allowing the agent to run without a connection to the API.
+//
+// LocalSource implements sm.TenantsClient so that it can be passed to
+// the tenant manager in place of the API client.
+type LocalSource struct {
+	filename string
+	interval time.Duration
+
+	mutex   sync.Mutex
+	tenants map[int64]sm.Tenant
+}
+
+var _ sm.TenantsClient = (*LocalSource)(nil)
+
+// NewLocalSource creates a LocalSource for the specified file. The file
+// is polled for modifications every interval.
+func NewLocalSource(filename string, interval time.Duration) *LocalSource {
+	if interval <= 0 {
+		interval = DefaultLocalSourceInterval
+	}
+
+	return &LocalSource{
+		filename: filename,
+		interval: interval,
+		tenants:  make(map[int64]sm.Tenant),
+	}
+}
+
+// Filename returns the name of the file backing this source.
+func (s *LocalSource) Filename() string {
+	return s.filename
+}
+
+// GetTenant returns the tenant with the requested ID from the most
+// recently loaded version of the file.
+func (s *LocalSource) GetTenant(_ context.Context, in *sm.TenantInfo, _ ...grpc.CallOption) (*sm.Tenant, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tenant, found := s.tenants[in.Id]
+	if !found {
+		return nil, fmt.Errorf("%w: %d", errTenantNotFound, in.Id)
+	}
+
+	return &tenant, nil
+}
+
+func (s *LocalSource) setTenants(tenants []sm.Tenant) {
+	m := make(map[int64]sm.Tenant, len(tenants))
+	for _, tenant := range tenants {
+		m[tenant.Id] = tenant
+	}
+
+	s.mutex.Lock()
+	s.tenants = m
+	s.mutex.Unlock()
+}
+
+// localState is the state applied by the updater from the most recent
+// successful load of the local checks file.
+type localState struct {
+	probe   sm.Probe
+	tenants map[int64]sm.Tenant
+	checks  map[int64]sm.Check
+}
+
+// diff computes the changes needed to go from the current state to the
+// one described by lc. Checks that are disabled or not assigned to the
+// probe are treated as absent.
+//
+// Since the file might not update the modification timestamps, the
+// provided modification time is used for checks and tenants that
+// changed without them being updated. This is necessary for the
+// config_version label and for the tenant manager to accept the new
+// version of the tenant.
+func (st *localState) diff(lc *LocalChecks, modTime time.Time) (*sm.Changes, localState) {
+	ts := float64(modTime.UnixNano()) / 1e9
+
+	next := localState{
+		probe:   lc.Probe,
+		tenants: make(map[int64]sm.Tenant, len(lc.Tenants)),
+		checks:  make(map[int64]sm.Check, len(lc.Checks)),
+	}
+
+	// Scrapers hold a copy of the probe, so any change to it requires
+	// restarting all of them.
+	probeChanged := !sameProbe(st.probe, next.probe)
+
+	var changes sm.Changes
+
+	for _, tenant := range lc.Tenants {
+		prev, found := st.tenants[tenant.Id]
+
+		switch {
+		case !found:
+			if tenant.Modified == 0 {
+				tenant.Modified = ts
+			}
+
+		case sameTenant(prev, tenant):
+			next.tenants[tenant.Id] = prev
+			continue
+
+		case tenant.Modified <= prev.Modified:
+			tenant.Modified = ts
+		}
+
+		next.tenants[tenant.Id] = tenant
+		changes.Tenants = append(changes.Tenants, tenant)
+	}
+
+	for _, check := range lc.Checks {
+		if !check.Enabled || !slices.Contains(check.Probes, lc.Probe.Id) {
+			continue
+		}
+
+		prev, found := st.checks[check.Id]
+
+		switch {
+		case !found:
+			if check.Modified == 0 {
+				check.Created = ts
+				check.Modified = ts
+			}
+
+			changes.Checks = append(changes.Checks, sm.CheckChange{Operation: sm.CheckOperation_CHECK_ADD, Check: check})
+
+		case sameCheck(prev, check) && !probeChanged:
+			check = prev
+
+		default:
+			if check.Modified <= prev.Modified {
+				check.Modified = ts
+			}
+
+			changes.Checks = append(changes.Checks, sm.CheckChange{Operation: sm.CheckOperation_CHECK_UPDATE, Check: check})
+		}
+
+		next.checks[check.Id] = check
+	}
+
+	for id := range st.checks {
+		if _, found := next.checks[id]; !found {
+			changes.Checks = append(changes.Checks, sm.CheckChange{Operation: sm.CheckOperation_CHECK_DELETE, Check: sm.Check{Id: id}})
+		}
+	}
+
+	return &changes, next
+}
+
+type marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// sameWire compares two protobuf messages using their wire
+// representation.
+func sameWire(a, b marshaler) bool {
+	da, errA := a.Marshal()
+	db, errB := b.Marshal()
+
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+// sameCheck, sameTenant and sameProbe compare two messages ignoring the
+// creation and modification timestamps, as those are updated by diff.
+func sameCheck(a, b sm.Check) bool {
+	a.Created, a.Modified = 0, 0
+	b.Created, b.Modified = 0, 0
+
+	return sameWire(&a, &b)
+}
+
+func sameTenant(a, b sm.Tenant) bool {
+	a.Created, a.Modified = 0, 0
+	b.Created, b.Modified = 0, 0
+
+	return sameWire(&a, &b)
+}
+
+func sameProbe(a, b sm.Probe) bool {
+	a.Created, a.Modified = 0, 0
+	b.Created, b.Modified = 0, 0
+
+	return sameWire(&a, &b)
+}
+
+// runLocal is the equivalent of Run for agents running from a local
+// checks file. The file is read once at startup, and it's an error if
+// it cannot be loaded. After that, the file is polled for changes and
+// any errors while reloading it are logged and the previous state is
+// kept.
+func (c *Updater) runLocal(ctx context.Context) error {
+	src := c.localSource
+	logger := c.logger.With().Str("checks_file", src.filename).Logger()
+
+	fi, err := os.Stat(src.filename)
+	if err != nil {
+		return fmt.Errorf("reading local checks file: %w", err)
+	}
+
+	lc, err := ReadLocalChecks(src.filename)
+	if err != nil {
+		return fmt.Errorf("reading local checks file: %w", err)
+	}
+
+	if err := c.validateProbeCapabilities(lc.Probe.Capabilities); err != nil {
+		return err
+	}
+
+	var state localState
+
+	state = c.applyLocalChecks(ctx, &state, lc, fi.ModTime())
+
+	c.notifyProbeTenant()
+
+	logger.Info().Str("probe_name", c.probe.Name).Int("checks", len(state.checks)).Msg("loaded local checks file")
+
+	c.IsConnected(true)
+	defer c.IsConnected(false)
+
+	ticker := time.NewTicker(src.interval)
+	defer ticker.Stop()
+
+	lastModTime, lastSize := fi.ModTime(), fi.Size()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-c.draining:
+			logger.Info().Msg("drained, not reloading the local checks file again")
+			return nil
+
+		case <-ticker.C:
+			fi, err := os.Stat(src.filename)
+			if err != nil {
+				logger.Warn().Err(err).Msg("cannot stat local checks file, keeping current checks")
+				continue
+			}
+
+			if fi.ModTime().Equal(lastModTime) && fi.Size() == lastSize {
+				continue
+			}
+
+			lastModTime, lastSize = fi.ModTime(), fi.Size()
+
+			lc, err := ReadLocalChecks(src.filename)
+			if err != nil {
+				c.metrics.changeErrorsCounter.WithLabelValues("file").Inc()
+				logger.Error().Err(err).Msg("cannot reload local checks file, keeping current checks")
+
+				continue
+			}
+
+			if err := c.validateProbeCapabilities(lc.Probe.Capabilities); err != nil {
+				c.metrics.changeErrorsCounter.WithLabelValues("file").Inc()
+				logger.Error().Err(err).Msg("invalid probe capabilities in local checks file, keeping current checks")
+
+				continue
+			}
+
+			state = c.applyLocalChecks(ctx, &state, lc, fi.ModTime())
+
+			logger.Info().Int("checks", len(state.checks)).Msg("reloaded local checks file")
+		}
+	}
+}
+
+// applyLocalChecks pushes the differences between the current state and
+// the provided file contents thru the same path used for changes coming
+// from the API, and returns the new state.
+func (c *Updater) applyLocalChecks(ctx context.Context, state *localState, lc *LocalChecks, modTime time.Time) localState {
+	changes, next := state.diff(lc, modTime)
+
+	// Make the tenants available to the tenant manager before any
+	// scraper has a chance to ask for them.
+	c.localSource.setTenants(lc.Tenants)
+
+	probe := next.probe
+	c.probe = &probe
+
+	c.metrics.probeInfo.Reset()
+	c.metrics.probeInfo.With(c.probeInfoLabels()).Set(1)
+
+	c.handleChangeBatch(ctx, changes, false)
+
+	return next
+}
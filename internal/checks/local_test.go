@@ -0,0 +1,217 @@
+package checks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestReadLocalChecks(t *testing.T) {
+	t.Parallel()
+
+	const yamlData = `
+probe:
+  id: 1
+  tenantId: 1000
+  name: local
+  region: local
+tenants:
+  - id: 1000
+    stackId: 2
+checks:
+  - id: 10
+    tenantId: 1000
+    job: job
+    target: 127.0.0.1
+    frequency: 60000
+    timeout: 3000
+    enabled: true
+    probes: [1]
+    settings:
+      ping:
+        ipVersion: V4
+`
+
+	const jsonData = `{
+  "probe": {"id": 1, "tenantId": 1000, "name": "local", "region": "local"},
+  "tenants": [{"id": 1000, "stackId": 2}],
+  "checks": [{
+    "id": 10, "tenantId": 1000, "job": "job", "target": "127.0.0.1",
+    "frequency": 60000, "timeout": 3000, "enabled": true, "probes": [1],
+    "settings": {"ping": {"ipVersion": "V4"}}
+  }]
+}`
+
+	testcases := map[string]struct {
+		filename    string
+		data        string
+		expectError bool
+	}{
+		"yaml": {
+			filename: "checks.yaml",
+			data:     yamlData,
+		},
+		"json": {
+			filename: "checks.json",
+			data:     jsonData,
+		},
+		"unknown field": {
+			filename:    "checks.yaml",
+			data:        yamlData + "foo: bar\n",
+			expectError: true,
+		},
+		"unknown tenant": {
+			filename:    "checks.json",
+			data:        `{"probe": {"id": 1, "tenantId": 1000, "name": "local", "region": "local"}, "checks": [{"id": 10, "tenantId": 1000, "job": "job", "target": "127.0.0.1", "frequency": 60000, "timeout": 3000, "enabled": true, "probes": [1], "settings": {"ping": {}}}]}`,
+			expectError: true,
+		},
+		"invalid probe": {
+			filename:    "checks.yaml",
+			data:        "probe: {}\n",
+			expectError: true,
+		},
+		"not found": {
+			filename:    "checks.yaml",
+			expectError: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			fn := filepath.Join(t.TempDir(), tc.filename)
+			if tc.data != "" {
+				require.NoError(t, os.WriteFile(fn, []byte(tc.data), 0o600))
+			}
+
+			lc, err := ReadLocalChecks(fn)
+			if tc.expectError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, int64(1), lc.Probe.Id)
+			require.Len(t, lc.Tenants, 1)
+			require.Len(t, lc.Checks, 1)
+			require.Equal(t, int64(10), lc.Checks[0].Id)
+			require.NotNil(t, lc.Checks[0].Settings.Ping)
+		})
+	}
+}
+
+func TestLocalStateDiff(t *testing.T) {
+	t.Parallel()
+
+	probe := sm.Probe{Id: 1, TenantId: 1000, Name: "local"}
+	tenant := sm.Tenant{Id: 1000, StackId: 2}
+	newCheck := func(id int64) sm.Check {
+		return sm.Check{
+			Id:        id,
+			TenantId:  tenant.Id,
+			Job:       "job",
+			Target:    "127.0.0.1",
+			Frequency: 60000,
+			Timeout:   3000,
+			Enabled:   true,
+			Probes:    []int64{probe.Id},
+			Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+		}
+	}
+
+	t0 := time.Unix(100, 0)
+	t1 := time.Unix(200, 0)
+
+	var state localState
+
+	changes, state := state.diff(&LocalChecks{
+		Probe:   probe,
+		Tenants: []sm.Tenant{tenant},
+		Checks:  []sm.Check{newCheck(1), newCheck(2), newCheck(3)},
+	}, t0)
+
+	require.Len(t, changes.Tenants, 1)
+	require.Equal(t, float64(100), changes.Tenants[0].Modified)
+	require.Len(t, changes.Checks, 3)
+
+	for _, change := range changes.Checks {
+		require.Equal(t, sm.CheckOperation_CHECK_ADD, change.Operation)
+		require.Equal(t, float64(100), change.Check.Modified)
+	}
+
+	// Same content, no changes.
+	changes, state = state.diff(&LocalChecks{
+		Probe:   probe,
+		Tenants: []sm.Tenant{tenant},
+		Checks:  []sm.Check{newCheck(1), newCheck(2), newCheck(3)},
+	}, t1)
+
+	require.Empty(t, changes.Tenants)
+	require.Empty(t, changes.Checks)
+
+	// Check 1 is updated, check 2 is disabled, check 3 is removed and
+	// check 4 is not assigned to this probe.
+	check1 := newCheck(1)
+	check1.Target = "127.0.0.2"
+	check2 := newCheck(2)
+	check2.Enabled = false
+	check4 := newCheck(4)
+	check4.Probes = []int64{2}
+
+	changes, state = state.diff(&LocalChecks{
+		Probe:   probe,
+		Tenants: []sm.Tenant{tenant},
+		Checks:  []sm.Check{check1, check2, check4},
+	}, t1)
+
+	require.Empty(t, changes.Tenants)
+	require.Len(t, changes.Checks, 3)
+
+	ops := make(map[int64]sm.CheckOperation)
+	for _, change := range changes.Checks {
+		ops[change.Check.Id] = change.Operation
+	}
+
+	require.Equal(t, map[int64]sm.CheckOperation{
+		1: sm.CheckOperation_CHECK_UPDATE,
+		2: sm.CheckOperation_CHECK_DELETE,
+		3: sm.CheckOperation_CHECK_DELETE,
+	}, ops)
+	require.Equal(t, float64(200), changes.Checks[0].Check.Modified)
+	require.Len(t, state.checks, 1)
+
+	// Changing the probe updates all the checks.
+	probe.Name = "renamed"
+
+	changes, _ = state.diff(&LocalChecks{
+		Probe:   probe,
+		Tenants: []sm.Tenant{tenant},
+		Checks:  []sm.Check{check1},
+	}, t1)
+
+	require.Len(t, changes.Checks, 1)
+	require.Equal(t, sm.CheckOperation_CHECK_UPDATE, changes.Checks[0].Operation)
+}
+
+func TestLocalSourceGetTenant(t *testing.T) {
+	t.Parallel()
+
+	src := NewLocalSource("checks.yaml", 0)
+	require.Equal(t, DefaultLocalSourceInterval, src.interval)
+
+	_, err := src.GetTenant(context.Background(), &sm.TenantInfo{Id: 1000})
+	require.ErrorIs(t, err, errTenantNotFound)
+
+	src.setTenants([]sm.Tenant{{Id: 1000, StackId: 2}})
+
+	tenant, err := src.GetTenant(context.Background(), &sm.TenantInfo{Id: 1000})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), tenant.StackId)
+}
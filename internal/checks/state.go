@@ -0,0 +1,382 @@
+package checks
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// DefaultStateMaxStaleness is the default for how long checks keep
+// running without being confirmed by the API.
+const DefaultStateMaxStaleness = 24 * time.Hour
+
+// stateRefreshInterval is how often the state file is rewritten while
+// the updater is in sync with the API, even if nothing changed, so that
+// its timestamp reflects when the checks were last known to be current.
+const stateRefreshInterval = 5 * time.Minute
+
+// State is the check set applied by the updater, as saved to its state
+// file. It allows the agent to start running its checks right away after
+// a restart, even if the API can't be reached.
+//
+// Tenants are saved without their credentials, see withoutCredentials.
+// When restored, they are handed to the tenant manager, which uses them
+// for the settings the checks need, like their limits, until the full
+// tenants are obtained from its cache or the API. Publishing requires the
+// credentials, so until then results are queued by the publisher, within
+// its limits.
+type State struct {
+	// SyncedAt is the last time the checks were known to match the
+	// ones in the API.
+	SyncedAt time.Time   `json:"syncedAt"`
+	Probe    sm.Probe    `json:"probe"`
+	Tenants  []sm.Tenant `json:"tenants"`
+	Checks   []sm.Check  `json:"checks"`
+}
+
+// ReadState reads the state file with the specified name.
+func ReadState(fn string) (*State, error) {
+	data, err := os.ReadFile(fn) //#nosec -- the file is provided by the operator.
+	if err != nil {
+		return nil, err
+	}
+
+	var st State
+
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", fn, err)
+	}
+
+	return &st, nil
+}
+
+// WriteState atomically replaces the state file with the specified name.
+// The file is only readable by its owner.
+func WriteState(fn string, st *State) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("encoding state: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fn), "."+filepath.Base(fn)+".*")
+	if err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	defer func() {
+		// Only fails if the file was renamed.
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), fn); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	return nil
+}
+
+// withoutCredentials returns a copy of the tenant without the passwords
+// of its remotes and without its secret store details.
+func withoutCredentials(tenant sm.Tenant) sm.Tenant {
+	for _, remote := range []**sm.RemoteInfo{&tenant.MetricsRemote, &tenant.EventsRemote} {
+		if *remote != nil {
+			r := **remote
+			r.Password = ""
+			*remote = &r
+		}
+	}
+
+	tenant.SecretStore = nil
+
+	return tenant
+}
+
+// sameProbeIdentity compares two probes ignoring the fields that change
+// without the probe itself changing, like its online status or the
+// version of the agent running it.
+func sameProbeIdentity(a, b sm.Probe) bool {
+	for _, p := range []*sm.Probe{&a, &b} {
+		p.Online, p.OnlineChange = false, 0
+		p.Version, p.Commit, p.Buildstamp = "", "", ""
+	}
+
+	return sameProbe(a, b)
+}
+
+// stateInfo tracks what's needed to maintain the state file. It's
+// guarded by the scrapers mutex.
+type stateInfo struct {
+	filename     string
+	maxStaleness time.Duration
+	// restorer receives the tenants read from the file, if set.
+	restorer TenantRestorer
+	// tenants are the tenants received from the API, without their
+	// credentials.
+	tenants  map[int64]sm.Tenant
+	syncedAt time.Time
+	// synced is true once a batch of changes has been received from
+	// the current connection to the API.
+	synced bool
+	// restoredProbe is the probe read from the state file, until the
+	// API confirms it.
+	restoredProbe *sm.Probe
+	expiry        *time.Timer
+}
+
+// restoreState starts the checks found in the state file, if it's recent
+// enough. Problems with the file are logged, as the checks will come from
+// the API eventually.
+func (c *Updater) restoreState(ctx context.Context) {
+	logger := c.logger.With().Str("state_file", c.state.filename).Logger()
+
+	st, err := ReadState(c.state.filename)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return
+
+	case err != nil:
+		logger.Warn().Err(err).Msg("cannot read state file, waiting for checks from the API")
+		return
+
+	case c.state.maxStaleness > 0 && time.Since(st.SyncedAt) > c.state.maxStaleness:
+		logger.Info().Time("synced_at", st.SyncedAt).Msg("state file is too old, waiting for checks from the API")
+		return
+	}
+
+	if err := c.validateProbeCapabilities(st.Probe.Capabilities); err != nil {
+		logger.Warn().Err(err).Msg("invalid probe in state file, waiting for checks from the API")
+		return
+	}
+
+	// Passwords are written as "<encrypted>".
+	tenants := make([]sm.Tenant, 0, len(st.Tenants))
+	for _, tenant := range st.Tenants {
+		tenants = append(tenants, withoutCredentials(tenant))
+	}
+
+	if c.state.restorer != nil {
+		c.state.restorer.RestoreTenants(tenants)
+	}
+
+	probe := st.Probe
+	c.probe = &probe
+
+	c.notifyProbeTenant()
+
+	c.metrics.probeInfo.Reset()
+	c.metrics.probeInfo.With(c.probeInfoLabels()).Set(1)
+
+	changes := sm.Changes{Checks: make([]sm.CheckChange, 0, len(st.Checks))}
+
+	for _, check := range st.Checks {
+		changes.Checks = append(changes.Checks, sm.CheckChange{Operation: sm.CheckOperation_CHECK_ADD, Check: check})
+	}
+
+	c.handleFirstBatch(ctx, &changes)
+
+	c.scrapersMutex.Lock()
+	defer c.scrapersMutex.Unlock()
+
+	for _, tenant := range tenants {
+		c.state.tenants[tenant.Id] = tenant
+	}
+
+	c.state.syncedAt = st.SyncedAt
+	c.state.restoredProbe = &probe
+	c.scheduleExpiryWithLock()
+
+	logger.Info().
+		Int64("probe_id", probe.Id).
+		Int("checks", len(c.scrapers)).
+		Time("synced_at", st.SyncedAt).
+		Int("tenants", len(tenants)).
+		Msg("restored checks from state file, results are published once tenant credentials are available from the tenant cache or the API")
+}
+
+// connectedState is called once the probe is registered with the API,
+// before requesting changes. It stops the restored checks if the probe
+// is not the one they were saved for, so that all of them are requested
+// again. Otherwise the API only sends the differences with the running
+// checks.
+func (c *Updater) connectedState() {
+	if c.state.filename == "" {
+		return
+	}
+
+	c.scrapersMutex.Lock()
+	defer c.scrapersMutex.Unlock()
+
+	c.state.synced = false
+
+	if c.state.expiry != nil {
+		c.state.expiry.Stop()
+		c.state.expiry = nil
+	}
+
+	if restored := c.state.restoredProbe; restored != nil && !sameProbeIdentity(*restored, *c.probe) {
+		c.logger.Info().
+			Int64("probe_id", c.probe.Id).
+			Int64("restored_probe_id", restored.Id).
+			Msg("probe changed since the state file was saved, discarding restored checks")
+
+		c.stopAllScrapersWithLock()
+	}
+
+	c.state.restoredProbe = nil
+}
+
+// disconnectedState is called when the connection to the API is lost. The
+// checks keep running until they are too stale.
+func (c *Updater) disconnectedState() {
+	if c.state.filename == "" {
+		return
+	}
+
+	c.scrapersMutex.Lock()
+	defer c.scrapersMutex.Unlock()
+
+	c.state.synced = false
+	c.scheduleExpiryWithLock()
+}
+
+// scheduleExpiryWithLock arranges for the running checks to be stopped
+// once they go without being confirmed by the API for longer than the
+// maximum staleness. It MUST be called with the scrapers mutex held.
+func (c *Updater) scheduleExpiryWithLock() {
+	if c.state.maxStaleness <= 0 || c.state.expiry != nil || len(c.scrapers) == 0 {
+		return
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(time.Until(c.state.syncedAt.Add(c.state.maxStaleness)), func() {
+		c.scrapersMutex.Lock()
+		defer c.scrapersMutex.Unlock()
+
+		// The timer might have been replaced while waiting for
+		// the lock.
+		if c.state.expiry != timer {
+			return
+		}
+
+		c.state.expiry = nil
+
+		c.logger.Warn().
+			Time("synced_at", c.state.syncedAt).
+			Int("checks", len(c.scrapers)).
+			Msg("checks not confirmed by the API for too long, stopping them")
+
+		c.stopAllScrapersWithLock()
+	})
+
+	c.state.expiry = timer
+}
+
+// syncState records the tenants in a batch of changes received from the
+// API and saves the state file.
+func (c *Updater) syncState(changes *sm.Changes) {
+	if c.state.filename == "" {
+		return
+	}
+
+	c.scrapersMutex.Lock()
+
+	for _, tenant := range changes.Tenants {
+		c.state.tenants[tenant.Id] = withoutCredentials(tenant)
+	}
+
+	c.state.synced = true
+
+	c.scrapersMutex.Unlock()
+
+	c.saveState()
+}
+
+// refreshState periodically saves the state file while the updater is in
+// sync with the API, until ctx is cancelled.
+func (c *Updater) refreshState(ctx context.Context) {
+	ticker := time.NewTicker(stateRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			c.saveState()
+		}
+	}
+}
+
+// saveState writes the running checks to the state file, if the updater
+// is in sync with the API. Once draining, the file keeps the checks that
+// were running, for when the agent starts again.
+func (c *Updater) saveState() {
+	c.stateWriteMutex.Lock()
+	defer c.stateWriteMutex.Unlock()
+
+	c.scrapersMutex.Lock()
+
+	if !c.state.synced || c.probe == nil || c.isDraining() {
+		c.scrapersMutex.Unlock()
+		return
+	}
+
+	c.state.syncedAt = time.Now()
+
+	st := State{
+		SyncedAt: c.state.syncedAt,
+		Probe:    *c.probe,
+		Tenants:  slices.SortedFunc(maps.Values(c.state.tenants), func(a, b sm.Tenant) int { return cmp.Compare(a.Id, b.Id) }),
+		Checks:   make([]sm.Check, 0, len(c.scrapers)),
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(c.scrapers)) {
+		st.Checks = append(st.Checks, c.scrapers[id].Status().Check.Check)
+	}
+
+	c.scrapersMutex.Unlock()
+
+	if err := WriteState(c.state.filename, &st); err != nil {
+		c.logger.Warn().Err(err).Str("state_file", c.state.filename).Msg("cannot save state file")
+	}
+}
+
+// stopAllScrapersWithLock stops all the running scrapers. It MUST be
+// called with the scrapers mutex held.
+func (c *Updater) stopAllScrapersWithLock() {
+	for id, s := range c.scrapers {
+		checkType := s.CheckType().String()
+		s.Stop()
+
+		delete(c.scrapers, id)
+
+		c.metrics.runningScrapers.WithLabelValues(checkType).Dec()
+	}
+}
@@ -0,0 +1,229 @@
+package checks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestWriteState(t *testing.T) {
+	t.Parallel()
+
+	fn := filepath.Join(t.TempDir(), "state.json")
+
+	_, err := ReadState(fn)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	st := State{
+		SyncedAt: time.Unix(100, 0).UTC(),
+		Probe:    sm.Probe{Id: 1, Name: "probe"},
+		Tenants:  []sm.Tenant{{Id: 1000, StackId: 2}},
+		Checks:   []sm.Check{{Id: 10, TenantId: 1000, Target: "127.0.0.1"}},
+	}
+
+	require.NoError(t, WriteState(fn, &st))
+
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	// Replacing the file doesn't leave temporary files behind.
+	require.NoError(t, WriteState(fn, &st))
+
+	entries, err := os.ReadDir(filepath.Dir(fn))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	actual, err := ReadState(fn)
+	require.NoError(t, err)
+	require.Equal(t, &st, actual)
+}
+
+func TestWithoutCredentials(t *testing.T) {
+	t.Parallel()
+
+	tenant := sm.Tenant{
+		Id:            1000,
+		MetricsRemote: &sm.RemoteInfo{Url: "https://metrics", Username: "1", Password: "secret"},
+		EventsRemote:  &sm.RemoteInfo{Url: "https://events", Username: "2", Password: "secret"},
+		SecretStore:   &sm.SecretStore{Url: "https://secrets", Token: "secret"},
+		Limits:        &sm.TenantLimits{MaxMetricLabels: 10},
+	}
+
+	actual := withoutCredentials(tenant)
+
+	require.Equal(t, sm.Tenant{
+		Id:            1000,
+		MetricsRemote: &sm.RemoteInfo{Url: "https://metrics", Username: "1"},
+		EventsRemote:  &sm.RemoteInfo{Url: "https://events", Username: "2"},
+		Limits:        &sm.TenantLimits{MaxMetricLabels: 10},
+	}, actual)
+
+	// The original is not modified.
+	require.Equal(t, "secret", tenant.MetricsRemote.Password)
+	require.NotNil(t, tenant.SecretStore)
+}
+
+// tenantRecorder is a TenantRestorer that records the tenants it's given.
+type tenantRecorder struct {
+	tenants []sm.Tenant
+}
+
+func (r *tenantRecorder) RestoreTenants(tenants []sm.Tenant) {
+	r.tenants = append(r.tenants, tenants...)
+}
+
+func TestUpdaterState(t *testing.T) {
+	synctest.Test(t, testUpdaterStateImpl)
+}
+
+func testUpdaterStateImpl(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	fn := filepath.Join(t.TempDir(), "state.json")
+
+	restorer := &tenantRecorder{}
+
+	newUpdater := func(t *testing.T, maxStaleness time.Duration) *Updater {
+		t.Helper()
+
+		u, err := NewUpdater(UpdaterOptions{
+			Conn:              new(grpc.ClientConn),
+			PromRegisterer:    prometheus.NewPedanticRegistry(),
+			Publisher:         channelPublisher(make(chan pusher.Payload, 100)),
+			TenantCh:          make(chan<- sm.Tenant),
+			Logger:            testhelper.Logger(t),
+			ScraperFactory:    testScraperFactory,
+			K6Runner:          noopRunner{},
+			StateFile:         fn,
+			StateMaxStaleness: maxStaleness,
+			TenantRestorer:    restorer,
+		})
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			u.scrapersMutex.Lock()
+			defer u.scrapersMutex.Unlock()
+
+			u.stopAllScrapersWithLock()
+		})
+
+		return u
+	}
+
+	running := func(u *Updater) []model.GlobalID {
+		var ids []model.GlobalID
+
+		for _, s := range u.Checks() {
+			ids = append(ids, s.Check.GlobalID())
+		}
+
+		return ids
+	}
+
+	probe := sm.Probe{Id: 1, TenantId: 1000, Name: "probe", Online: true}
+
+	changes := sm.Changes{
+		Tenants: []sm.Tenant{{Id: 1000, MetricsRemote: &sm.RemoteInfo{Url: "https://metrics", Password: "s3cr3t"}}},
+		Checks: []sm.CheckChange{{
+			Operation: sm.CheckOperation_CHECK_ADD,
+			Check: sm.Check{
+				Id:        10,
+				TenantId:  1000,
+				Job:       "job",
+				Target:    "127.0.0.1",
+				Frequency: 60000,
+				Timeout:   1000,
+				Enabled:   true,
+				Probes:    []int64{1},
+				Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+			},
+		}},
+	}
+
+	// The state is saved after each batch of changes.
+	u := newUpdater(t, time.Hour)
+	u.probe = &probe
+	u.handleChangeBatch(ctx, &changes, true)
+	u.syncState(&changes)
+
+	st, err := ReadState(fn)
+	require.NoError(t, err)
+	require.True(t, time.Now().Equal(st.SyncedAt))
+	require.Equal(t, probe, st.Probe)
+	require.Len(t, st.Tenants, 1)
+	require.Equal(t, "https://metrics", st.Tenants[0].MetricsRemote.Url)
+
+	// Tenant credentials are not saved.
+	data, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "s3cr3t")
+	require.Len(t, st.Checks, 1)
+	require.Equal(t, int64(10), st.Checks[0].Id)
+
+	// A new updater restores the checks, and keeps them if the API
+	// reports the same probe.
+	u = newUpdater(t, time.Hour)
+	u.restoreState(ctx)
+	require.Equal(t, []model.GlobalID{10}, running(u))
+	require.Equal(t, probe, *u.probe)
+
+	// The restored tenants are handed over without credentials, and
+	// saved again even if the API doesn't send them.
+	restored := sm.Tenant{Id: 1000, MetricsRemote: &sm.RemoteInfo{Url: "https://metrics"}}
+	require.Equal(t, []sm.Tenant{restored}, restorer.tenants)
+	require.Equal(t, map[int64]sm.Tenant{1000: restored}, u.state.tenants)
+
+	reconnected := probe
+	reconnected.Online = false
+	u.probe = &reconnected
+	u.connectedState()
+	require.Equal(t, []model.GlobalID{10}, running(u))
+
+	// The checks are discarded if the probe changed.
+	u = newUpdater(t, time.Hour)
+	u.restoreState(ctx)
+
+	renamed := probe
+	renamed.Name = "renamed"
+	u.probe = &renamed
+	u.connectedState()
+	require.Empty(t, running(u))
+
+	// Restored checks stop once they are too stale.
+	u = newUpdater(t, time.Hour)
+	u.restoreState(ctx)
+	require.Len(t, running(u), 1)
+
+	time.Sleep(59 * time.Minute)
+	synctest.Wait()
+	require.Len(t, running(u), 1)
+
+	time.Sleep(2 * time.Minute)
+	synctest.Wait()
+	require.Empty(t, running(u))
+
+	// And they are not restored from a stale file.
+	u = newUpdater(t, time.Hour)
+	u.restoreState(ctx)
+	require.Empty(t, running(u))
+	require.Nil(t, u.probe)
+
+	// Unless staleness is not limited.
+	u = newUpdater(t, 0)
+	u.restoreState(ctx)
+	require.Len(t, running(u), 1)
+}
@@ -14,6 +14,8 @@ const (
 	K6                    = "k6"
 	ExperimentalDnsProber = "experimental-dns-prober"
 	ProtocolSecrets       = "protocol-secrets"
+	NativeHistograms      = "native-histograms"
+	RemoteWriteV2         = "remote-write-v2"
 )
 
 // ErrInvalidCollection is returned when you try to set a flag in an
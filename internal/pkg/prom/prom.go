@@ -393,6 +393,10 @@ func (c *Client) StoreBytes(ctx context.Context, req []byte) error {
 // StoreStream sends a batch of samples to the HTTP endpoint, the request is the proto marshalled
 // and encoded bytes from codec.go.
 func (c *Client) StoreStream(ctx context.Context, req io.Reader) error {
+	return c.store(ctx, req, remoteWriteV1ContentType, "")
+}
+
+func (c *Client) store(ctx context.Context, req io.Reader, contentType, version string) error {
 	// Setup the new request...
 	httpReq, err := http.NewRequest("POST", c.url.String(), req)
 	if err != nil {
@@ -402,12 +406,16 @@ func (c *Client) StoreStream(ctx context.Context, req io.Reader) error {
 	}
 
 	httpReq.Header.Add("Content-Encoding", "snappy")
-	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("Content-Type", contentType)
 
 	for k, v := range c.headers {
 		httpReq.Header.Set(k, v)
 	}
 
+	if version != "" {
+		httpReq.Header.Set("X-Prometheus-Remote-Write-Version", version)
+	}
+
 	// ... and add a context with timeout as late as possible to give it as
 	// much chance to finish as possible.
 	ctx, cancel := context.WithTimeout(ctx, c.timeout)
@@ -0,0 +1,354 @@
+package prom
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+const (
+	// RemoteWriteV1Version is the value of the
+	// X-Prometheus-Remote-Write-Version header for Remote-Write 1.0
+	// requests.
+	RemoteWriteV1Version = "0.1.0"
+	// RemoteWriteV2Version is the value of the
+	// X-Prometheus-Remote-Write-Version header for Remote-Write 2.0
+	// requests.
+	RemoteWriteV2Version = "2.0.0"
+
+	remoteWriteV1ContentType = "application/x-protobuf"
+	remoteWriteV2ContentType = "application/x-protobuf;proto=io.prometheus.write.v2.Request"
+
+	metricNameLabel = "__name__"
+)
+
+// SeriesMetadata holds the information about a time series that
+// Remote-Write 2.0 is able to carry in addition to its labels and
+// samples.
+type SeriesMetadata struct {
+	Type prompb.MetricMetadata_MetricType
+	Help string
+	Unit string
+	// StartTimestamp is the time, in milliseconds since the epoch, at
+	// which the series was created. It's only meaningful for
+	// counters, summaries and histograms. Zero means unknown.
+	StartTimestamp int64
+}
+
+// StoreStreamV2 is like StoreStream, but the request is a
+// snappy-encoded Remote-Write 2.0 request.
+func (c *Client) StoreStreamV2(ctx context.Context, req io.Reader) error {
+	return c.store(ctx, req, remoteWriteV2ContentType, RemoteWriteV2Version)
+}
+
+// ToWriteV2Request converts the provided time series into a Remote-Write
+// 2.0 request. If metadata is not nil, it must have one entry for each of
+// the time series, in the same order.
+func ToWriteV2Request(series []prompb.TimeSeries, metadata []SeriesMetadata) *writev2.Request {
+	symbols := writev2.NewSymbolTable()
+
+	req := writev2.Request{
+		Timeseries: make([]writev2.TimeSeries, 0, len(series)),
+	}
+
+	for i, ts := range series {
+		out := writev2.TimeSeries{
+			LabelsRefs: make([]uint32, 0, 2*len(ts.Labels)),
+			Samples:    make([]writev2.Sample, 0, len(ts.Samples)),
+		}
+
+		for _, l := range ts.Labels {
+			out.LabelsRefs = append(out.LabelsRefs, symbols.Symbolize(l.Name), symbols.Symbolize(l.Value))
+		}
+
+		var md SeriesMetadata
+		if i < len(metadata) {
+			md = metadata[i]
+		}
+
+		out.Metadata = writev2.Metadata{
+			Type:    toWriteV2MetricType(md.Type),
+			HelpRef: symbols.Symbolize(md.Help),
+			UnitRef: symbols.Symbolize(md.Unit),
+		}
+
+		for _, s := range ts.Samples {
+			out.Samples = append(out.Samples, writev2.Sample{
+				Value:          s.Value,
+				Timestamp:      s.Timestamp,
+				StartTimestamp: md.StartTimestamp,
+			})
+		}
+
+		for _, h := range ts.Histograms {
+			wh := toWriteV2Histogram(h)
+			wh.StartTimestamp = md.StartTimestamp
+			out.Histograms = append(out.Histograms, wh)
+		}
+
+		req.Timeseries = append(req.Timeseries, out)
+	}
+
+	req.Symbols = symbols.Symbols()
+
+	return &req
+}
+
+// MergeWriteV2Requests combines multiple Remote-Write 2.0 requests into a
+// single one. Since each request has its own symbol table, the references
+// in the time series are rewritten to point to the combined table. The
+// time series in the provided requests are modified in place.
+func MergeWriteV2Requests(reqs []*writev2.Request) *writev2.Request {
+	if len(reqs) == 1 {
+		return reqs[0]
+	}
+
+	symbols := writev2.NewSymbolTable()
+
+	var out writev2.Request
+
+	for _, req := range reqs {
+		refs := make([]uint32, len(req.Symbols))
+		for i, s := range req.Symbols {
+			refs[i] = symbols.Symbolize(s)
+		}
+
+		remap := func(ref uint32) uint32 {
+			if int(ref) < len(refs) {
+				return refs[ref]
+			}
+
+			return 0
+		}
+
+		for _, ts := range req.Timeseries {
+			for i, ref := range ts.LabelsRefs {
+				ts.LabelsRefs[i] = remap(ref)
+			}
+
+			for i := range ts.Exemplars {
+				for j, ref := range ts.Exemplars[i].LabelsRefs {
+					ts.Exemplars[i].LabelsRefs[j] = remap(ref)
+				}
+			}
+
+			ts.Metadata.HelpRef = remap(ts.Metadata.HelpRef)
+			ts.Metadata.UnitRef = remap(ts.Metadata.UnitRef)
+
+			out.Timeseries = append(out.Timeseries, ts)
+		}
+	}
+
+	out.Symbols = symbols.Symbols()
+
+	return &out
+}
+
+// FromWriteV2Request converts a Remote-Write 2.0 request into a
+// Remote-Write 1.0 one. Start timestamps are dropped, and metadata is
+// converted to per-family metadata.
+func FromWriteV2Request(req *writev2.Request) *prompb.WriteRequest {
+	symbol := func(ref uint32) string {
+		if int(ref) < len(req.Symbols) {
+			return req.Symbols[ref]
+		}
+
+		return ""
+	}
+
+	var out prompb.WriteRequest
+
+	seen := make(map[string]struct{})
+
+	for _, ts := range req.Timeseries {
+		series := prompb.TimeSeries{
+			Labels:  make([]prompb.Label, 0, len(ts.LabelsRefs)/2),
+			Samples: make([]prompb.Sample, 0, len(ts.Samples)),
+		}
+
+		var name string
+
+		for i := 0; i+1 < len(ts.LabelsRefs); i += 2 {
+			l := prompb.Label{Name: symbol(ts.LabelsRefs[i]), Value: symbol(ts.LabelsRefs[i+1])}
+			if l.Name == metricNameLabel {
+				name = l.Value
+			}
+
+			series.Labels = append(series.Labels, l)
+		}
+
+		for _, s := range ts.Samples {
+			series.Samples = append(series.Samples, prompb.Sample{Value: s.Value, Timestamp: s.Timestamp})
+		}
+
+		for _, h := range ts.Histograms {
+			series.Histograms = append(series.Histograms, fromWriteV2Histogram(h))
+		}
+
+		out.Timeseries = append(out.Timeseries, series)
+
+		family := metricFamilyName(name, ts.Metadata.Type)
+		if _, found := seen[family]; found || ts.Metadata.Type == writev2.Metadata_METRIC_TYPE_UNSPECIFIED {
+			continue
+		}
+
+		seen[family] = struct{}{}
+
+		out.Metadata = append(out.Metadata, prompb.MetricMetadata{
+			Type:             fromWriteV2MetricType(ts.Metadata.Type),
+			MetricFamilyName: family,
+			Help:             symbol(ts.Metadata.HelpRef),
+			Unit:             symbol(ts.Metadata.UnitRef),
+		})
+	}
+
+	return &out
+}
+
+// metricFamilyName returns the name of the family a series belongs to,
+// removing the suffixes added for the individual components of classic
+// summaries and histograms.
+func metricFamilyName(name string, t writev2.Metadata_MetricType) string {
+	var suffixes []string
+
+	switch t {
+	case writev2.Metadata_METRIC_TYPE_SUMMARY:
+		suffixes = []string{"_sum", "_count"}
+
+	case writev2.Metadata_METRIC_TYPE_HISTOGRAM:
+		suffixes = []string{"_sum", "_count", "_bucket"}
+	}
+
+	for _, suffix := range suffixes {
+		if family, found := strings.CutSuffix(name, suffix); found {
+			return family
+		}
+	}
+
+	return name
+}
+
+func toWriteV2MetricType(t prompb.MetricMetadata_MetricType) writev2.Metadata_MetricType {
+	switch t {
+	case prompb.MetricMetadata_COUNTER:
+		return writev2.Metadata_METRIC_TYPE_COUNTER
+	case prompb.MetricMetadata_GAUGE:
+		return writev2.Metadata_METRIC_TYPE_GAUGE
+	case prompb.MetricMetadata_HISTOGRAM:
+		return writev2.Metadata_METRIC_TYPE_HISTOGRAM
+	case prompb.MetricMetadata_GAUGEHISTOGRAM:
+		return writev2.Metadata_METRIC_TYPE_GAUGEHISTOGRAM
+	case prompb.MetricMetadata_SUMMARY:
+		return writev2.Metadata_METRIC_TYPE_SUMMARY
+	case prompb.MetricMetadata_INFO:
+		return writev2.Metadata_METRIC_TYPE_INFO
+	case prompb.MetricMetadata_STATESET:
+		return writev2.Metadata_METRIC_TYPE_STATESET
+	default:
+		return writev2.Metadata_METRIC_TYPE_UNSPECIFIED
+	}
+}
+
+func fromWriteV2MetricType(t writev2.Metadata_MetricType) prompb.MetricMetadata_MetricType {
+	switch t {
+	case writev2.Metadata_METRIC_TYPE_COUNTER:
+		return prompb.MetricMetadata_COUNTER
+	case writev2.Metadata_METRIC_TYPE_GAUGE:
+		return prompb.MetricMetadata_GAUGE
+	case writev2.Metadata_METRIC_TYPE_HISTOGRAM:
+		return prompb.MetricMetadata_HISTOGRAM
+	case writev2.Metadata_METRIC_TYPE_GAUGEHISTOGRAM:
+		return prompb.MetricMetadata_GAUGEHISTOGRAM
+	case writev2.Metadata_METRIC_TYPE_SUMMARY:
+		return prompb.MetricMetadata_SUMMARY
+	case writev2.Metadata_METRIC_TYPE_INFO:
+		return prompb.MetricMetadata_INFO
+	case writev2.Metadata_METRIC_TYPE_STATESET:
+		return prompb.MetricMetadata_STATESET
+	default:
+		return prompb.MetricMetadata_UNKNOWN
+	}
+}
+
+func toWriteV2Histogram(h prompb.Histogram) writev2.Histogram {
+	out := writev2.Histogram{
+		Sum:            h.Sum,
+		Schema:         h.Schema,
+		ZeroThreshold:  h.ZeroThreshold,
+		NegativeSpans:  make([]writev2.BucketSpan, 0, len(h.NegativeSpans)),
+		NegativeDeltas: h.NegativeDeltas,
+		NegativeCounts: h.NegativeCounts,
+		PositiveSpans:  make([]writev2.BucketSpan, 0, len(h.PositiveSpans)),
+		PositiveDeltas: h.PositiveDeltas,
+		PositiveCounts: h.PositiveCounts,
+		ResetHint:      writev2.Histogram_ResetHint(h.ResetHint),
+		Timestamp:      h.Timestamp,
+	}
+
+	switch c := h.Count.(type) {
+	case *prompb.Histogram_CountInt:
+		out.Count = &writev2.Histogram_CountInt{CountInt: c.CountInt}
+	case *prompb.Histogram_CountFloat:
+		out.Count = &writev2.Histogram_CountFloat{CountFloat: c.CountFloat}
+	}
+
+	switch c := h.ZeroCount.(type) {
+	case *prompb.Histogram_ZeroCountInt:
+		out.ZeroCount = &writev2.Histogram_ZeroCountInt{ZeroCountInt: c.ZeroCountInt}
+	case *prompb.Histogram_ZeroCountFloat:
+		out.ZeroCount = &writev2.Histogram_ZeroCountFloat{ZeroCountFloat: c.ZeroCountFloat}
+	}
+
+	for _, s := range h.NegativeSpans {
+		out.NegativeSpans = append(out.NegativeSpans, writev2.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+
+	for _, s := range h.PositiveSpans {
+		out.PositiveSpans = append(out.PositiveSpans, writev2.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+
+	return out
+}
+
+func fromWriteV2Histogram(h writev2.Histogram) prompb.Histogram {
+	out := prompb.Histogram{
+		Sum:            h.Sum,
+		Schema:         h.Schema,
+		ZeroThreshold:  h.ZeroThreshold,
+		NegativeSpans:  make([]prompb.BucketSpan, 0, len(h.NegativeSpans)),
+		NegativeDeltas: h.NegativeDeltas,
+		NegativeCounts: h.NegativeCounts,
+		PositiveSpans:  make([]prompb.BucketSpan, 0, len(h.PositiveSpans)),
+		PositiveDeltas: h.PositiveDeltas,
+		PositiveCounts: h.PositiveCounts,
+		ResetHint:      prompb.Histogram_ResetHint(h.ResetHint),
+		Timestamp:      h.Timestamp,
+	}
+
+	switch c := h.Count.(type) {
+	case *writev2.Histogram_CountInt:
+		out.Count = &prompb.Histogram_CountInt{CountInt: c.CountInt}
+	case *writev2.Histogram_CountFloat:
+		out.Count = &prompb.Histogram_CountFloat{CountFloat: c.CountFloat}
+	}
+
+	switch c := h.ZeroCount.(type) {
+	case *writev2.Histogram_ZeroCountInt:
+		out.ZeroCount = &prompb.Histogram_ZeroCountInt{ZeroCountInt: c.ZeroCountInt}
+	case *writev2.Histogram_ZeroCountFloat:
+		out.ZeroCount = &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: c.ZeroCountFloat}
+	}
+
+	for _, s := range h.NegativeSpans {
+		out.NegativeSpans = append(out.NegativeSpans, prompb.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+
+	for _, s := range h.PositiveSpans {
+		out.PositiveSpans = append(out.PositiveSpans, prompb.BucketSpan{Offset: s.Offset, Length: s.Length})
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+package prom_test
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/pkg/prom"
+)
+
+func TestWriteV2RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	labels := func(name, job string) []prompb.Label {
+		return []prompb.Label{{Name: "__name__", Value: name}, {Name: "job", Value: job}}
+	}
+
+	histogram := prompb.Histogram{
+		Count:          &prompb.Histogram_CountInt{CountInt: 3},
+		Sum:            1.5,
+		Schema:         3,
+		ZeroThreshold:  1e-128,
+		ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 0},
+		NegativeSpans:  []prompb.BucketSpan{},
+		PositiveSpans:  []prompb.BucketSpan{{Offset: 1, Length: 2}},
+		PositiveDeltas: []int64{1, 1},
+		Timestamp:      1000,
+	}
+
+	series1 := []prompb.TimeSeries{
+		{Labels: labels("probe_success", "a"), Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}}},
+		{Labels: labels("probe_duration_seconds_sum", "a"), Samples: []prompb.Sample{{Value: 0.5, Timestamp: 1000}}},
+		{Labels: labels("probe_duration_seconds_count", "a"), Samples: []prompb.Sample{{Value: 2, Timestamp: 1000}}},
+	}
+	metadata1 := []prom.SeriesMetadata{
+		{Type: prompb.MetricMetadata_GAUGE, Help: "Probe success"},
+		{Type: prompb.MetricMetadata_SUMMARY, Help: "Probe duration", Unit: "seconds", StartTimestamp: 500},
+		{Type: prompb.MetricMetadata_SUMMARY, Help: "Probe duration", Unit: "seconds", StartTimestamp: 500},
+	}
+
+	series2 := []prompb.TimeSeries{
+		{Labels: labels("probe_success", "b"), Samples: []prompb.Sample{{Value: 0, Timestamp: 2000}}},
+		{Labels: labels("probe_all_duration_seconds", "b"), Samples: []prompb.Sample{}, Histograms: []prompb.Histogram{histogram}},
+	}
+	metadata2 := []prom.SeriesMetadata{
+		{Type: prompb.MetricMetadata_GAUGE, Help: "Probe success"},
+		{Type: prompb.MetricMetadata_HISTOGRAM, Help: "Duration", Unit: "seconds", StartTimestamp: 700},
+	}
+
+	req1 := prom.ToWriteV2Request(series1, metadata1)
+	require.Len(t, req1.Timeseries, 3)
+	require.Equal(t, "", req1.Symbols[0], "the first symbol must be the empty string")
+	require.Equal(t, int64(500), req1.Timeseries[1].Samples[0].StartTimestamp)
+
+	req2 := prom.ToWriteV2Request(series2, metadata2)
+	require.Equal(t, int64(700), req2.Timeseries[1].Histograms[0].StartTimestamp)
+
+	merged := prom.MergeWriteV2Requests([]*writev2.Request{req1, req2})
+	require.Len(t, merged.Timeseries, 5)
+
+	// Symbols are not repeated in the merged request.
+	seen := make(map[string]struct{})
+	for _, s := range merged.Symbols {
+		_, found := seen[s]
+		require.Falsef(t, found, "duplicate symbol %q", s)
+		seen[s] = struct{}{}
+	}
+
+	out := prom.FromWriteV2Request(merged)
+	require.Equal(t, append(series1, series2...), out.Timeseries)
+	require.ElementsMatch(t, []prompb.MetricMetadata{
+		{Type: prompb.MetricMetadata_GAUGE, MetricFamilyName: "probe_success", Help: "Probe success"},
+		{Type: prompb.MetricMetadata_SUMMARY, MetricFamilyName: "probe_duration_seconds", Help: "Probe duration", Unit: "seconds"},
+		{Type: prompb.MetricMetadata_HISTOGRAM, MetricFamilyName: "probe_all_duration_seconds", Help: "Duration", Unit: "seconds"},
+	}, out.Metadata)
+}
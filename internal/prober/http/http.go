@@ -94,6 +94,8 @@ func (p Prober) buildProbeConfig(ctx context.Context) (config.Module, error) {
 	// Start with static config
 	cfg := p.staticConfig
 
+	p.prefetchSecrets(ctx)
+
 	// Resolve authentication secrets at probe time
 	httpClientConfig, err := buildPrometheusHTTPClientConfig(
 		ctx,
@@ -207,6 +209,45 @@ func buildStaticConfig(settings *sm.HttpSettings) (config.Module, error) {
 	return m, nil
 }
 
+// SecretNames returns the names of the secrets referenced by the settings,
+// which are resolved at probe time.
+func SecretNames(settings *sm.HttpSettings) []string {
+	if settings == nil || !settings.SecretManagerEnabled {
+		return nil
+	}
+
+	values := []string{settings.BearerToken}
+
+	if settings.BasicAuth != nil {
+		values = append(values, settings.BasicAuth.Password)
+	}
+
+	if settings.TlsConfig != nil {
+		values = append(values,
+			string(settings.TlsConfig.CACert),
+			string(settings.TlsConfig.ClientCert),
+			string(settings.TlsConfig.ClientKey),
+		)
+	}
+
+	return interpolation.SecretNames(values...)
+}
+
+// prefetchSecrets resolves all the secrets used by the probe in a single
+// batch, so that resolving each of them afterwards hits the cache instead
+// of paying a round trip to the secret store for each one. Failures are
+// reported when the individual secrets are resolved.
+func (p Prober) prefetchSecrets(ctx context.Context) {
+	names := SecretNames(p.settings)
+	if len(names) < 2 {
+		return
+	}
+
+	if _, err := secrets.GetSecretValues(ctx, p.secretStore, p.tenantID, names); err != nil {
+		p.logger.Debug().Err(err).Msg("failed to prefetch secrets")
+	}
+}
+
 // resolveSecretValue resolves a secret value using string interpolation with ${secrets.secret_name} syntax.
 // If secretManagerEnabled is false, the value is returned as-is without any interpolation.
 func resolveSecretValue(ctx context.Context, value string, secretStore secrets.SecretProvider, tenantID model.GlobalID, logger zerolog.Logger, secretManagerEnabled bool) (string, error) {
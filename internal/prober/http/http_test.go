@@ -1026,3 +1026,25 @@ func TestBuildTLSConfig_WithSecrets(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretNames(t *testing.T) {
+	settings := &sm.HttpSettings{
+		BearerToken: "${secrets.token}",
+		BasicAuth: &sm.BasicAuth{
+			Username: "user",
+			Password: "${secrets.password}",
+		},
+		TlsConfig: &sm.TLSConfig{
+			ClientCert: []byte("${secrets.cert}"),
+			ClientKey:  []byte("${secrets.key}"),
+		},
+	}
+
+	// Without the secret manager, placeholders are not interpolated.
+	require.Nil(t, SecretNames(settings))
+
+	settings.SecretManagerEnabled = true
+	require.Equal(t, []string{"token", "password", "cert", "key"}, SecretNames(settings))
+
+	require.Nil(t, SecretNames(nil))
+}
@@ -85,6 +85,13 @@ var (
 	privilegedCheckMutex sync.Mutex
 )
 
+// PrivilegedRequired reports whether ICMP probes need privileged (raw)
+// sockets, because unprivileged ones don't work on this host. The result
+// is computed once, by pinging 127.0.0.1 without privileges.
+func PrivilegedRequired() bool {
+	return isPrivilegedRequired()
+}
+
 func isPrivilegedRequired() bool {
 	privilegedCheckMutex.Lock()
 	defer privilegedCheckMutex.Unlock()
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
 	"github.com/rs/zerolog"
 )
 
@@ -111,6 +113,8 @@ func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
 			return "", fmt.Errorf("failed to get secret '%s' from GSM: %w", secretMatch.name, err)
 		}
 
+		secrets.UsageFromContext(ctx).Record(secretMatch.name, secretValue)
+
 		result.WriteString(secretValue)
 
 		lastPos = secretMatch.end
@@ -126,6 +130,25 @@ func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
 	return result.String(), nil
 }
 
+// SecretNames returns the names of the secrets referenced by values, in
+// order of appearance and without duplicates. Invalid names are skipped, as
+// resolving them fails anyway.
+func SecretNames(values ...string) []string {
+	var names []string
+
+	for _, value := range values {
+		for _, match := range SecretRegex.FindAllStringSubmatch(value, -1) {
+			if len(match) < 2 || !isValidSecretName(match[1]) || slices.Contains(names, match[1]) {
+				continue
+			}
+
+			names = append(names, match[1])
+		}
+	}
+
+	return names
+}
+
 // processVariables resolves ${variable_name} patterns in a string
 func (r *Resolver) processVariables(value string) string {
 	if !r.variableEnabled {
@@ -1,10 +1,13 @@
 package interpolation
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
 	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
@@ -188,6 +191,30 @@ func TestResolver_Resolve(t *testing.T) {
 	})
 }
 
+func TestResolver_ResolveRecordsUsage(t *testing.T) {
+	ctx, logger, tenantID := testhelper.CommonTestSetup()
+
+	var audit bytes.Buffer
+
+	usage := secrets.NewUsage(42, "execution-id", zerolog.New(&audit))
+	ctx = secrets.WithUsage(ctx, usage)
+
+	secretProvider := testhelper.NewMockSecretProvider(map[string]string{
+		"api-token": "secret-token-123",
+	})
+
+	resolver := NewResolver(nil, secretProvider, tenantID, logger, true)
+
+	actual, err := resolver.Resolve(ctx, "Bearer ${secrets.api-token}")
+	require.NoError(t, err)
+	require.Equal(t, "Bearer secret-token-123", actual)
+
+	require.Equal(t, "token="+secrets.RedactedValue, usage.Redact("token=secret-token-123"))
+	require.Contains(t, audit.String(), `"secretName":"api-token"`)
+	require.Contains(t, audit.String(), `"checkId":42`)
+	require.NotContains(t, audit.String(), "secret-token-123")
+}
+
 func TestIsValidSecretName(t *testing.T) {
 	testcases := map[string]struct {
 		name     string
@@ -297,3 +324,17 @@ func TestToJavaScript(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretNames(t *testing.T) {
+	require.Nil(t, SecretNames("", "no secrets here", "${variable}"))
+
+	require.Equal(t,
+		[]string{"token", "user.password", "cert"},
+		SecretNames(
+			"Bearer ${secrets.token}",
+			"${secrets.user.password}:${secrets.token}",
+			"${secrets.Invalid_Name}",
+			"${secrets.cert}",
+		),
+	)
+}
@@ -130,6 +130,19 @@ func (f proberFactory) New(ctx context.Context, logger zerolog.Logger, check mod
 	return p, target, err
 }
 
+// SecretNames returns the names of the secrets that the agent resolves for
+// the check when running it. Secrets used by k6-backed checks are resolved
+// by k6 itself, so they are not included.
+func SecretNames(check model.Check) []string {
+	switch check.Type() {
+	case sm.CheckTypeHttp:
+		return httpProber.SecretNames(check.Settings.Http)
+
+	default:
+		return nil
+	}
+}
+
 // Build reserved HTTP request headers for applicable checks.
 func (f proberFactory) getReservedHeaders(check *model.Check) http.Header {
 	reservedHeaders := http.Header{}
@@ -38,7 +38,7 @@ func ClientFromRemoteInfo(remote *sm.RemoteInfo) (*prom.ClientConfig, error) {
 		clientCfg.Headers = make(map[string]string)
 	}
 
-	clientCfg.Headers["X-Prometheus-Remote-Write-Version"] = "0.1.0"
+	clientCfg.Headers["X-Prometheus-Remote-Write-Version"] = prom.RemoteWriteV1Version
 
 	return &clientCfg, nil
 }
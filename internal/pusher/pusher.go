@@ -9,6 +9,7 @@ import (
 
 	logproto "github.com/grafana/loki/pkg/push"
 	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pkg/prom"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
 
@@ -18,10 +19,28 @@ type Payload interface {
 	Streams() []logproto.Stream
 }
 
+// SeriesMetadata is the additional information about a time series that
+// can be sent using Remote-Write 2.0.
+type SeriesMetadata = prom.SeriesMetadata
+
+// MetadataPayload is implemented by payloads that are able to provide
+// metadata for their time series. SeriesMetadata returns one entry for
+// each of the time series returned by Metrics, in the same order.
+type MetadataPayload interface {
+	SeriesMetadata() []SeriesMetadata
+}
+
 type Publisher interface {
 	Publish(Payload)
 }
 
+// Flusher is implemented by publishers that queue payloads before sending
+// them. Flush returns once all the queued payloads have been sent or
+// given up on, or ctx is done.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
 type TenantProvider interface {
 	GetTenant(context.Context, *sm.TenantInfo) (*sm.Tenant, error)
 }
@@ -170,6 +170,12 @@ func parsePublishError(err error) (httpStatusCode int, pushErr pushError) {
 		}
 	}
 
+	// Errors that are already classified are returned as is.
+	var pErr pushError
+	if errors.As(err, &pErr) {
+		return noHTTPCode, pErr
+	}
+
 	// Context errors can be wrapped by various other error types, like
 	// prom.recoverableError and url.Error.
 	if errors.Is(err, context.Canceled) {
@@ -84,6 +84,7 @@ type pusherOptions struct {
 	tenantDelay       time.Duration // How long to wait between GetTenant calls.
 	waitPeriod        time.Duration // How long to wait in case of errors
 	discardPeriod     time.Duration // How long to discard metrics when a fatal error is encountered.
+	remoteWriteV2     bool          // Try to send metrics using Remote-Write 2.0
 	logger            zerolog.Logger
 	metrics           pusher.Metrics
 	pool              bufferPool
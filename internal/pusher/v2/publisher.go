@@ -3,6 +3,7 @@ package v2
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
@@ -13,6 +14,10 @@ import (
 
 const Name = "v2"
 
+// flushPollInterval is how often Flush checks whether the queues are
+// empty.
+const flushPollInterval = 100 * time.Millisecond
+
 // NewPublisher creates a new instance of the v2 Publisher.
 //
 // The provider context is used to control the lifetime of the publisher.
@@ -29,11 +34,24 @@ func NewPublisher(ctx context.Context, tenantProvider pusher.TenantProvider, log
 	return impl
 }
 
+// NewRemoteWriteV2Publisher is like NewPublisher, but metrics are sent
+// using Remote-Write 2.0. Remotes that reject Remote-Write 2.0 requests
+// are sent Remote-Write 1.0 requests instead, until the tenant is fetched
+// again, which happens at least every maxLifetime.
+func NewRemoteWriteV2Publisher(ctx context.Context, tenantProvider pusher.TenantProvider, logger zerolog.Logger, pr prometheus.Registerer) pusher.Publisher {
+	impl := NewPublisher(ctx, tenantProvider, logger, pr).(*publisherImpl)
+	impl.options.remoteWriteV2 = true
+
+	return impl
+}
+
 type payloadHandler interface {
 	publish(payload pusher.Payload)
 	// run returns the handler that should run or nil to signal that it
 	// should be terminated.
 	run(ctx context.Context) payloadHandler
+	// pending returns the number of records waiting to be sent.
+	pending() int
 }
 
 type publisherImpl struct {
@@ -44,7 +62,10 @@ type publisherImpl struct {
 	handlers       map[model.GlobalID]payloadHandler
 }
 
-var _ pusher.Publisher = &publisherImpl{}
+var (
+	_ pusher.Publisher = &publisherImpl{}
+	_ pusher.Flusher   = &publisherImpl{}
+)
 
 func (p *publisherImpl) Publish(payload pusher.Payload) {
 	tenantID := payload.Tenant()
@@ -64,6 +85,43 @@ func (p *publisherImpl) Publish(payload pusher.Payload) {
 	handler.publish(payload)
 }
 
+// Flush waits until the queues of all the tenants are empty, or ctx is
+// done. Payloads published while flushing are waited for, too.
+func (p *publisherImpl) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pending := p.pending()
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			p.options.logger.Warn().Int("records", pending).Msg("records not sent before flush deadline")
+			return ctx.Err()
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending returns the number of records waiting to be sent across all the
+// tenants.
+func (p *publisherImpl) pending() int {
+	p.handlerMutex.Lock()
+	defer p.handlerMutex.Unlock()
+
+	var n int
+
+	for _, h := range p.handlers {
+		n += h.pending()
+	}
+
+	return n
+}
+
 func (p *publisherImpl) runHandler(tenantID model.GlobalID, h payloadHandler) {
 	tid, rid := model.GetLocalAndRegionIDs(tenantID)
 
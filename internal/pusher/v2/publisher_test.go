@@ -0,0 +1,75 @@
+package v2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	logproto "github.com/grafana/loki/pkg/push"
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+type testPayload struct {
+	tenant  model.GlobalID
+	metrics []prompb.TimeSeries
+}
+
+func (p testPayload) Tenant() model.GlobalID       { return p.tenant }
+func (p testPayload) Metrics() []prompb.TimeSeries { return p.metrics }
+func (testPayload) Streams() []logproto.Stream     { return nil }
+
+func TestPublisherFlush(t *testing.T) {
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tenantProvider := testTenantProvider{
+		1: &sm.Tenant{
+			Id:            1,
+			MetricsRemote: &sm.RemoteInfo{Url: server.URL},
+			EventsRemote:  &sm.RemoteInfo{Url: server.URL},
+			Status:        sm.TenantStatus_ACTIVE,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	p := NewPublisher(ctx, tenantProvider, zerolog.Nop(), prometheus.NewPedanticRegistry())
+	flusher, ok := p.(pusher.Flusher)
+	require.True(t, ok)
+
+	// Nothing to flush.
+	require.NoError(t, flusher.Flush(t.Context()))
+
+	p.Publish(testPayload{
+		tenant: 1,
+		metrics: []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "test"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+		}},
+	})
+
+	// The remote doesn't respond before the deadline.
+	flushCtx, flushCancel := context.WithTimeout(t.Context(), 2*flushPollInterval)
+	defer flushCancel()
+
+	require.ErrorIs(t, flusher.Flush(flushCtx), context.DeadlineExceeded)
+
+	close(release)
+
+	require.NoError(t, flusher.Flush(t.Context()))
+}
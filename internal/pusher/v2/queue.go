@@ -1,6 +1,7 @@
 package v2
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
@@ -9,22 +10,28 @@ import (
 	"sync"
 	"time"
 
+	"github.com/golang/snappy"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+
 	"github.com/grafana/synthetic-monitoring-agent/internal/pkg/prom"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
 
 type queue struct {
-	options   *pusherOptions
-	dataMutex sync.Mutex
-	data      []queueEntry
-	pending   condition
+	options       *pusherOptions
+	dataMutex     sync.Mutex
+	data          []queueEntry
+	pending       condition
+	remoteWriteV2 bool // protected by dataMutex
+	inFlight      int  // records being pushed, protected by dataMutex
 }
 
 func newQueue(options *pusherOptions) queue {
 	return queue{
-		options: options,
-		pending: newCondition(),
+		options:       options,
+		pending:       newCondition(),
+		remoteWriteV2: options.remoteWriteV2,
 	}
 }
 
@@ -71,8 +78,7 @@ func (q *queue) push(ctx context.Context, remote *sm.RemoteInfo) error {
 
 			retrying = false
 
-			concatReader := newConcatReader(records)
-			httpStatusCode, pushErr := parsePublishError(client.StoreStream(ctx, &concatReader))
+			httpStatusCode, pushErr := parsePublishError(q.store(ctx, client, records))
 			statusCodeStr := strconv.Itoa(httpStatusCode)
 
 			// TODO(mem): this might be a problem, we are keeping a
@@ -112,6 +118,7 @@ func (q *queue) push(ctx context.Context, remote *sm.RemoteInfo) error {
 			// Drop the records by returning their buffers to the pool. They were either published or we
 			// gave up on them.
 			size := q.options.pool.returnAll(records)
+			q.release()
 
 			switch pushErr.Kind() {
 			case errKindNoError:
@@ -150,13 +157,105 @@ func (q *queue) push(ctx context.Context, remote *sm.RemoteInfo) error {
 	}
 }
 
+// store sends the records to the remote. Records holding Remote-Write
+// 2.0 requests cannot be simply concatenated like Remote-Write 1.0 ones,
+// as each of them has its own symbol table, so they are merged into a
+// single request instead.
+//
+// If the remote rejects a Remote-Write 2.0 request as unsupported, the
+// queue falls back to Remote-Write 1.0: the records are converted and sent
+// again, and new records are encoded using Remote-Write 1.0.
+func (q *queue) store(ctx context.Context, client *prom.Client, records []queueEntry) error {
+	if !records[0].v2 {
+		concatReader := newConcatReader(records)
+		return client.StoreStream(ctx, &concatReader)
+	}
+
+	req, err := decodeV2Records(records)
+	if err != nil {
+		return pushError{kind: errKindPayload, inner: err}
+	}
+
+	if q.isRemoteWriteV2() {
+		data, err := req.Marshal()
+		if err != nil {
+			return pushError{kind: errKindPayload, inner: err}
+		}
+
+		err = client.StoreStreamV2(ctx, bytes.NewReader(snappy.Encode(nil, data)))
+		if code, _ := prom.GetHttpStatusCode(err); code != http.StatusUnsupportedMediaType {
+			return err
+		}
+
+		q.options.logger.Info().Msg("remote does not support remote-write 2.0, falling back to remote-write 1.0")
+		q.setRemoteWriteV2(false)
+	}
+
+	data, err := prom.FromWriteV2Request(req).Marshal()
+	if err != nil {
+		return pushError{kind: errKindPayload, inner: err}
+	}
+
+	return client.StoreBytes(ctx, snappy.Encode(nil, data))
+}
+
+func decodeV2Records(records []queueEntry) (*writev2.Request, error) {
+	reqs := make([]*writev2.Request, 0, len(records))
+
+	for _, rec := range records {
+		data, err := snappy.Decode(nil, *rec.data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding record: %w", err)
+		}
+
+		var req writev2.Request
+		if err := req.Unmarshal(data); err != nil {
+			return nil, fmt.Errorf("decoding record: %w", err)
+		}
+
+		reqs = append(reqs, &req)
+	}
+
+	return prom.MergeWriteV2Requests(reqs), nil
+}
+
+func (q *queue) isRemoteWriteV2() bool {
+	q.dataMutex.Lock()
+	defer q.dataMutex.Unlock()
+
+	return q.remoteWriteV2
+}
+
+func (q *queue) setRemoteWriteV2(v bool) {
+	q.dataMutex.Lock()
+	defer q.dataMutex.Unlock()
+
+	q.remoteWriteV2 = v
+}
+
+// resetRemoteWriteV2 undoes a fallback to Remote-Write 1.0, so that the
+// remote is tried again with Remote-Write 2.0 if it's enabled.
+func (q *queue) resetRemoteWriteV2() {
+	q.setRemoteWriteV2(q.options.remoteWriteV2)
+}
+
 func (q *queue) insert(data *[]byte) {
+	q.add(data, false)
+}
+
+// insertV2 adds a record holding a Remote-Write 2.0 request.
+func (q *queue) insertV2(data *[]byte) {
+	q.add(data, true)
+}
+
+func (q *queue) add(data *[]byte, v2 bool) {
 	q.dataMutex.Lock()
 	defer q.dataMutex.Unlock()
 
 	q.data = append(q.data, queueEntry{
 		data: data,
 		ts:   time.Now(),
+		v2:   v2,
 	})
 	q.applyLimits()
 	q.pending.Signal()
@@ -225,10 +324,12 @@ func (q *queue) get() []queueEntry {
 		return nil
 	}
 
-	limit, numBytes := 1, uint64(len(*q.data[0].data))
+	// Records encoded using different protocols cannot be sent in the
+	// same request.
+	limit, numBytes, v2 := 1, uint64(len(*q.data[0].data)), q.data[0].v2
 	for limit < totalQueued {
 		thisSize := uint64(len(*q.data[limit].data))
-		if numBytes+thisSize > q.options.maxPushBytes {
+		if numBytes+thisSize > q.options.maxPushBytes || q.data[limit].v2 != v2 {
 			break
 		}
 
@@ -243,6 +344,7 @@ func (q *queue) get() []queueEntry {
 	copy(take, q.data[:limit])
 	copy(q.data, q.data[limit:])
 	q.data = q.data[:len(q.data[limit:])]
+	q.inFlight = limit
 
 	if limit < totalQueued {
 		q.pending.Signal()
@@ -259,14 +361,34 @@ func (q *queue) requeue(data []queueEntry) {
 	q.dataMutex.Lock()
 	defer q.dataMutex.Unlock()
 
+	q.inFlight = 0
 	q.data = append(data, q.data...)
 	q.applyLimits()
 	q.pending.Signal()
 }
 
+// release records that the records returned by get are no longer being
+// pushed.
+func (q *queue) release() {
+	q.dataMutex.Lock()
+	defer q.dataMutex.Unlock()
+
+	q.inFlight = 0
+}
+
+// pendingRecords returns the number of records either queued or being
+// pushed.
+func (q *queue) pendingRecords() int {
+	q.dataMutex.Lock()
+	defer q.dataMutex.Unlock()
+
+	return len(q.data) + q.inFlight
+}
+
 type queueEntry struct {
 	data *[]byte
 	ts   time.Time
+	v2   bool // data is a Remote-Write 2.0 request
 }
 
 func newConcatReader(records []queueEntry) SnappyConcatReader {
@@ -10,9 +10,12 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 
+	"github.com/grafana/synthetic-monitoring-agent/internal/pkg/prom"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
@@ -360,6 +363,110 @@ func TestQueuePush(t *testing.T) {
 	}
 }
 
+func TestQueuePushRemoteWriteV2(t *testing.T) {
+	series := func(job string) []prompb.TimeSeries {
+		return []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "probe_success"}, {Name: "job", Value: job}},
+				Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+			},
+		}
+	}
+	metadata := []pusher.SeriesMetadata{{Type: prompb.MetricMetadata_GAUGE, Help: "probe success"}}
+
+	for title, tc := range map[string]struct {
+		status              int
+		expectedContentType []string
+		expectedV2          bool
+	}{
+		"supported": {
+			status:              http.StatusOK,
+			expectedContentType: []string{"application/x-protobuf;proto=io.prometheus.write.v2.Request"},
+			expectedV2:          true,
+		},
+		"unsupported": {
+			status: http.StatusUnsupportedMediaType,
+			expectedContentType: []string{
+				"application/x-protobuf;proto=io.prometheus.write.v2.Request",
+				"application/x-protobuf",
+			},
+			expectedV2: false,
+		},
+	} {
+		t.Run(title, func(t *testing.T) {
+			var contentTypes []string
+
+			respond := func(code int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+					w.WriteHeader(code)
+				}
+			}
+
+			srv := testServer{responses: []http.HandlerFunc{respond(tc.status)}}
+			if tc.status != http.StatusOK {
+				srv.responses = append(srv.responses, respond(http.StatusOK))
+			}
+
+			srv.start()
+			defer srv.stop()
+
+			opt := defaultPusherOptions
+			opt.remoteWriteV2 = true
+			opt.metrics = pusher.NewMetrics(prometheus.NewRegistry())
+			opt = opt.withTenant(1).withType("test")
+
+			q := newQueue(&opt)
+			q.insertV2(toRequest(prom.ToWriteV2Request(series("a"), metadata), opt.pool))
+			q.insertV2(toRequest(prom.ToWriteV2Request(series("b"), metadata), opt.pool))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			errGroup, gCtx := errgroup.WithContext(ctx)
+			errGroup.Go(func() error {
+				return q.push(gCtx, &sm.RemoteInfo{Name: "test", Url: srv.server.URL})
+			})
+			errGroup.Go(func() error {
+				defer cancel()
+
+				for !srv.done() {
+					if err := sleepCtx(gCtx, 10*time.Millisecond); err != nil {
+						return nil
+					}
+				}
+
+				return nil
+			})
+
+			err := errGroup.Wait()
+			if errors.Is(err, context.Canceled) {
+				err = nil
+			}
+
+			require.NoError(t, err)
+			require.True(t, srv.done())
+			require.Equal(t, tc.expectedContentType, contentTypes)
+			require.Equal(t, tc.expectedV2, q.isRemoteWriteV2())
+
+			// Both records are sent in a single request, in whichever
+			// version the remote accepts.
+			var received *prompb.WriteRequest
+			if tc.expectedV2 {
+				var req writev2.Request
+				require.NoError(t, req.Unmarshal(srv.receivedBody))
+				received = prom.FromWriteV2Request(&req)
+			} else {
+				received = &prompb.WriteRequest{}
+				require.NoError(t, received.Unmarshal(srv.receivedBody))
+			}
+
+			require.Equal(t, append(series("a"), series("b")...), received.Timeseries)
+			require.Len(t, received.Metadata, 1)
+		})
+	}
+}
+
 type testSavedState struct {
 	lastGet []queueEntry
 }
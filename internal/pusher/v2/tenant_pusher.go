@@ -15,6 +15,7 @@ import (
 
 	logproto "github.com/grafana/loki/pkg/push"
 	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	"github.com/grafana/synthetic-monitoring-agent/internal/pkg/prom"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
 )
@@ -33,6 +34,7 @@ var _ payloadHandler = &tenantPusher{}
 func newTenantPusher(tenantID model.GlobalID, tenantProvider pusher.TenantProvider, options pusherOptions) *tenantPusher {
 	mOptions := options.withType(pusher.LabelValueMetrics)
 	eOptions := options.withType(pusher.LabelValueLogs)
+	eOptions.remoteWriteV2 = false // Remote-Write 2.0 only applies to metrics.
 	tp := &tenantPusher{
 		tenantID:       tenantID,
 		tenantProvider: tenantProvider,
@@ -109,6 +111,10 @@ func (p *tenantPusher) runPushers(ctx context.Context) error {
 		}
 	}
 
+	// The remote could have been changed or upgraded since the
+	// previous time the tenant was fetched.
+	p.metrics.resetRemoteWriteV2()
+
 	g, gCtx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -185,7 +191,16 @@ func (p *tenantPusher) publish(payload pusher.Payload) {
 	atomic.AddUint64(&p.pushCounter, 1)
 
 	if len(payload.Metrics()) > 0 {
-		p.metrics.insert(toRequest(&prompb.WriteRequest{Timeseries: payload.Metrics()}, p.options.pool))
+		if p.metrics.isRemoteWriteV2() {
+			var metadata []pusher.SeriesMetadata
+			if mp, ok := payload.(pusher.MetadataPayload); ok {
+				metadata = mp.SeriesMetadata()
+			}
+
+			p.metrics.insertV2(toRequest(prom.ToWriteV2Request(payload.Metrics(), metadata), p.options.pool))
+		} else {
+			p.metrics.insert(toRequest(&prompb.WriteRequest{Timeseries: payload.Metrics()}, p.options.pool))
+		}
 	}
 
 	if len(payload.Streams()) > 0 {
@@ -193,6 +208,10 @@ func (p *tenantPusher) publish(payload pusher.Payload) {
 	}
 }
 
+func (p *tenantPusher) pending() int {
+	return p.metrics.pendingRecords() + p.logs.pendingRecords()
+}
+
 func toRequest(m proto.Marshaler, p bufferPool) *[]byte {
 	data, err := m.Marshal()
 	if err != nil {
@@ -227,6 +246,10 @@ func (p delayPusher) publish(payloads pusher.Payload) {
 	p.next.publish(payloads)
 }
 
+func (p delayPusher) pending() int {
+	return p.next.pending()
+}
+
 type discardPusher struct {
 	duration time.Duration
 	options  pusherOptions
@@ -241,6 +264,11 @@ func (p discardPusher) run(ctx context.Context) payloadHandler {
 	return nil
 }
 
+func (discardPusher) pending() int {
+	// Payloads are dropped as they are published.
+	return 0
+}
+
 func (p discardPusher) publish(payloads pusher.Payload) {
 	if len(payloads.Metrics()) > 0 {
 		p.options.metrics.DroppedCounter.WithLabelValues(pusher.LabelValueMetrics).Inc()
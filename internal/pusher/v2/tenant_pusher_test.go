@@ -96,6 +96,36 @@ func TestTenantPusherRunPushers(t *testing.T) {
 	require.ErrorIs(t, err, errTestNoTenant)
 }
 
+func TestTenantPusherResetsRemoteWriteV2(t *testing.T) {
+	tenantProvider := testTenantProvider{
+		1: &sm.Tenant{
+			Id:            1,
+			OrgId:         1,
+			MetricsRemote: &sm.RemoteInfo{},
+			EventsRemote:  &sm.RemoteInfo{},
+			Status:        sm.TenantStatus_ACTIVE,
+		},
+	}
+
+	opts := defaultPusherOptions
+	opts.remoteWriteV2 = true
+	opts.metrics = pusher.NewMetrics(prometheus.NewPedanticRegistry()).WithTenant(1, 1)
+
+	p := newTenantPusher(1, tenantProvider, opts)
+
+	// The remote rejected Remote-Write 2.0 before the tenant was
+	// refreshed.
+	p.metrics.setRemoteWriteV2(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_ = p.runPushers(ctx)
+
+	require.True(t, p.metrics.isRemoteWriteV2())
+	require.False(t, p.logs.isRemoteWriteV2())
+}
+
 func makeRecords(blocks [][]byte) []queueEntry {
 	out := make([]queueEntry, len(blocks))
 	for idx, b := range blocks {
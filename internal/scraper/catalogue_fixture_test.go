@@ -48,7 +48,7 @@ func collectFixtureCatalogueWithLogger(t *testing.T, name string, spec fixtureSp
 		probe:         sm.Probe{Id: 100, TenantId: 200, Name: "test-probe", Latitude: -1, Longitude: -2, Region: "test-region"},
 	}
 
-	data, _, err := s.collectData(ctx, time.Unix(3141, 0))
+	data, _, err := s.collectData(ctx, time.Unix(3141, 0), checkStateMachine{})
 	if err != nil {
 		t.Fatalf("collectData(%s): %v", name, err)
 	}
@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// CheckPolicies selects the policies applied to each check. Logs and Retry
+// apply to every check, unless overridden by one of the rules: for each
+// policy, the first rule that matches the check and sets that policy
+// wins.
+type CheckPolicies struct {
+	Logs  LogPolicy
+	Retry RetryPolicy
+	Rules []PolicyRule
+}
+
+// PolicyRule overrides the policies of the checks it matches. Policies
+// that are not set are not overridden.
+type PolicyRule struct {
+	Match PolicyMatch  `json:"match"`
+	Logs  *LogPolicy   `json:"logs,omitempty"`
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// PolicyMatch selects checks. A check matches if it matches all the
+// fields that are set. Lists match if they contain the value for the
+// check, and labels match if the check has all of them, with the same
+// values. The zero value matches every check.
+type PolicyMatch struct {
+	// CheckIDs lists check IDs, as shown by the API. With several API
+	// connections, they match the checks from all of them.
+	CheckIDs []int64  `json:"checkIds,omitempty"`
+	Jobs     []string `json:"jobs,omitempty"`
+	// Types lists check types, e.g. "http" or "traceroute".
+	Types  []string          `json:"types,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+var ErrInvalidPolicyRule = errors.New("invalid policy rule")
+
+// policyRulesFile is the content of a policy rules file.
+type policyRulesFile struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// ReadPolicyRules reads the policy rules from the file with the specified
+// name. Files with a .json extension are decoded as JSON, any other file
+// is decoded as YAML, using the same field names.
+func ReadPolicyRules(fn string) ([]PolicyRule, error) {
+	data, err := os.ReadFile(fn) //#nosec -- the file is provided by the operator.
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(fn), ".json") {
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", fn, err)
+		}
+
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", fn, err)
+		}
+	}
+
+	var f policyRulesFile
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", fn, err)
+	}
+
+	for i, rule := range f.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("validating %s: rule %d: %w", fn, i+1, err)
+		}
+	}
+
+	return f.Rules, nil
+}
+
+// Validate returns an error if the rule doesn't override any policy,
+// matches unknown check types, or enables retries for check types that
+// don't support them.
+func (r PolicyRule) Validate() error {
+	if r.Logs == nil && r.Retry == nil {
+		return fmt.Errorf("%w: no policy set", ErrInvalidPolicyRule)
+	}
+
+	for _, name := range r.Match.Types {
+		checkType, found := sm.CheckTypeFromString(name)
+		if !found {
+			return fmt.Errorf("%w: unknown check type %q", ErrInvalidPolicyRule, name)
+		}
+
+		if r.Retry != nil && r.Retry.enabled() && !retriesSupported(checkType) {
+			return fmt.Errorf("%w: retries are not supported for %s checks", ErrInvalidPolicyRule, name)
+		}
+	}
+
+	return nil
+}
+
+func (m PolicyMatch) matches(check model.Check) bool {
+	if len(m.CheckIDs) > 0 && !slices.Contains(m.CheckIDs, check.Id) {
+		return false
+	}
+
+	if len(m.Jobs) > 0 && !slices.Contains(m.Jobs, check.Job) {
+		return false
+	}
+
+	if len(m.Types) > 0 && !slices.ContainsFunc(m.Types, func(name string) bool {
+		checkType, _ := sm.CheckTypeFromString(name)
+		return checkType == check.Type()
+	}) {
+		return false
+	}
+
+	for name, value := range m.Labels {
+		if !slices.Contains(check.Labels, sm.Label{Name: name, Value: value}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// logPolicy returns the log policy for the check.
+func (p CheckPolicies) logPolicy(check model.Check) LogPolicy {
+	for _, rule := range p.Rules {
+		if rule.Logs != nil && rule.Match.matches(check) {
+			return *rule.Logs
+		}
+	}
+
+	return p.Logs
+}
+
+// retryPolicy returns the retry policy for the check.
+func (p CheckPolicies) retryPolicy(check model.Check) RetryPolicy {
+	for _, rule := range p.Rules {
+		if rule.Retry != nil && rule.Match.matches(check) {
+			return *rule.Retry
+		}
+	}
+
+	return p.Retry
+}
@@ -0,0 +1,123 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestReadPolicyRules(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		fn := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o600))
+
+		return fn
+	}
+
+	rules, err := ReadPolicyRules(write("rules.yaml", `
+rules:
+  - match:
+      types: [traceroute]
+      labels:
+        env: prod
+    logs:
+      emission: changes
+      successInterval: 10
+  - match:
+      checkIds: [1, 2]
+    logs:
+      emission: all
+    retry:
+      maxAttempts: 3
+      delay: 1s
+      classes: [error]
+`))
+	require.NoError(t, err)
+	require.Equal(t, []PolicyRule{
+		{
+			Match: PolicyMatch{Types: []string{"traceroute"}, Labels: map[string]string{"env": "prod"}},
+			Logs:  &LogPolicy{Emission: LogEmissionChanges, SuccessInterval: 10},
+		},
+		{
+			Match: PolicyMatch{CheckIDs: []int64{1, 2}},
+			Logs:  &LogPolicy{Emission: LogEmissionAll},
+			Retry: &RetryPolicy{MaxAttempts: 3, Delay: time.Second, Classes: FailureClasses{FailureClassError}},
+		},
+	}, rules)
+
+	rules, err = ReadPolicyRules(write("rules.json", `{"rules": [{"match": {"jobs": ["a"]}, "logs": {"emission": "changes"}}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []PolicyRule{{Match: PolicyMatch{Jobs: []string{"a"}}, Logs: &LogPolicy{Emission: LogEmissionChanges}}}, rules)
+
+	for name, content := range map[string]string{
+		"no policy":      `{"rules": [{"match": {"jobs": ["a"]}}]}`,
+		"unknown type":   `{"rules": [{"match": {"types": ["smtp"]}, "logs": {"emission": "all"}}]}`,
+		"bad emission":   `{"rules": [{"logs": {"emission": "some"}}]}`,
+		"bad delay":      `{"rules": [{"retry": {"delay": "soon"}}]}`,
+		"k6 retries":     `{"rules": [{"match": {"types": ["http", "scripted"]}, "retry": {"maxAttempts": 2}}]}`,
+		"unknown field":  `{"rules": [{"logs": {"emission": "all"}, "limits": {}}]}`,
+		"not a document": `[`,
+	} {
+		_, err := ReadPolicyRules(write("bad.json", content))
+		require.Error(t, err, name)
+	}
+
+	// Only enabling retries is rejected for k6-backed checks.
+	_, err = ReadPolicyRules(write("k6.json", `{"rules": [{"match": {"types": ["browser"]}, "logs": {"emission": "changes"}, "retry": {"maxAttempts": 1}}]}`))
+	require.NoError(t, err)
+
+	_, err = ReadPolicyRules(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestCheckPoliciesLogPolicy(t *testing.T) {
+	changes := LogPolicy{Emission: LogEmissionChanges}
+	everyTen := LogPolicy{Emission: LogEmissionChanges, SuccessInterval: 10}
+
+	policies := CheckPolicies{
+		Logs: LogPolicy{Emission: LogEmissionAll},
+		Rules: []PolicyRule{
+			{Match: PolicyMatch{CheckIDs: []int64{1}}},
+			{Match: PolicyMatch{Types: []string{"traceroute"}, Labels: map[string]string{"env": "prod"}}, Logs: &everyTen},
+			{Match: PolicyMatch{Jobs: []string{"job"}}, Logs: &changes},
+		},
+	}
+
+	check := func(id int64, job string, settings sm.CheckSettings, labels ...sm.Label) model.Check {
+		return model.Check{Check: sm.Check{Id: id, Job: job, Settings: settings, Labels: labels}}
+	}
+
+	traceroute := sm.CheckSettings{Traceroute: &sm.TracerouteSettings{}}
+	ping := sm.CheckSettings{Ping: &sm.PingSettings{}}
+	prod := sm.Label{Name: "env", Value: "prod"}
+
+	// The first rule doesn't set a log policy.
+	require.Equal(t, policies.Logs, policies.logPolicy(check(1, "other", ping)))
+	require.Equal(t, everyTen, policies.logPolicy(check(2, "job", traceroute, prod)))
+	require.Equal(t, changes, policies.logPolicy(check(2, "job", traceroute)))
+	require.Equal(t, changes, policies.logPolicy(check(2, "job", ping, prod)))
+	require.Equal(t, policies.Logs, policies.logPolicy(check(2, "other", ping, prod)))
+}
+
+func TestCheckPoliciesRetryPolicy(t *testing.T) {
+	retry := RetryPolicy{MaxAttempts: 2}
+
+	policies := CheckPolicies{
+		Retry: RetryPolicy{MaxAttempts: 3},
+		Rules: []PolicyRule{
+			{Match: PolicyMatch{Jobs: []string{"job"}}, Logs: &LogPolicy{Emission: LogEmissionChanges}},
+			{Match: PolicyMatch{Jobs: []string{"job"}}, Retry: &retry},
+		},
+	}
+
+	require.Equal(t, retry, policies.retryPolicy(model.Check{Check: sm.Check{Job: "job"}}))
+	require.Equal(t, policies.Retry, policies.retryPolicy(model.Check{Check: sm.Check{Job: "other"}}))
+}
@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	kitlog "github.com/go-kit/kit/log" //nolint:staticcheck // TODO(mem): replace in BBE
+	dto "github.com/prometheus/client_model/go"
+)
+
+// failureRecorder is a logger that keeps the errors logged by a prober, so
+// that a failed attempt can be classified once it's done. Probers log
+// their errors as the value of the "err" key; the slog adapter used by
+// the blackbox-exporter probers turns them into strings, so only their
+// text is kept.
+type failureRecorder struct {
+	logger kitlog.Logger
+	mutex  sync.Mutex
+	errs   []string
+}
+
+func (r *failureRecorder) Log(keyvals ...any) error {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if key, ok := keyvals[i].(string); ok && key == "err" && keyvals[i+1] != nil {
+			r.mutex.Lock()
+			r.errs = append(r.errs, fmt.Sprint(keyvals[i+1]))
+			r.mutex.Unlock()
+		}
+	}
+
+	return r.logger.Log(keyvals...)
+}
+
+// errors returns the errors logged so far.
+func (r *failureRecorder) errors() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.errs
+}
+
+// Error messages from the Go standard library that identify the failure
+// classes which can't be told apart using the prober's metrics.
+var (
+	dnsErrorMessages = []string{
+		"no such host",
+		"server misbehaving",
+		"unable to find ip",
+	}
+
+	tlsErrorMessages = []string{
+		"tls: ",
+		"x509: ",
+	}
+
+	connectionErrorMessages = []string{
+		"connection refused",
+		"connection reset",
+		"broken pipe",
+		"no route to host",
+		"host is unreachable",
+		"network is unreachable",
+	}
+)
+
+// classifyFailure returns the class of a failed attempt that didn't time
+// out, using the metrics the prober registered and the errors it logged.
+func classifyFailure(mfs []*dto.MetricFamily, errs []string) FailureClass {
+	// The blackbox-exporter probers, and the ping prober, register
+	// probe_ip_protocol before resolving the target, and only set it
+	// once it's resolved.
+	if protocol, found := gaugeValue(mfs, "probe_ip_protocol"); found && protocol == 0 {
+		return FailureClassDNS
+	}
+
+	switch {
+	case errorsContain(errs, dnsErrorMessages):
+		return FailureClassDNS
+
+	case errorsContain(errs, tlsErrorMessages):
+		return FailureClassTLS
+
+	case errorsContain(errs, connectionErrorMessages):
+		return FailureClassConnection
+	}
+
+	if statusCode, found := gaugeValue(mfs, "probe_http_status_code"); found && statusCode > 0 {
+		return FailureClassHTTP
+	}
+
+	sent, _ := gaugeValue(mfs, "probe_icmp_packets_sent_count")
+	received, _ := gaugeValue(mfs, "probe_icmp_packets_received_count")
+
+	if sent > 0 && received < sent {
+		return FailureClassPacketLoss
+	}
+
+	return FailureClassError
+}
+
+func errorsContain(errs []string, messages []string) bool {
+	for _, err := range errs {
+		for _, msg := range messages {
+			if strings.Contains(err, msg) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// gaugeValue returns the value of the gauge with the provided name, if
+// there's one without labels.
+func gaugeValue(mfs []*dto.MetricFamily, name string) (float64, bool) {
+	for _, mf := range mfs {
+		if mf.GetName() != name || mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			if len(m.GetLabel()) == 0 {
+				return m.GetGauge().GetValue(), true
+			}
+		}
+	}
+
+	return 0, false
+}
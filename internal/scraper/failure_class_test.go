@@ -0,0 +1,147 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	httpProber "github.com/grafana/synthetic-monitoring-agent/internal/prober/http"
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestRunProberClassifiesFailures(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer untrusted.Close()
+
+	// Nothing listens on this address once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	closed := "http://" + l.Addr().String()
+	require.NoError(t, l.Close())
+
+	testcases := map[string]struct {
+		target   string
+		expected FailureClass
+	}{
+		"dns":        {target: "http://does-not-exist.invalid/", expected: FailureClassDNS},
+		"connection": {target: closed, expected: FailureClassConnection},
+		"tls":        {target: untrusted.URL, expected: FailureClassTLS},
+		"http":       {target: failing.URL, expected: FailureClassHTTP},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			check := model.Check{
+				Check: sm.Check{
+					Target:  tc.target,
+					Timeout: 2000,
+					Settings: sm.CheckSettings{
+						Http: &sm.HttpSettings{IpVersion: sm.IpVersion_V4},
+					},
+				},
+			}
+
+			p, err := httpProber.NewProber(context.Background(), check, zerolog.New(io.Discard), http.Header{}, testhelper.NoopSecretStore{})
+			require.NoError(t, err)
+
+			success, class := runProber(
+				context.Background(),
+				p,
+				check.Target,
+				2*time.Second,
+				prometheus.NewRegistry(),
+				nil,
+				kitlog.NewNopLogger(),
+				"execution-id",
+				scheduledScrapeClock(time.Now()),
+			)
+			require.False(t, success)
+			require.Equal(t, tc.expected, class)
+		})
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	gauge := func(name string, value float64) *dto.MetricFamily {
+		return &dto.MetricFamily{
+			Name:   proto.String(name),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(value)}}},
+		}
+	}
+
+	testcases := map[string]struct {
+		mfs      []*dto.MetricFamily
+		errs     []string
+		expected FailureClass
+	}{
+		"unresolved target": {
+			mfs:      []*dto.MetricFamily{gauge("probe_ip_protocol", 0)},
+			expected: FailureClassDNS,
+		},
+		"dns error": {
+			mfs:      []*dto.MetricFamily{gauge("probe_ip_protocol", 4)},
+			errs:     []string{"lookup example.com on 127.0.0.53:53: no such host"},
+			expected: FailureClassDNS,
+		},
+		"connection reset": {
+			mfs:      []*dto.MetricFamily{gauge("probe_ip_protocol", 4)},
+			errs:     []string{"read tcp 10.0.0.1:1234->10.0.0.2:443: read: connection reset by peer"},
+			expected: FailureClassConnection,
+		},
+		"certificate": {
+			errs:     []string{"x509: certificate has expired or is not yet valid"},
+			expected: FailureClassTLS,
+		},
+		"status code": {
+			mfs:      []*dto.MetricFamily{gauge("probe_ip_protocol", 4), gauge("probe_http_status_code", 503)},
+			expected: FailureClassHTTP,
+		},
+		"packet loss": {
+			mfs: []*dto.MetricFamily{
+				gauge("probe_ip_protocol", 4),
+				gauge("probe_icmp_packets_sent_count", 3),
+				gauge("probe_icmp_packets_received_count", 2),
+			},
+			expected: FailureClassPacketLoss,
+		},
+		"no packets sent": {
+			mfs: []*dto.MetricFamily{
+				gauge("probe_icmp_packets_sent_count", 0),
+				gauge("probe_icmp_packets_received_count", 0),
+			},
+			expected: FailureClassError,
+		},
+		"other": {
+			errs:     []string{"something else"},
+			expected: FailureClassError,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.expected, classifyFailure(tc.mfs, tc.errs))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/go-logfmt/logfmt"
+)
+
+// LogEmission selects which check executions publish their full logs.
+type LogEmission string
+
+var _ flag.Value = (*LogEmission)(nil)
+
+const (
+	// LogEmissionAll publishes the full logs of every execution.
+	LogEmissionAll LogEmission = "all"
+	// LogEmissionChanges publishes the full logs of an execution only
+	// if it failed, if the check changed state, or every
+	// LogPolicy.SuccessInterval successful executions. All the other
+	// executions only publish a summary line.
+	LogEmissionChanges LogEmission = "changes"
+)
+
+var ErrUnsupportedLogEmission = errors.New("unsupported log emission policy")
+
+func (val *LogEmission) Set(s string) error {
+	switch s {
+	case string(LogEmissionAll), string(LogEmissionChanges):
+		*val = LogEmission(s)
+
+		return nil
+
+	default:
+		return ErrUnsupportedLogEmission
+	}
+}
+
+func (val LogEmission) String() string {
+	return string(val)
+}
+
+func (val LogEmission) MarshalText() ([]byte, error) {
+	return []byte(val), nil
+}
+
+func (val *LogEmission) UnmarshalText(text []byte) error {
+	return val.Set(string(text))
+}
+
+// LogPolicy determines which logs a scraper publishes. It's evaluated
+// against the pass/fail state of the check. The zero value publishes the
+// full logs of every execution.
+type LogPolicy struct {
+	Emission LogEmission `json:"emission"`
+	// SuccessInterval makes LogEmissionChanges publish the full logs
+	// of every Nth successful execution of a passing check. Zero
+	// disables this.
+	SuccessInterval int `json:"successInterval,omitempty"`
+}
+
+// logOutput selects what extractLogs produces out of the logs of an
+// execution.
+type logOutput int
+
+const (
+	// logOutputFull produces all the log lines.
+	logOutputFull logOutput = iota
+	// logOutputFullWithSummary produces all the log lines followed by
+	// a summary line.
+	logOutputFullWithSummary
+	// logOutputSummary produces only a summary line.
+	logOutputSummary
+)
+
+// output returns the logs that should be produced for an execution with
+// the provided result, given the state of the check before it. state is
+// not modified: the caller records the result once the execution is
+// complete.
+func (p LogPolicy) output(success bool, state checkStateMachine) logOutput {
+	if p.Emission != LogEmissionChanges {
+		return logOutputFull
+	}
+
+	if !success {
+		return logOutputFullWithSummary
+	}
+
+	transition := false
+
+	state.pass(func() { transition = true })
+
+	switch {
+	case transition:
+		return logOutputFullWithSummary
+
+	case p.SuccessInterval > 0 && state.isPassing() && (state.passes-state.threshold-1)%p.SuccessInterval == 0:
+		return logOutputFullWithSummary
+
+	default:
+		return logOutputSummary
+	}
+}
+
+// logSummaryLine returns the summary line for an execution that produced
+// numLines log lines.
+func logSummaryLine(numLines int, suppressed bool) string {
+	var line strings.Builder
+
+	enc := logfmt.NewEncoder(&line)
+	_ = enc.EncodeKeyvals(
+		"level", "info",
+		"msg", "Check execution summary",
+		"log_lines", numLines,
+		"logs_suppressed", suppressed,
+	)
+	_ = enc.EndRecord()
+
+	return line.String()
+}
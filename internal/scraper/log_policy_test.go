@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/secrets"
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+)
+
+func TestLogEmissionSet(t *testing.T) {
+	var val LogEmission
+
+	require.NoError(t, val.Set("changes"))
+	require.Equal(t, LogEmissionChanges, val)
+	require.NoError(t, val.Set("all"))
+	require.Equal(t, LogEmissionAll, val)
+	require.ErrorIs(t, val.Set("some"), ErrUnsupportedLogEmission)
+	require.Equal(t, LogEmissionAll, val)
+}
+
+func TestLogEmitterOutput(t *testing.T) {
+	const (
+		full    = logOutputFullWithSummary
+		summary = logOutputSummary
+	)
+
+	testcases := map[string]struct {
+		policy   LogPolicy
+		results  []bool
+		expected []logOutput
+	}{
+		"all": {
+			policy:   LogPolicy{Emission: LogEmissionAll},
+			results:  []bool{true, true, false, true},
+			expected: []logOutput{logOutputFull, logOutputFull, logOutputFull, logOutputFull},
+		},
+		"zero value": {
+			results:  []bool{true, false},
+			expected: []logOutput{logOutputFull, logOutputFull},
+		},
+		"changes": {
+			policy:   LogPolicy{Emission: LogEmissionChanges},
+			results:  []bool{true, true, true, false, false, true, true},
+			expected: []logOutput{full, summary, summary, full, full, full, summary},
+		},
+		"changes with success interval": {
+			policy:   LogPolicy{Emission: LogEmissionChanges, SuccessInterval: 2},
+			results:  []bool{true, true, true, true, true, false, true, true},
+			expected: []logOutput{full, summary, full, summary, full, full, full, summary},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			var state checkStateMachine
+
+			actual := make([]logOutput, 0, len(tc.results))
+			for _, success := range tc.results {
+				actual = append(actual, tc.policy.output(success, state))
+
+				if success {
+					state.pass(func() {})
+				} else {
+					state.fail(func() {})
+				}
+			}
+
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestExtractLogsSummary(t *testing.T) {
+	const logs = "ts=2023-06-01T20:00:00Z level=info msg=one\n" +
+		"ts=2023-06-01T20:00:01Z level=info msg=two\n"
+
+	sharedLabels := []labelPair{{name: "probe", value: "test-probe"}}
+	lastTime, err := time.Parse(time.RFC3339, "2023-06-01T20:00:01Z")
+	require.NoError(t, err)
+
+	s := Scraper{logger: testhelper.Logger(t)}
+
+	streams := s.extractLogs(time.Now(), []byte(logs), sharedLabels, nil, logOutputFullWithSummary, nil)
+	require.Len(t, streams, 1)
+	require.Equal(t, `{probe="test-probe"}`, streams[0].Labels)
+	require.Len(t, streams[0].Entries, 3)
+	require.Equal(t, "level=info msg=one\n", streams[0].Entries[0].Line)
+	require.Equal(t, `level=info msg="Check execution summary" log_lines=2 logs_suppressed=false`+"\n", streams[0].Entries[2].Line)
+	require.Equal(t, lastTime, streams[0].Entries[2].Timestamp)
+
+	streams = s.extractLogs(time.Now(), []byte(logs), sharedLabels, nil, logOutputSummary, nil)
+	require.Len(t, streams, 1)
+	require.Len(t, streams[0].Entries, 1)
+	require.Equal(t, `level=info msg="Check execution summary" log_lines=2 logs_suppressed=true`+"\n", streams[0].Entries[0].Line)
+	require.Equal(t, lastTime, streams[0].Entries[0].Timestamp)
+
+	// Without any logs, the summary still carries the stream labels.
+	now := time.Now()
+	streams = s.extractLogs(now, nil, sharedLabels, nil, logOutputSummary, nil)
+	require.Len(t, streams, 1)
+	require.Equal(t, `{probe="test-probe"}`, streams[0].Labels)
+	require.Len(t, streams[0].Entries, 1)
+	require.Equal(t, now, streams[0].Entries[0].Timestamp)
+}
+
+func TestExtractLogsRedactsSecrets(t *testing.T) {
+	const logs = "ts=2023-06-01T20:00:00Z level=error msg=\"Error for HTTP request\" url=\"https://example.com/?token=s%2Fcr3t\" token=s/cr3t\n"
+
+	usage := secrets.NewUsage(1, "execution-id", zerolog.Nop())
+	usage.Record("api-token", "s/cr3t")
+
+	s := Scraper{logger: testhelper.Logger(t)}
+
+	streams := s.extractLogs(time.Now(), []byte(logs), nil, nil, logOutputFull, usage)
+	require.Len(t, streams, 1)
+	require.Len(t, streams[0].Entries, 1)
+	require.Equal(t, `level=error msg="Error for HTTP request" url="https://example.com/?token=<redacted>" token=<redacted>`+"\n", streams[0].Entries[0].Line)
+}
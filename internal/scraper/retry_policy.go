@@ -0,0 +1,198 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// FailureClass classifies failed check attempts in order to decide
+// whether they should be retried.
+type FailureClass string
+
+const (
+	// FailureClassDNS is an attempt that could not resolve the target.
+	FailureClassDNS FailureClass = "dns"
+	// FailureClassConnection is an attempt whose connection to the
+	// target was refused, reset or could not be routed.
+	FailureClassConnection FailureClass = "connection"
+	// FailureClassTLS is an attempt that failed the TLS handshake,
+	// including certificate validation.
+	FailureClassTLS FailureClass = "tls"
+	// FailureClassHTTP is an attempt that got an HTTP response, but
+	// failed because of its status code or an assertion on it.
+	FailureClassHTTP FailureClass = "http"
+	// FailureClassPacketLoss is a ping attempt that didn't get a reply
+	// to every packet it sent.
+	FailureClassPacketLoss FailureClass = "packet-loss"
+	// FailureClassError is any other failed attempt.
+	FailureClassError FailureClass = "error"
+	// FailureClassTimeout is an attempt that ran out of time. Such an
+	// attempt uses up the check's timeout, so it's never retried, and
+	// it can't be selected in a policy.
+	FailureClassTimeout FailureClass = "timeout"
+)
+
+// retryableFailureClasses lists the failure classes that policies can
+// select.
+var retryableFailureClasses = []FailureClass{
+	FailureClassDNS,
+	FailureClassConnection,
+	FailureClassTLS,
+	FailureClassHTTP,
+	FailureClassPacketLoss,
+	FailureClassError,
+}
+
+var ErrUnsupportedFailureClass = errors.New("unsupported failure class")
+
+func (val *FailureClass) UnmarshalText(text []byte) error {
+	class := FailureClass(text)
+	if !slices.Contains(retryableFailureClasses, class) {
+		return ErrUnsupportedFailureClass
+	}
+
+	*val = class
+
+	return nil
+}
+
+// FailureClasses is a list of failure classes that can be set from a
+// comma-separated command line flag.
+type FailureClasses []FailureClass
+
+var _ flag.Value = (*FailureClasses)(nil)
+
+func (val *FailureClasses) Set(s string) error {
+	var classes FailureClasses
+
+	for elem := range strings.SplitSeq(s, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		var class FailureClass
+		if err := class.UnmarshalText([]byte(elem)); err != nil {
+			return err
+		}
+
+		classes = append(classes, class)
+	}
+
+	*val = classes
+
+	return nil
+}
+
+func (val FailureClasses) String() string {
+	values := make([]string, 0, len(val))
+	for _, class := range val {
+		values = append(values, string(class))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// RetryPolicy determines whether a failed check is run again before
+// reporting the failure. All the attempts share the check's timeout: each
+// one gets whatever is left of it, so the first attempt is not shortened
+// by enabling retries. The zero value runs each check exactly once.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the check is run in a
+	// single execution. Values lower than 2 disable retries.
+	MaxAttempts int
+	// Delay is the time to wait between attempts.
+	Delay time.Duration
+	// Classes lists the failures that are retried. Empty retries all
+	// of them.
+	Classes FailureClasses
+}
+
+// UnmarshalJSON decodes a policy from a JSON object, with the delay as a
+// string accepted by time.ParseDuration.
+func (p *RetryPolicy) UnmarshalJSON(data []byte) error {
+	var v struct {
+		MaxAttempts int            `json:"maxAttempts"`
+		Delay       string         `json:"delay"`
+		Classes     []FailureClass `json:"classes"`
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	var delay time.Duration
+
+	if v.Delay != "" {
+		var err error
+
+		delay, err = time.ParseDuration(v.Delay)
+		if err != nil {
+			return fmt.Errorf("invalid retry delay: %w", err)
+		}
+	}
+
+	*p = RetryPolicy{MaxAttempts: v.MaxAttempts, Delay: delay, Classes: v.Classes}
+
+	return nil
+}
+
+// forCheck returns the policy that applies to checks of type checkType.
+// Retries are not supported for k6-backed checks: they are always run
+// once, whatever the policy.
+func (p RetryPolicy) forCheck(checkType sm.CheckType) RetryPolicy {
+	if !retriesSupported(checkType) {
+		return RetryPolicy{}
+	}
+
+	return p
+}
+
+// retriesSupported returns false for the check types that are never
+// retried. Those are the k6-backed ones: the k6 runner only retries its
+// own infrastructure errors, and nothing retries failed scripts.
+func retriesSupported(checkType sm.CheckType) bool {
+	switch checkType {
+	case sm.CheckTypeMultiHttp, sm.CheckTypeScripted, sm.CheckTypeBrowser:
+		return false
+
+	default:
+		return true
+	}
+}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// retries returns true if failures of the provided class should be
+// retried. Timeouts never are.
+func (p RetryPolicy) retries(class FailureClass) bool {
+	if class == FailureClassTimeout {
+		return false
+	}
+
+	return len(p.Classes) == 0 || slices.Contains(p.Classes, class)
+}
+
+// sleepCtx waits for d or until ctx is done, whatever happens first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-timer.C:
+		return nil
+	}
+}
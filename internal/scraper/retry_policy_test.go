@@ -0,0 +1,186 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/prober/logger"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestFailureClassesSet(t *testing.T) {
+	var val FailureClasses
+
+	require.NoError(t, val.Set("dns, connection"))
+	require.Equal(t, FailureClasses{FailureClassDNS, FailureClassConnection}, val)
+	require.Equal(t, "dns,connection", val.String())
+	require.NoError(t, val.Set("packet-loss"))
+	require.Equal(t, FailureClasses{FailureClassPacketLoss}, val)
+	require.ErrorIs(t, val.Set("tls,bogus"), ErrUnsupportedFailureClass)
+	require.Equal(t, FailureClasses{FailureClassPacketLoss}, val)
+
+	// Timed out attempts are never retried, so they can't be selected.
+	require.ErrorIs(t, val.Set("timeout"), ErrUnsupportedFailureClass)
+}
+
+func TestRetryPolicyForCheck(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3}
+
+	require.Equal(t, policy, policy.forCheck(sm.CheckTypePing))
+	require.False(t, policy.forCheck(sm.CheckTypeScripted).enabled())
+	require.False(t, policy.forCheck(sm.CheckTypeBrowser).enabled())
+	require.False(t, policy.forCheck(sm.CheckTypeMultiHttp).enabled())
+}
+
+func TestRetryPolicyJSON(t *testing.T) {
+	var policy RetryPolicy
+
+	require.NoError(t, json.Unmarshal([]byte(`{"maxAttempts": 3, "delay": "500ms", "classes": ["error"]}`), &policy))
+	require.Equal(t, RetryPolicy{MaxAttempts: 3, Delay: 500 * time.Millisecond, Classes: FailureClasses{FailureClassError}}, policy)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"maxAttempts": 2}`), &policy))
+	require.Equal(t, RetryPolicy{MaxAttempts: 2}, policy)
+
+	require.Error(t, json.Unmarshal([]byte(`{"delay": "soon"}`), &policy))
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"classes": ["timeout"]}`), &policy), ErrUnsupportedFailureClass)
+}
+
+// retryTestProber fails the first failures attempts, either right away or
+// by waiting for the context to expire.
+type retryTestProber struct {
+	failures int
+	timeout  bool
+	attempts int
+	budgets  []time.Duration
+}
+
+func (p *retryTestProber) Name() string {
+	return "retry test prober"
+}
+
+func (p *retryTestProber) Probe(ctx context.Context, target string, registry *prometheus.Registry, logger logger.Logger, _ string) (bool, float64) {
+	p.attempts++
+
+	if deadline, ok := ctx.Deadline(); ok {
+		p.budgets = append(p.budgets, time.Until(deadline))
+	}
+
+	if p.attempts > p.failures {
+		return true, 0
+	}
+
+	if p.timeout {
+		<-ctx.Done()
+	}
+
+	return false, 0
+}
+
+func TestRunProberWithRetries(t *testing.T) {
+	testcases := map[string]struct {
+		prober           retryTestProber
+		policy           RetryPolicy
+		expectedSuccess  bool
+		expectedAttempts int
+	}{
+		"disabled": {
+			prober:           retryTestProber{failures: 1},
+			policy:           RetryPolicy{MaxAttempts: 1},
+			expectedSuccess:  false,
+			expectedAttempts: 0,
+		},
+		"success after retry": {
+			prober:           retryTestProber{failures: 2},
+			policy:           RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+			expectedSuccess:  true,
+			expectedAttempts: 3,
+		},
+		"too many failures": {
+			prober:           retryTestProber{failures: 3},
+			policy:           RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+			expectedSuccess:  false,
+			expectedAttempts: 3,
+		},
+		"first attempt succeeds": {
+			prober:           retryTestProber{},
+			policy:           RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+			expectedSuccess:  true,
+			expectedAttempts: 1,
+		},
+		"class not retried": {
+			prober:           retryTestProber{failures: 1},
+			policy:           RetryPolicy{MaxAttempts: 3, Classes: FailureClasses{FailureClassDNS}},
+			expectedSuccess:  false,
+			expectedAttempts: 1,
+		},
+		"timeout not retried": {
+			prober:           retryTestProber{failures: 1, timeout: true},
+			policy:           RetryPolicy{MaxAttempts: 2},
+			expectedSuccess:  false,
+			expectedAttempts: 1,
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var logs bytes.Buffer
+
+			success, _, registry := runProberWithRetries(
+				context.Background(),
+				&tc.prober,
+				"target",
+				200*time.Millisecond,
+				tc.policy,
+				nil,
+				kitlog.NewLogfmtLogger(&logs),
+				"execution-id",
+				scheduledScrapeClock(time.Now()),
+			)
+
+			require.Equal(t, tc.expectedSuccess, success)
+
+			// The first attempt gets the whole timeout, the next ones
+			// what's left of it.
+			require.Greater(t, tc.prober.budgets[0], 150*time.Millisecond)
+			require.IsDecreasing(t, tc.prober.budgets)
+
+			mfs, err := registry.Gather()
+			require.NoError(t, err)
+			require.Equal(t, boolToFloat(tc.expectedSuccess), metricGaugeValue(t, mfs, ProbeSuccessMetricName, nil))
+
+			if tc.expectedAttempts == 0 {
+				// Without retries, the output is unchanged.
+				for _, mf := range mfs {
+					require.NotEqual(t, ProbeAttemptsMetricName, mf.GetName())
+				}
+
+				require.NotContains(t, logs.String(), "attempt=")
+
+				return
+			}
+
+			require.Equal(t, float64(tc.expectedAttempts), metricGaugeValue(t, mfs, ProbeAttemptsMetricName, nil))
+			require.Equal(t, tc.expectedAttempts, strings.Count(logs.String(), `msg="Beginning check"`))
+			require.Contains(t, logs.String(), "attempt=1 ")
+			require.Equal(t, tc.expectedAttempts-1, strings.Count(logs.String(), `msg="Retrying check"`))
+		})
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -35,12 +35,22 @@ import (
 )
 
 const (
-	ProbeSuccessMetricName = "probe_success"
-	CheckInfoMetricName    = "sm_check_info"
-	CheckInfoSource        = "synthetic-monitoring-agent"
-	maxLabelValueLength    = 2048 // this is the default value in Prometheus
-	maxPublishInterval     = 2 * time.Minute
-	minPublishGap          = 10 * time.Second
+	ProbeSuccessMetricName  = "probe_success"
+	ProbeAttemptsMetricName = "probe_attempts"
+	CheckInfoMetricName     = "sm_check_info"
+	CheckInfoSource         = "synthetic-monitoring-agent"
+	maxLabelValueLength     = 2048 // this is the default value in Prometheus
+	maxPublishInterval      = 2 * time.Minute
+	minPublishGap           = 10 * time.Second
+)
+
+// Parameters for native histograms. The bucket factor results in buckets
+// about 9% wider than the previous one, which is the same resolution
+// Prometheus recommends by default.
+const (
+	nativeHistogramBucketFactor     = 1.1
+	nativeHistogramMaxBucketNumber  = 160
+	nativeHistogramMinResetDuration = time.Hour
 )
 
 const (
@@ -102,6 +112,21 @@ type Scraper struct {
 	histograms    map[uint64]prometheus.Histogram
 	telemeter     Telemeter
 	cals          TenantCals
+	// nativeHistograms makes the derived duration histograms native
+	// histograms instead of classic ones.
+	nativeHistograms bool
+	// logs decides which logs are published for scheduled
+	// executions.
+	logs LogPolicy
+	// retry decides whether failed checks are run again.
+	retry RetryPolicy
+	// status records the latest execution. nil records nothing.
+	status *statusTracker
+	// handover is closed before stop if the scraper is drained for
+	// another agent, see Drain.
+	handover chan struct{}
+	// done is closed once Run returns.
+	done chan struct{}
 }
 
 type Factory func(
@@ -123,15 +148,22 @@ type (
 )
 
 type probeData struct {
-	tenantId model.GlobalID
-	ts       TimeSeries
-	streams  Streams
+	tenantId     model.GlobalID
+	ts           TimeSeries
+	metadata     []pusher.SeriesMetadata
+	streams      Streams
+	executionID  string
+	failureClass FailureClass
 }
 
 func (d *probeData) Metrics() TimeSeries {
 	return d.ts
 }
 
+func (d *probeData) SeriesMetadata() []pusher.SeriesMetadata {
+	return d.metadata
+}
+
 func (d *probeData) Streams() Streams {
 	return d.streams
 }
@@ -152,21 +184,48 @@ func New(
 	cals TenantCals,
 	labellingMode TenantLabelMode,
 ) (*Scraper, error) {
-	return NewWithOpts(ctx, check, ScraperOpts{
-		Probe:                 probe,
-		Publisher:             publisher,
-		Logger:                logger,
-		Metrics:               metrics,
-		ProbeFactory:          prober.NewProberFactory(k6runner, probe.Id, features, secretStore),
-		LabelsLimiter:         labelsLimiter,
-		Telemeter:             telemeter,
-		CostAttributionLabels: cals,
-		LabellingMode:         labellingMode,
-	})
+	return NewFactory(CheckPolicies{}, 0)(
+		ctx, check, publisher, probe, features, logger, metrics, k6runner,
+		labelsLimiter, telemeter, secretStore, cals, labellingMode,
+	)
 }
 
 var _ Factory = New
 
+// NewFactory returns a Factory that creates scrapers publishing logs
+// and retrying failed checks according to the policies selected for each
+// check by policies, and keeping the latest historySize executions.
+func NewFactory(policies CheckPolicies, historySize int) Factory {
+	return func(
+		ctx context.Context, check model.Check, publisher pusher.Publisher, probe sm.Probe,
+		features feature.Collection,
+		logger zerolog.Logger,
+		metrics Metrics,
+		k6runner k6runner.Runner,
+		labelsLimiter LabelsLimiter,
+		telemeter *telemetry.Telemeter,
+		secretStore secrets.SecretProvider,
+		cals TenantCals,
+		labellingMode TenantLabelMode,
+	) (*Scraper, error) {
+		return NewWithOpts(ctx, check, ScraperOpts{
+			Probe:                 probe,
+			Publisher:             publisher,
+			Logger:                logger,
+			Metrics:               metrics,
+			ProbeFactory:          prober.NewProberFactory(k6runner, probe.Id, features, secretStore),
+			LabelsLimiter:         labelsLimiter,
+			Telemeter:             telemeter,
+			CostAttributionLabels: cals,
+			LabellingMode:         labellingMode,
+			NativeHistograms:      features.IsSet(feature.NativeHistograms),
+			LogPolicy:             policies.logPolicy(check),
+			RetryPolicy:           policies.retryPolicy(check),
+			HistorySize:           historySize,
+		})
+	}
+}
+
 type ScraperOpts struct {
 	Probe                 sm.Probe
 	Publisher             pusher.Publisher
@@ -177,6 +236,12 @@ type ScraperOpts struct {
 	LabellingMode         TenantLabelMode
 	Telemeter             Telemeter
 	CostAttributionLabels TenantCals
+	NativeHistograms      bool
+	LogPolicy             LogPolicy
+	RetryPolicy           RetryPolicy
+	// HistorySize is the number of executions kept in the history
+	// returned by Status. 0 keeps none.
+	HistorySize int
 }
 
 func NewWithOpts(ctx context.Context, check model.Check, opts ScraperOpts) (*Scraper, error) {
@@ -201,22 +266,28 @@ func NewWithOpts(ctx context.Context, check model.Check, opts ScraperOpts) (*Scr
 	}
 
 	return &Scraper{
-		publisher:     opts.Publisher,
-		cancel:        cancel,
-		checkName:     checkName,
-		target:        target,
-		logger:        logger,
-		check:         check,
-		probe:         opts.Probe,
-		prober:        smProber,
-		labelsLimiter: opts.LabelsLimiter,
-		labellingMode: opts.LabellingMode,
-		stop:          make(chan struct{}),
-		metrics:       opts.Metrics,
-		summaries:     make(map[uint64]prometheus.Summary),
-		histograms:    make(map[uint64]prometheus.Histogram),
-		telemeter:     opts.Telemeter,
-		cals:          opts.CostAttributionLabels,
+		publisher:        opts.Publisher,
+		cancel:           cancel,
+		checkName:        checkName,
+		target:           target,
+		logger:           logger,
+		check:            check,
+		probe:            opts.Probe,
+		prober:           smProber,
+		labelsLimiter:    opts.LabelsLimiter,
+		labellingMode:    opts.LabellingMode,
+		stop:             make(chan struct{}),
+		handover:         make(chan struct{}),
+		done:             make(chan struct{}),
+		metrics:          opts.Metrics,
+		summaries:        make(map[uint64]prometheus.Summary),
+		histograms:       make(map[uint64]prometheus.Histogram),
+		telemeter:        opts.Telemeter,
+		cals:             opts.CostAttributionLabels,
+		nativeHistograms: opts.NativeHistograms,
+		logs:             opts.LogPolicy,
+		retry:            opts.RetryPolicy.forCheck(check.Type()),
+		status:           newStatusTracker(opts.HistorySize),
 	}, nil
 }
 
@@ -263,6 +334,8 @@ func (sm checkStateMachine) isFailing() bool {
 }
 
 func (s *Scraper) Run(ctx context.Context) {
+	defer close(s.done)
+
 	s.logger.Info().Msg("starting scraper")
 
 	// TODO(mem): keep count of the number of successive errors and
@@ -306,7 +379,7 @@ func (h *scrapeHandler) scrape(ctx context.Context, t time.Time) {
 		duration time.Duration
 	)
 
-	h.payload, duration, err = h.scraper.collectData(ctx, t)
+	h.payload, duration, err = h.scraper.collectData(ctx, t, h.sm)
 
 	switch {
 	case errors.Is(err, errCheckFailed):
@@ -318,6 +391,7 @@ func (h *scrapeHandler) scrape(ctx context.Context, t time.Time) {
 	case err != nil:
 		h.scraper.metrics.AddCollectorError()
 		h.scraper.logger.Error().Err(err).Msg("error collecting data")
+		h.scraper.status.record(newExecution(t, duration, nil, err), h.sm)
 
 		return
 
@@ -327,6 +401,8 @@ func (h *scrapeHandler) scrape(ctx context.Context, t time.Time) {
 		})
 	}
 
+	h.scraper.status.record(newExecution(t, duration, h.payload, err), h.sm)
+
 	costAttributionLabels, err := h.scraper.getCostAttributionLabels(ctx, h.payload.tenantId)
 	if err != nil {
 		// If cals can't be found, do not block
@@ -370,6 +446,10 @@ func (h *scrapeHandler) republish(ctx context.Context, t time.Time) {
 		for j := range ts.Samples {
 			ts.Samples[j].Timestamp = now
 		}
+
+		for j := range ts.Histograms {
+			ts.Histograms[j].Timestamp = now
+		}
 	}
 
 	h.scraper.publisher.Publish(h.payload)
@@ -380,16 +460,37 @@ func (h *scrapeHandler) cleanup(ctx context.Context, t time.Time) {
 		return
 	}
 
+	select {
+	case <-h.scraper.handover:
+		// Another agent continues publishing these series, marking
+		// them as stale would create a gap.
+		h.payload = nil
+		return
+
+	default:
+	}
+
 	staleSample := prompb.Sample{
 		Timestamp: t.UnixNano()/1e6 + 1, // ms
 		Value:     staleMarker,
 	}
 
+	// Native histograms are marked as stale using a stale marker as
+	// their sum.
+	staleHistogram := prompb.Histogram{
+		Timestamp: staleSample.Timestamp,
+		Sum:       staleMarker,
+	}
+
 	for i := range h.payload.ts {
 		ts := &h.payload.ts[i]
 		for j := range ts.Samples {
 			ts.Samples[j] = staleSample
 		}
+
+		for j := range ts.Histograms {
+			ts.Histograms[j] = staleHistogram
+		}
 	}
 
 	h.payload.streams = nil
@@ -412,6 +513,23 @@ func (s *Scraper) Stop() {
 	close(s.stop)
 }
 
+// Drain stops the scraper like Stop. As the scraper only checks whether it
+// has been stopped between executions, an execution in progress is allowed
+// to finish. With handover, no stale markers are published, as another
+// agent is expected to continue running the check. The returned channel
+// is closed once the scraper has stopped.
+func (s *Scraper) Drain(handover bool) <-chan struct{} {
+	s.logger.Info().Bool("handover", handover).Msg("draining scraper")
+
+	if handover {
+		close(s.handover)
+	}
+
+	close(s.stop)
+
+	return s.done
+}
+
 func (s Scraper) CheckType() sm.CheckType {
 	return s.check.Type()
 }
@@ -525,12 +643,25 @@ func tickWithOffset(
 	}
 }
 
+// Detached returns a copy of the scraper that can collect data with
+// CollectData while the scraper runs, without affecting its scheduled
+// executions: the copy has its own derived summaries and histograms, and
+// doesn't record its executions in Status.
+func (s *Scraper) Detached() *Scraper {
+	detached := *s
+	detached.summaries = make(map[uint64]prometheus.Summary)
+	detached.histograms = make(map[uint64]prometheus.Histogram)
+	detached.status = nil
+
+	return &detached
+}
+
 // CollectData runs the configured prober once at time t and returns transformed
 // metrics and logs without publishing. A failed probe returns populated
 // metrics and logs alongside a non-nil error; fatal collection errors return
 // no data.
 func (s *Scraper) CollectData(ctx context.Context, t time.Time) (TimeSeries, Streams, model.GlobalID, time.Duration, error) {
-	pd, d, err := s.collectDataWith(ctx, t, logicalScrapeClock(t))
+	pd, d, err := s.collectDataWith(ctx, t, logicalScrapeClock(t), LogPolicy{}, checkStateMachine{})
 	if err != nil && !errors.Is(err, errCheckFailed) {
 		return nil, nil, 0, 0, err
 	}
@@ -538,11 +669,16 @@ func (s *Scraper) CollectData(ctx context.Context, t time.Time) (TimeSeries, Str
 	return pd.Metrics(), pd.Streams(), pd.Tenant(), d, err
 }
 
-func (s Scraper) collectData(ctx context.Context, t time.Time) (*probeData, time.Duration, error) {
-	return s.collectDataWith(ctx, t, scheduledScrapeClock(t))
+// collectData runs a scheduled execution of the check, which was in the
+// provided state before it.
+func (s Scraper) collectData(ctx context.Context, t time.Time, state checkStateMachine) (*probeData, time.Duration, error) {
+	return s.collectDataWith(ctx, t, scheduledScrapeClock(t), s.logs, state)
 }
 
-func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeClock) (*probeData, time.Duration, error) {
+// collectDataWith runs the prober once and assembles the resulting
+// payload. The logs included in the payload are selected by applying logs
+// to the result and the state of the check.
+func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeClock, logs LogPolicy, state checkStateMachine) (*probeData, time.Duration, error) {
 	target := s.target
 
 	labelMode, err := s.labellingMode.ForTenant(ctx, s.check.GlobalTenantID())
@@ -571,8 +707,12 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 		checkInfoLabels = s.buildCheckInfoLabels(userLabels, sysMetricLabels, labelMode)
 		// This is the execution ID for the check run.
 		executionID = uuid.New().String()
+		// These are the secrets resolved during the check run.
+		secretUsage = secrets.NewUsage(s.check.Id, executionID, s.logger)
 	)
 
+	ctx = secrets.WithUsage(ctx, secretUsage)
+
 	maxMetricLabels, err := s.labelsLimiter.MetricLabels(ctx, s.check.GlobalTenantID())
 	if err != nil {
 		return nil, 0, fmt.Errorf("retrieving tenant metric labels limit: %w", err)
@@ -608,8 +748,8 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 	logLabels = mergeLogLabels(logLabels, userLabels)
 
 	// set up logger to capture check logs
-	logs := bytes.Buffer{}
-	bl := kitlog.NewLogfmtLogger(&logs)
+	logBuf := bytes.Buffer{}
+	bl := kitlog.NewLogfmtLogger(&logBuf)
 
 	// set up logger to capture all the labels as part of the log entry
 	loggerLabels := make([]any, 0, 2*(2+len(logLabels)))
@@ -636,7 +776,7 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 
 	wallStart := time.Now()
 
-	success, mfs, err := getProbeMetrics(
+	success, class, mfs, err := getProbeMetrics(
 		ctx,
 		s.prober,
 		target,
@@ -645,6 +785,8 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 		s.summaries, s.histograms,
 		sl,
 		s.check.BasicMetricsOnly,
+		s.nativeHistograms,
+		s.retry,
 		executionID,
 		clock,
 	)
@@ -665,7 +807,7 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 	// user-defined label values are retained over system-defined values.
 	executionMetricLabels := appendUniqueLabels(customMetricLabels(s.probe.Labels, s.check.Labels, labelMode), sysMetricLabels)
 
-	ts := s.extractTimeseries(t, mfs, executionMetricLabels)
+	ts, metadata := s.extractTimeseries(t, mfs, executionMetricLabels)
 
 	successValue := "1"
 
@@ -698,9 +840,18 @@ func (s Scraper) collectDataWith(ctx context.Context, t time.Time, clock scrapeC
 	structuredMetadata := overflowMetadata
 
 	// streams need to have all the labels applied to them because loki does not support joins
-	streams := s.extractLogs(t, logs.Bytes(), streamLogLabels, structuredMetadata)
+	streams := s.extractLogs(t, logBuf.Bytes(), streamLogLabels, structuredMetadata, logs.output(success, state), secretUsage)
 
-	return &probeData{ts: ts, streams: streams, tenantId: s.check.GlobalTenantID()}, duration, err
+	data := &probeData{
+		ts:           ts,
+		metadata:     metadata,
+		streams:      streams,
+		tenantId:     s.check.GlobalTenantID(),
+		executionID:  executionID,
+		failureClass: class,
+	}
+
+	return data, duration, err
 }
 
 // getCostAttributionLabels looks for the cost attribution labels for a specific tenant and
@@ -784,34 +935,97 @@ func getProbeMetrics(
 	histograms map[uint64]prometheus.Histogram,
 	logger kitlog.Logger,
 	basicMetricsOnly bool,
+	nativeHistograms bool,
+	retry RetryPolicy,
 	executionID string,
 	clock scrapeClock,
-) (bool, []*dto.MetricFamily, error) {
-	registry := prometheus.NewRegistry()
-
-	success := runProber(ctx, prober, target, timeout, registry, checkInfoLabels, logger, executionID, clock)
+) (bool, FailureClass, []*dto.MetricFamily, error) {
+	success, class, registry := runProberWithRetries(ctx, prober, target, timeout, retry, checkInfoLabels, logger, executionID, clock)
 
 	mfs, err := registry.Gather()
 	if err != nil {
-		return success, nil, fmt.Errorf(`extracting data from blackbox-exporter: %w`, err)
+		return success, class, nil, fmt.Errorf(`extracting data from blackbox-exporter: %w`, err)
 	}
 
 	registry = prometheus.NewRegistry()
 
-	if err := getDerivedMetrics(mfs, summaries, histograms, registry, basicMetricsOnly); err != nil {
-		return success, nil, fmt.Errorf(`getting derived metrics: %w`, err)
+	if err := getDerivedMetrics(mfs, summaries, histograms, registry, basicMetricsOnly, nativeHistograms); err != nil {
+		return success, class, nil, fmt.Errorf(`getting derived metrics: %w`, err)
 	}
 
 	dmfs, err := registry.Gather()
 	if err != nil {
-		return success, nil, fmt.Errorf(`extracting derived metrics: %w`, err)
+		return success, class, nil, fmt.Errorf(`extracting derived metrics: %w`, err)
 	}
 
 	mfs = append(mfs, dmfs...)
 
-	return success, mfs, nil
+	return success, class, mfs, nil
+}
+
+// runProberWithRetries runs the prober, retrying failed attempts according
+// to retry within the timeout budget. Each attempt can use all the time
+// left in the budget. It returns the result and the
+// registry of the last attempt, as well as how it failed. If retries are
+// enabled, each attempt logs its number and the registry includes the
+// number of attempts made.
+func runProberWithRetries(
+	ctx context.Context,
+	prober prober.Prober,
+	target string,
+	timeout time.Duration,
+	retry RetryPolicy,
+	checkInfoLabels map[string]string,
+	logger kitlog.Logger,
+	executionID string,
+	clock scrapeClock,
+) (bool, FailureClass, *prometheus.Registry) {
+	if !retry.enabled() {
+		registry := prometheus.NewRegistry()
+		success, class := runProber(ctx, prober, target, timeout, registry, checkInfoLabels, logger, executionID, clock)
+
+		return success, class, registry
+	}
+
+	var (
+		deadline = time.Now().Add(timeout)
+		registry *prometheus.Registry
+		success  bool
+		class    FailureClass
+		attempt  int
+	)
+
+	for {
+		attempt++
+
+		attemptLogger := kitlog.With(logger, "attempt", attempt)
+
+		registry = prometheus.NewRegistry()
+		success, class = runProber(ctx, prober, target, time.Until(deadline), registry, checkInfoLabels, attemptLogger, executionID, clock)
+
+		if success || attempt >= retry.MaxAttempts || !retry.retries(class) || time.Until(deadline) <= retry.Delay {
+			break
+		}
+
+		_ = level.Info(attemptLogger).Log("msg", "Retrying check", "failure", class, "delay_seconds", retry.Delay.Seconds())
+
+		if err := sleepCtx(ctx, retry.Delay); err != nil {
+			break
+		}
+	}
+
+	attemptsGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: ProbeAttemptsMetricName,
+		Help: "Returns how many times the check was attempted",
+	})
+	attemptsGauge.Set(float64(attempt))
+	registry.MustRegister(attemptsGauge)
+
+	return success, class, registry
 }
 
+// runProber runs the prober once. If the check fails, it returns the
+// class of the failure.
 func runProber(
 	ctx context.Context,
 	prober prober.Prober,
@@ -822,7 +1036,7 @@ func runProber(
 	logger kitlog.Logger,
 	executionID string,
 	clock scrapeClock,
-) bool {
+) (bool, FailureClass) {
 	wallStart := time.Now()
 
 	// The begin log needs no explicit time: the wrapper `ts` valuer already
@@ -833,7 +1047,9 @@ func runProber(
 	checkCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	success, duration := prober.Probe(checkCtx, target, registry, logger, executionID)
+	recorder := &failureRecorder{logger: logger}
+
+	success, duration := prober.Probe(checkCtx, target, registry, recorder, executionID)
 
 	wallDuration := time.Since(wallStart).Seconds()
 	if duration == 0 {
@@ -885,10 +1101,23 @@ func runProber(
 
 	smCheckInfo.Set(1)
 
-	return success
+	if success {
+		return true, ""
+	}
+
+	if errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+		return false, FailureClassTimeout
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		return false, FailureClassError
+	}
+
+	return false, classifyFailure(mfs, recorder.errors())
 }
 
-func getDerivedMetrics(mfs []*dto.MetricFamily, summaries map[uint64]prometheus.Summary, histograms map[uint64]prometheus.Histogram, registry *prometheus.Registry, basicMetricsOnly bool) error {
+func getDerivedMetrics(mfs []*dto.MetricFamily, summaries map[uint64]prometheus.Summary, histograms map[uint64]prometheus.Histogram, registry *prometheus.Registry, basicMetricsOnly, nativeHistograms bool) error {
 	for _, mf := range mfs {
 		switch {
 		case mf.GetType() == dto.MetricType_GAUGE && mf.GetName() == ProbeSuccessMetricName:
@@ -918,7 +1147,7 @@ func getDerivedMetrics(mfs []*dto.MetricFamily, summaries map[uint64]prometheus.
 					derivedMetricName := strings.TrimSuffix(metricName, suffix) + "_all" + suffix
 
 					for _, metric := range mf.GetMetric() {
-						_, err := updateHistogramFromMetric(derivedMetricName, mf.GetHelp(), metric, histograms, registry)
+						_, err := updateHistogramFromMetric(derivedMetricName, mf.GetHelp(), metric, histograms, registry, nativeHistograms)
 						if err != nil {
 							return err
 						}
@@ -935,15 +1164,22 @@ func getDerivedMetrics(mfs []*dto.MetricFamily, summaries map[uint64]prometheus.
 
 // extractLogs parses logfmt-encoded log bytes and returns Loki streams using sharedLabels
 // as stream labels. Any labels in structuredMetadata are attached to each log entry as
-// Loki structured metadata.
-func (s Scraper) extractLogs(t time.Time, logs []byte, sharedLabels []labelPair, structuredMetadata []logproto.LabelAdapter) Streams {
+// Loki structured metadata. The output argument selects whether the log lines, a summary
+// line or both are returned. The values of the secrets recorded in usage are redacted.
+func (s Scraper) extractLogs(t time.Time, logs []byte, sharedLabels []labelPair, structuredMetadata []logproto.LabelAdapter, output logOutput, usage *secrets.Usage) Streams {
 	var line strings.Builder
 
+	redact := !usage.Empty()
+
 	dec := logfmt.NewDecoder(bytes.NewReader(logs))
 
 	labels := make([]labelPair, 0, len(sharedLabels))
 
-	var entries []logproto.Entry
+	var (
+		entries  []logproto.Entry
+		numLines int
+		lastTime = t
+	)
 
 RECORD:
 	for dec.ScanRecord() {
@@ -989,6 +1225,10 @@ RECORD:
 				}
 
 			default:
+				if redact {
+					value = []byte(usage.Redact(string(value)))
+				}
+
 				if err := enc.EncodeKeyval(key, value); err != nil {
 					// We should never hit this because all the entries are valid.
 					s.logger.Warn().Err(err).Bytes("key", key).Bytes("value", value).Msg("invalid entry scanning logs")
@@ -1001,6 +1241,16 @@ RECORD:
 			s.logger.Warn().Err(err).Msg("encoding logs")
 		}
 
+		numLines++
+
+		if !t.IsZero() {
+			lastTime = t
+		}
+
+		if output == logOutputSummary {
+			continue
+		}
+
 		entries = append(entries, logproto.Entry{
 			Timestamp:          t,
 			Line:               line.String(),
@@ -1012,6 +1262,15 @@ RECORD:
 		s.logger.Error().Err(err).Msg("decoding logs")
 	}
 
+	if output != logOutputFull {
+		labels = append(labels[:0], sharedLabels...)
+		entries = append(entries, logproto.Entry{
+			Timestamp:          lastTime,
+			Line:               logSummaryLine(numLines, output == logOutputSummary),
+			StructuredMetadata: structuredMetadata,
+		})
+	}
+
 	return Streams{
 		logproto.Stream{
 			Labels:  fmtLabels(labels),
@@ -1020,15 +1279,16 @@ RECORD:
 	}
 }
 
-func (s Scraper) extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels []labelPair) TimeSeries {
+func (s Scraper) extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels []labelPair) (TimeSeries, []pusher.SeriesMetadata) {
 	return extractTimeseries(t, metrics, executionLabels, s.summaries, s.histograms, s.logger)
 }
 
-// extractTimeseries converts gathered Prometheus metrics into remote-write time series.
+// extractTimeseries converts gathered Prometheus metrics into remote-write time series,
+// along with the metadata for each of them.
 //
 //	executionLabels: system labels + un-prefixed user labels; applied to all check execution
 //		metrics (probe_success, etc.).
-func extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels []labelPair, summaries map[uint64]prometheus.Summary, histograms map[uint64]prometheus.Histogram, logger zerolog.Logger) TimeSeries {
+func extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels []labelPair, summaries map[uint64]prometheus.Summary, histograms map[uint64]prometheus.Histogram, logger zerolog.Logger) (TimeSeries, []pusher.SeriesMetadata) {
 	toPrompb := func(pairs []labelPair) []prompb.Label {
 		out := make([]prompb.Label, 0, len(pairs))
 		for _, label := range pairs {
@@ -1040,7 +1300,10 @@ func extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels
 
 	executionPrompb := toPrompb(executionLabels)
 
-	var ts []prompb.TimeSeries
+	var (
+		ts       []prompb.TimeSeries
+		metadata []pusher.SeriesMetadata
+	)
 
 	for _, mf := range metrics {
 		mName := mf.GetName()
@@ -1054,11 +1317,58 @@ func extractTimeseries(t time.Time, metrics []*dto.MetricFamily, executionLabels
 		}
 
 		for _, m := range mf.GetMetric() {
+			n := len(ts)
 			ts = appendDtoToTimeseries(ts, t, mName, shared, mType, m)
+
+			md := seriesMetadata(mf, m)
+			for range len(ts) - n {
+				metadata = append(metadata, md)
+			}
 		}
 	}
 
-	return ts
+	return ts, metadata
+}
+
+// seriesMetadata returns the metadata for the time series created out of
+// metric m.
+//
+// Start timestamps are only provided for summaries and histograms, as
+// those are the only metrics that persist across check executions. Other
+// metrics are created each time the check runs.
+func seriesMetadata(mf *dto.MetricFamily, m *dto.Metric) pusher.SeriesMetadata {
+	md := pusher.SeriesMetadata{
+		Help: mf.GetHelp(),
+		Unit: mf.GetUnit(),
+	}
+
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		md.Type = prompb.MetricMetadata_COUNTER
+
+	case dto.MetricType_GAUGE:
+		md.Type = prompb.MetricMetadata_GAUGE
+
+	case dto.MetricType_SUMMARY:
+		md.Type = prompb.MetricMetadata_SUMMARY
+		if ct := m.GetSummary().GetCreatedTimestamp(); ct != nil {
+			md.StartTimestamp = ct.AsTime().UnixMilli()
+		}
+
+	case dto.MetricType_HISTOGRAM:
+		md.Type = prompb.MetricMetadata_HISTOGRAM
+		if ct := m.GetHistogram().GetCreatedTimestamp(); ct != nil {
+			md.StartTimestamp = ct.AsTime().UnixMilli()
+		}
+
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		md.Type = prompb.MetricMetadata_GAUGEHISTOGRAM
+
+	default:
+		md.Type = prompb.MetricMetadata_UNKNOWN
+	}
+
+	return md
 }
 
 func (s Scraper) buildCheckInfoLabels(userLabels []labelPair, commonLabels []labelPair, mode sm.LabelMode) map[string]string {
@@ -1182,35 +1492,71 @@ func regionLabelForMode(mode sm.LabelMode, probeRegion string) labelPair {
 }
 
 func makeTimeseries(t time.Time, value float64, labels ...prompb.Label) prompb.TimeSeries {
-	var ts prompb.TimeSeries
+	return prompb.TimeSeries{
+		Labels: uniqueLabels(labels),
+		Samples: []prompb.Sample{
+			{Timestamp: t.UnixNano() / 1e6, Value: value},
+		},
+	}
+}
 
+// makeHistogramTimeseries creates a time series holding the native
+// histogram h.
+func makeHistogramTimeseries(t time.Time, h *dto.Histogram, labels ...prompb.Label) prompb.TimeSeries {
+	toSpans := func(spans []*dto.BucketSpan) []prompb.BucketSpan {
+		out := make([]prompb.BucketSpan, 0, len(spans))
+		for _, s := range spans {
+			out = append(out, prompb.BucketSpan{Offset: s.GetOffset(), Length: s.GetLength()})
+		}
+
+		return out
+	}
+
+	return prompb.TimeSeries{
+		Labels: uniqueLabels(labels),
+		Histograms: []prompb.Histogram{
+			{
+				Count:          &prompb.Histogram_CountInt{CountInt: h.GetSampleCount()},
+				Sum:            h.GetSampleSum(),
+				Schema:         h.GetSchema(),
+				ZeroThreshold:  h.GetZeroThreshold(),
+				ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: h.GetZeroCount()},
+				NegativeSpans:  toSpans(h.GetNegativeSpan()),
+				NegativeDeltas: h.GetNegativeDelta(),
+				PositiveSpans:  toSpans(h.GetPositiveSpan()),
+				PositiveDeltas: h.GetPositiveDelta(),
+				Timestamp:      t.UnixNano() / 1e6,
+			},
+		},
+	}
+}
+
+// uniqueLabels returns the provided labels, keeping only the first
+// occurrence of each label name.
+func uniqueLabels(labels []prompb.Label) []prompb.Label {
 	// duplicate labels on timeseries are rejected by Mimir.
 	// this is also a common point to enforce conflict resolution
 	// for LabelMode - user-defined labels should appear first in the list
 	// of labels associated with each timeseries so that de-duplication favours retaining them
 	// over system-defined values.
-	ts.Labels = make([]prompb.Label, 0, len(labels))
+	out := make([]prompb.Label, 0, len(labels))
 
 	for _, l := range labels {
 		dup := false
 
-		for i := range ts.Labels {
-			if ts.Labels[i].Name == l.Name {
+		for i := range out {
+			if out[i].Name == l.Name {
 				dup = true
 				break
 			}
 		}
 
 		if !dup {
-			ts.Labels = append(ts.Labels, l)
+			out = append(out, l)
 		}
 	}
 
-	ts.Samples = []prompb.Sample{
-		{Timestamp: t.UnixNano() / 1e6, Value: value},
-	}
-
-	return ts
+	return out
 }
 
 // mergeUserLabels combines probe- and check-level labels into a single ordered
@@ -1348,7 +1694,11 @@ func appendDtoToTimeseries(ts []prompb.TimeSeries, t time.Time, mName string, sh
 
 	case dto.MetricType_HISTOGRAM:
 		if h := metric.GetHistogram(); h != nil {
-			if b := h.GetBucket(); b != nil {
+			if h.Schema != nil && len(h.GetBucket()) == 0 {
+				// This is a native histogram without classic
+				// buckets.
+				ts = append(ts, makeHistogramTimeseries(t, h, labels...))
+			} else if b := h.GetBucket(); b != nil {
 				hLabels := make([]prompb.Label, len(labels))
 				copy(hLabels, labels)
 
@@ -1452,7 +1802,11 @@ func updateSummaryFromMetric(mName, help string, m *dto.Metric, summaries map[ui
 	return summary, nil
 }
 
-func updateHistogramFromMetric(mName, help string, m *dto.Metric, histograms map[uint64]prometheus.Histogram, registry *prometheus.Registry) (prometheus.Histogram, error) {
+// updateHistogramFromMetric observes the value of m in the histogram
+// associated with mName and the labels in m, creating it if necessary. If
+// native is true, the histogram is a native histogram without classic
+// buckets.
+func updateHistogramFromMetric(mName, help string, m *dto.Metric, histograms map[uint64]prometheus.Histogram, registry *prometheus.Registry, native bool) (prometheus.Histogram, error) {
 	var value float64
 
 	switch {
@@ -1470,12 +1824,21 @@ func updateHistogramFromMetric(mName, help string, m *dto.Metric, histograms map
 
 	histogram, found := histograms[mHash]
 	if !found {
-		histogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		opts := prometheus.HistogramOpts{
 			Name:        mName,
 			Help:        help + " (histogram)",
 			ConstLabels: getLabels(m),
 			Buckets:     prometheus.DefBuckets,
-		})
+		}
+
+		if native {
+			opts.Buckets = nil
+			opts.NativeHistogramBucketFactor = nativeHistogramBucketFactor
+			opts.NativeHistogramMaxBucketNumber = nativeHistogramMaxBucketNumber
+			opts.NativeHistogramMinResetDuration = nativeHistogramMinResetDuration
+		}
+
+		histogram = prometheus.NewHistogram(opts)
 
 		histograms[mHash] = histogram
 	}
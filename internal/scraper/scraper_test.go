@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -18,8 +19,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/synctest"
 	"time"
 
 	"github.com/go-logfmt/logfmt"
@@ -118,7 +121,7 @@ func verifyProberMetrics(
 	prober, check, stop := setup(ctx, t)
 	defer stop()
 
-	success, mfs, err := getProbeMetrics(
+	success, _, mfs, err := getProbeMetrics(
 		ctx,
 		prober,
 		check.Target,
@@ -128,6 +131,8 @@ func verifyProberMetrics(
 		histograms,
 		logger,
 		basicMetricsOnly,
+		false,
+		RetryPolicy{},
 		"test-execution-id",
 		scheduledScrapeClock(time.Now()),
 	)
@@ -293,7 +298,7 @@ func TestHTTPTimeoutTelemetryContract(t *testing.T) {
 
 	var logs bytes.Buffer
 
-	success, mfs, err := getProbeMetrics(
+	success, _, mfs, err := getProbeMetrics(
 		context.Background(),
 		p,
 		check.Target,
@@ -303,6 +308,8 @@ func TestHTTPTimeoutTelemetryContract(t *testing.T) {
 		make(map[uint64]prometheus.Histogram),
 		&testLogger{w: &logs},
 		false,
+		false,
+		RetryPolicy{},
 		"timeout-contract",
 		scheduledScrapeClock(time.Now()),
 	)
@@ -1237,7 +1244,7 @@ func TestValidateLabels(t *testing.T) {
 				},
 			}
 
-			data, duration, err := s.collectData(context.Background(), time.Unix(int64(3141000)/1000, 0))
+			data, duration, err := s.collectData(context.Background(), time.Unix(int64(3141000)/1000, 0), checkStateMachine{})
 			require.NoError(t, err)
 			require.NotNil(t, data)
 			require.NotZero(t, duration)
@@ -1327,6 +1334,51 @@ func TestMakeTimeseriesDeduplicates(t *testing.T) {
 	}, ts.Labels)
 }
 
+// TestNativeHistogramTimeseries verifies that derived histograms created as
+// native histograms are converted into a single histogram series, and that
+// their metadata carries the histogram's start timestamp.
+func TestNativeHistogramTimeseries(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	histograms := make(map[uint64]prometheus.Histogram)
+
+	for _, v := range []float64{0.1, 0.2, 0.4} {
+		m := &dto.Metric{Gauge: &dto.Gauge{Value: &v}}
+		_, err := updateHistogramFromMetric("probe_all_duration_seconds", "duration", m, histograms, registry, true)
+		require.NoError(t, err)
+		registry = prometheus.NewRegistry()
+	}
+
+	require.NoError(t, registry.Register(histograms[hashMetricNameAndLabels("probe_all_duration_seconds", nil)]))
+
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 1)
+
+	mf := mfs[0]
+	m := mf.GetMetric()[0]
+	now := time.Unix(1000, 0)
+
+	ts := appendDtoToTimeseries(nil, now, mf.GetName(), nil, mf.GetType(), m)
+	require.Len(t, ts, 1)
+	require.Empty(t, ts[0].Samples)
+	require.Equal(t, []prompb.Label{{Name: prom.MetricNameLabel, Value: "probe_all_duration_seconds"}}, ts[0].Labels)
+	require.Len(t, ts[0].Histograms, 1)
+
+	h := ts[0].Histograms[0]
+	require.Equal(t, uint64(3), h.GetCountInt())
+	require.InDelta(t, 0.7, h.Sum, 1e-9)
+	require.Equal(t, m.GetHistogram().GetSchema(), h.Schema)
+	require.Equal(t, now.UnixMilli(), h.Timestamp)
+
+	require.NotEmpty(t, h.PositiveSpans)
+	require.NotEmpty(t, h.PositiveDeltas)
+
+	md := seriesMetadata(mf, m)
+	require.Equal(t, prompb.MetricMetadata_HISTOGRAM, md.Type)
+	require.Equal(t, "duration (histogram)", md.Help)
+	require.NotZero(t, md.StartTimestamp)
+}
+
 // TestScraperCollectDataTooManyMetricLabels verifies that the check-info label
 // guard rejects a scrape whose non-system label count exceeds the tenant's
 // metric-label budget, before any data is emitted.
@@ -1363,7 +1415,7 @@ func TestScraperCollectDataTooManyMetricLabels(t *testing.T) {
 		probe: sm.Probe{Id: 100, TenantId: 200, Name: "probe name", Region: "REGION"},
 	}
 
-	_, _, err := s.collectData(context.Background(), time.Unix(3141, 0))
+	_, _, err := s.collectData(context.Background(), time.Unix(3141, 0), checkStateMachine{})
 	require.ErrorIs(t, err, errTooManyLabels)
 }
 
@@ -2330,7 +2382,7 @@ func TestScraperCollectData(t *testing.T) {
 				},
 			}
 
-			data, duration, err := s.collectData(context.Background(), time.Unix(sampleTsMs/1000, 0))
+			data, duration, err := s.collectData(context.Background(), time.Unix(sampleTsMs/1000, 0), checkStateMachine{})
 			require.NoError(t, err)
 			require.NotNil(t, data)
 			require.NotZero(t, duration)
@@ -2431,7 +2483,7 @@ func TestScraperCollectDataReservedLabelCollision(t *testing.T) {
 		},
 	}
 
-	data, _, err := s.collectData(context.Background(), time.Unix(3141, 0))
+	data, _, err := s.collectData(context.Background(), time.Unix(3141, 0), checkStateMachine{})
 	require.NoError(t, err)
 	require.NotNil(t, data)
 
@@ -2538,7 +2590,7 @@ func TestScraperCollectDataReservedPhaseCollision(t *testing.T) {
 		},
 	}
 
-	data, _, err := s.collectData(context.Background(), time.Unix(3141, 0))
+	data, _, err := s.collectData(context.Background(), time.Unix(3141, 0), checkStateMachine{})
 	require.NoError(t, err)
 	require.NotNil(t, data)
 
@@ -2858,6 +2910,112 @@ func TestScraperRun(t *testing.T) {
 	}
 }
 
+// blockingProber succeeds once release is closed, signalling started when
+// each execution begins.
+type blockingProber struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p blockingProber) Name() string {
+	return "blocking prober"
+}
+
+func (p blockingProber) Probe(ctx context.Context, target string, registry *prometheus.Registry, logger logger.Logger, _ string) (bool, float64) {
+	p.started <- struct{}{}
+	<-p.release
+
+	return true, 1
+}
+
+// stalePublisher counts the payloads published, and how many of them
+// carry stale markers.
+type stalePublisher struct {
+	mutex     sync.Mutex
+	published int
+	stale     int
+}
+
+func (p *stalePublisher) Publish(payload pusher.Payload) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.published++
+
+	for _, ts := range payload.Metrics() {
+		if len(ts.Samples) > 0 && math.Float64bits(ts.Samples[0].Value) == staleNaN {
+			p.stale++
+			return
+		}
+	}
+}
+
+func TestScraperDrain(t *testing.T) {
+	for _, handover := range []bool{false, true} {
+		t.Run(fmt.Sprintf("handover=%t", handover), func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				var check model.Check
+
+				require.NoError(t, check.FromSM(sm.Check{
+					Id:        1,
+					TenantId:  1000,
+					Frequency: 60000,
+					Offset:    1000,
+					Timeout:   10000,
+					Enabled:   true,
+					Target:    "127.0.0.1",
+					Job:       "test",
+					Settings:  sm.CheckSettings{Ping: &sm.PingSettings{}},
+				}))
+
+				p := blockingProber{started: make(chan struct{}), release: make(chan struct{})}
+				publisher := &stalePublisher{}
+
+				s, err := NewWithOpts(t.Context(), check, ScraperOpts{
+					Metrics:               NewMetrics(&testCounter{}, &testCounterVec{counters: make(map[string]Incrementer), t: t}),
+					ProbeFactory:          testProbeFactory{builder: func() prober.Prober { return p }},
+					Logger:                zerolog.New(zerolog.NewTestWriter(t)),
+					Publisher:             publisher,
+					LabelsLimiter:         testLabelsLimiter{maxMetricLabels: 20, maxLogLabels: 15},
+					LabellingMode:         testLabellingMode{},
+					Telemeter:             &testTelemeter{},
+					CostAttributionLabels: testCalTenants{},
+				})
+				require.NoError(t, err)
+
+				go s.Run(t.Context())
+
+				<-p.started
+
+				// The execution in progress is not interrupted.
+				done := s.Drain(handover)
+
+				synctest.Wait()
+
+				select {
+				case <-done:
+					require.Fail(t, "scraper stopped during an execution")
+				default:
+				}
+
+				close(p.release)
+				<-done
+
+				publisher.mutex.Lock()
+				defer publisher.mutex.Unlock()
+
+				if handover {
+					require.Equal(t, 1, publisher.published)
+					require.Zero(t, publisher.stale)
+				} else {
+					require.Equal(t, 2, publisher.published)
+					require.Equal(t, 1, publisher.stale)
+				}
+			})
+		})
+	}
+}
+
 func TestTickWithOffset(t *testing.T) {
 	const (
 		WORK    = 1
@@ -3143,7 +3301,7 @@ func TestExtractLogsK6TimeOverridesDefaultTimestamp(t *testing.T) {
 				logger: testhelper.Logger(t),
 			}
 
-			streams := s.extractLogs(time.Now(), []byte(tc.logs), tc.sharedLabels, nil)
+			streams := s.extractLogs(time.Now(), []byte(tc.logs), tc.sharedLabels, nil, logOutputFull, nil)
 			tc.expected(t, streams)
 		})
 	}
@@ -3178,7 +3336,7 @@ func TestHTTPCheckLogTimestampsAreNonDecreasing(t *testing.T) {
 	// but its wrapper logs must retain their original wall-clock behavior. The
 	// unscheduled collector has separate coverage for logical timestamps.
 	wallStart := time.Now()
-	data, _, err := s.collectData(ctx, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC))
+	data, _, err := s.collectData(ctx, time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC), checkStateMachine{})
 	require.NoError(t, err)
 	require.NotNil(t, data)
 
@@ -0,0 +1,267 @@
+package scraper
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+)
+
+// State is the state of a check as tracked by its state machine, which
+// only changes after several executions with the same result.
+type State string
+
+const (
+	StateUnknown State = "unknown"
+	StatePassing State = "passing"
+	StateFailing State = "failing"
+)
+
+// Result is the outcome of a single check execution.
+type Result string
+
+const (
+	// ResultSuccess means the check ran and succeeded.
+	ResultSuccess Result = "success"
+	// ResultFailure means the check ran and failed.
+	ResultFailure Result = "failure"
+	// ResultError means the check could not run, e.g. because of a
+	// configuration problem, so no data was published.
+	ResultError Result = "error"
+)
+
+// DefaultHistorySize is the default number of executions kept in the
+// history of each check.
+const DefaultHistorySize = 20
+
+// maxHistoryLogBytes is the maximum size of the logs kept for each
+// execution in the history.
+const maxHistoryLogBytes = 1024
+
+// Execution describes a scheduled check execution.
+type Execution struct {
+	Time     time.Time
+	Duration time.Duration
+	Result   Result
+	// Error is set when Result is ResultError.
+	Error string
+	// ExecutionID identifies the execution in the published logs. It's
+	// empty if the check could not run.
+	ExecutionID string
+	// FailureClass is set when Result is ResultFailure.
+	FailureClass FailureClass
+	// Series and Streams are the data published for this execution.
+	// The logs follow the scraper's LogPolicy.
+	Series  TimeSeries
+	Streams Streams
+}
+
+// Status is a snapshot of what a scraper is doing.
+type Status struct {
+	Check model.Check
+	State State
+	// LastExecution is nil until the check runs for the first time.
+	LastExecution *Execution
+	// History holds the latest executions, oldest first.
+	History []HistoryEntry
+}
+
+// HistoryEntry summarises a past execution, keeping just enough to tell
+// what happened without holding on to its data.
+type HistoryEntry struct {
+	Time         time.Time
+	Duration     time.Duration
+	Result       Result
+	FailureClass FailureClass
+	Error        string
+	ExecutionID  string
+	// Logs are the published log lines, truncated to a few hundred
+	// bytes.
+	Logs string
+}
+
+func newHistoryEntry(exec Execution) HistoryEntry {
+	return HistoryEntry{
+		Time:         exec.Time,
+		Duration:     exec.Duration,
+		Result:       exec.Result,
+		FailureClass: exec.FailureClass,
+		Error:        exec.Error,
+		ExecutionID:  exec.ExecutionID,
+		Logs:         truncateLogs(exec.Streams, maxHistoryLogBytes),
+	}
+}
+
+// truncateLogs returns the lines in streams, one per line, keeping at most
+// maxBytes bytes without splitting characters. Truncated logs end with
+// "...".
+func truncateLogs(streams Streams, maxBytes int) string {
+	var sb strings.Builder
+
+	for _, stream := range streams {
+		for _, entry := range stream.Entries {
+			if sb.Len() > 0 {
+				sb.WriteByte('\n')
+			}
+
+			sb.WriteString(entry.Line)
+
+			if sb.Len() > maxBytes {
+				logs := sb.String()
+
+				n := maxBytes
+				for n > 0 && !utf8.RuneStart(logs[n]) {
+					n--
+				}
+
+				return logs[:n] + "..."
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// statusTracker records the latest executions of a scraper. A nil tracker
+// records nothing.
+type statusTracker struct {
+	mutex sync.Mutex
+	state State
+	last  *Execution
+	// history is a ring buffer of the latest executions, next is where
+	// the following one goes.
+	history []HistoryEntry
+	next    int
+	size    int
+}
+
+// newStatusTracker returns a tracker that keeps the latest historySize
+// executions in its history.
+func newStatusTracker(historySize int) *statusTracker {
+	return &statusTracker{state: StateUnknown, size: max(historySize, 0)}
+}
+
+func (t *statusTracker) record(exec Execution, sm checkStateMachine) {
+	if t == nil {
+		return
+	}
+
+	state := StateUnknown
+
+	switch {
+	case sm.isPassing():
+		state = StatePassing
+
+	case sm.isFailing():
+		state = StateFailing
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.state = state
+	t.last = &exec
+
+	if t.size == 0 {
+		return
+	}
+
+	entry := newHistoryEntry(exec)
+
+	if len(t.history) < t.size {
+		t.history = append(t.history, entry)
+	} else {
+		t.history[t.next] = entry
+	}
+
+	t.next = (t.next + 1) % t.size
+}
+
+func (t *statusTracker) snapshot() (State, *Execution) {
+	if t == nil {
+		return StateUnknown, nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.state, t.last
+}
+
+// historySnapshot returns a copy of the history, oldest first.
+func (t *statusTracker) historySnapshot() []HistoryEntry {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.history) < t.size {
+		return slices.Clone(t.history)
+	}
+
+	return slices.Concat(t.history[t.next:], t.history[:t.next])
+}
+
+// Status returns what the scraper is currently doing. The returned value
+// must not be modified.
+func (s *Scraper) Status() Status {
+	state, last := s.status.snapshot()
+
+	return Status{Check: s.check, State: state, LastExecution: last, History: s.status.historySnapshot()}
+}
+
+// NewExecution describes an execution from the values returned by
+// CollectData.
+func NewExecution(t time.Time, duration time.Duration, ts TimeSeries, streams Streams, err error) Execution {
+	if err != nil && !errors.Is(err, errCheckFailed) {
+		return newExecution(t, duration, nil, err)
+	}
+
+	return newExecution(t, duration, &probeData{ts: ts, streams: streams}, err)
+}
+
+// newExecution builds the execution record for the data collected at t.
+// The samples are copied because they are modified in place when the
+// payload is republished.
+func newExecution(t time.Time, duration time.Duration, payload *probeData, err error) Execution {
+	exec := Execution{Time: t, Duration: duration, Result: ResultSuccess}
+
+	switch {
+	case payload == nil:
+		exec.Result = ResultError
+
+		if err != nil {
+			exec.Error = err.Error()
+		}
+
+		return exec
+
+	case err != nil:
+		exec.Result = ResultFailure
+		exec.FailureClass = payload.failureClass
+	}
+
+	exec.ExecutionID = payload.executionID
+
+	exec.Series = make(TimeSeries, len(payload.ts))
+
+	for i, ts := range payload.ts {
+		exec.Series[i] = prompb.TimeSeries{
+			Labels:     ts.Labels,
+			Samples:    slices.Clone(ts.Samples),
+			Histograms: slices.Clone(ts.Histograms),
+		}
+	}
+
+	exec.Streams = payload.streams
+
+	return exec
+}
@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	logproto "github.com/grafana/loki/pkg/push"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExecution(t *testing.T) {
+	now := time.Now()
+
+	payload := &probeData{
+		ts: TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "probe_success"}},
+				Samples: []prompb.Sample{{Timestamp: now.UnixMilli(), Value: 1}},
+			},
+		},
+		streams: Streams{{Labels: `{job="job"}`, Entries: []logproto.Entry{{Timestamp: now, Line: "msg=done"}}}},
+	}
+
+	exec := newExecution(now, time.Second, payload, nil)
+	require.Equal(t, ResultSuccess, exec.Result)
+	require.Equal(t, time.Second, exec.Duration)
+	require.Equal(t, payload.streams, exec.Streams)
+	require.Equal(t, payload.ts, exec.Series)
+
+	// Republishing modifies the payload in place, but not the execution.
+	payload.ts[0].Samples[0].Value = staleMarker
+	require.Equal(t, float64(1), exec.Series[0].Samples[0].Value)
+
+	exec = newExecution(now, time.Second, payload, errCheckFailed)
+	require.Equal(t, ResultFailure, exec.Result)
+	require.Empty(t, exec.Error)
+
+	payload.executionID = "execution-id"
+	payload.failureClass = FailureClassTimeout
+
+	exec = newExecution(now, time.Second, payload, errCheckFailed)
+	require.Equal(t, "execution-id", exec.ExecutionID)
+	require.Equal(t, FailureClassTimeout, exec.FailureClass)
+
+	exec = newExecution(now, 0, nil, errors.New("boom"))
+	require.Equal(t, ResultError, exec.Result)
+	require.Equal(t, "boom", exec.Error)
+	require.Nil(t, exec.Series)
+}
+
+func TestStatusTracker(t *testing.T) {
+	var nilTracker *statusTracker
+
+	nilTracker.record(Execution{}, checkStateMachine{})
+	state, last := nilTracker.snapshot()
+	require.Equal(t, StateUnknown, state)
+	require.Nil(t, last)
+
+	tracker := newStatusTracker(0)
+
+	state, last = tracker.snapshot()
+	require.Equal(t, StateUnknown, state)
+	require.Nil(t, last)
+
+	sm := checkStateMachine{}
+	sm.pass(func() {})
+	tracker.record(Execution{Result: ResultSuccess}, sm)
+
+	state, last = tracker.snapshot()
+	require.Equal(t, StatePassing, state)
+	require.Equal(t, ResultSuccess, last.Result)
+
+	sm.fail(func() {})
+	tracker.record(Execution{Result: ResultFailure}, sm)
+
+	state, last = tracker.snapshot()
+	require.Equal(t, StateFailing, state)
+	require.Equal(t, ResultFailure, last.Result)
+
+	s := Scraper{status: tracker}
+	require.Equal(t, StateFailing, s.Status().State)
+}
+
+func TestStatusTrackerHistory(t *testing.T) {
+	var nilTracker *statusTracker
+
+	require.Nil(t, nilTracker.historySnapshot())
+
+	// Without a history size, no history is kept.
+	tracker := newStatusTracker(0)
+	tracker.record(Execution{Result: ResultSuccess}, checkStateMachine{})
+	require.Empty(t, tracker.historySnapshot())
+
+	tracker = newStatusTracker(3)
+
+	start := time.Now()
+
+	record := func(i int) {
+		tracker.record(Execution{
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			Duration:    time.Duration(i) * time.Millisecond,
+			Result:      ResultSuccess,
+			ExecutionID: strconv.Itoa(i),
+			Streams:     Streams{{Entries: []logproto.Entry{{Line: "msg=" + strconv.Itoa(i)}}}},
+		}, checkStateMachine{})
+	}
+
+	ids := func() []string {
+		var ids []string
+		for _, e := range tracker.historySnapshot() {
+			ids = append(ids, e.ExecutionID)
+		}
+
+		return ids
+	}
+
+	record(1)
+	record(2)
+	require.Equal(t, []string{"1", "2"}, ids())
+
+	record(3)
+	record(4)
+	require.Equal(t, []string{"2", "3", "4"}, ids())
+
+	record(5)
+	record(6)
+	record(7)
+	require.Equal(t, []string{"5", "6", "7"}, ids())
+
+	history := tracker.historySnapshot()
+	require.Equal(t, HistoryEntry{
+		Time:        start.Add(5 * time.Minute),
+		Duration:    5 * time.Millisecond,
+		Result:      ResultSuccess,
+		ExecutionID: "5",
+		Logs:        "msg=5",
+	}, history[0])
+
+	// Snapshots are copies.
+	history[0].ExecutionID = "modified"
+	require.Equal(t, []string{"5", "6", "7"}, ids())
+
+	s := Scraper{status: tracker}
+	require.Len(t, s.Status().History, 3)
+}
+
+func TestTruncateLogs(t *testing.T) {
+	streams := Streams{
+		{Entries: []logproto.Entry{{Line: "first"}, {Line: "second"}}},
+		{Entries: []logproto.Entry{{Line: "third"}}},
+	}
+
+	require.Empty(t, truncateLogs(nil, 10))
+	require.Equal(t, "first\nsecond\nthird", truncateLogs(streams, 100))
+	require.Equal(t, "first\nsecond\nthird", truncateLogs(streams, 18))
+	require.Equal(t, "first\nsec...", truncateLogs(streams, 9))
+
+	// Characters are not split.
+	streams = Streams{{Entries: []logproto.Entry{{Line: "añb"}}}}
+	require.Equal(t, "a...", truncateLogs(streams, 2))
+}
@@ -0,0 +1,315 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+var (
+	// ErrSecretNotFound is returned by backends that don't have the
+	// requested secret, allowing the next backend to be consulted.
+	ErrSecretNotFound = errors.New("secret not found")
+
+	ErrUnsupportedBackend = errors.New("unsupported secret backend")
+	ErrDuplicateBackend   = errors.New("duplicate secret backend")
+	ErrInvalidTenant      = errors.New("invalid tenant")
+)
+
+// Backend resolves secret values from a source local to the probe.
+//
+// Implementations must return an error wrapping ErrSecretNotFound when the
+// secret does not exist, and any other error when the source cannot be
+// consulted.
+type Backend interface {
+	Name() string
+	GetSecretValue(ctx context.Context, tenantID model.GlobalID, secretKey string) (string, error)
+}
+
+// BackendKind identifies a secret backend.
+type BackendKind string
+
+const (
+	BackendGSM   BackendKind = "gsm"
+	BackendEnv   BackendKind = "env"
+	BackendFiles BackendKind = "files"
+	BackendVault BackendKind = "vault"
+)
+
+// BackendKinds is an ordered list of secret backends that can be set from
+// a comma-separated command line flag.
+type BackendKinds []BackendKind
+
+var _ flag.Value = (*BackendKinds)(nil)
+
+func (val *BackendKinds) Set(s string) error {
+	var kinds BackendKinds
+
+	for elem := range strings.SplitSeq(s, ",") {
+		switch kind := BackendKind(strings.TrimSpace(elem)); kind {
+		case "":
+			continue
+
+		case BackendGSM, BackendEnv, BackendFiles, BackendVault:
+			if slices.Contains(kinds, kind) {
+				return fmt.Errorf("%w: %s", ErrDuplicateBackend, kind)
+			}
+
+			kinds = append(kinds, kind)
+
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedBackend, kind)
+		}
+	}
+
+	*val = kinds
+
+	return nil
+}
+
+func (val BackendKinds) String() string {
+	values := make([]string, 0, len(val))
+	for _, kind := range val {
+		values = append(values, string(kind))
+	}
+
+	return strings.Join(values, ",")
+}
+
+// TenantList lists the tenants allowed to use the local secret backends.
+// Each tenant is either a tenant ID, matching the tenant with that ID in
+// any region, or a region ID and a tenant ID separated by a colon,
+// matching only in that region. It can be set from a comma-separated
+// command line flag.
+type TenantList []TenantRef
+
+// TenantRef identifies a tenant. A zero RegionID matches any region.
+type TenantRef struct {
+	RegionID int
+	TenantID int64
+}
+
+var _ flag.Value = (*TenantList)(nil)
+
+func (val *TenantList) Set(s string) error {
+	var tenants TenantList
+
+	for elem := range strings.SplitSeq(s, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		var (
+			ref    TenantRef
+			region string
+			err    error
+		)
+
+		if before, after, found := strings.Cut(elem, ":"); found {
+			region, elem = before, after
+
+			ref.RegionID, err = strconv.Atoi(region)
+			if err != nil || ref.RegionID <= 0 {
+				return fmt.Errorf("%w: %s:%s", ErrInvalidTenant, region, elem)
+			}
+		}
+
+		ref.TenantID, err = strconv.ParseInt(elem, 10, 64)
+		if err != nil || ref.TenantID <= 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidTenant, elem)
+		}
+
+		tenants = append(tenants, ref)
+	}
+
+	*val = tenants
+
+	return nil
+}
+
+func (val TenantList) String() string {
+	values := make([]string, 0, len(val))
+
+	for _, ref := range val {
+		if ref.RegionID != 0 {
+			values = append(values, strconv.Itoa(ref.RegionID)+":"+strconv.FormatInt(ref.TenantID, 10))
+		} else {
+			values = append(values, strconv.FormatInt(ref.TenantID, 10))
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+// Contains returns whether the tenant with the specified global ID is in
+// the list.
+func (val TenantList) Contains(tenantID model.GlobalID) bool {
+	localID, regionID := model.GetLocalAndRegionIDs(tenantID)
+
+	return slices.ContainsFunc(val, func(ref TenantRef) bool {
+		return ref.TenantID == localID && (ref.RegionID == 0 || ref.RegionID == regionID)
+	})
+}
+
+// LayeredOpts configures a layered secret provider.
+type LayeredOpts struct {
+	// Backends are the local backends, consulted in order.
+	Backends []Backend
+	// Tenants are the only tenants allowed to use Backends. Local
+	// backends are shared by every tenant running checks on this
+	// probe, so they are never consulted for other tenants, whose
+	// secrets come from Remote only.
+	Tenants TenantList
+	// Remote is the Grafana Secrets Manager provider. It can be nil,
+	// in which case only the local backends are used.
+	Remote SecretProvider
+	// ProtocolSecrets enables secrets in protocol checks when Remote
+	// is nil. Otherwise Remote decides, based on the probe
+	// capabilities reported by the API.
+	ProtocolSecrets bool
+}
+
+// layeredProvider resolves secrets from local backends, in order, falling
+// back to the remote provider (Grafana Secrets Manager) for secrets that
+// none of them have.
+type layeredProvider struct {
+	backends        []Backend
+	tenants         TenantList
+	remote          SecretProvider
+	protocolSecrets bool
+	logger          zerolog.Logger
+}
+
+// NewLayeredSecretProvider creates a SecretProvider that looks up secret
+// values in each of the local backends in order, and then in the remote
+// provider.
+//
+// The local backends hold the secrets of the probe operator, not of the
+// tenants running checks on the probe, so only the tenants in
+// opts.Tenants can use them. For every other tenant, secrets are looked
+// up in the remote provider only.
+//
+// Only a backend reporting that the secret does not exist moves the lookup
+// to the next one; any other error is returned to the caller, so that an
+// unreachable backend never causes a different value to be used.
+//
+// Secret store credentials, used by k6-backed checks, are always obtained
+// from the remote provider.
+func NewLayeredSecretProvider(opts LayeredOpts, logger zerolog.Logger) SecretProvider {
+	return &layeredProvider{
+		backends:        opts.Backends,
+		tenants:         opts.Tenants,
+		remote:          opts.Remote,
+		protocolSecrets: opts.ProtocolSecrets,
+		logger:          logger.With().Str("component", "secret-layers").Logger(),
+	}
+}
+
+func (lp *layeredProvider) GetSecretCredentials(ctx context.Context, tenantID model.GlobalID) (*sm.SecretStore, error) {
+	if lp.remote == nil {
+		return nil, nil
+	}
+
+	return lp.remote.GetSecretCredentials(ctx, tenantID)
+}
+
+func (lp *layeredProvider) GetSecretValue(ctx context.Context, tenantID model.GlobalID, secretKey string) (string, error) {
+	value, found, err := lp.getLocalValue(ctx, tenantID, secretKey)
+	if err != nil || found {
+		return value, err
+	}
+
+	if lp.remote == nil {
+		return "", fmt.Errorf("%w: '%s'", ErrSecretNotFound, secretKey)
+	}
+
+	return lp.remote.GetSecretValue(ctx, tenantID, secretKey)
+}
+
+// GetSecretValues resolves each secret from the local backends, and the
+// ones that none of them have from remote in a single batch.
+func (lp *layeredProvider) GetSecretValues(ctx context.Context, tenantID model.GlobalID, secretKeys []string) (map[string]string, error) {
+	var (
+		values    = make(map[string]string, len(secretKeys))
+		errs      []error
+		remaining []string
+	)
+
+	for _, secretKey := range uniqueKeys(secretKeys) {
+		value, found, err := lp.getLocalValue(ctx, tenantID, secretKey)
+
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+
+		case found:
+			values[secretKey] = value
+
+		case lp.remote == nil:
+			errs = append(errs, fmt.Errorf("%w: '%s'", ErrSecretNotFound, secretKey))
+
+		default:
+			remaining = append(remaining, secretKey)
+		}
+	}
+
+	if len(remaining) > 0 {
+		remoteValues, err := GetSecretValues(ctx, lp.remote, tenantID, remaining)
+		maps.Copy(values, remoteValues)
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// getLocalValue looks up the secret in the local backends, in order, if
+// the tenant is allowed to use them.
+func (lp *layeredProvider) getLocalValue(ctx context.Context, tenantID model.GlobalID, secretKey string) (string, bool, error) {
+	if len(lp.backends) == 0 || !lp.tenants.Contains(tenantID) {
+		return "", false, nil
+	}
+
+	for _, backend := range lp.backends {
+		value, err := backend.GetSecretValue(ctx, tenantID, secretKey)
+		switch {
+		case err == nil:
+			lp.logger.Debug().
+				Int64("tenantId", int64(tenantID)).
+				Str("secretKey", secretKey).
+				Str("backend", backend.Name()).
+				Msg("secret resolved")
+
+			return value, true, nil
+
+		case errors.Is(err, ErrSecretNotFound):
+			continue
+
+		default:
+			return "", false, fmt.Errorf("%s secret backend: %w", backend.Name(), err)
+		}
+	}
+
+	return "", false, nil
+}
+
+func (lp *layeredProvider) IsProtocolSecretsEnabled() bool {
+	if lp.remote == nil {
+		return lp.protocolSecrets
+	}
+
+	return lp.remote.IsProtocolSecretsEnabled()
+}
@@ -0,0 +1,193 @@
+package secrets
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+func TestBackendKindsSet(t *testing.T) {
+	var val BackendKinds
+
+	require.NoError(t, val.Set("files, vault,gsm"))
+	require.Equal(t, BackendKinds{BackendFiles, BackendVault, BackendGSM}, val)
+	require.Equal(t, "files,vault,gsm", val.String())
+	require.ErrorIs(t, val.Set("env,aws"), ErrUnsupportedBackend)
+	require.ErrorIs(t, val.Set("env,env"), ErrDuplicateBackend)
+	require.Equal(t, BackendKinds{BackendFiles, BackendVault, BackendGSM}, val)
+}
+
+func TestTenantList(t *testing.T) {
+	var val TenantList
+
+	require.NoError(t, val.Set("1000, 2:2000,"))
+	require.Equal(t, TenantList{{TenantID: 1000}, {RegionID: 2, TenantID: 2000}}, val)
+	require.Equal(t, "1000,2:2000", val.String())
+
+	for _, s := range []string{"a", "-1", "0:1000", "x:1000", "2:"} {
+		require.ErrorIs(t, val.Set(s), ErrInvalidTenant, s)
+	}
+
+	require.Equal(t, TenantList{{TenantID: 1000}, {RegionID: 2, TenantID: 2000}}, val)
+
+	globalID := func(localID int64, regionID int) model.GlobalID {
+		id, err := sm.LocalIDToGlobalID(localID, regionID)
+		require.NoError(t, err)
+
+		return model.GlobalID(id)
+	}
+
+	require.True(t, val.Contains(1000))
+	require.True(t, val.Contains(globalID(1000, 3)))
+	require.True(t, val.Contains(globalID(2000, 2)))
+	require.False(t, val.Contains(globalID(2000, 3)))
+	require.False(t, val.Contains(2000))
+	require.False(t, val.Contains(3000))
+}
+
+type mapBackend map[string]string
+
+func (b mapBackend) Name() string {
+	return "map"
+}
+
+func (b mapBackend) GetSecretValue(_ context.Context, _ model.GlobalID, secretKey string) (string, error) {
+	if value, found := b[secretKey]; found {
+		return value, nil
+	}
+
+	return "", ErrSecretNotFound
+}
+
+type errorBackend struct{}
+
+func (errorBackend) Name() string {
+	return "error"
+}
+
+func (errorBackend) GetSecretValue(context.Context, model.GlobalID, string) (string, error) {
+	return "", assert.AnError
+}
+
+type remoteProvider struct {
+	mapBackend
+}
+
+func (p remoteProvider) GetSecretCredentials(context.Context, model.GlobalID) (*sm.SecretStore, error) {
+	return &sm.SecretStore{Url: "https://gsm.example.com", Token: "token"}, nil
+}
+
+func (p remoteProvider) IsProtocolSecretsEnabled() bool {
+	return true
+}
+
+func TestLayeredSecretProvider(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.New(io.Discard)
+
+	local := []Backend{
+		mapBackend{"a": "local a"},
+		mapBackend{"a": "shadowed a", "b": "local b"},
+	}
+	remote := remoteProvider{mapBackend{"a": "remote a", "c": "remote c"}}
+
+	provider := NewLayeredSecretProvider(LayeredOpts{Backends: local, Tenants: TenantList{{TenantID: 1000}}, Remote: remote}, logger)
+
+	for key, expected := range map[string]string{"a": "local a", "b": "local b", "c": "remote c"} {
+		value, err := provider.GetSecretValue(ctx, 1000, key)
+		require.NoError(t, err)
+		require.Equal(t, expected, value)
+	}
+
+	_, err := provider.GetSecretValue(ctx, 1000, "d")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+
+	// Other tenants don't see the local secrets.
+	for key, expected := range map[string]string{"a": "remote a", "c": "remote c"} {
+		value, err := provider.GetSecretValue(ctx, 2000, key)
+		require.NoError(t, err)
+		require.Equal(t, expected, value)
+	}
+
+	_, err = provider.GetSecretValue(ctx, 2000, "b")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+
+	store, err := provider.GetSecretCredentials(ctx, 1000)
+	require.NoError(t, err)
+	require.Equal(t, "https://gsm.example.com", store.Url)
+
+	// Without the remote provider, there are no secret store
+	// credentials.
+	provider = NewLayeredSecretProvider(LayeredOpts{Backends: local, Tenants: TenantList{{TenantID: 1000}}}, logger)
+
+	_, err = provider.GetSecretValue(ctx, 1000, "c")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+
+	store, err = provider.GetSecretCredentials(ctx, 1000)
+	require.NoError(t, err)
+	require.Nil(t, store)
+
+	// Nor is it the one deciding whether protocol secrets are enabled.
+	require.False(t, provider.IsProtocolSecretsEnabled())
+
+	provider = NewLayeredSecretProvider(LayeredOpts{Backends: local, Tenants: TenantList{{TenantID: 1000}}, ProtocolSecrets: true}, logger)
+	require.True(t, provider.IsProtocolSecretsEnabled())
+
+	// Errors other than not found stop the lookup.
+	provider = NewLayeredSecretProvider(LayeredOpts{Backends: []Backend{errorBackend{}}, Tenants: TenantList{{TenantID: 1000}}, Remote: remote}, logger)
+
+	_, err = provider.GetSecretValue(ctx, 1000, "a")
+	require.ErrorIs(t, err, assert.AnError)
+}
+
+func TestEnvBackend(t *testing.T) {
+	b := NewEnvBackend(DefaultEnvPrefix)
+	t.Setenv("SM_SECRET_API_TOKEN", "s3cr3t")
+	t.Setenv("SM_SECRET_EMPTY", "")
+
+	value, err := b.GetSecretValue(context.Background(), 1000, "api-token")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", value)
+
+	value, err = b.GetSecretValue(context.Background(), 1000, "empty")
+	require.NoError(t, err)
+	require.Empty(t, value)
+
+	_, err = b.GetSecretValue(context.Background(), 1000, "missing")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+func TestFilesBackend(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api-token"), []byte("s3cr3t\n"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "db"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db", "password"), []byte("hunter2"), 0o600))
+
+	b, err := NewFilesBackend(dir)
+	require.NoError(t, err)
+
+	value, err := b.GetSecretValue(context.Background(), 1000, "api-token")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", value)
+
+	value, err = b.GetSecretValue(context.Background(), 1000, "db/password")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+
+	for _, key := range []string{"missing", "../api-token", "/etc/passwd", ".", ""} {
+		_, err = b.GetSecretValue(context.Background(), 1000, key)
+		require.ErrorIs(t, err, ErrSecretNotFound, key)
+	}
+
+	_, err = NewFilesBackend(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
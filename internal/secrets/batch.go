@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+)
+
+const (
+	// DefaultNegativeCacheTTL is how long secrets that GSM reported as
+	// missing or inaccessible are remembered, so that they are not
+	// requested again on every check execution.
+	DefaultNegativeCacheTTL = 15 * time.Second
+
+	maxConcurrentSecretFetches = 4
+)
+
+// BatchSecretProvider is implemented by secret providers that can resolve
+// several secrets of a tenant more efficiently than one at a time.
+type BatchSecretProvider interface {
+	// GetSecretValues returns the values of the secrets that could be
+	// resolved, keyed by name, and an error joining the failures for
+	// the rest.
+	GetSecretValues(ctx context.Context, tenantID model.GlobalID, secretKeys []string) (map[string]string, error)
+}
+
+// GetSecretValues resolves several secrets of a tenant, in a single batch
+// if provider supports it, and one at a time otherwise. As with
+// BatchSecretProvider, the values that could be resolved are returned even
+// if some of them failed.
+func GetSecretValues(ctx context.Context, provider SecretProvider, tenantID model.GlobalID, secretKeys []string) (map[string]string, error) {
+	if bp, ok := provider.(BatchSecretProvider); ok {
+		return bp.GetSecretValues(ctx, tenantID, secretKeys)
+	}
+
+	var (
+		values = make(map[string]string, len(secretKeys))
+		errs   []error
+	)
+
+	for _, secretKey := range uniqueKeys(secretKeys) {
+		value, err := provider.GetSecretValue(ctx, tenantID, secretKey)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		values[secretKey] = value
+	}
+
+	return values, errors.Join(errs...)
+}
+
+// uniqueKeys returns the distinct keys, in their original order.
+func uniqueKeys(keys []string) []string {
+	unique := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if !slices.Contains(unique, key) {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
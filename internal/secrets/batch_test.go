@@ -0,0 +1,213 @@
+package secrets
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+type countingTenantProvider struct {
+	mutex    sync.Mutex
+	requests int
+	token    string
+}
+
+func (p *countingTenantProvider) GetTenant(context.Context, *sm.TenantInfo) (*sm.Tenant, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.requests++
+
+	return &sm.Tenant{
+		Id:          123,
+		SecretStore: &sm.SecretStore{Url: "https://gsm.example.com", Token: cmp.Or(p.token, "token")},
+	}, nil
+}
+
+// fakeGSM returns a gsmFetchFunc serving the given values, and a function
+// returning how many times each secret has been fetched. Secrets without
+// a value are reported with the given status code.
+func fakeGSM(values map[string]string, statusCodes map[string]int) (gsmFetchFunc, func(string) int) {
+	var (
+		mutex   sync.Mutex
+		fetches = make(map[string]int)
+	)
+
+	fetch := func(_ context.Context, _ *sm.SecretStore, secretKey string) (string, int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		fetches[secretKey]++
+
+		if value, found := values[secretKey]; found {
+			return value, http.StatusOK, nil
+		}
+
+		if statusCode, found := statusCodes[secretKey]; found {
+			return "", statusCode, nil
+		}
+
+		return "", http.StatusNotFound, nil
+	}
+
+	count := func(secretKey string) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return fetches[secretKey]
+	}
+
+	return fetch, count
+}
+
+func TestSecretProviderGetSecretValues(t *testing.T) {
+	ctx := context.Background()
+	tp := &countingTenantProvider{}
+
+	sp := newSecretProvider(tp, time.Minute, zerolog.New(io.Discard), false)
+	fetch, fetches := fakeGSM(
+		map[string]string{"a": "value a", "b": "value b", "c": "value c"},
+		map[string]int{"unavailable": http.StatusServiceUnavailable},
+	)
+	sp.fetch = fetch
+
+	keys := []string{"a", "b", "c", "missing", "unavailable", "a"}
+
+	values, err := sp.GetSecretValues(ctx, 123, keys)
+	require.Error(t, err)
+	require.ErrorContains(t, err, "'missing' not found")
+	require.ErrorContains(t, err, "status 503")
+	require.Equal(t, map[string]string{"a": "value a", "b": "value b", "c": "value c"}, values)
+
+	// Credentials are obtained once for the whole batch, and each
+	// secret is fetched once.
+	require.Equal(t, 1, tp.requests)
+
+	for _, key := range keys {
+		require.Equal(t, 1, fetches(key), key)
+	}
+
+	// Successes and not found errors are cached, other errors are not.
+	values, err = sp.GetSecretValues(ctx, 123, keys)
+	require.Error(t, err)
+	require.Len(t, values, 3)
+	require.Equal(t, 2, tp.requests)
+	require.Equal(t, 1, fetches("a"))
+	require.Equal(t, 1, fetches("missing"))
+	require.Equal(t, 2, fetches("unavailable"))
+
+	value, err := sp.GetSecretValue(ctx, 123, "b")
+	require.NoError(t, err)
+	require.Equal(t, "value b", value)
+
+	_, err = sp.GetSecretValue(ctx, 123, "missing")
+	require.ErrorContains(t, err, "'missing' not found")
+	require.Equal(t, 1, fetches("missing"))
+	require.Equal(t, 2, tp.requests)
+
+	// Cached values don't require credentials at all.
+	values, err = sp.GetSecretValues(ctx, 123, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	require.Equal(t, 2, tp.requests)
+}
+
+func TestSecretProviderNegativeCache(t *testing.T) {
+	ctx := context.Background()
+
+	sp := newSecretProvider(&countingTenantProvider{}, time.Minute, zerolog.New(io.Discard), false)
+	sp.negativeCache = cache.New(50*time.Millisecond, time.Minute)
+
+	values := map[string]string{}
+	fetch, fetches := fakeGSM(values, map[string]int{"forbidden": http.StatusUnauthorized})
+	sp.fetch = fetch
+
+	for range 3 {
+		_, err := sp.GetSecretValue(ctx, 123, "secret")
+		require.ErrorContains(t, err, "not found in GSM (404)")
+
+		_, err = sp.GetSecretValue(ctx, 123, "forbidden")
+		require.ErrorContains(t, err, "unauthorized")
+	}
+
+	require.Equal(t, 1, fetches("secret"))
+	require.Equal(t, 1, fetches("forbidden"))
+
+	// Unauthorized errors are only remembered for the credentials that
+	// caused them, so they are forgotten once the token is rotated.
+	rotated := &countingTenantProvider{token: "rotated"}
+	sp.tenantProvider = rotated
+
+	_, err := sp.GetSecretValue(ctx, 123, "forbidden")
+	require.ErrorContains(t, err, "unauthorized")
+	require.Equal(t, 2, fetches("forbidden"))
+	require.Equal(t, 1, rotated.requests)
+
+	_, err = sp.GetSecretValue(ctx, 123, "forbidden")
+	require.ErrorContains(t, err, "unauthorized")
+	require.Equal(t, 2, fetches("forbidden"))
+
+	// Once the negative entry expires, the secret is requested again.
+	values["secret"] = "created"
+
+	time.Sleep(100 * time.Millisecond)
+
+	value, err := sp.GetSecretValue(ctx, 123, "secret")
+	require.NoError(t, err)
+	require.Equal(t, "created", value)
+	require.Equal(t, 2, fetches("secret"))
+}
+
+// batchRemoteProvider is a remoteProvider that records the batches it's
+// asked to resolve.
+type batchRemoteProvider struct {
+	remoteProvider
+	batches [][]string
+}
+
+func (p *batchRemoteProvider) GetSecretValues(ctx context.Context, tenantID model.GlobalID, secretKeys []string) (map[string]string, error) {
+	p.batches = append(p.batches, secretKeys)
+
+	return GetSecretValues(ctx, p.remoteProvider, tenantID, secretKeys)
+}
+
+func TestGetSecretValues(t *testing.T) {
+	ctx := context.Background()
+	logger := zerolog.New(io.Discard)
+
+	// Providers without batch support are asked for each secret.
+	remote := remoteProvider{mapBackend{"a": "remote a", "b": "remote b"}}
+
+	values, err := GetSecretValues(ctx, remote, 1000, []string{"a", "b", "c"})
+	require.ErrorIs(t, err, ErrSecretNotFound)
+	require.Equal(t, map[string]string{"a": "remote a", "b": "remote b"}, values)
+
+	// The layered provider resolves local secrets itself, and sends
+	// the rest to the remote provider in a single batch.
+	batchRemote := &batchRemoteProvider{remoteProvider: remote}
+	provider := NewLayeredSecretProvider(LayeredOpts{Backends: []Backend{mapBackend{"a": "local a"}}, Tenants: TenantList{{TenantID: 1000}}, Remote: batchRemote}, logger)
+
+	values, err = GetSecretValues(ctx, provider, 1000, []string{"a", "b", "c", "b"})
+	require.ErrorIs(t, err, ErrSecretNotFound)
+	require.Equal(t, map[string]string{"a": "local a", "b": "remote b"}, values)
+	require.Equal(t, [][]string{{"b", "c"}}, batchRemote.batches)
+
+	// Errors from local backends are reported for the affected secret
+	// only.
+	provider = NewLayeredSecretProvider(LayeredOpts{Backends: []Backend{errorBackend{}}, Tenants: TenantList{{TenantID: 1000}}}, logger)
+
+	values, err = GetSecretValues(ctx, provider, 1000, []string{"a"})
+	require.Error(t, err)
+	require.Empty(t, values)
+}
@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables holding
+// secrets, unless configured otherwise.
+const DefaultEnvPrefix = "SM_SECRET_"
+
+// envBackend resolves secrets from environment variables.
+type envBackend struct {
+	prefix    string
+	lookupEnv func(string) (string, bool)
+}
+
+// NewEnvBackend creates a Backend that resolves the secret named name from
+// the environment variable formed by prefix followed by name in uppercase,
+// with every character other than letters, digits and underscores replaced
+// by an underscore. For example, with the default prefix the secret
+// "api-token" is read from SM_SECRET_API_TOKEN.
+func NewEnvBackend(prefix string) Backend {
+	return &envBackend{
+		prefix:    prefix,
+		lookupEnv: os.LookupEnv,
+	}
+}
+
+func (b *envBackend) Name() string {
+	return string(BackendEnv)
+}
+
+func (b *envBackend) GetSecretValue(_ context.Context, _ model.GlobalID, secretKey string) (string, error) {
+	name := b.variableName(secretKey)
+
+	value, found := b.lookupEnv(name)
+	if !found {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrSecretNotFound, name)
+	}
+
+	return value, nil
+}
+
+func (b *envBackend) variableName(secretKey string) string {
+	var sb strings.Builder
+
+	sb.Grow(len(b.prefix) + len(secretKey))
+	sb.WriteString(b.prefix)
+
+	for _, r := range strings.ToUpper(secretKey) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+
+		default:
+			sb.WriteByte('_')
+		}
+	}
+
+	return sb.String()
+}
+
+// filesBackend resolves secrets from the files in a directory.
+type filesBackend struct {
+	fsys fs.FS
+}
+
+// NewFilesBackend creates a Backend that resolves the secret named name
+// from the file with the same name in dir, like the ones created by
+// mounting a Kubernetes secret as a volume. Names can refer to files in
+// subdirectories, but never outside of dir. A single trailing newline is
+// removed from the contents.
+//
+// Files are read on each lookup, so that updates to them are picked up
+// right away.
+func NewFilesBackend(dir string) (Backend, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("secrets directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("secrets directory: %s is not a directory", dir)
+	}
+
+	return &filesBackend{fsys: os.DirFS(dir)}, nil
+}
+
+func (b *filesBackend) Name() string {
+	return string(BackendFiles)
+}
+
+func (b *filesBackend) GetSecretValue(_ context.Context, _ model.GlobalID, secretKey string) (string, error) {
+	if !fs.ValidPath(secretKey) || secretKey == "." {
+		return "", fmt.Errorf("%w: '%s' is not a valid file name", ErrSecretNotFound, secretKey)
+	}
+
+	data, err := fs.ReadFile(b.fsys, secretKey)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("%w: no file for secret '%s'", ErrSecretNotFound, secretKey)
+
+	case err != nil:
+		return "", err
+	}
+
+	value := strings.TrimSuffix(string(data), "\n")
+	value = strings.TrimSuffix(value, "\r")
+
+	return value, nil
+}
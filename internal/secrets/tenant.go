@@ -2,8 +2,11 @@ package secrets
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -97,27 +100,21 @@ func (ts *TenantSecrets) UpdateCapabilities(probeCapabilities *sm.Probe_Capabili
 type secretProvider struct {
 	tenantProvider        TenantProvider
 	cache                 *cache.Cache
+	negativeCache         *cache.Cache
 	logger                zerolog.Logger
 	enableProtocolSecrets bool
 	gsmClientFactory      *GSMClientFactory
+	fetch                 gsmFetchFunc
 }
 
+// gsmFetchFunc retrieves the value of a secret from the given secret
+// store. It returns the HTTP status code of the response, or an error if
+// no response was obtained.
+type gsmFetchFunc func(ctx context.Context, secretStore *sm.SecretStore, secretKey string) (string, int, error)
+
 // NewSecretProvider creates a new secret provider
 func NewSecretProvider(tenantProvider TenantProvider, ttl time.Duration, logger zerolog.Logger) SecretProvider {
-	// go-cache handles cleanup automatically, so we don't need manual cleanup
-	// The cleanup interval is set to ttl/10 to ensure expired items are cleaned up reasonably quickly
-	cleanupInterval := ttl / 10
-	if cleanupInterval < time.Minute {
-		cleanupInterval = time.Minute
-	}
-
-	return &secretProvider{
-		tenantProvider:        tenantProvider,
-		cache:                 cache.New(ttl, cleanupInterval),
-		logger:                logger.With().Str("component", "secret-cache").Logger(),
-		enableProtocolSecrets: false, // Default to false
-		gsmClientFactory:      NewGSMClientFactory(),
-	}
+	return newSecretProvider(tenantProvider, ttl, logger, false) // Default to false
 }
 
 // NewSecretProviderWithCapabilities creates a new secret provider with probe capabilities
@@ -127,6 +124,10 @@ func NewSecretProviderWithCapabilities(tenantProvider TenantProvider, ttl time.D
 		enableProtocolSecrets = probeCapabilities.EnableProtocolSecrets
 	}
 
+	return newSecretProvider(tenantProvider, ttl, logger, enableProtocolSecrets)
+}
+
+func newSecretProvider(tenantProvider TenantProvider, ttl time.Duration, logger zerolog.Logger, enableProtocolSecrets bool) *secretProvider {
 	// go-cache handles cleanup automatically, so we don't need manual cleanup
 	// The cleanup interval is set to ttl/10 to ensure expired items are cleaned up reasonably quickly
 	cleanupInterval := ttl / 10
@@ -134,19 +135,25 @@ func NewSecretProviderWithCapabilities(tenantProvider TenantProvider, ttl time.D
 		cleanupInterval = time.Minute
 	}
 
-	return &secretProvider{
+	sp := &secretProvider{
 		tenantProvider:        tenantProvider,
 		cache:                 cache.New(ttl, cleanupInterval),
+		negativeCache:         cache.New(DefaultNegativeCacheTTL, time.Minute),
 		logger:                logger.With().Str("component", "secret-cache").Logger(),
 		enableProtocolSecrets: enableProtocolSecrets,
 		gsmClientFactory:      NewGSMClientFactory(),
 	}
+
+	sp.fetch = sp.fetchFromGSM
+
+	return sp
 }
 
 // Close gracefully shuts down the secret provider
 func (sp *secretProvider) Close() {
 	// go-cache doesn't require explicit cleanup, but we can flush the cache
 	sp.cache.Flush()
+	sp.negativeCache.Flush()
 }
 
 // cacheKey creates a unique key for tenant+secret combination
@@ -154,6 +161,15 @@ func (sp *secretProvider) cacheKey(tenantID model.GlobalID, secretKey string) st
 	return fmt.Sprintf("%d:%s", tenantID, secretKey)
 }
 
+// unauthorizedKey creates the negative cache key for a secret that GSM
+// refused to decrypt with the given credentials. It includes a digest of
+// the token, so the error is forgotten as soon as the token is rotated.
+func (sp *secretProvider) unauthorizedKey(tenantID model.GlobalID, secretStore *sm.SecretStore, secretKey string) string {
+	digest := sha256.Sum256([]byte(secretStore.Token))
+
+	return fmt.Sprintf("%d:%s:%x", tenantID, secretKey, digest[:8])
+}
+
 // GetSecretCredentials gets the secret store configuration for a tenant
 func (sp *secretProvider) GetSecretCredentials(ctx context.Context, tenantID model.GlobalID) (*sm.SecretStore, error) {
 	if sp.logger.GetLevel() <= zerolog.DebugLevel {
@@ -174,16 +190,114 @@ func (sp *secretProvider) GetSecretCredentials(ctx context.Context, tenantID mod
 
 // GetSecretValue implements caching with intelligent GSM response handling
 func (sp *secretProvider) GetSecretValue(ctx context.Context, tenantID model.GlobalID, secretKey string) (string, error) {
+	if value, err, found := sp.cached(tenantID, secretKey); found {
+		return value, err
+	}
+
+	if sp.logger.GetLevel() <= zerolog.DebugLevel {
+		tenantID, regionID := model.GetLocalAndRegionIDs(tenantID)
+		sp.logger.Debug().Int("regionID", regionID).Int64("tenantId", tenantID).Str("secretKey", secretKey).Msg("getting secret value")
+	}
+
+	secretStore, err := sp.secretStore(ctx, tenantID)
+	if err != nil {
+		return "", err
+	}
+
+	return sp.fetchAndCache(ctx, tenantID, secretStore, secretKey)
+}
+
+// GetSecretValues resolves several secrets of the same tenant. The secret
+// store credentials are obtained once, and the secrets missing from the
+// cache are fetched concurrently, as GSM doesn't provide a way to decrypt
+// several secrets in a single request.
+func (sp *secretProvider) GetSecretValues(ctx context.Context, tenantID model.GlobalID, secretKeys []string) (map[string]string, error) {
+	var (
+		values  = make(map[string]string, len(secretKeys))
+		errs    []error
+		missing []string
+	)
+
+	for _, secretKey := range uniqueKeys(secretKeys) {
+		value, err, found := sp.cached(tenantID, secretKey)
+
+		switch {
+		case !found:
+			missing = append(missing, secretKey)
+
+		case err != nil:
+			errs = append(errs, err)
+
+		default:
+			values[secretKey] = value
+		}
+	}
+
+	if len(missing) == 0 {
+		return values, errors.Join(errs...)
+	}
+
+	secretStore, err := sp.secretStore(ctx, tenantID)
+	if err != nil {
+		return values, errors.Join(append(errs, err)...)
+	}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, maxConcurrentSecretFetches)
+	)
+
+	for _, secretKey := range missing {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			value, err := sp.fetchAndCache(ctx, tenantID, secretStore, secretKey)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+
+			values[secretKey] = value
+		}()
+	}
+
+	wg.Wait()
+
+	return values, errors.Join(errs...)
+}
+
+// cached returns the cached value of the secret, or the error cached for
+// it if it recently could not be retrieved.
+func (sp *secretProvider) cached(tenantID model.GlobalID, secretKey string) (string, error, bool) {
 	cacheKey := sp.cacheKey(tenantID, secretKey)
 
-	// Check cache first
 	if cachedValue, found := sp.cache.Get(cacheKey); found {
 		sp.logger.Debug().
 			Int64("tenantId", int64(tenantID)).
 			Str("secretKey", secretKey).
 			Msg("secret cache hit")
 
-		return cachedValue.(string), nil
+		return cachedValue.(string), nil, true
+	}
+
+	if cachedErr, found := sp.negativeCache.Get(cacheKey); found {
+		sp.logger.Debug().
+			Int64("tenantId", int64(tenantID)).
+			Str("secretKey", secretKey).
+			Msg("secret negative cache hit")
+
+		return "", cachedErr.(error), true
 	}
 
 	sp.logger.Debug().
@@ -191,50 +305,56 @@ func (sp *secretProvider) GetSecretValue(ctx context.Context, tenantID model.Glo
 		Str("secretKey", secretKey).
 		Msg("secret cache miss, fetching from GSM")
 
-	if sp.logger.GetLevel() <= zerolog.DebugLevel {
-		tenantID, regionID := model.GetLocalAndRegionIDs(tenantID)
-		sp.logger.Debug().Int("regionID", regionID).Int64("tenantId", tenantID).Str("secretKey", secretKey).Msg("getting secret value")
-	}
+	return "", nil, false
+}
 
-	// Get the secret store configuration for this tenant
+// secretStore returns the secret store configuration for the tenant.
+func (sp *secretProvider) secretStore(ctx context.Context, tenantID model.GlobalID) (*sm.SecretStore, error) {
 	secretStore, err := sp.GetSecretCredentials(ctx, tenantID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get secret store credentials: %w", err)
+		return nil, fmt.Errorf("failed to get secret store credentials: %w", err)
 	}
 
 	if secretStore == nil {
-		return "", fmt.Errorf("no secret store configured for tenant %d", tenantID)
+		return nil, fmt.Errorf("no secret store configured for tenant %d", tenantID)
 	}
 
-	// Create GSM client
-	client, err := sp.gsmClientFactory.CreateClient(secretStore.Url, secretStore.Token)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GSM client: %w", err)
+	return secretStore, nil
+}
+
+// fetchAndCache fetches the secret from GSM and updates the caches
+// according to the response.
+func (sp *secretProvider) fetchAndCache(ctx context.Context, tenantID model.GlobalID, secretStore *sm.SecretStore, secretKey string) (string, error) {
+	cacheKey := sp.cacheKey(tenantID, secretKey)
+	unauthorizedKey := sp.unauthorizedKey(tenantID, secretStore, secretKey)
+
+	if cachedErr, found := sp.negativeCache.Get(unauthorizedKey); found {
+		sp.logger.Debug().
+			Int64("tenantId", int64(tenantID)).
+			Str("secretKey", secretKey).
+			Msg("secret negative cache hit for these credentials")
+
+		return "", cachedErr.(error)
 	}
 
-	// Get the decrypted secret value
-	resp, err := client.DecryptSecretByIdWithResponse(ctx, secretKey)
+	secretValue, statusCode, err := sp.fetch(ctx, secretStore, secretKey)
 	if err != nil {
 		// Network error or client error - leave cache unchanged
 		sp.logger.Warn().
 			Err(err).
 			Int64("tenantId", int64(tenantID)).
 			Str("secretKey", secretKey).
-			Msg("network error fetching secret, leaving cache unchanged")
+			Msg("error fetching secret, leaving cache unchanged")
 
-		return "", fmt.Errorf("failed to contact GSM for secret '%s': %w", secretKey, err)
+		return "", err
 	}
 
 	// Handle different status codes
-	switch resp.StatusCode() {
+	switch statusCode {
 	case http.StatusOK:
 		// Success - update cache and return value
-		if resp.JSON200 == nil {
-			return "", fmt.Errorf("empty response from GSM for secret %s", secretKey)
-		}
-
-		secretValue := resp.JSON200.Plaintext
 		sp.cache.Set(cacheKey, secretValue, cache.DefaultExpiration)
+		sp.negativeCache.Delete(cacheKey)
 
 		sp.logger.Debug().
 			Int64("tenantId", int64(tenantID)).
@@ -244,31 +364,37 @@ func (sp *secretProvider) GetSecretValue(ctx context.Context, tenantID model.Glo
 		return secretValue, nil
 
 	case http.StatusNotFound:
-		// Secret not found - remove from cache
+		// Secret not found - remove from cache, and remember the
+		// failure for a little while so that every execution
+		// doesn't hit GSM again.
+		err := fmt.Errorf("secret '%s' not found in GSM (404)", secretKey)
 		sp.cache.Delete(cacheKey)
+		sp.negativeCache.Set(cacheKey, err, cache.DefaultExpiration)
 
 		sp.logger.Warn().
 			Int64("tenantId", int64(tenantID)).
 			Str("secretKey", secretKey).
 			Msg("secret not found in GSM, removed from cache")
 
-		return "", fmt.Errorf("secret '%s' not found in GSM (404)", secretKey)
+		return "", err
 
 	case http.StatusUnauthorized:
-		// Auth issue - remove from cache (credentials may have changed)
+		// Auth issue - remove from cache (credentials may have
+		// changed), and remember the failure for these
+		// credentials only.
+		err := fmt.Errorf("unauthorized to access secret '%s' in GSM (401)", secretKey)
 		sp.cache.Delete(cacheKey)
+		sp.negativeCache.Set(unauthorizedKey, err, cache.DefaultExpiration)
 
 		sp.logger.Warn().
 			Int64("tenantId", int64(tenantID)).
 			Str("secretKey", secretKey).
 			Msg("unauthorized accessing secret in GSM, removed from cache")
 
-		return "", fmt.Errorf("unauthorized to access secret '%s' in GSM (401)", secretKey)
+		return "", err
 
 	default:
 		// 5xx or other errors - leave cache unchanged
-		statusCode := resp.StatusCode()
-
 		sp.logger.Warn().
 			Int("statusCode", statusCode).
 			Int64("tenantId", int64(tenantID)).
@@ -279,6 +405,29 @@ func (sp *secretProvider) GetSecretValue(ctx context.Context, tenantID model.Glo
 	}
 }
 
+// fetchFromGSM is the gsmFetchFunc that decrypts secrets using the GSM API.
+func (sp *secretProvider) fetchFromGSM(ctx context.Context, secretStore *sm.SecretStore, secretKey string) (string, int, error) {
+	client, err := sp.gsmClientFactory.CreateClient(secretStore.Url, secretStore.Token)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create GSM client: %w", err)
+	}
+
+	resp, err := client.DecryptSecretByIdWithResponse(ctx, secretKey)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to contact GSM for secret '%s': %w", secretKey, err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return "", resp.StatusCode(), nil
+	}
+
+	if resp.JSON200 == nil {
+		return "", 0, fmt.Errorf("empty response from GSM for secret %s", secretKey)
+	}
+
+	return resp.JSON200.Plaintext, http.StatusOK, nil
+}
+
 // IsProtocolSecretsEnabled returns whether protocol secrets are enabled for this probe
 func (sp *secretProvider) IsProtocolSecretsEnabled() bool {
 	return sp.enableProtocolSecrets
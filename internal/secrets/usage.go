@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// RedactedValue replaces secret values in check logs.
+const RedactedValue = "<redacted>"
+
+type usageKey struct{}
+
+// Usage records the secrets resolved during a single check execution, so
+// that their values can be removed from the logs produced by it. It also
+// emits an audit event for every resolution, identifying the secret but
+// never including its value.
+//
+// The nil value is valid and records nothing.
+type Usage struct {
+	checkID     int64
+	executionID string
+	logger      zerolog.Logger
+
+	mutex  sync.Mutex
+	values []string
+}
+
+// NewUsage creates a Usage for the execution executionID of the check
+// checkID. Audit events are sent to logger.
+func NewUsage(checkID int64, executionID string, logger zerolog.Logger) *Usage {
+	return &Usage{
+		checkID:     checkID,
+		executionID: executionID,
+		logger:      logger.With().Str("component", "secret-audit").Logger(),
+	}
+}
+
+// WithUsage returns a copy of ctx carrying u.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// UsageFromContext returns the Usage carried by ctx, or nil if there's
+// none.
+func UsageFromContext(ctx context.Context) *Usage {
+	u, _ := ctx.Value(usageKey{}).(*Usage)
+	return u
+}
+
+// Record registers that the secret name resolved to value.
+func (u *Usage) Record(name, value string) {
+	if u == nil {
+		return
+	}
+
+	// The audit event must be emitted regardless of the log level, so
+	// it doesn't have one.
+	u.logger.Log().
+		Str("event", "secret_resolved").
+		Str("secretName", name).
+		Int64("checkId", u.checkID).
+		Str("executionId", u.executionID).
+		Msg("secret resolved")
+
+	if value == "" {
+		return
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// Secrets often end up in URLs, in which case they are escaped.
+	for _, v := range []string{value, url.QueryEscape(value), url.PathEscape(value)} {
+		if !slices.Contains(u.values, v) {
+			u.values = append(u.values, v)
+		}
+	}
+
+	// Replace longer values first, so that a secret containing another
+	// one is fully redacted.
+	slices.SortFunc(u.values, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+// Redact returns s with all the values recorded so far replaced by
+// RedactedValue.
+func (u *Usage) Redact(s string) string {
+	if u == nil {
+		return s
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	for _, v := range u.values {
+		s = strings.ReplaceAll(s, v, RedactedValue)
+	}
+
+	return s
+}
+
+// Empty returns true if no values that need redacting have been
+// recorded.
+func (u *Usage) Empty() bool {
+	if u == nil {
+		return true
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return len(u.values) == 0
+}
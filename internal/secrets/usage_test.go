@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	var audit bytes.Buffer
+
+	// The audit events are emitted regardless of the log level.
+	u := NewUsage(42, "execution-id", zerolog.New(&audit).Level(zerolog.ErrorLevel))
+	require.True(t, u.Empty())
+	require.Equal(t, "s3cr3t", u.Redact("s3cr3t"))
+
+	u.Record("short", "s3cr3t")
+	u.Record("long", "s3cr3t s3cr3t!")
+	u.Record("empty", "")
+	require.False(t, u.Empty())
+
+	require.Equal(t, "a=<redacted> b=<redacted> c=<redacted>", u.Redact("a=s3cr3t b=s3cr3t s3cr3t! c=s3cr3t+s3cr3t%21"))
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], `"secretName":"short"`)
+	require.Contains(t, lines[0], `"checkId":42`)
+	require.Contains(t, lines[0], `"executionId":"execution-id"`)
+	require.NotContains(t, audit.String(), "s3cr3t")
+
+	// A nil usage records nothing.
+	var nilUsage *Usage
+	nilUsage.Record("name", "value")
+	require.True(t, nilUsage.Empty())
+	require.Equal(t, "value", nilUsage.Redact("value"))
+
+	ctx := WithUsage(context.Background(), u)
+	require.Same(t, u, UsageFromContext(ctx))
+	require.Nil(t, UsageFromContext(context.Background()))
+}
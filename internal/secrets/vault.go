@@ -0,0 +1,312 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+)
+
+const (
+	defaultVaultMount        = "secret"
+	defaultVaultField        = "value"
+	defaultVaultAppRoleMount = "approle"
+)
+
+var (
+	ErrVaultAddressRequired = errors.New("vault address is required")
+	ErrVaultAuthRequired    = errors.New("vault token or AppRole credentials are required")
+)
+
+// VaultOpts configures the HashiCorp Vault secret backend.
+type VaultOpts struct {
+	// Address is the base URL of the Vault server.
+	Address string
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+	// Mount is the mount path of the KV version 2 secrets engine,
+	// "secret" if empty.
+	Mount string
+	// Path is prepended to secret names to obtain the path of the Vault
+	// secret holding them.
+	Path string
+	// Field is the key in the Vault secret data holding the value,
+	// "value" if empty.
+	Field string
+	// Token authenticates with Vault. It takes precedence over
+	// AppRole credentials.
+	Token string
+	// RoleID and SecretID authenticate with Vault using the AppRole
+	// method mounted at AppRoleMount ("approle" if empty).
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+	// TTL is how long values are cached. Values are not cached if it
+	// is not positive.
+	TTL time.Duration
+	// Client is the HTTP client used to talk to Vault,
+	// http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// vaultBackend resolves secrets from a KV version 2 secrets engine.
+type vaultBackend struct {
+	opts   VaultOpts
+	cache  *cache.Cache
+	logger zerolog.Logger
+
+	mutex       sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewVaultBackend creates a Backend that resolves the secret named name
+// from the field opts.Field of the KV version 2 secret at opts.Path/name.
+func NewVaultBackend(opts VaultOpts, logger zerolog.Logger) (Backend, error) {
+	if opts.Address == "" {
+		return nil, ErrVaultAddressRequired
+	}
+
+	if opts.Token == "" && (opts.RoleID == "" || opts.SecretID == "") {
+		return nil, ErrVaultAuthRequired
+	}
+
+	if opts.Mount == "" {
+		opts.Mount = defaultVaultMount
+	}
+
+	if opts.Field == "" {
+		opts.Field = defaultVaultField
+	}
+
+	if opts.AppRoleMount == "" {
+		opts.AppRoleMount = defaultVaultAppRoleMount
+	}
+
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	opts.Path = strings.Trim(opts.Path, "/")
+
+	b := &vaultBackend{
+		opts:   opts,
+		logger: logger.With().Str("component", "secret-vault").Logger(),
+		token:  opts.Token,
+	}
+
+	if opts.TTL > 0 {
+		b.cache = cache.New(opts.TTL, max(opts.TTL/10, time.Minute))
+	}
+
+	return b, nil
+}
+
+func (b *vaultBackend) Name() string {
+	return string(BackendVault)
+}
+
+func (b *vaultBackend) GetSecretValue(ctx context.Context, _ model.GlobalID, secretKey string) (string, error) {
+	if b.cache != nil {
+		if cachedValue, found := b.cache.Get(secretKey); found {
+			return cachedValue.(string), nil
+		}
+	}
+
+	secretPath := path.Join(b.opts.Path, secretKey)
+	if !fs.ValidPath(secretKey) || !fs.ValidPath(secretPath) {
+		return "", fmt.Errorf("%w: '%s' is not a valid Vault path", ErrSecretNotFound, secretKey)
+	}
+
+	data, err := b.readSecret(ctx, secretPath)
+	if err != nil {
+		return "", err
+	}
+
+	value, found := data[b.opts.Field]
+	if !found {
+		return "", fmt.Errorf("%w: Vault secret '%s' has no field '%s'", ErrSecretNotFound, secretPath, b.opts.Field)
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field '%s' of Vault secret '%s' is not a string", b.opts.Field, secretPath)
+	}
+
+	if b.cache != nil {
+		b.cache.Set(secretKey, str, cache.DefaultExpiration)
+	}
+
+	return str, nil
+}
+
+// readSecret returns the data of the latest version of the secret at
+// secretPath, logging in again once if the token has been rejected.
+func (b *vaultBackend) readSecret(ctx context.Context, secretPath string) (map[string]any, error) {
+	u, err := url.JoinPath(b.opts.Address, "v1", b.opts.Mount, "data", secretPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		token, err := b.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp struct {
+			Data struct {
+				Data map[string]any `json:"data"`
+			} `json:"data"`
+		}
+
+		status, err := b.do(ctx, http.MethodGet, u, token, nil, &resp)
+		switch {
+		case err != nil:
+			return nil, err
+
+		case status == http.StatusOK:
+			return resp.Data.Data, nil
+
+		case status == http.StatusNotFound:
+			return nil, fmt.Errorf("%w: no Vault secret at '%s'", ErrSecretNotFound, secretPath)
+
+		case status == http.StatusForbidden && attempt == 1 && b.usesAppRole():
+			b.logger.Debug().Msg("Vault token rejected, logging in again")
+			b.resetToken()
+
+		default:
+			return nil, fmt.Errorf("vault returned status %d for secret '%s'", status, secretPath)
+		}
+	}
+}
+
+func (b *vaultBackend) usesAppRole() bool {
+	return b.opts.Token == ""
+}
+
+func (b *vaultBackend) resetToken() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.token = ""
+}
+
+// getToken returns the configured token, or the one obtained by logging in
+// using AppRole, renewing it before it expires.
+func (b *vaultBackend) getToken(ctx context.Context) (string, error) {
+	if !b.usesAppRole() {
+		return b.opts.Token, nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.token != "" && (b.tokenExpiry.IsZero() || time.Now().Before(b.tokenExpiry)) {
+		return b.token, nil
+	}
+
+	u, err := url.JoinPath(b.opts.Address, "v1", "auth", b.opts.AppRoleMount, "login")
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"role_id":   b.opts.RoleID,
+		"secret_id": b.opts.SecretID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+
+	status, err := b.do(ctx, http.MethodPost, u, "", body, &resp)
+	if err != nil {
+		return "", fmt.Errorf("vault AppRole login: %w", err)
+	}
+
+	if status != http.StatusOK || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault AppRole login failed with status %d", status)
+	}
+
+	b.token = resp.Auth.ClientToken
+	b.tokenExpiry = time.Time{}
+
+	if lease := time.Duration(resp.Auth.LeaseDuration) * time.Second; lease > 0 {
+		// Renew the token a bit before it expires, so that it is not
+		// rejected in the middle of a lookup.
+		b.tokenExpiry = time.Now().Add(lease * 9 / 10)
+	}
+
+	b.logger.Debug().Time("expiry", b.tokenExpiry).Msg("logged in to Vault using AppRole")
+
+	return b.token, nil
+}
+
+// do sends a request to Vault and decodes successful JSON responses into
+// out, returning the response status code.
+func (b *vaultBackend) do(ctx context.Context, method, u, token string, body []byte, out any) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	if b.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.opts.Namespace)
+	}
+
+	resp, err := b.opts.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to contact Vault: %w", err)
+	}
+
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decoding Vault response: %w", err)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault implements the subset of the Vault API used by the backend:
+// AppRole login and KV version 2 reads.
+type fakeVault struct {
+	secrets map[string]map[string]any
+	logins  atomic.Int32
+	reads   atomic.Int32
+	// rejectTokens makes the server reject every token issued before
+	// the current login.
+	rejectTokens atomic.Bool
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login":
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["role_id"] != "role" || req["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		v.logins.Add(1)
+		v.rejectTokens.Store(false)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"auth": map[string]any{"client_token": "approle-token", "lease_duration": 3600},
+		})
+
+	case r.Method == http.MethodGet:
+		token := r.Header.Get("X-Vault-Token")
+		if (token != "root-token" && token != "approle-token") || v.rejectTokens.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		v.reads.Add(1)
+
+		data, found := v.secrets[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"data": data},
+		})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+
+	vault := &fakeVault{
+		secrets: map[string]map[string]any{
+			"/v1/kv/data/probes/api-token": {"value": "s3cr3t"},
+			"/v1/kv/data/probes/port":      {"value": 8080},
+			"/v1/kv/data/probes/other":     {"password": "hunter2"},
+		},
+	}
+
+	srv := httptest.NewServer(vault)
+	t.Cleanup(srv.Close)
+
+	return vault, srv
+}
+
+func TestVaultBackendToken(t *testing.T) {
+	vault, srv := newFakeVault(t)
+	ctx := context.Background()
+
+	b, err := NewVaultBackend(VaultOpts{
+		Address: srv.URL,
+		Mount:   "kv",
+		Path:    "/probes/",
+		Token:   "root-token",
+		TTL:     time.Minute,
+	}, zerolog.New(io.Discard))
+	require.NoError(t, err)
+
+	value, err := b.GetSecretValue(ctx, 1000, "api-token")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", value)
+
+	// The second lookup is served from the cache.
+	value, err = b.GetSecretValue(ctx, 1000, "api-token")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", value)
+	require.Equal(t, int32(1), vault.reads.Load())
+
+	_, err = b.GetSecretValue(ctx, 1000, "missing")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+
+	_, err = b.GetSecretValue(ctx, 1000, "other")
+	require.ErrorIs(t, err, ErrSecretNotFound, "missing field")
+
+	_, err = b.GetSecretValue(ctx, 1000, "../api-token")
+	require.ErrorIs(t, err, ErrSecretNotFound)
+
+	_, err = b.GetSecretValue(ctx, 1000, "port")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSecretNotFound)
+
+	require.Zero(t, vault.logins.Load())
+}
+
+func TestVaultBackendAppRole(t *testing.T) {
+	vault, srv := newFakeVault(t)
+	ctx := context.Background()
+
+	b, err := NewVaultBackend(VaultOpts{
+		Address:  srv.URL,
+		Mount:    "kv",
+		Path:     "probes",
+		Field:    "password",
+		RoleID:   "role",
+		SecretID: "secret",
+	}, zerolog.New(io.Discard))
+	require.NoError(t, err)
+
+	value, err := b.GetSecretValue(ctx, 1000, "other")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+	require.Equal(t, int32(1), vault.logins.Load())
+
+	// Without a TTL, values are not cached, but the token is reused.
+	_, err = b.GetSecretValue(ctx, 1000, "other")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), vault.reads.Load())
+	require.Equal(t, int32(1), vault.logins.Load())
+
+	// A rejected token causes a new login.
+	vault.rejectTokens.Store(true)
+
+	value, err = b.GetSecretValue(ctx, 1000, "other")
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", value)
+	require.Equal(t, int32(2), vault.logins.Load())
+}
+
+func TestNewVaultBackend(t *testing.T) {
+	_, err := NewVaultBackend(VaultOpts{Token: "token"}, zerolog.New(io.Discard))
+	require.ErrorIs(t, err, ErrVaultAddressRequired)
+
+	_, err = NewVaultBackend(VaultOpts{Address: "http://vault:8200", RoleID: "role"}, zerolog.New(io.Discard))
+	require.ErrorIs(t, err, ErrVaultAuthRequired)
+}
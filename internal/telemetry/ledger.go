@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Ledger appends a record of each telemetry push to a file, one JSON
+// object per line, so that the executions billed for private probes can be
+// reconciled with what the API reports.
+type Ledger struct {
+	file       *ledgerFile
+	connection string
+}
+
+type ledgerFile struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// LedgerEntry records a telemetry push for a region. Tenants holds what
+// changed since the previous push for the region, from SpanStart to
+// SpanEnd, leaving out the entries without executions. Pushed is false if
+// the API did not accept the telemetry, in which case Error describes why
+// and the next push for the region includes the same executions again.
+type LedgerEntry struct {
+	Connection string         `json:"connection,omitempty"`
+	Instance   string         `json:"instance"`
+	RegionID   int32          `json:"regionId"`
+	SpanStart  time.Time      `json:"spanStart"`
+	SpanEnd    time.Time      `json:"spanEnd"`
+	Pushed     bool           `json:"pushed"`
+	Error      string         `json:"error,omitempty"`
+	Tenants    []TenantReport `json:"tenants"`
+}
+
+// OpenLedger opens the ledger file at path, creating it if needed. Entries
+// are appended to the existing ones.
+func OpenLedger(path string) (*Ledger, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) //#nosec -- the path is provided by the operator.
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ledger{file: &ledgerFile{file: f}}, nil
+}
+
+// ForConnection returns a ledger that writes to the same file, labelling
+// its entries with the name of an API connection.
+func (l *Ledger) ForConnection(name string) *Ledger {
+	return &Ledger{file: l.file, connection: name}
+}
+
+// Record appends an entry to the ledger.
+func (l *Ledger) Record(entry LedgerEntry) error {
+	entry.Connection = l.connection
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	l.file.mutex.Lock()
+	defer l.file.mutex.Unlock()
+
+	if _, err := l.file.file.Write(data); err != nil {
+		return err
+	}
+
+	return l.file.file.Sync()
+}
+
+// Close closes the ledger file, for all the connections.
+func (l *Ledger) Close() error {
+	l.file.mutex.Lock()
+	defer l.file.mutex.Unlock()
+
+	return l.file.file.Close()
+}
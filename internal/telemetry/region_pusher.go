@@ -3,6 +3,7 @@ package telemetry
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"slices"
 	"strings"
 	"sync"
@@ -16,7 +17,19 @@ import (
 
 const CalNilStringTerminator = "__MISSING__"
 
+const (
+	defaultRetryMinBackoff = 10 * time.Second
+	defaultRetryMaxBackoff = 2 * time.Minute
+)
+
 // RegionPusher periodically sends telemetry data for a specific region.
+//
+// The telemetry pushed is cumulative since the pusher started, so a push
+// for a time span supersedes the ones for the previous spans, for every
+// tenant, check class and cost attribution labels. If a push fails, the
+// spans it covers stay buffered and the pusher retries with exponential
+// backoff until the next tick, which merges them with its own span. There
+// is never more than one push in flight.
 type RegionPusher struct {
 	client sm.TelemetryClient
 	logger zerolog.Logger
@@ -28,6 +41,15 @@ type RegionPusher struct {
 	telemetryMu sync.Mutex
 
 	metrics RegionMetrics
+
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+
+	// ledger, if not nil, records each push. The state below is only
+	// used by run.
+	ledger       *Ledger
+	spanStart    time.Time
+	ledgerTotals map[string]sm.CheckClassTelemetry
 }
 
 type RegionMetrics struct {
@@ -36,6 +58,12 @@ type RegionMetrics struct {
 	pushRequestsTotal    prom.Counter
 	pushRequestsError    prom.Counter
 
+	// bufferedSpans counts the time spans whose telemetry has not been
+	// accepted by the API yet, and droppedSpans the ones that never were
+	// because the pusher stopped.
+	bufferedSpans prom.Gauge
+	droppedSpans  prom.Counter
+
 	addExecutionDuration prom.Observer
 }
 
@@ -83,6 +111,11 @@ func NewRegionPusher(
 
 	opts.ApplyDefaults(timeSpan)
 
+	tp.retryMinBackoff = opts.retryMinBackoff
+	tp.retryMaxBackoff = opts.retryMaxBackoff
+	tp.ledger = opts.ledger
+	tp.spanStart = time.Now()
+
 	opts.wg.Add(1)
 
 	go func() {
@@ -95,8 +128,11 @@ func NewRegionPusher(
 }
 
 type regionPusherOptions struct {
-	ticker ticker
-	wg     *sync.WaitGroup
+	ticker          ticker
+	wg              *sync.WaitGroup
+	ledger          *Ledger
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
 }
 
 func (opts *regionPusherOptions) ApplyDefaults(timeSpan time.Duration) {
@@ -107,6 +143,14 @@ func (opts *regionPusherOptions) ApplyDefaults(timeSpan time.Duration) {
 	if opts.wg == nil {
 		opts.wg = new(sync.WaitGroup)
 	}
+
+	if opts.retryMinBackoff <= 0 {
+		opts.retryMinBackoff = defaultRetryMinBackoff
+	}
+
+	if opts.retryMaxBackoff < opts.retryMinBackoff {
+		opts.retryMaxBackoff = max(defaultRetryMaxBackoff, opts.retryMinBackoff)
+	}
 }
 
 type RegionPusherOption func(opts *regionPusherOptions)
@@ -123,15 +167,73 @@ func WithWaitGroup(wg *sync.WaitGroup) RegionPusherOption {
 	}
 }
 
+// WithLedger records each push in the ledger.
+func WithLedger(l *Ledger) RegionPusherOption {
+	return func(opts *regionPusherOptions) {
+		opts.ledger = l
+	}
+}
+
+// WithRetryBackoff sets the delay before retrying a failed push, which
+// doubles after each failure, up to maxDelay.
+func WithRetryBackoff(minDelay, maxDelay time.Duration) RegionPusherOption {
+	return func(opts *regionPusherOptions) {
+		opts.retryMinBackoff = minDelay
+		opts.retryMaxBackoff = maxDelay
+	}
+}
+
+// pushResult is the outcome of a push covering a number of time spans.
+type pushResult struct {
+	spans int
+	err   error
+}
+
 func (p *RegionPusher) run(ctx context.Context, ticker ticker, wg *sync.WaitGroup) {
 	p.logger.Info().Msg("region pusher starting")
 	defer p.logger.Debug().Msg("region pusher stopped")
 
-	// TODO: We could potentially create here a pushCtx, pass that to push, and
-	// from push keep retrying sending the data if it fails initially until the
-	// pushCtx is canceled, which should happen once the ticker ticks again, to
-	// avoid overlapping push requests.
-	// By now, only retry folllowing the ticker's pace.
+	var (
+		buffered int  // Time spans not accepted by the API yet.
+		pushing  bool // A push is in flight.
+		queued   bool // A tick happened while pushing.
+		backoff  time.Duration
+		results  = make(chan pushResult, 1)
+		retry    = time.NewTimer(0)
+	)
+
+	retry.Stop()
+	defer retry.Stop()
+
+	startPush := func() {
+		m := p.next()
+		entry := p.nextLedgerEntry(m)
+		spans := buffered
+
+		pushing = true
+
+		wg.Add(1)
+		// Avoid blocking
+		go func() {
+			defer wg.Done()
+
+			err := p.push(m)
+			p.record(entry, err)
+			results <- pushResult{spans: spans, err: err}
+		}()
+	}
+
+	handleResult := func(r pushResult) {
+		pushing = false
+
+		if r.err != nil {
+			return
+		}
+
+		buffered -= r.spans
+		backoff = 0
+		p.metrics.bufferedSpans.Set(float64(buffered))
+	}
 
 LOOP:
 	for {
@@ -139,28 +241,73 @@ LOOP:
 		case <-ticker.C():
 			p.logger.Info().Msg("pushing telemetry")
 
-			m := p.next()
+			buffered++
+			p.metrics.bufferedSpans.Set(float64(buffered))
+
+			// The new span supersedes any pending retry.
+			retry.Stop()
+
+			if pushing {
+				queued = true
+				continue
+			}
+
+			startPush()
 
-			wg.Add(1)
-			// Avoid blocking
-			go func() {
-				defer wg.Done()
+		case <-retry.C:
+			p.logger.Info().Int("spans", buffered).Msg("retrying telemetry push")
 
-				p.push(m)
-			}()
+			startPush()
+
+		case r := <-results:
+			handleResult(r)
+
+			switch {
+			case r.err != nil:
+				backoff = min(max(2*backoff, p.retryMinBackoff), p.retryMaxBackoff)
+				queued = false
+
+				retry.Reset(retryJitter(backoff))
+
+			case queued:
+				queued = false
+
+				startPush()
+			}
 
 		case <-ctx.Done():
 			p.logger.Debug().Msg("region pusher stopping")
 
-			m := p.next()
-			p.push(m)
 			ticker.Stop()
 
+			if pushing {
+				handleResult(<-results)
+			}
+
+			// Push whatever is left once, the agent is exiting.
+			buffered++
+
+			startPush()
+			handleResult(<-results)
+
+			if buffered > 0 {
+				p.logger.Error().Int("spans", buffered).Msg("dropping telemetry that could not be pushed")
+				p.metrics.droppedSpans.Add(float64(buffered))
+			}
+
+			p.metrics.bufferedSpans.Set(0)
+
 			break LOOP
 		}
 	}
 }
 
+// retryJitter shortens the backoff by up to a quarter, so that agents
+// don't retry in lockstep after the API recovers.
+func retryJitter(d time.Duration) time.Duration {
+	return d - time.Duration(rand.Int63n(int64(d/4)+1)) //#nosec -- no need for a cryptographically secure jitter.
+}
+
 // AddExecution adds a new execution to the tenant telemetry.
 func (p *RegionPusher) AddExecution(e Execution) {
 	start := time.Now()
@@ -274,7 +421,7 @@ func deserializeCals(calKey string) []sm.CostAttributionLabel {
 	return cals
 }
 
-func (p *RegionPusher) push(m sm.RegionTelemetry) {
+func (p *RegionPusher) push(m sm.RegionTelemetry) error {
 	var (
 		r   *sm.PushTelemetryResponse
 		err error
@@ -291,7 +438,7 @@ func (p *RegionPusher) push(m sm.RegionTelemetry) {
 	r, err = p.client.PushTelemetry(ctx, &m)
 	if err != nil {
 		p.logger.Err(err).Msg("error pushing telemetry")
-		return
+		return err
 	}
 
 	if r.Status.Code != sm.StatusCode_OK {
@@ -302,4 +449,52 @@ func (p *RegionPusher) push(m sm.RegionTelemetry) {
 			Str("statusMessage", r.Status.Message).
 			Msg("error pushing telemetry")
 	}
+
+	return err
+}
+
+// nextLedgerEntry returns the ledger entry for the telemetry about to be
+// pushed, covering the executions since the previous one, or nil if there
+// is no ledger.
+func (p *RegionPusher) nextLedgerEntry(m sm.RegionTelemetry) *LedgerEntry {
+	if p.ledger == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	entry := &LedgerEntry{
+		Instance:  m.Instance,
+		RegionID:  m.RegionId,
+		SpanStart: p.spanStart,
+		SpanEnd:   now,
+		Tenants:   newRegionReport(m, p.ledgerTotals).Tenants,
+	}
+
+	p.spanStart = now
+	p.ledgerTotals = make(map[string]sm.CheckClassTelemetry)
+
+	for _, tenantTele := range m.Telemetry {
+		for _, calTele := range tenantTele.Telemetry {
+			p.ledgerTotals[calReportKey(tenantTele.TenantId, calTele)] = *calTele
+		}
+	}
+
+	return entry
+}
+
+// record adds the entry to the ledger, with the result of pushing it.
+func (p *RegionPusher) record(entry *LedgerEntry, pushErr error) {
+	if entry == nil {
+		return
+	}
+
+	entry.Pushed = pushErr == nil
+	if pushErr != nil {
+		entry.Error = pushErr.Error()
+	}
+
+	if err := p.ledger.Record(*entry); err != nil {
+		p.logger.Err(err).Msg("error recording telemetry in the ledger")
+	}
 }
@@ -576,6 +576,107 @@ func TestTenantPusher(t *testing.T) {
 		})
 	})
 
+	t.Run("should retry with backoff until the next tick", func(t *testing.T) {
+		t.Parallel()
+
+		synctest.Test(t, func(t *testing.T) {
+			td, tc, pusher, _ := setupTest(t)
+
+			t.Cleanup(td.shutdownAndWait)
+
+			addExecutions(pusher, getTestDataset(0).executions)
+
+			tc.rr = testPushRespKO
+
+			td.tickAndWait()
+			tc.assert(t, getTestDataset(0).message)
+
+			// The first retry happens within 10s, and the second
+			// one 15 to 20s after that.
+			time.Sleep(10 * time.Second)
+			synctest.Wait()
+			tc.assert(t, getTestDataset(0).message)
+
+			time.Sleep(10 * time.Second)
+			synctest.Wait()
+			tc.assertEmpty(t)
+
+			time.Sleep(10 * time.Second)
+			synctest.Wait()
+			tc.assert(t, getTestDataset(0).message)
+
+			// The tick replaces the pending retry.
+			addExecutions(pusher, getTestDataset(1).executions)
+
+			tc.mu.Lock()
+			tc.rr = testPushRespOK
+			tc.mu.Unlock()
+
+			td.tickAndWait()
+			tc.assert(t, getTestDataset(1).message)
+
+			time.Sleep(time.Hour)
+			synctest.Wait()
+			tc.assertEmpty(t)
+		})
+	})
+
+	t.Run("should count buffered spans", func(t *testing.T) {
+		t.Parallel()
+
+		synctest.Test(t, func(t *testing.T) {
+			td, tc, pusher, metrics := setupTest(t)
+
+			t.Cleanup(td.shutdownAndWait)
+
+			addExecutions(pusher, getTestDataset(0).executions)
+
+			tc.rr = testPushRespKO
+
+			td.tickAndWait()
+			td.tickAndWait()
+
+			bufferedMetric := getMetricFromCollector(t, metrics.bufferedSpans)
+			require.Equal(t, 2, int(*bufferedMetric.Gauge.Value))
+
+			addExecutions(pusher, getTestDataset(1).executions)
+
+			tc.mu.Lock()
+			tc.rr = testPushRespOK
+			tc.mu.Unlock()
+
+			td.tickAndWait()
+
+			tc.assert(t, getTestDataset(0).message, getTestDataset(0).message, getTestDataset(1).message)
+
+			bufferedMetric = getMetricFromCollector(t, metrics.bufferedSpans)
+			require.Equal(t, 0, int(*bufferedMetric.Gauge.Value))
+		})
+	})
+
+	t.Run("should drop buffered spans on context done", func(t *testing.T) {
+		t.Parallel()
+
+		synctest.Test(t, func(t *testing.T) {
+			td, tc, pusher, metrics := setupTest(t)
+
+			addExecutions(pusher, getTestDataset(0).executions)
+
+			tc.rr = testPushRespKO
+
+			td.tickAndWait()
+			td.shutdownAndWait()
+
+			tc.assert(t, getTestDataset(0).message, getTestDataset(0).message)
+
+			droppedMetric := getMetricFromCollector(t, metrics.droppedSpans)
+			require.Equal(t, 2, int(*droppedMetric.Counter.Value))
+
+			bufferedMetric := getMetricFromCollector(t, metrics.bufferedSpans)
+			require.Equal(t, 0, int(*bufferedMetric.Gauge.Value))
+		})
+	})
+
 	t.Run("should push on context done", func(t *testing.T) {
 		t.Parallel()
 
@@ -696,6 +797,8 @@ func setupTest(t *testing.T) (*testDriver, *testTelemetryClient, *RegionPusher,
 		pushRequestsDuration: prom.NewHistogram(prom.HistogramOpts{}),
 		pushRequestsTotal:    prom.NewCounter(prom.CounterOpts{}),
 		pushRequestsError:    prom.NewCounter(prom.CounterOpts{}),
+		bufferedSpans:        prom.NewGauge(prom.GaugeOpts{}),
+		droppedSpans:         prom.NewCounter(prom.CounterOpts{}),
 		addExecutionDuration: prom.NewHistogram(prom.HistogramOpts{}),
 	}
 
@@ -757,6 +860,9 @@ func (tc *testTelemetryClient) PushTelemetry(
 func (tc *testTelemetryClient) assert(t *testing.T, exp ...sm.RegionTelemetry) {
 	t.Helper()
 
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
 	defer func() {
 		// Copy the remaining messages in the mm buffer to the front, and clip it to that size.
 		rest := copy(tc.mm, tc.mm[len(exp):])
@@ -769,6 +875,16 @@ func (tc *testTelemetryClient) assert(t *testing.T, exp ...sm.RegionTelemetry) {
 	}
 }
 
+// assertEmpty verifies that there are no more pushed messages to assert.
+func (tc *testTelemetryClient) assertEmpty(t *testing.T) {
+	t.Helper()
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	require.Empty(t, tc.mm)
+}
+
 func assertInfoData(t *testing.T, exp, got *sm.RegionTelemetry) {
 	t.Helper()
 	require.Equal(t, exp.Instance, got.Instance, "instances should match")
@@ -0,0 +1,146 @@
+package telemetry
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// Report describes the telemetry accumulated by the agent since it
+// started, the same data that is pushed to the API.
+type Report struct {
+	Instance string         `json:"instance"`
+	Regions  []RegionReport `json:"regions"`
+}
+
+// RegionReport is the telemetry for the tenants in a region.
+type RegionReport struct {
+	RegionID int32          `json:"regionId"`
+	Tenants  []TenantReport `json:"tenants"`
+}
+
+// TenantReport is the telemetry for a tenant, with one entry for each
+// combination of check class and cost attribution labels.
+type TenantReport struct {
+	TenantID  int64         `json:"tenantId"`
+	Telemetry []ClassReport `json:"telemetry"`
+}
+
+// ClassReport counts the executions for a check class and cost
+// attribution labels. Duration is in seconds, and SampledExecutions counts
+// each execution once per started minute, as billed.
+type ClassReport struct {
+	CheckClass            string            `json:"checkClass"`
+	CostAttributionLabels map[string]string `json:"costAttributionLabels"`
+	Executions            int32             `json:"executions"`
+	Duration              float64           `json:"duration"`
+	SampledExecutions     int32             `json:"sampledExecutions"`
+}
+
+// Report returns the telemetry accumulated for all the regions, sorted by
+// region, tenant, check class and cost attribution labels.
+func (t *Telemeter) Report() Report {
+	t.pushersMu.RLock()
+	defer t.pushersMu.RUnlock()
+
+	report := Report{
+		Instance: t.instance,
+		Regions:  make([]RegionReport, 0, len(t.pushers)),
+	}
+
+	for _, p := range t.pushers {
+		report.Regions = append(report.Regions, newRegionReport(p.next(), nil))
+	}
+
+	slices.SortFunc(report.Regions, func(a, b RegionReport) int {
+		return cmp.Compare(a.RegionID, b.RegionID)
+	})
+
+	return report
+}
+
+// newRegionReport converts the telemetry for a region. If previous is not
+// nil, the counters are reduced by the ones in previous, which is indexed
+// by calReportKey, and entries left without executions are skipped.
+func newRegionReport(m sm.RegionTelemetry, previous map[string]sm.CheckClassTelemetry) RegionReport {
+	report := RegionReport{
+		RegionID: m.RegionId,
+		Tenants:  make([]TenantReport, 0, len(m.Telemetry)),
+	}
+
+	for _, tenantTele := range m.Telemetry {
+		tenant := TenantReport{
+			TenantID:  tenantTele.TenantId,
+			Telemetry: make([]ClassReport, 0, len(tenantTele.Telemetry)),
+		}
+
+		for _, calTele := range tenantTele.Telemetry {
+			class := ClassReport{
+				CheckClass:            calTele.CheckClass.String(),
+				CostAttributionLabels: make(map[string]string, len(calTele.CostAttributionLabels)),
+				Executions:            calTele.Executions,
+				Duration:              float64(calTele.Duration),
+				SampledExecutions:     calTele.SampledExecutions,
+			}
+
+			for _, label := range calTele.CostAttributionLabels {
+				class.CostAttributionLabels[label.Name] = label.Value
+			}
+
+			if previous != nil {
+				prev := previous[calReportKey(tenantTele.TenantId, calTele)]
+
+				class.Executions -= prev.Executions
+				class.Duration -= float64(prev.Duration)
+				class.SampledExecutions -= prev.SampledExecutions
+
+				if class.Executions == 0 {
+					continue
+				}
+			}
+
+			tenant.Telemetry = append(tenant.Telemetry, class)
+		}
+
+		slices.SortFunc(tenant.Telemetry, func(a, b ClassReport) int {
+			return cmp.Or(
+				strings.Compare(a.CheckClass, b.CheckClass),
+				strings.Compare(serializeCALMap(a.CostAttributionLabels), serializeCALMap(b.CostAttributionLabels)),
+			)
+		})
+
+		if previous != nil && len(tenant.Telemetry) == 0 {
+			continue
+		}
+
+		report.Tenants = append(report.Tenants, tenant)
+	}
+
+	slices.SortFunc(report.Tenants, func(a, b TenantReport) int {
+		return cmp.Compare(a.TenantID, b.TenantID)
+	})
+
+	return report
+}
+
+// calReportKey identifies the telemetry for a tenant, check class and cost
+// attribution labels.
+func calReportKey(tenantID int64, calTele *sm.CheckClassTelemetry) string {
+	return strings.Join([]string{
+		strconv.FormatInt(tenantID, 10),
+		calTele.CheckClass.String(),
+		serializeCALs(calTele.CostAttributionLabels),
+	}, "/")
+}
+
+func serializeCALMap(labels map[string]string) string {
+	cals := make([]sm.CostAttributionLabel, 0, len(labels))
+	for name, value := range labels {
+		cals = append(cals, sm.CostAttributionLabel{Name: name, Value: value})
+	}
+
+	return serializeCALs(cals)
+}
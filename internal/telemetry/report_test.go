@@ -0,0 +1,223 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/testhelper"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemeterReport(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		defer func() {
+			cancel()
+			synctest.Wait()
+		}()
+
+		tc := &testTelemetryClient{
+			rr: testPushResp{tr: &sm.PushTelemetryResponse{Status: &sm.Status{Code: sm.StatusCode_OK}}},
+		}
+
+		tele := NewTelemeter(ctx, instance, time.Hour, tc, testhelper.Logger(t), prom.NewPedanticRegistry())
+
+		require.Equal(t, Report{Instance: instance, Regions: []RegionReport{}}, tele.Report())
+
+		executions := []Execution{
+			{LocalTenantID: 2, RegionID: 2, CheckClass: sm.CheckClass_PROTOCOL, Duration: 30 * time.Second},
+			{LocalTenantID: 2, RegionID: 1, CheckClass: sm.CheckClass_SCRIPTED, Duration: 90 * time.Second},
+			{LocalTenantID: 1, RegionID: 1, CheckClass: sm.CheckClass_SCRIPTED, Duration: 30 * time.Second},
+			{LocalTenantID: 1, RegionID: 1, CheckClass: sm.CheckClass_PROTOCOL, Duration: 10 * time.Second},
+			{LocalTenantID: 1, RegionID: 1, CheckClass: sm.CheckClass_PROTOCOL, Duration: 20 * time.Second},
+			{
+				LocalTenantID:         1,
+				RegionID:              1,
+				CheckClass:            sm.CheckClass_PROTOCOL,
+				Duration:              61 * time.Second,
+				CostAttributionLabels: []sm.CostAttributionLabel{{Name: "team", Value: "a"}},
+			},
+		}
+
+		for _, e := range executions {
+			tele.AddExecution(e)
+		}
+
+		require.Equal(t, Report{
+			Instance: instance,
+			Regions: []RegionReport{
+				{
+					RegionID: 1,
+					Tenants: []TenantReport{
+						{
+							TenantID: 1,
+							Telemetry: []ClassReport{
+								{CheckClass: "PROTOCOL", CostAttributionLabels: map[string]string{}, Executions: 2, Duration: 30, SampledExecutions: 2},
+								{CheckClass: "PROTOCOL", CostAttributionLabels: map[string]string{"team": "a"}, Executions: 1, Duration: 61, SampledExecutions: 2},
+								{CheckClass: "SCRIPTED", CostAttributionLabels: map[string]string{}, Executions: 1, Duration: 30, SampledExecutions: 1},
+							},
+						},
+						{
+							TenantID: 2,
+							Telemetry: []ClassReport{
+								{CheckClass: "SCRIPTED", CostAttributionLabels: map[string]string{}, Executions: 1, Duration: 90, SampledExecutions: 2},
+							},
+						},
+					},
+				},
+				{
+					RegionID: 2,
+					Tenants: []TenantReport{
+						{
+							TenantID: 2,
+							Telemetry: []ClassReport{
+								{CheckClass: "PROTOCOL", CostAttributionLabels: map[string]string{}, Executions: 1, Duration: 30, SampledExecutions: 1},
+							},
+						},
+					},
+				},
+			},
+		}, tele.Report())
+	})
+}
+
+func TestLedger(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "ledger.jsonl")
+
+	ledger, err := OpenLedger(fn)
+	require.NoError(t, err)
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ticker := &testTicker{c: make(chan time.Time)}
+		td := testDriver{cancel: cancel, ticker: ticker}
+		tc := &testTelemetryClient{
+			rr: testPushResp{tr: &sm.PushTelemetryResponse{Status: &sm.Status{Code: sm.StatusCode_OK}}},
+		}
+
+		start := time.Now().UTC()
+
+		pusher := NewRegionPusher(
+			ctx, time.Minute, tc, testhelper.Logger(t), instance, regionID,
+			RegionMetrics{
+				pushRequestsActive:   prom.NewGauge(prom.GaugeOpts{}),
+				pushRequestsDuration: prom.NewHistogram(prom.HistogramOpts{}),
+				pushRequestsTotal:    prom.NewCounter(prom.CounterOpts{}),
+				pushRequestsError:    prom.NewCounter(prom.CounterOpts{}),
+				bufferedSpans:        prom.NewGauge(prom.GaugeOpts{}),
+				droppedSpans:         prom.NewCounter(prom.CounterOpts{}),
+				addExecutionDuration: prom.NewHistogram(prom.HistogramOpts{}),
+			},
+			WithTicker(ticker),
+			WithWaitGroup(new(sync.WaitGroup)),
+			WithLedger(ledger.ForConnection("stack")),
+		)
+
+		pusher.AddExecution(Execution{LocalTenantID: 1, CheckClass: sm.CheckClass_PROTOCOL, Duration: 30 * time.Second})
+		pusher.AddExecution(Execution{LocalTenantID: 1, CheckClass: sm.CheckClass_PROTOCOL, Duration: 90 * time.Second})
+
+		time.Sleep(time.Minute)
+		td.tickAndWait()
+
+		// The second push only accounts for the new executions, and
+		// fails.
+		pusher.AddExecution(Execution{LocalTenantID: 2, CheckClass: sm.CheckClass_BROWSER, Duration: 10 * time.Second})
+
+		tc.mu.Lock()
+		tc.rr = testPushResp{tr: &sm.PushTelemetryResponse{Status: &sm.Status{Code: sm.StatusCode_INTERNAL_ERROR}}}
+		tc.mu.Unlock()
+
+		time.Sleep(time.Minute)
+		td.tickAndWait()
+
+		// Nothing new for the last push, when stopping.
+		td.shutdownAndWait()
+
+		entries := readLedger(t, fn)
+		require.Equal(t, []LedgerEntry{
+			{
+				Connection: "stack",
+				Instance:   instance,
+				RegionID:   regionID,
+				SpanStart:  start,
+				SpanEnd:    start.Add(time.Minute),
+				Pushed:     true,
+				Tenants: []TenantReport{
+					{
+						TenantID: 1,
+						Telemetry: []ClassReport{
+							{CheckClass: "PROTOCOL", CostAttributionLabels: map[string]string{}, Executions: 2, Duration: 120, SampledExecutions: 3},
+						},
+					},
+				},
+			},
+			{
+				Connection: "stack",
+				Instance:   instance,
+				RegionID:   regionID,
+				SpanStart:  start.Add(time.Minute),
+				SpanEnd:    start.Add(2 * time.Minute),
+				Pushed:     false,
+				Error:      "unexpected status code",
+				Tenants: []TenantReport{
+					{
+						TenantID: 2,
+						Telemetry: []ClassReport{
+							{CheckClass: "BROWSER", CostAttributionLabels: map[string]string{}, Executions: 1, Duration: 10, SampledExecutions: 1},
+						},
+					},
+				},
+			},
+			{
+				Connection: "stack",
+				Instance:   instance,
+				RegionID:   regionID,
+				SpanStart:  start.Add(2 * time.Minute),
+				SpanEnd:    start.Add(2 * time.Minute),
+				Pushed:     false,
+				Error:      "unexpected status code",
+				Tenants:    []TenantReport{},
+			},
+		}, entries)
+	})
+
+	require.NoError(t, ledger.Close())
+}
+
+func readLedger(t *testing.T, fn string) []LedgerEntry {
+	t.Helper()
+
+	f, err := os.Open(fn)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var entries []LedgerEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry LedgerEntry
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+
+		// Drop the monotonic clock readings for comparing.
+		entry.SpanStart = entry.SpanStart.Round(0)
+		entry.SpanEnd = entry.SpanEnd.Round(0)
+
+		entries = append(entries, entry)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return entries
+}
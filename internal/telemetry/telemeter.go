@@ -31,6 +31,7 @@ type Telemeter struct {
 
 	pushers   map[int32]*RegionPusher // Indexed by region ID
 	pushersMu sync.RWMutex
+	options   []RegionPusherOption
 
 	metrics metrics
 }
@@ -40,6 +41,8 @@ type metrics struct {
 	pushRequestsDuration *prom.HistogramVec
 	pushRequestsTotal    *prom.CounterVec
 	pushRequestsError    *prom.CounterVec
+	bufferedSpans        *prom.GaugeVec
+	droppedSpans         *prom.CounterVec
 
 	addExecutionDuration *prom.HistogramVec
 }
@@ -53,10 +56,11 @@ type Execution struct {
 	CostAttributionLabels []sm.CostAttributionLabel
 }
 
-// NewTelemeter creates a new Telemeter component.
+// NewTelemeter creates a new Telemeter component. The options are applied to
+// the pusher of each region.
 func NewTelemeter(
 	ctx context.Context, instance string, pushTimeSpan time.Duration, client sm.TelemetryClient,
-	logger zerolog.Logger, registerer prom.Registerer,
+	logger zerolog.Logger, registerer prom.Registerer, options ...RegionPusherOption,
 ) *Telemeter {
 	t := &Telemeter{
 		ctx:          ctx,
@@ -65,6 +69,7 @@ func NewTelemeter(
 		instance:     instance,
 		pushTimeSpan: pushTimeSpan,
 		pushers:      make(map[int32]*RegionPusher),
+		options:      options,
 	}
 
 	t.registerMetrics(registerer)
@@ -112,11 +117,14 @@ func (t *Telemeter) AddExecution(e Execution) {
 		t.metrics.pushRequestsDuration.With(labels),
 		t.metrics.pushRequestsTotal.With(labels),
 		t.metrics.pushRequestsError.With(labels),
+		t.metrics.bufferedSpans.With(labels),
+		t.metrics.droppedSpans.With(labels),
 		t.metrics.addExecutionDuration.With(labels),
 	}
 	p := NewRegionPusher(
 		t.ctx, t.pushTimeSpan, t.client,
 		l, t.instance, e.RegionID, m,
+		t.options...,
 	)
 	p.AddExecution(e)
 
@@ -153,6 +161,20 @@ func (t *Telemeter) registerMetrics(registerer prom.Registerer) {
 		Help:        "Total count of errored push telemetry requests",
 		ConstLabels: prom.Labels{agentInstanceLabelName: t.instance},
 	}, []string{regionIDLabelName})
+	t.metrics.bufferedSpans = prom.NewGaugeVec(prom.GaugeOpts{
+		Namespace:   metricNamespace,
+		Subsystem:   metricSubsystem,
+		Name:        "push_buffered_spans",
+		Help:        "Time spans whose telemetry has not been accepted by the API yet",
+		ConstLabels: prom.Labels{agentInstanceLabelName: t.instance},
+	}, []string{regionIDLabelName})
+	t.metrics.droppedSpans = prom.NewCounterVec(prom.CounterOpts{
+		Namespace:   metricNamespace,
+		Subsystem:   metricSubsystem,
+		Name:        "push_dropped_spans_total",
+		Help:        "Total count of time spans whose telemetry was never accepted by the API",
+		ConstLabels: prom.Labels{agentInstanceLabelName: t.instance},
+	}, []string{regionIDLabelName})
 
 	t.metrics.addExecutionDuration = prom.NewHistogramVec(prom.HistogramOpts{
 		Namespace:                       metricNamespace,
@@ -170,5 +192,7 @@ func (t *Telemeter) registerMetrics(registerer prom.Registerer) {
 	registerer.MustRegister(t.metrics.pushRequestsDuration)
 	registerer.MustRegister(t.metrics.pushRequestsTotal)
 	registerer.MustRegister(t.metrics.pushRequestsError)
+	registerer.MustRegister(t.metrics.bufferedSpans)
+	registerer.MustRegister(t.metrics.droppedSpans)
 	registerer.MustRegister(t.metrics.addExecutionDuration)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
 	"github.com/grafana/synthetic-monitoring-agent/internal/pusher"
 	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog"
 )
@@ -27,12 +28,46 @@ func isSecretStoreConfigured(secretStore *sm.SecretStore) bool {
 }
 
 type Manager struct {
-	tenantCh      <-chan sm.Tenant
-	tenantsClient sm.TenantsClient
-	timeout       time.Duration
-	cache         cache.Cache
-	fetchMutexes  *xsync.Map[int64, *sync.Mutex] // for fetch deduplication.
-	logger        zerolog.Logger
+	tenantCh        <-chan sm.Tenant
+	tenantsClient   sm.TenantsClient
+	timeout         time.Duration
+	refreshAhead    time.Duration
+	refreshInterval time.Duration
+	staleGrace      time.Duration
+	cache           cache.Cache
+	fetchMutexes    *xsync.Map[int64, *sync.Mutex] // for fetch deduplication.
+	restored        *xsync.Map[int64, sm.Tenant]
+	tracker         *tracker
+	metrics         managerMetrics
+	logger          zerolog.Logger
+}
+
+// ManagerOpts configures a tenant manager.
+type ManagerOpts struct {
+	// TenantsClient retrieves tenants from the API.
+	TenantsClient sm.TenantsClient
+	// TenantCh receives tenants pushed by the API.
+	TenantCh <-chan sm.Tenant
+	// Timeout is the maximum time tenants are kept before being
+	// retrieved again.
+	Timeout time.Duration
+	// RefreshAhead is how long before they expire tenants are
+	// retrieved again in the background. Zero disables background
+	// refreshes, so tenants are retrieved when requested after they
+	// expire.
+	RefreshAhead time.Duration
+	// RefreshInterval is how often expiring tenants are looked for,
+	// DefaultRefreshInterval if zero.
+	RefreshInterval time.Duration
+	// StaleGracePeriod is how long past their expiration tenants are
+	// returned if the API cannot be reached, DefaultStaleGracePeriod
+	// if zero.
+	StaleGracePeriod time.Duration
+	Cache            cache.Cache
+	// Registerer is used to register the manager's metrics, if not
+	// nil.
+	Registerer prometheus.Registerer
+	Logger     zerolog.Logger
 }
 
 var _ pusher.TenantProvider = &Manager{}
@@ -64,17 +99,51 @@ func (tm *Manager) getFetchMutex(tenantID int64) *sync.Mutex {
 // A new goroutine is started which stops when the provided context is
 // cancelled.
 func NewManager(ctx context.Context, tenantsClient sm.TenantsClient, tenantCh <-chan sm.Tenant, timeout time.Duration, cache cache.Cache, logger zerolog.Logger) *Manager {
+	return NewManagerWithOpts(ctx, ManagerOpts{
+		TenantsClient: tenantsClient,
+		TenantCh:      tenantCh,
+		Timeout:       timeout,
+		Cache:         cache,
+		Logger:        logger,
+	})
+}
+
+// NewManagerWithOpts creates a new tenant manager like NewManager, which
+// can also refresh tenants in the background before they expire.
+//
+// The goroutines started stop when the provided context is cancelled.
+func NewManagerWithOpts(ctx context.Context, opts ManagerOpts) *Manager {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+
+	if opts.StaleGracePeriod <= 0 {
+		opts.StaleGracePeriod = DefaultStaleGracePeriod
+	}
+
+	t := newTracker()
+
 	tm := &Manager{
-		tenantCh:      tenantCh,
-		tenantsClient: tenantsClient,
-		timeout:       timeout,
-		cache:         cache,
-		logger:        logger,
-		fetchMutexes:  xsync.NewMap[int64, *sync.Mutex](),
+		tenantCh:        opts.TenantCh,
+		tenantsClient:   opts.TenantsClient,
+		timeout:         opts.Timeout,
+		refreshAhead:    opts.RefreshAhead,
+		refreshInterval: opts.RefreshInterval,
+		staleGrace:      opts.StaleGracePeriod,
+		cache:           opts.Cache,
+		logger:          opts.Logger,
+		fetchMutexes:    xsync.NewMap[int64, *sync.Mutex](),
+		restored:        xsync.NewMap[int64, sm.Tenant](),
+		tracker:         t,
+		metrics:         newManagerMetrics(opts.Registerer, t),
 	}
 
 	go tm.run(ctx)
 
+	if tm.refreshAhead > 0 {
+		go tm.refresher(ctx)
+	}
+
 	return tm
 }
 
@@ -240,6 +309,9 @@ func (tm *Manager) updateTenant(tenant sm.Tenant) {
 		return
 	}
 
+	tm.tracker.stored(tenant.Id, validUntil, tm.refreshAhead, time.Now())
+	tm.restored.Delete(tenant.Id)
+
 	tm.logger.Debug().
 		Int64("tenantId", tenant.Id).
 		Time("validUntil", validUntil).
@@ -249,7 +321,7 @@ func (tm *Manager) updateTenant(tenant sm.Tenant) {
 // GetTenant retrieves the tenant specified by `req`, either from the cache
 // or by making a request to the API. Notice that this method will favour
 // returning expired tenant data from the cache if new data can not be retrieved
-// from the API.
+// from the API, as long as it expired less than the stale grace period ago.
 func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenant, error) {
 	key := cacheKey(req.Id)
 	now := time.Now()
@@ -267,6 +339,8 @@ func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenan
 			Dur("validFor", cached.ValidUntil.Sub(now)).
 			Msg("returning tenant from cache")
 
+		tm.tracker.used(req.Id, cached.ValidUntil, tm.refreshAhead, now)
+
 		return cached.Tenant, nil
 	}
 
@@ -283,6 +357,8 @@ func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenan
 			Int64("tenantId", req.Id).
 			Msg("tenant was fetched by another goroutine")
 
+		tm.tracker.used(req.Id, cached.ValidUntil, tm.refreshAhead, now)
+
 		return cached.Tenant, nil
 	}
 
@@ -296,13 +372,16 @@ func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenan
 	// "silly" on it.
 	if fetchErr != nil {
 		// If we have stale cached data, return it as fallback
-		if err == nil && cached.Tenant != nil {
+		if err == nil && cached.Tenant != nil && now.Sub(cached.ValidUntil) <= tm.staleGrace {
 			tm.logger.Warn().
 				Err(fetchErr).
 				Int64("tenantId", req.Id).
 				Time("cachedValidUntil", cached.ValidUntil).
 				Msg("API fetch failed, returning stale cached data")
 
+			tm.metrics.staleServed.Inc()
+			tm.tracker.used(req.Id, cached.ValidUntil, tm.refreshAhead, now)
+
 			return cached.Tenant, nil
 		}
 
@@ -315,14 +394,67 @@ func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenan
 		return nil, fetchErr
 	}
 
+	validUntil := tm.storeTenant(ctx, req.Id, tenant)
+	tm.tracker.used(req.Id, validUntil, tm.refreshAhead, now)
+
+	return tenant, nil
+}
+
+// RestoreTenants provides the manager with tenants saved without their
+// credentials, e.g. in the updater's state file. They are not returned by
+// GetTenant, as they can't be used to publish, but by the provider
+// returned by Settings, until the full tenant is obtained from the cache
+// or the API.
+func (tm *Manager) RestoreTenants(tenants []sm.Tenant) {
+	for _, tenant := range tenants {
+		tm.restored.Store(tenant.Id, tenant)
+	}
+}
+
+// Settings returns a provider for the settings of tenants, like their
+// limits, for the components that don't need their credentials. It
+// returns the same tenants as GetTenant, or a restored tenant if GetTenant
+// fails, so that those components keep working after a restart while the
+// API can't be reached.
+func (tm *Manager) Settings() pusher.TenantProvider {
+	return settingsProvider{tm: tm}
+}
+
+type settingsProvider struct {
+	tm *Manager
+}
+
+func (p settingsProvider) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenant, error) {
+	tenant, err := p.tm.GetTenant(ctx, req)
+	if err == nil {
+		return tenant, nil
+	}
+
+	restored, found := p.tm.restored.Load(req.Id)
+	if !found {
+		return nil, err
+	}
+
+	p.tm.logger.Debug().
+		Err(err).
+		Int64("tenantId", req.Id).
+		Msg("returning restored tenant settings")
+
+	return &restored, nil
+}
+
+// storeTenant stores a tenant retrieved from the API in the cache, and
+// returns the time until which it's valid. It must be called with the
+// tenant's fetch mutex held.
+func (tm *Manager) storeTenant(ctx context.Context, tenantID int64, tenant *sm.Tenant) time.Time {
 	// Validate secret store configuration
 	if tenant.SecretStore == nil {
 		tm.logger.Warn().
-			Int64("tenantId", req.Id).
+			Int64("tenantId", tenantID).
 			Msg("tenant retrieved from API without secret store details")
 	} else if !isSecretStoreConfigured(tenant.SecretStore) {
 		tm.logger.Warn().
-			Int64("tenantId", req.Id).
+			Int64("tenantId", tenantID).
 			Msg("tenant retrieved from API with incomplete secret store configuration")
 	}
 
@@ -338,18 +470,21 @@ func (tm *Manager) GetTenant(ctx context.Context, req *sm.TenantInfo) (*sm.Tenan
 
 	// Store in cache without TTL - we'll check ValidUntil manually
 	// This allows us to return stale data if the API is unavailable
-	if err := tm.cache.Set(ctx, key, newCached, 0); err != nil {
+	if err := tm.cache.Set(ctx, cacheKey(tenantID), newCached, 0); err != nil {
 		tm.logger.Error().
 			Err(err).
-			Int64("tenantId", req.Id).
+			Int64("tenantId", tenantID).
 			Msg("failed to store tenant in cache")
 		// Don't fail the request if cache storage fails
 	}
 
+	tm.tracker.stored(tenantID, validUntil, tm.refreshAhead, time.Now())
+	tm.restored.Delete(tenantID)
+
 	tm.logger.Debug().
-		Int64("tenantId", req.Id).
+		Int64("tenantId", tenantID).
 		Time("validUntil", validUntil).
 		Msg("tenant retrieved from API")
 
-	return tenant, nil
+	return validUntil
 }
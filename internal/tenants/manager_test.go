@@ -350,3 +350,56 @@ func TestCalculateValidUntil(t *testing.T) {
 		})
 	}
 }
+
+func TestTenantManagerRestoreTenants(t *testing.T) {
+	tc := testTenantsClient{
+		tenants:      map[int64]sm.Tenant{},
+		requestCount: make(map[int64]int),
+		err:          errors.New("API unavailable"),
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+
+	localCache, err := cache.NewLocal(cache.LocalConfig{
+		MaxCapacity:     100,
+		InitialCapacity: 10,
+		Logger:          logger,
+	})
+	require.NoError(t, err)
+
+	defer localCache.Close()
+
+	tm := NewManager(ctx, &tc, make(chan sm.Tenant), time.Minute, localCache, logger)
+
+	restored := makeTenant(1)
+	restored.MetricsRemote.Password = ""
+	restored.Limits = &sm.TenantLimits{MaxMetricLabels: 10}
+
+	tm.RestoreTenants([]sm.Tenant{restored})
+
+	// Restored tenants lack credentials, so they are only used for
+	// their settings while the API can't be reached.
+	_, err = tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.ErrorIs(t, err, tc.err)
+
+	tenant, err := tm.Settings().GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, restored, *tenant)
+
+	_, err = tm.Settings().GetTenant(ctx, &sm.TenantInfo{Id: 2})
+	require.ErrorIs(t, err, tc.err)
+
+	// Once the full tenant is available, it replaces the restored one.
+	tc.err = nil
+	tc.tenants[1] = makeTenant(1)
+
+	tenant, err = tm.Settings().GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, tc.tenants[1], *tenant)
+
+	_, found := tm.restored.Load(1)
+	require.False(t, found)
+}
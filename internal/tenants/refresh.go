@@ -0,0 +1,262 @@
+package tenants
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/model"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+const (
+	// DefaultRefreshInterval is how often the refresher looks for
+	// tenants that are about to expire.
+	DefaultRefreshInterval = 10 * time.Second
+	// DefaultStaleGracePeriod is how long past their expiration cached
+	// tenants are served when the API cannot be reached.
+	DefaultStaleGracePeriod = time.Hour
+
+	refreshJitter  = 0.25 // 25% jitter
+	refreshTimeout = 10 * time.Second
+
+	metricNamespace = "sm_agent"
+	metricSubsystem = "tenants"
+)
+
+// tenantState tracks the freshness of a tenant known to this agent. The
+// cache might be shared with other agents, so this is kept separately.
+type tenantState struct {
+	validUntil  time.Time
+	refreshAt   time.Time
+	lastRefresh time.Time
+	lastUsed    time.Time
+}
+
+// tracker holds the state of the tenants used by this agent.
+type tracker struct {
+	mutex   sync.Mutex
+	tenants map[int64]*tenantState
+}
+
+func newTracker() *tracker {
+	return &tracker{tenants: make(map[int64]*tenantState)}
+}
+
+// stored records that a new copy of the tenant valid until validUntil has
+// been stored in the cache, scheduling a refresh refreshAhead before that.
+func (t *tracker) stored(tenantID int64, validUntil time.Time, refreshAhead time.Duration, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.get(tenantID, now)
+	state.validUntil = validUntil
+	state.lastRefresh = now
+	state.refreshAt = refreshTime(validUntil, refreshAhead, now)
+}
+
+// used records that the tenant, valid until validUntil, has been requested.
+func (t *tracker) used(tenantID int64, validUntil time.Time, refreshAhead time.Duration, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	state := t.get(tenantID, now)
+	state.lastUsed = now
+
+	// Another agent sharing the cache might have refreshed the tenant.
+	if !validUntil.Equal(state.validUntil) {
+		state.validUntil = validUntil
+		state.refreshAt = refreshTime(validUntil, refreshAhead, now)
+	}
+}
+
+// failed postpones the refresh of the tenant until retryAt.
+func (t *tracker) failed(tenantID int64, retryAt time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if state, found := t.tenants[tenantID]; found {
+		state.refreshAt = retryAt
+	}
+}
+
+// due returns the tenants that need to be refreshed, forgetting those that
+// haven't been used since idleSince.
+func (t *tracker) due(now, idleSince time.Time) []int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var ids []int64
+
+	for id, state := range t.tenants {
+		switch {
+		case state.lastUsed.Before(idleSince):
+			delete(t.tenants, id)
+
+		case !state.refreshAt.After(now):
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func (t *tracker) get(tenantID int64, now time.Time) *tenantState {
+	state, found := t.tenants[tenantID]
+	if !found {
+		state = &tenantState{lastUsed: now}
+		t.tenants[tenantID] = state
+	}
+
+	return state
+}
+
+// refreshTime returns when a tenant valid until validUntil should be
+// refreshed: refreshAhead before it expires, minus a random jitter so
+// that agents don't hit the API at the same time. Tenants that are valid
+// for less than twice refreshAhead, like the ones holding short-lived
+// secret store tokens, are refreshed halfway through their validity.
+func refreshTime(validUntil time.Time, refreshAhead time.Duration, now time.Time) time.Time {
+	ahead := min(refreshAhead, validUntil.Sub(now)/2)
+	if ahead <= 0 {
+		return validUntil
+	}
+
+	jitter := time.Duration(rand.Float64() * refreshJitter * float64(ahead))
+
+	return validUntil.Add(-ahead - jitter)
+}
+
+// refresher periodically renews the tenants that are about to expire, so
+// that check executions don't have to wait for the API.
+func (tm *Manager) refresher(ctx context.Context) {
+	ticker := time.NewTicker(tm.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			now := time.Now()
+
+			// Tenants that haven't been used for as long as
+			// they are cached are not worth refreshing.
+			for _, id := range tm.tracker.due(now, now.Add(-tm.timeout)) {
+				tm.refreshTenant(ctx, id)
+			}
+		}
+	}
+}
+
+func (tm *Manager) refreshTenant(ctx context.Context, tenantID int64) {
+	mutex := tm.getFetchMutex(tenantID)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	tenant, err := tm.tenantsClient.GetTenant(ctx, &sm.TenantInfo{Id: tenantID})
+	if err != nil {
+		tm.metrics.refreshes.WithLabelValues("error").Inc()
+		tm.tracker.failed(tenantID, time.Now().Add(tm.refreshInterval))
+
+		tm.logger.Warn().
+			Err(err).
+			Int64("tenantId", tenantID).
+			Msg("failed to refresh tenant ahead of expiration")
+
+		return
+	}
+
+	tm.metrics.refreshes.WithLabelValues("success").Inc()
+
+	tm.storeTenant(ctx, tenantID, tenant)
+
+	tm.logger.Debug().
+		Int64("tenantId", tenantID).
+		Msg("tenant refreshed ahead of expiration")
+}
+
+// managerMetrics are the metrics exposed by the tenant manager.
+type managerMetrics struct {
+	refreshes   *prometheus.CounterVec
+	staleServed prometheus.Counter
+}
+
+func newManagerMetrics(registerer prometheus.Registerer, t *tracker) managerMetrics {
+	m := managerMetrics{
+		refreshes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricNamespace,
+				Subsystem: metricSubsystem,
+				Name:      "refreshes_total",
+				Help:      "Total number of background tenant refreshes by result.",
+			},
+			[]string{"result"},
+		),
+		staleServed: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: metricNamespace,
+				Subsystem: metricSubsystem,
+				Name:      "stale_served_total",
+				Help:      "Total number of times expired tenant information was returned because the API could not be reached.",
+			},
+		),
+	}
+
+	if registerer != nil {
+		registerer.MustRegister(m.refreshes, m.staleServed, &freshnessCollector{tracker: t})
+	}
+
+	return m
+}
+
+var (
+	tenantExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, metricSubsystem, "expiry_seconds"),
+		"Time until the cached tenant information expires, negative if it has already expired.",
+		[]string{"regionID", "tenantID"},
+		nil,
+	)
+	tenantLastRefreshDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricNamespace, metricSubsystem, "last_refresh_timestamp_seconds"),
+		"Time at which the tenant information was last retrieved by this agent.",
+		[]string{"regionID", "tenantID"},
+		nil,
+	)
+)
+
+// freshnessCollector reports the freshness of each tracked tenant.
+type freshnessCollector struct {
+	tracker *tracker
+}
+
+func (c *freshnessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tenantExpiryDesc
+	ch <- tenantLastRefreshDesc
+}
+
+func (c *freshnessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.tracker.mutex.Lock()
+	defer c.tracker.mutex.Unlock()
+
+	now := time.Now()
+
+	for id, state := range c.tracker.tenants {
+		localID, regionID := model.GetLocalAndRegionIDs(model.GlobalID(id))
+		labels := []string{strconv.Itoa(regionID), strconv.FormatInt(localID, 10)}
+
+		ch <- prometheus.MustNewConstMetric(tenantExpiryDesc, prometheus.GaugeValue, state.validUntil.Sub(now).Seconds(), labels...)
+
+		if !state.lastRefresh.IsZero() {
+			ch <- prometheus.MustNewConstMetric(tenantLastRefreshDesc, prometheus.GaugeValue, float64(state.lastRefresh.UnixMilli())/1e3, labels...)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/synthetic-monitoring-agent/internal/cache"
+	sm "github.com/grafana/synthetic-monitoring-agent/pkg/pb/synthetic_monitoring"
+)
+
+// syncTenantsClient is a tenants client that can be used concurrently
+// with the background refresher.
+type syncTenantsClient struct {
+	mutex    sync.Mutex
+	tenant   sm.Tenant
+	requests int
+	err      error
+}
+
+func (c *syncTenantsClient) GetTenant(ctx context.Context, in *sm.TenantInfo, opts ...grpc.CallOption) (*sm.Tenant, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.requests++
+
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	tenant := c.tenant
+
+	return &tenant, nil
+}
+
+func (c *syncTenantsClient) setError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.err = err
+}
+
+func (c *syncTenantsClient) requestCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.requests
+}
+
+func newTestCache(t *testing.T) cache.Cache {
+	t.Helper()
+
+	localCache, err := cache.NewLocal(cache.LocalConfig{
+		MaxCapacity:     100,
+		InitialCapacity: 10,
+		Logger:          zerolog.New(zerolog.NewTestWriter(t)),
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = localCache.Close() })
+
+	return localCache
+}
+
+func TestRefreshTime(t *testing.T) {
+	now := time.Now()
+
+	// Plenty of validity left: refresh ahead, with jitter.
+	validUntil := now.Add(time.Hour)
+	refreshAt := refreshTime(validUntil, time.Minute, now)
+	require.False(t, refreshAt.After(validUntil.Add(-time.Minute)))
+	require.False(t, refreshAt.Before(validUntil.Add(-time.Minute-time.Duration(refreshJitter*float64(time.Minute)))))
+
+	// Short validity: refresh around halfway through it.
+	validUntil = now.Add(time.Minute)
+	refreshAt = refreshTime(validUntil, time.Hour, now)
+	require.False(t, refreshAt.After(now.Add(30*time.Second)))
+	require.True(t, refreshAt.After(now))
+
+	// Already expired.
+	require.Equal(t, now, refreshTime(now, time.Minute, now))
+}
+
+func TestTenantManagerRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &syncTenantsClient{tenant: makeTenant(1)}
+	registry := prometheus.NewRegistry()
+	timeout := 200 * time.Millisecond
+
+	tm := NewManagerWithOpts(ctx, ManagerOpts{
+		TenantsClient:   client,
+		TenantCh:        make(chan sm.Tenant),
+		Timeout:         timeout,
+		RefreshAhead:    timeout,
+		RefreshInterval: 5 * time.Millisecond,
+		Cache:           newTestCache(t),
+		Registerer:      registry,
+		Logger:          zerolog.New(zerolog.NewTestWriter(t)),
+	})
+
+	_, err := tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, client.requestCount())
+
+	// Keep using the tenant for several validity periods. The
+	// refresher must renew it before it expires every time.
+	for deadline := time.Now().Add(3 * timeout); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var cached cachedTenant
+		require.NoError(t, tm.cache.Get(ctx, cacheKey(1), &cached))
+		require.True(t, cached.ValidUntil.After(time.Now()), "tenant expired before being refreshed")
+
+		_, err := tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+		require.NoError(t, err)
+	}
+
+	require.Greater(t, client.requestCount(), 2)
+
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+
+	found := make(map[string]bool)
+
+	for _, mf := range mfs {
+		found[mf.GetName()] = true
+
+		if mf.GetName() == "sm_agent_tenants_expiry_seconds" {
+			require.Len(t, mf.GetMetric(), 1)
+			require.Positive(t, mf.GetMetric()[0].GetGauge().GetValue())
+		}
+	}
+
+	require.True(t, found["sm_agent_tenants_expiry_seconds"])
+	require.True(t, found["sm_agent_tenants_last_refresh_timestamp_seconds"])
+	require.True(t, found["sm_agent_tenants_refreshes_total"])
+}
+
+func TestTenantManagerStaleGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &syncTenantsClient{tenant: makeTenant(1)}
+	timeout := 20 * time.Millisecond
+	maxTimeout := timeout + time.Duration(defaultCacheJitter*float64(timeout))
+
+	tm := NewManagerWithOpts(ctx, ManagerOpts{
+		TenantsClient:    client,
+		TenantCh:         make(chan sm.Tenant),
+		Timeout:          timeout,
+		StaleGracePeriod: 200 * time.Millisecond,
+		Cache:            newTestCache(t),
+		Logger:           zerolog.New(zerolog.NewTestWriter(t)),
+	})
+
+	_, err := tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.NoError(t, err)
+
+	client.setError(errors.New("network error"))
+
+	// Within the grace period, the expired tenant is returned.
+	time.Sleep(maxTimeout)
+
+	tenant, err := tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), tenant.Id)
+
+	// Past the grace period, the error is returned.
+	time.Sleep(250 * time.Millisecond)
+
+	_, err = tm.GetTenant(ctx, &sm.TenantInfo{Id: 1})
+	require.Error(t, err)
+	require.Equal(t, 3, client.requestCount())
+}